@@ -1111,6 +1111,7 @@ type File struct {
 	Imports      []*ImportSpec   // imports in this file
 	Unresolved   []*Ident        // unresolved identifiers in this file
 	Comments     []*CommentGroup // list of all comments in the source file
+	Directives   []*Comment      // list of //gop:xxx directives at the start of lines, eg. //gop:generate (ParseComments mode only)
 	Code         []byte
 	NoEntrypoint bool // no entrypoint func to indicate the module entry point.
 	NoPkgDecl    bool // no `package xxx` declaration
@@ -506,9 +506,15 @@ func MergePackageFiles(pkg *Package, mode MergeMode) *File {
 		}
 	}
 
+	// Collect directives from all package files.
+	var directives []*Comment
+	for _, filename := range filenames {
+		directives = append(directives, pkg.Files[filename].Directives...)
+	}
+
 	// TODO(gri) need to compute unresolved identifiers!
 	return &File{
 		doc, pos, NewIdent(pkg.Name), decls, pkg.Scope,
-		imports, nil, comments, nil, false, false, FileTypeGop,
+		imports, nil, comments, directives, nil, false, false, FileTypeGop,
 	}
 }
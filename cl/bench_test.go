@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl_test
+
+import (
+	"testing"
+
+	"github.com/goplus/gop/cl"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/token"
+	"github.com/goplus/gox"
+)
+
+// benchCompile benchmarks compiling the Go+ package in _testdata/bench/name.
+// Only cl.NewPackage is timed: the source files are parsed again for each
+// run with the timer stopped, and the imported packages are loaded by a
+// warm-up run which isn't timed.
+func benchCompile(b *testing.B, name string) {
+	gox.SetDebug(0)
+	cl.SetDebug(0)
+	defer func() {
+		gox.SetDebug(gox.DbgFlagAll)
+		cl.SetDebug(cl.DbgFlagAll)
+	}()
+
+	dir := "./_testdata/bench/" + name
+	conf := *baseConf
+	conf.PkgsLoader = nil
+	conf.Ensure()
+	compile := func() {
+		b.StopTimer()
+		conf.Fset = token.NewFileSet()
+		pkgs, err := parser.ParseDir(conf.Fset, dir, nil, 0)
+		if err != nil {
+			b.Fatal("ParseDir:", err)
+		}
+		b.StartTimer()
+		if _, err = cl.NewPackage("", pkgs["main"], &conf); err != nil {
+			b.Fatal("NewPackage:", err)
+		}
+	}
+	compile()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compile()
+	}
+}
+
+func BenchmarkCompileSmall(b *testing.B) {
+	benchCompile(b, "small")
+}
+
+func BenchmarkCompileMedium(b *testing.B) {
+	benchCompile(b, "medium")
+}
+
+func BenchmarkCompileLarge(b *testing.B) {
+	benchCompile(b, "large")
+}
+
+func BenchmarkCompileSpx(b *testing.B) {
+	benchCompile(b, "spx")
+}
@@ -19,6 +19,7 @@ package cl
 import (
 	"go/token"
 	"go/types"
+	"path/filepath"
 
 	"github.com/goplus/gox"
 )
@@ -50,12 +51,32 @@ func initBuiltin(pkg gox.PkgImporter, builtin *types.Package, fmt, big *gox.PkgR
 	scope.Insert(gox.NewOverloadFunc(token.NoPos, builtin, "newRange", big.Ref("NewRange__0")))
 }
 
+const (
+	fmtPkgPath     = "fmt"
+	builtinPkgPath = "github.com/goplus/gop/builtin"
+)
+
+// builtinImports are the packages imported implicitly by every Go+ file, for
+// Go+ builtins (eg. println, bigint) and the code generated for Go+ syntax.
+var builtinImports = []string{fmtPkgPath, builtinPkgPath, "strconv", "strings"}
+
+// BuiltinImports returns the paths of the packages which the compiler imports
+// implicitly for the Go+ source file filename, ie. the packages of Go+
+// builtins, and the classfile packages if it's a class file of the registered
+// types (see ClassFileInfo). Their names are in scope without import specs,
+// and the Go code generated imports the ones used only.
+func BuiltinImports(filename string) []string {
+	ret := append([]string(nil), builtinImports...)
+	return append(ret, classPkgPaths(filepath.Ext(filename))...)
+}
+
 func newBuiltinDefault(pkg gox.PkgImporter, conf *gox.Config) *types.Package {
 	builtin := types.NewPackage("", "")
-	fmt := pkg.Import("fmt")
-	big := pkg.Import("github.com/goplus/gop/builtin")
-	pkg.Import("strconv")
-	pkg.Import("strings")
+	imps := make(map[string]*gox.PkgRef, len(builtinImports))
+	for _, pkgPath := range builtinImports {
+		imps[pkgPath] = pkg.Import(pkgPath)
+	}
+	fmt, big := imps[fmtPkgPath], imps[builtinPkgPath]
 	initMathBig(pkg, conf, big)
 	initBuiltin(pkg, builtin, fmt, big)
 	gox.InitBuiltin(pkg, builtin, conf)
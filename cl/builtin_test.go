@@ -114,8 +114,57 @@ func TestRegisterClassFileType(t *testing.T) {
 	RegisterClassFileType(".t3gmx", ".t3spx")
 }
 
+func TestRegisterClassFile(t *testing.T) {
+	defer func() {
+		if e := recover(); e == nil {
+			t.Fatal("TestRegisterClassFile: no error?")
+		}
+	}()
+	RegisterClassFile(".t3form", "github.com/goplus/gop/cl/internal/spx", "", "")
+}
+
 func init() {
 	RegisterClassFileType(".t2gmx", ".t2spx", "github.com/goplus/gop/cl/internal/spx2")
 }
 
+func TestSortImports(t *testing.T) {
+	src := `package main
+
+import (
+	// doc of strings
+	strings "strings"
+	spx "github.com/goplus/gop/cl/internal/spx" // spx
+
+	// doc of fmt
+	fmt "fmt"
+	// end
+)
+
+func main() {
+}
+`
+	const expected = `package main
+
+import (
+	// doc of fmt
+	fmt "fmt"
+	// doc of strings
+	strings "strings"
+
+	spx "github.com/goplus/gop/cl/internal/spx" // spx
+	// end
+)
+
+func main() {
+}
+`
+	if ret := string(sortImports([]byte(src))); ret != expected {
+		t.Fatalf("sortImports:\n%s\nExpected:\n%s\n", ret, expected)
+	}
+	src = "package main\n\nimport fmt \"fmt\"\n"
+	if ret := string(sortImports([]byte(src))); ret != src {
+		t.Fatal("sortImports of a single import:", ret)
+	}
+}
+
 // -----------------------------------------------------------------------------
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl
+
+import (
+	"go/types"
+	"sort"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// CallGraph is the static call graph of a Go+ package. Functions are named by
+// their full names (see types.Func.FullName), eg. main.foo, (*main.T).Bar, and
+// fmt.Println. A method of a class file is a method of the class.
+type CallGraph struct {
+	// Edges maps a function declared in the package to the functions it
+	// calls statically, sorted and deduplicated. Calls in function literals
+	// are calls of the function declaring them.
+	Edges map[string][]string
+
+	// Dynamic maps a function declared in the package to the calls in it
+	// which can't be resolved statically, in order of positions.
+	Dynamic map[string][]DynamicCall
+}
+
+// DynamicCall is a call which can't be resolved statically, eg. a call of an
+// interface method or a function value.
+type DynamicCall struct {
+	Pos    token.Pos // position of the call
+	Callee string    // the interface method (eg. (io.Reader).Read), or the function value (eg. f) called
+}
+
+// NewCallGraph returns the call graph of pkg, made from the type information
+// info (its Defs and Uses are required) recorded when compiling pkg by
+// NewPackage. Calls of builtin functions (eg. len) and type conversions are
+// not calls of functions, so they aren't in the call graph.
+func NewCallGraph(pkg *ast.Package, info *Info) *CallGraph {
+	g := &CallGraph{
+		Edges:   make(map[string][]string),
+		Dynamic: make(map[string][]DynamicCall),
+	}
+	for _, f := range pkg.Files {
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			caller, ok := info.Defs[fn.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			g.addCalls(caller.FullName(), fn.Body, info)
+		}
+	}
+	for caller, callees := range g.Edges {
+		sort.Strings(callees)
+		ret := callees[:0]
+		for i, callee := range callees {
+			if i == 0 || callee != callees[i-1] {
+				ret = append(ret, callee)
+			}
+		}
+		g.Edges[caller] = ret
+	}
+	for _, calls := range g.Dynamic {
+		sort.Slice(calls, func(i, j int) bool {
+			return calls[i].Pos < calls[j].Pos
+		})
+	}
+	return g
+}
+
+func (g *CallGraph) addCalls(caller string, body *ast.BlockStmt, info *Info) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		var id *ast.Ident
+		switch fn := unparen(call.Fun).(type) {
+		case *ast.Ident:
+			id = fn
+		case *ast.SelectorExpr:
+			id = fn.Sel
+		case *ast.FuncLit: // its calls are added as calls of caller
+			return true
+		}
+		var obj types.Object
+		if id != nil {
+			obj = info.Uses[id]
+		}
+		switch o := obj.(type) {
+		case *types.Func:
+			if isInterfaceMethod(o) {
+				g.Dynamic[caller] = append(g.Dynamic[caller], DynamicCall{Pos: call.Pos(), Callee: o.FullName()})
+			} else {
+				g.Edges[caller] = append(g.Edges[caller], o.FullName())
+			}
+		case *types.Builtin, *types.TypeName:
+		case *types.Var:
+			g.Dynamic[caller] = append(g.Dynamic[caller], DynamicCall{Pos: call.Pos(), Callee: o.Name()})
+		default:
+			if t := info.TypeOf(call.Fun); t == nil || isFuncValue(t) {
+				g.Dynamic[caller] = append(g.Dynamic[caller], DynamicCall{Pos: call.Pos()})
+			}
+		}
+		return true
+	})
+}
+
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
+
+func isInterfaceMethod(fn *types.Func) bool {
+	sig := fn.Type().(*types.Signature)
+	if recv := sig.Recv(); recv != nil {
+		return types.IsInterface(recv.Type())
+	}
+	return false
+}
+
+func isFuncValue(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Signature)
+	return ok
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goplus/gop/cl"
+	"github.com/goplus/gop/parser"
+)
+
+func newCallGraph(t *testing.T, fs parser.FileSystem) *cl.CallGraph {
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.Info = newInfo()
+	if _, err = cl.NewPackage("example.com/foo", pkgs["main"], &conf); err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	return cl.NewCallGraph(pkgs["main"], conf.Info)
+}
+
+func TestCallGraph(t *testing.T) {
+	fs := newMultiFileFS("/foo", "bar.gop", `import (
+	"io"
+	"strings"
+)
+
+type T struct{}
+
+func (t *T) Get() int {
+	return 1
+}
+
+func read(r io.Reader, f func() int) int {
+	b := make([]byte, 1)
+	n, _ := r.Read(b)
+	return n + f() + len(b)
+}
+
+func main() {
+	t := &T{}
+	n := read(strings.NewReader("Hi"), t.Get)
+	println int64(n), strings.ToUpper("a")
+	func() {
+		t.Get()
+	}()
+}
+`)
+	g := newCallGraph(t, fs)
+	edges := map[string]string{
+		"example.com/foo.main": "(*example.com/foo.T).Get example.com/foo.read strings.NewReader strings.ToUpper",
+		"example.com/foo.read": "",
+	}
+	for caller, callees := range edges {
+		if v := strings.Join(g.Edges[caller], " "); v != callees {
+			t.Fatalf("Edges[%s]: %s", caller, v)
+		}
+	}
+	calls := g.Dynamic["example.com/foo.read"]
+	if len(calls) != 2 || calls[0].Callee != "(io.Reader).Read" || calls[1].Callee != "f" {
+		t.Fatal("Dynamic:", calls)
+	}
+	if pos := gblFset.Position(calls[1].Pos); pos.Line != 15 || pos.Column != 13 {
+		t.Fatal("Dynamic: position of f() -", pos)
+	}
+	if len(g.Dynamic) != 1 {
+		t.Fatal("Dynamic:", g.Dynamic)
+	}
+}
+
+func TestCallGraphClassFile(t *testing.T) {
+	fs := newMultiFileFS("/foo", "Game.tgmx", `
+func onInit() {
+	reset()
+}
+
+func reset() {
+}
+`, "Kai.tspx", `
+func onMsg(msg string) {
+	say msg
+	greet()
+}
+
+func greet() {
+}
+`)
+	g := newCallGraph(t, fs)
+	if v := strings.Join(g.Edges["(*example.com/foo.Game).onInit"], " "); v != "(*example.com/foo.Game).reset" {
+		t.Fatal("Edges of Game.onInit:", g.Edges)
+	}
+	callees := strings.Join(g.Edges["(*example.com/foo.Kai).onMsg"], " ")
+	if callees != "(*example.com/foo.Kai).greet (*github.com/goplus/gop/cl/internal/spx.Sprite).Say" {
+		t.Fatal("Edges of Kai.onMsg:", g.Edges)
+	}
+}
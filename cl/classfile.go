@@ -34,11 +34,13 @@ import (
 type gmxInfo struct {
 	extSpx   string
 	pkgPaths []string
+	works    []WorkClass
+	this     string // receiver name of the project and extSpx files, "this" if empty
 }
 
 var (
 	gmxTypes = map[string]gmxInfo{
-		".gmx": {".spx", []string{"github.com/goplus/spx", "math"}},
+		".gmx": {extSpx: ".spx", pkgPaths: []string{"github.com/goplus/spx", "math"}},
 	}
 )
 
@@ -52,17 +54,166 @@ func RegisterClassFileType(extGmx, extSpx string, pkgPaths ...string) {
 		parser.RegisterFileType(extSpx, ast.FileTypeSpx)
 	}
 	if _, ok := gmxTypes[extGmx]; !ok {
-		gmxTypes[extGmx] = gmxInfo{extSpx, pkgPaths}
+		gmxTypes[extGmx] = gmxInfo{extSpx: extSpx, pkgPaths: pkgPaths}
 	}
 }
 
+// WorkClass describes a kind of work class files of a classfile project.
+type WorkClass struct {
+	Ext  string // extension of the work class files, eg. ".worker"
+	Base string // name of the base type, which is looked up in the classfile packages
+	This string // receiver name, "this" if empty
+}
+
+// RegisterWorkClasses registers more kinds of work class files for the
+// classfile project type extGmx, which is registered by RegisterClassFileType.
+func RegisterWorkClasses(extGmx string, works ...WorkClass) {
+	gt, ok := gmxTypes[extGmx]
+	if !ok {
+		panic("RegisterWorkClasses: classfile project type not found - " + extGmx)
+	}
+	for _, work := range works {
+		if work.Ext == "" || work.Ext == gt.extSpx || work.Base == "" {
+			panic("RegisterWorkClasses: invalid work class - " + work.Ext)
+		}
+		if work.This != "" && !isValidThis(work.This) {
+			panic("RegisterWorkClasses: invalid receiver name - " + work.This)
+		}
+		parser.RegisterFileType(work.Ext, ast.FileTypeSpx)
+	}
+	gt.works = append(gt.works, works...)
+	gmxTypes[extGmx] = gt
+}
+
+type classFileInfo struct {
+	pkgPath string
+	base    string
+	this    string
+}
+
+var (
+	classFiles = map[string]classFileInfo{} // ext => standalone class file type
+)
+
+// RegisterClassThis sets the receiver name of the project file (eg. main.gmx)
+// and the class files of extSpx (eg. .spx) of the classfile project type
+// extGmx, which is registered by RegisterClassFileType. It's "this" by default.
+// The receiver names of the work classes are set by RegisterWorkClasses.
+func RegisterClassThis(extGmx, this string) {
+	gt, ok := gmxTypes[extGmx]
+	if !ok {
+		panic("RegisterClassThis: classfile project type not found - " + extGmx)
+	}
+	if !isValidThis(this) {
+		panic("RegisterClassThis: invalid receiver name - " + this)
+	}
+	gt.this = this
+	gmxTypes[extGmx] = gt
+}
+
+// isValidThis reports whether this can be a receiver name of class files.
+func isValidThis(this string) bool {
+	return token.IsIdentifier(this) && this != "_"
+}
+
+func (p *gmxInfo) getThis() string {
+	if p.this == "" {
+		return "this"
+	}
+	return p.this
+}
+
+// RegisterClassFile registers a kind of standalone class files, which don't
+// belong to a classfile project: a class file named Foo.ext (eg. Foo.form)
+// defines the class Foo, which embeds the base type of package pkgPath, and
+// this is the receiver name ("this" if empty). Unlike class files of a
+// classfile project, there isn't a project file (like .gmx) to run them.
+func RegisterClassFile(ext, pkgPath, base, this string) {
+	if ext == "" || pkgPath == "" || base == "" {
+		panic("RegisterClassFile: invalid class file type - " + ext)
+	}
+	if this == "" {
+		this = "this"
+	} else if !isValidThis(this) {
+		panic("RegisterClassFile: invalid receiver name - " + this)
+	}
+	parser.RegisterFileType(ext, ast.FileTypeSpx)
+	classFiles[ext] = classFileInfo{pkgPath: pkgPath, base: base, this: this}
+}
+
+// ClassFileInfo classifies the file filename by its extension. ok reports
+// whether it's a Go+ source file (a .go/.gop file, or a class file of the
+// registered types). If it's a class file, isClass is true, gamePkg is the
+// package path of its classfile framework (eg. "github.com/goplus/spx"), class
+// is the name of the class it defines, and this is the receiver name of its
+// methods. ClassFileInfo doesn't read the file.
+func ClassFileInfo(filename string) (isClass bool, gamePkg, class, this string, ok bool) {
+	ext := filepath.Ext(filename)
+	switch ext {
+	case ".go", ".gop":
+		return false, "", "", "", true
+	}
+	if cf, found := classFiles[ext]; found {
+		return true, cf.pkgPath, getDefaultClass(filename), cf.this, true
+	}
+	if gt, found := gmxTypes[ext]; found { // project file, eg. main.gmx
+		if class = getDefaultClass(filename); class == "main" {
+			class = "_main"
+		}
+		return true, gt.pkgPaths[0], class, gt.getThis(), true
+	}
+	for _, gt := range gmxTypes {
+		if ext == gt.extSpx {
+			return true, gt.pkgPaths[0], getDefaultClass(filename), gt.getThis(), true
+		}
+		for _, work := range gt.works {
+			if ext == work.Ext {
+				if this = work.This; this == "" {
+					this = "this"
+				}
+				return true, gt.pkgPaths[0], getDefaultClass(filename), this, true
+			}
+		}
+	}
+	return
+}
+
+// classPkgPaths returns the classfile packages in which identifiers of a class
+// file with extension ext are looked up (see preloadFile), or nil if ext isn't a
+// class file type registered.
+func classPkgPaths(ext string) []string {
+	if cf, found := classFiles[ext]; found {
+		return []string{cf.pkgPath}
+	}
+	if gt, found := gmxTypes[ext]; found {
+		return gt.pkgPaths
+	}
+	for _, gt := range gmxTypes {
+		if ext == gt.extSpx {
+			return gt.pkgPaths
+		}
+		for _, work := range gt.works {
+			if ext == work.Ext {
+				return gt.pkgPaths
+			}
+		}
+	}
+	return nil
+}
+
 // -----------------------------------------------------------------------------
 
+type workClass struct {
+	base gox.Ref
+	this string
+}
+
 type gmxSettings struct {
 	gameClass  string
+	gameThis   string // receiver name of the project file
 	extSpx     string
 	game       gox.Ref
-	sprite     gox.Ref
+	works      map[string]*workClass // ext => work class
 	scheds     []string
 	schedStmts []goast.Stmt // nil or len(scheds) == 2 (delayload)
 	pkgImps    []*gox.PkgRef
@@ -99,15 +250,24 @@ func newGmx(pkg *gox.Package, file string) *gmxSettings {
 	}
 	gt := gmxTypes[ext]
 	pkgPaths := gt.pkgPaths
-	p := &gmxSettings{extSpx: gt.extSpx, gameClass: name, pkgPaths: pkgPaths}
+	p := &gmxSettings{extSpx: gt.extSpx, gameClass: name, gameThis: gt.getThis(), pkgPaths: pkgPaths}
 	p.pkgImps = make([]*gox.PkgRef, len(pkgPaths))
 	for i, pkgPath := range pkgPaths {
 		p.pkgImps[i] = pkg.Import(pkgPath)
 	}
 	spx := p.pkgImps[0]
 	p.game, p.gameIsPtr = spxRef(spx, "Gop_game", "Game")
+	p.works = make(map[string]*workClass, len(gt.works)+1)
 	if gt.extSpx != "" {
-		p.sprite, _ = spxRef(spx, "Gop_sprite", "Sprite")
+		sprite, _ := spxRef(spx, "Gop_sprite", "Sprite")
+		p.works[gt.extSpx] = &workClass{base: sprite, this: p.gameThis}
+	}
+	for _, work := range gt.works {
+		this := work.This
+		if this == "" {
+			this = "this"
+		}
+		p.works[work.Ext] = &workClass{base: spxLookup(p.pkgImps, work.Base), this: this}
 	}
 	if x := getStringConst(spx, "Gop_sched"); x != "" {
 		p.scheds, p.hasScheds = strings.SplitN(x, ",", 2), true
@@ -171,8 +331,42 @@ func getFields(ctx *blockCtx, f *ast.File) (specs []ast.Spec) {
 	return
 }
 
+// checkClassThis reports the identifiers declared in the class file f which
+// conflict with its receiver name this: fields (specs) and methods of the
+// class, and parameters and results of the methods. Referring to them by name
+// is ambiguous, as they shadow the receiver or are shadowed by it.
+func checkClassThis(ctx *blockCtx, f *ast.File, specs []ast.Spec, this string) {
+	check := func(name *ast.Ident, kind string) {
+		if name.Name == this {
+			pos := ctx.Position(name.Pos())
+			ctx.handleCodeErrorf(&pos, "%s %s conflicts with the receiver name of class file", kind, this)
+		}
+	}
+	checkFields := func(list *ast.FieldList, kind string) {
+		if list != nil {
+			for _, fld := range list.List {
+				for _, name := range fld.Names {
+					check(name, kind)
+				}
+			}
+		}
+	}
+	for _, v := range specs {
+		for _, name := range v.(*ast.ValueSpec).Names {
+			check(name, "field")
+		}
+	}
+	for _, decl := range f.Decls {
+		if d, ok := decl.(*ast.FuncDecl); ok && d.Recv == nil {
+			check(d.Name, "method")
+			checkFields(d.Type.Params, "parameter")
+			checkFields(d.Type.Results, "result")
+		}
+	}
+}
+
 func setBodyHandler(ctx *blockCtx) {
-	if ctx.fileType > 0 { // in a Go+ class file
+	if ctx.fileType > 0 && !ctx.standalone { // in a Go+ class file of a classfile project
 		if scheds := ctx.getScheds(ctx.cb); scheds != nil {
 			ctx.cb.SetBodyHandler(func(body *goast.BlockStmt, kind int) {
 				idx := 0
@@ -185,10 +379,14 @@ func setBodyHandler(ctx *blockCtx) {
 	}
 }
 
-func gmxMainFunc(p *gox.Package, ctx *pkgCtx) {
+func gmxMainFunc(p *gox.Package, ctx *pkgCtx, doc *goast.CommentGroup) {
 	if o := p.Types.Scope().Lookup(ctx.gameClass); o != nil && hasMethod(o, "MainEntry") {
 		// new(Game).Main()
-		p.NewFunc(nil, "main", nil, nil, false).BodyStart(p).
+		fn := p.NewFunc(nil, "main", nil, nil, false)
+		if doc != nil {
+			fn.SetComments(doc)
+		}
+		fn.BodyStart(p).
 			Val(p.Builtin().Ref("new")).Val(o).Call(1).
 			MemberVal("Main").Call(0).EndStmt().
 			End()
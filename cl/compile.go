@@ -21,12 +21,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	goast "go/ast"
 	"go/types"
 	"log"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/goplus/gop/ast"
 	"github.com/goplus/gop/token"
@@ -117,9 +122,15 @@ type Config struct {
 	BuildFlags []string
 
 	// Fset provides source position information for syntax trees and types.
-	// If Fset is nil, Load will use a new fileset, but preserve Fset's value.
+	// It should be the fileset the package is parsed with. If Fset is nil, it
+	// is set to a new fileset by Ensure.
 	Fset *token.FileSet
 
+	// Importer imports packages before PkgsLoader if it isn't nil, eg. to serve
+	// pre-built dependencies from memory. The packages it fails to import are
+	// loaded by PkgsLoader.
+	Importer types.Importer
+
 	// GenGoPkg is called to convert a Go+ package into Go.
 	GenGoPkg func(pkgDir string, base *Config) error
 
@@ -132,16 +143,92 @@ type Config struct {
 	// PersistLoadPkgs = true means to cache all loaded packages to disk.
 	PersistLoadPkgs bool
 
-	// NoFileLine = true means not to generate file line comments.
+	// NoFileLine = true means not to generate file line comments. They are
+	// `//line` directives locating statements and function declarations of
+	// the generated code to the Go+ source, including functions synthesized
+	// for class files.
 	NoFileLine bool
 
 	// RelativePath = true means to generate file line comments with relative file path.
 	RelativePath bool
+
+	// GoVersion is the minimum Go version (eg. "go1.16") that the generated code
+	// should be compiled with. It is an error to use a source feature that
+	// requires a newer Go. If GoVersion is empty, there is no constraint.
+	GoVersion string
+
+	// UnusedImport and UnusedVar specify how an unused import and an unused
+	// local variable are reported. By default (StrictError), they are errors
+	// as in Go. With StrictWarning, the generated code is still valid: unused
+	// imports are removed, and unused variables are assigned to _.
+	UnusedImport, UnusedVar Strictness
+
+	// WarningsAsErrors = true means to report all warnings as errors, so that
+	// NewPackage fails with them, eg. to gate strict CI builds. It takes
+	// precedence over UnusedImport and UnusedVar, and the severity of findings
+	// of Rules: StrictWarning and SeverityWarning are errors then. But
+	// StrictIgnore is kept, as an ignored problem isn't checked at all.
+	WarningsAsErrors bool
+
+	// Info receives type information of the compiled package if it isn't nil.
+	// Only the non-nil maps of Info are filled.
+	Info *Info
+
+	// Trace is called with the time spent in each phase of NewPackage if it
+	// isn't nil. The phases are:
+	//   - "init": creating the package, including loading the builtins.
+	//   - "preload <file>": collecting declarations of a file.
+	//   - "load <file>": compiling declarations of a file. Type checking and
+	//     code generation are done at the same time. Declarations of other
+	//     files are compiled when they are referenced, so their time is
+	//     counted into the file referencing them first.
+	//   - "types": compiling the type declarations not referenced.
+	//   - "inits": compiling init functions and method bodies.
+	//   - "rules": running Rules.
+	Trace func(phase string, d time.Duration)
+
+	// Rules are custom checks run over the package after it's compiled
+	// without errors, in order. Findings they report are errors or warnings
+	// like the ones of the compiler.
+	Rules []Rule
+
+	// InlineFuncs = true means to inline calls of small functions when the
+	// generated code is written by WriteTo, to make it more readable (not
+	// faster). Only unexported functions just returning a small expression are
+	// inlined, at calls whose arguments are variables or literals. They are
+	// marked by `//gop:inline` comments, which are removed by WriteTo,
+	// WriteFile and ASTFile, so write the code by them rather than
+	// gox.WriteTo. A function whose calls are all inlined is removed too,
+	// unless Go files of the package (the ones compiled with the Go+ files, or
+	// in TargetDir) refer to it.
+	InlineFuncs bool
+
+	// GoAPI = true means that the package is a library for Go callers (eg. one
+	// written in Go+ and shipped to Go users), so its Go API must be the one
+	// declared in Go+. The comments of consts, vars, struct fields and
+	// interface methods are carried over onto the Go declarations too (the doc
+	// comments of types and funcs always are). It's an error if a name
+	// synthesized by Go+ appears in the exported API: an operator method (eg.
+	// Gop_Add), or a type like builtin.Gop_bigint (of bigint) in a signature.
+	GoAPI bool
+
+	// StructTags maps keys of struct tags (eg. "json") to the policies to
+	// name fields in them, for interop with encodings of external systems.
+	// The tags are generated for fields of the struct types declared in Go+,
+	// including the ones of classes. By default (nil), no tags are generated.
+	// Only exported fields are tagged, and embedded fields aren't (so that
+	// encoding/json still promotes their fields). A key written in the tag of
+	// a field is kept as it is, and the generated ones are added after the
+	// written tag in order of keys.
+	StructTags map[string]FieldNaming
 }
 
 func (conf *Config) Ensure() *Config {
 	if conf == nil {
-		conf = &Config{Fset: token.NewFileSet()}
+		conf = &Config{}
+	}
+	if conf.Fset == nil {
+		conf.Fset = token.NewFileSet()
 	}
 	if conf.PkgsLoader == nil {
 		initPkgsLoader(conf)
@@ -285,10 +372,20 @@ func doInitMethods(ld *typeLoader) {
 type pkgCtx struct {
 	*nodeInterp
 	*gmxSettings
-	syms  map[string]loader
-	inits []func()
-	tylds []*typeLoader
-	errs  []error
+	syms      map[string]loader
+	inits     []func()
+	tylds     []*typeLoader
+	errs      []error
+	warns     []error
+	goVersion int   // minor version of the target Go, 0 means no constraint
+	info      *Info // nil means not to record type information
+
+	unusedImport, unusedVar Strictness
+	warningsAsErrors        bool                       // see Config.WarningsAsErrors
+	structTags              map[string]FieldNaming     // see Config.StructTags
+	locals                  map[types.Object]*localVar // local variables not checked yet
+	stmtScopes              map[*types.Scope]bool      // scopes of blocks being compiled by compileStmts
+	fileCtxs                []*blockCtx
 }
 
 type blockCtx struct {
@@ -303,10 +400,14 @@ type blockCtx struct {
 	fileLine     bool
 	relativePath bool
 	fileType     int16
+	standalone   bool // in a standalone class file (see RegisterClassFile)
+
+	unusedImports map[*gox.PkgRef]*ast.ImportSpec // imports not used yet
 }
 
 func (bc *blockCtx) findImport(name string) (pr *gox.PkgRef, ok bool) {
 	if pr, ok = bc.imports[name]; ok {
+		bc.useImport(pr)
 		return
 	}
 	for k, v := range bc.imports {
@@ -318,7 +419,9 @@ func (bc *blockCtx) findImport(name string) (pr *gox.PkgRef, ok bool) {
 			}
 		}
 	}
-	pr, ok = bc.imports[name]
+	if pr, ok = bc.imports[name]; ok {
+		bc.useImport(pr)
+	}
 	return
 }
 
@@ -400,6 +503,12 @@ func (p *pkgCtx) handleRecover(e interface{}) {
 
 // NewPackage creates a Go+ package instance.
 func NewPackage(pkgPath string, pkg *ast.Package, conf *Config) (p *gox.Package, err error) {
+	p, ctx := newPackage(pkgPath, pkg, conf, false)
+	err = ctx.complete()
+	return
+}
+
+func newPackage(pkgPath string, pkg *ast.Package, conf *Config, recoverAll bool) (p *gox.Package, ctx *pkgCtx) {
 	conf = conf.Ensure()
 	dir := conf.Dir
 	if dir == "" {
@@ -414,7 +523,33 @@ func NewPackage(pkgPath string, pkg *ast.Package, conf *Config) (p *gox.Package,
 		targetDir = dir
 	}
 	interp := &nodeInterp{fset: conf.Fset, files: pkg.Files, workingDir: workingDir}
-	ctx := &pkgCtx{syms: make(map[string]loader), nodeInterp: interp}
+	info := conf.Info
+	if len(conf.Rules) > 0 {
+		info = ruleInfo(info)
+	}
+	ctx = &pkgCtx{
+		syms: make(map[string]loader), nodeInterp: interp, info: info,
+		unusedImport: conf.UnusedImport, unusedVar: conf.UnusedVar, locals: make(map[types.Object]*localVar),
+		stmtScopes: make(map[*types.Scope]bool), warningsAsErrors: conf.WarningsAsErrors,
+		structTags: conf.StructTags,
+	}
+	goVersion, err := parseGoVersion(conf.GoVersion)
+	if err != nil {
+		ctx.handleErr(err)
+		return
+	}
+	ctx.goVersion = goVersion
+	if recoverAll {
+		defer func() {
+			if e := recover(); e != nil {
+				ctx.handleRecover(e)
+			}
+		}()
+	}
+	loadPkgs := conf.PkgsLoader.LoadPkgs
+	if conf.Importer != nil {
+		loadPkgs = importerLoadPkgs(conf.Importer, loadPkgs)
+	}
 	confGox := &gox.Config{
 		Context:         conf.Context,
 		Logf:            conf.Logf,
@@ -423,45 +558,124 @@ func NewPackage(pkgPath string, pkg *ast.Package, conf *Config) (p *gox.Package,
 		Env:             conf.Env,
 		BuildFlags:      conf.BuildFlags,
 		Fset:            conf.Fset,
-		LoadPkgs:        conf.PkgsLoader.LoadPkgs,
+		LoadPkgs:        loadPkgs,
 		LoadNamed:       ctx.loadNamed,
 		HandleErr:       ctx.handleErr,
 		NodeInterpreter: interp,
 		ParseFile:       nil, // TODO
 		NewBuiltin:      newBuiltinDefault,
 	}
+	phase := func(name, file string) {}
+	if conf.Trace != nil {
+		start := time.Now()
+		phase = func(name, file string) {
+			if file != "" {
+				name += " " + file
+			}
+			now := time.Now()
+			conf.Trace(name, now.Sub(start))
+			start = now
+		}
+	}
 	p = gox.NewPackage(pkgPath, pkg.Name, confGox)
-	for file, gmx := range pkg.Files {
-		if gmx.FileType == ast.FileTypeGmx {
-			ctx.gmxSettings = newGmx(p, file)
+	phase("init", "")
+	files := sortedFiles(pkg) // in a fixed order, so the generated code is stable
+	for _, fpath := range files {
+		if pkg.Files[fpath].FileType == ast.FileTypeGmx {
+			ctx.gmxSettings = newGmx(p, fpath)
 			break
 		}
 	}
-	for fpath, f := range pkg.Files {
-		preloadFile(p, ctx, fpath, f, targetDir, conf)
+	for _, fpath := range files {
+		preloadFile(p, ctx, fpath, pkg.Files[fpath], targetDir, conf)
+		phase("preload", fpath)
 	}
-	for _, f := range pkg.Files {
-		if f.FileType == ast.FileTypeGmx {
+	for _, fpath := range files {
+		if f := pkg.Files[fpath]; f.FileType == ast.FileTypeGmx {
 			loadFile(ctx, f)
-			gmxMainFunc(p, ctx)
+			var doc *goast.CommentGroup
+			if !conf.NoFileLine { // func main is located at the beginning of the .gmx file
+				file := fpath
+				if conf.RelativePath {
+					file = relFile(targetDir, file)
+				}
+				doc = withLineDirective(nil, fmt.Sprintf("//line %s:1", file))
+			}
+			gmxMainFunc(p, ctx, doc)
+			phase("load", fpath)
 			break
 		}
 	}
-	for _, f := range pkg.Files {
-		if f.FileType != ast.FileTypeGmx { // only one .gmx file
+	for _, fpath := range files {
+		if f := pkg.Files[fpath]; f.FileType != ast.FileTypeGmx { // only one .gmx file
 			loadFile(ctx, f)
+			phase("load", fpath)
 		}
 	}
 	for _, ld := range ctx.tylds {
 		ld.load()
 	}
+	phase("types", "")
 	for _, load := range ctx.inits {
 		load()
 	}
-	err = ctx.complete()
+	phase("inits", "")
+	for _, fctx := range ctx.fileCtxs {
+		fctx.checkUnusedImports()
+	}
+	if len(conf.Rules) > 0 {
+		ctx.checkRules(conf.Rules, pkg, p.Types)
+		phase("rules", "")
+	}
+	if conf.GoAPI && ctx.errs == nil {
+		ctx.checkGoAPI(p.Types)
+		if ctx.errs == nil {
+			copyDocs(p, pkg)
+		}
+	}
+	if conf.InlineFuncs && ctx.errs == nil {
+		markInlineFuncs(p, goFileNames(pkg, targetDir))
+	}
 	return
 }
 
+func sortedFiles(pkg *ast.Package) []string {
+	files := make([]string, 0, len(pkg.Files))
+	for fpath := range pkg.Files {
+		files = append(files, fpath)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// parseGoVersion parses a Go version like "go1.16" (or "1.16") and returns
+// its minor version.
+func parseGoVersion(v string) (minor int, err error) {
+	if v == "" {
+		return 0, nil
+	}
+	ver := strings.TrimPrefix(v, "go")
+	if strings.HasPrefix(ver, "1.") {
+		ver = ver[2:]
+		if pos := strings.IndexByte(ver, '.'); pos >= 0 {
+			ver = ver[:pos]
+		}
+		if minor, err = strconv.Atoi(ver); err == nil && minor > 0 {
+			return
+		}
+	}
+	return 0, fmt.Errorf("invalid Go version %q, should be like go1.16", v)
+}
+
+// checkGoVersion reports an error if feature requires go1.minor but the
+// target Go version is lower. The feature is still compiled as it is, so
+// the code using it doesn't cause other errors.
+func (p *pkgCtx) checkGoVersion(pos token.Pos, feature string, minor int) {
+	if p.goVersion > 0 && p.goVersion < minor {
+		p.handleErr(p.newCodeErrorf(pos, "%s requires go1.%d or later (target Go version is go1.%d)", feature, minor, p.goVersion))
+	}
+}
+
 func hasMethod(o types.Object, name string) bool {
 	if obj, ok := o.(*types.TypeName); ok {
 		if t, ok := obj.Type().(*types.Named); ok {
@@ -527,22 +741,36 @@ func preloadFile(p *gox.Package, parent *pkgCtx, file string, f *ast.File, targe
 	ctx := &blockCtx{
 		pkg: p, pkgCtx: parent, cb: p.CB(), fset: p.Fset, targetDir: targetDir, fileType: f.FileType,
 		fileLine: fileLine, relativePath: conf.RelativePath, imports: make(map[string]*gox.PkgRef),
+		unusedImports: make(map[*gox.PkgRef]*ast.ImportSpec),
 	}
+	parent.fileCtxs = append(parent.fileCtxs, ctx)
 	var classType string
 	var baseTypeName string
 	var baseType types.Type
+	var thisName = "this"
+	var pkgPaths []string
 	switch f.FileType {
 	case ast.FileTypeSpx:
-		if parent.gmxSettings != nil {
+		ext := filepath.Ext(file)
+		if cf, ok := classFiles[ext]; ok {
 			classType = getDefaultClass(file)
-			o := parent.sprite
-			baseTypeName, baseType = o.Name(), o.Type()
+			o := p.Import(cf.pkgPath).Ref(cf.base)
+			baseTypeName, baseType, thisName = o.Name(), o.Type(), cf.this
+			pkgPaths, ctx.standalone = []string{cf.pkgPath}, true
+		} else if parent.gmxSettings != nil {
+			if work, ok := parent.works[ext]; ok {
+				classType = getDefaultClass(file)
+				o := work.base
+				baseTypeName, baseType, thisName = o.Name(), o.Type(), work.this
+				pkgPaths = parent.pkgPaths
+			}
 		}
 		// TODO: panic
 	case ast.FileTypeGmx:
 		classType = parent.gameClass
+		pkgPaths = parent.pkgPaths
 		o := parent.game
-		baseTypeName, baseType = o.Name(), o.Type()
+		baseTypeName, baseType, thisName = o.Name(), o.Type(), parent.gameThis
 		if parent.gameIsPtr {
 			baseType = types.NewPointer(baseType)
 		}
@@ -551,12 +779,13 @@ func preloadFile(p *gox.Package, parent *pkgCtx, file string, f *ast.File, targe
 		if debugLoad {
 			log.Println("==> Preload type", classType)
 		}
-		ctx.lookups = make([]*gox.PkgRef, len(parent.pkgPaths))
-		for i, pkgPath := range parent.pkgPaths {
+		ctx.lookups = make([]*gox.PkgRef, len(pkgPaths))
+		for i, pkgPath := range pkgPaths {
 			ctx.lookups[i] = p.Import(pkgPath)
 		}
 		pos := f.Pos()
 		specs := getFields(ctx, f)
+		checkClassThis(ctx, f, specs, thisName)
 		ld := getTypeLoader(parent, syms, pos, classType)
 		ld.typ = func() {
 			if debugLoad {
@@ -570,11 +799,12 @@ func preloadFile(p *gox.Package, parent *pkgCtx, file string, f *ast.File, targe
 				pkg := p.Types
 				flds := make([]*types.Var, 1, 2)
 				flds[0] = types.NewField(pos, pkg, baseTypeName, baseType, true)
-				if f.FileType == ast.FileTypeSpx {
+				if f.FileType == ast.FileTypeSpx && !ctx.standalone {
 					typ := toType(ctx, &ast.StarExpr{X: &ast.Ident{Name: parent.gameClass}})
 					fld := types.NewField(pos, pkg, getTypeName(typ), typ, true)
 					flds = append(flds, fld)
 				}
+				tags := make([]string, len(flds), cap(flds)) // embedded fields aren't tagged
 				for _, v := range specs {
 					spec := v.(*ast.ValueSpec)
 					if spec.Type == nil {
@@ -588,16 +818,19 @@ func preloadFile(p *gox.Package, parent *pkgCtx, file string, f *ast.File, targe
 					}
 					typ := toType(ctx, spec.Type)
 					for _, name := range spec.Names {
-						flds = append(flds, types.NewField(name.Pos(), pkg, name.Name, typ, false))
+						fld := types.NewField(name.Pos(), pkg, name.Name, typ, false)
+						flds = append(flds, fld)
+						tags = append(tags, ctx.structTag(name.Name, ""))
+						ctx.recordDef(name, fld)
 					}
 				}
-				decl.InitType(p, types.NewStruct(flds, nil))
+				decl.InitType(p, types.NewStruct(flds, tags))
 			}
 			parent.tylds = append(parent.tylds, ld)
 		}
 		ctx.classRecv = &ast.FieldList{List: []*ast.Field{{
 			Names: []*ast.Ident{
-				{Name: "this"},
+				{Name: thisName},
 			},
 			Type: &ast.StarExpr{
 				X: &ast.Ident{Name: classType},
@@ -670,13 +903,15 @@ func preloadFile(p *gox.Package, parent *pkgCtx, file string, f *ast.File, targe
 							if debugLoad {
 								log.Println("==> Load > AliasType", name)
 							}
-							ctx.pkg.AliasType(name, toType(ctx, t.Type))
+							ctx.pkg.AliasType(name, toType(ctx, t.Type), t.Name.Pos())
+							ctx.recordDef(t.Name, ctx.pkg.Types.Scope().Lookup(name))
 							return
 						}
 						if debugLoad {
 							log.Println("==> Load > NewType", name)
 						}
-						decl := ctx.pkg.NewType(name)
+						decl := ctx.pkg.NewType(name, t.Name.Pos())
+						ctx.recordDef(t.Name, decl.Type().Obj())
 						if t.Doc != nil {
 							decl.SetComments(t.Doc)
 						} else if d.Doc != nil {
@@ -707,6 +942,7 @@ func preloadFile(p *gox.Package, parent *pkgCtx, file string, f *ast.File, targe
 							for _, s := range d.Specs {
 								v := s.(*ast.ValueSpec)
 								removeNames(syms, v.Names)
+								ctx.recordDefs(p.Types.Scope(), v.Names)
 							}
 						}
 					})
@@ -769,9 +1005,8 @@ func loadFunc(ctx *blockCtx, recv *types.Var, d *ast.FuncDecl) {
 		ctx.handleErr(err)
 		return
 	}
-	if d.Doc != nil {
-		fn.SetComments(d.Doc)
-	}
+	ctx.recordDef(d.Name, fn.Func)
+	commentFunc(ctx, fn, d)
 	if body := d.Body; body != nil {
 		if recv != nil {
 			ctx.inits = append(ctx.inits, func() { // interface issue: #795
@@ -836,7 +1071,9 @@ var unaryGopNames = map[string]string{
 
 func loadFuncBody(ctx *blockCtx, fn *gox.Func, body *ast.BlockStmt) {
 	cb := fn.BodyStart(ctx.pkg)
+	scope := cb.Scope()
 	compileStmts(ctx, body.List)
+	ctx.checkUnusedLocals(scope)
 	cb.End()
 }
 
@@ -865,6 +1102,7 @@ func loadImport(ctx *blockCtx, spec *ast.ImportSpec) {
 		name = path.Base(pkgPath) // TODO: open pkgPath to get pkgName
 	}
 	ctx.imports[name] = pkg
+	ctx.unusedImports[pkg] = spec
 }
 
 func loadConstSpecs(ctx *blockCtx, cdecl *gox.ConstDecl, specs []ast.Spec) {
@@ -915,6 +1153,12 @@ func loadVars(ctx *blockCtx, v *ast.ValueSpec, global bool) {
 		scope = ctx.cb.Scope()
 	}
 	varDecl := ctx.pkg.NewVarEx(scope, v.Names[0].Pos(), typ, names...)
+	ctx.recordDefs(scope, v.Names)
+	if !global {
+		for _, name := range v.Names {
+			ctx.defineLocal(name, scope.Lookup(name.Name))
+		}
+	}
 	if nv := len(v.Values); nv > 0 {
 		cb := varDecl.InitStart(ctx.pkg)
 		if nv == 1 && len(names) == 2 {
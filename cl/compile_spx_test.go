@@ -20,6 +20,8 @@ import (
 	"bytes"
 	"os"
 	"path"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/goplus/gop/cl"
@@ -30,16 +32,28 @@ import (
 )
 
 func newTwoFileFS(dir string, fname, data string, fname2 string, data2 string) *parsertest.MemFS {
-	return parsertest.NewMemFS(map[string][]string{
-		dir: {fname, fname2},
-	}, map[string]string{
-		path.Join(dir, fname):  data,
-		path.Join(dir, fname2): data2,
-	})
+	return newMultiFileFS(dir, fname, data, fname2, data2)
+}
+
+// newMultiFileFS creates a MemFS by pairs of (fname, data).
+func newMultiFileFS(dir string, fnameAndDatas ...string) *parsertest.MemFS {
+	fnames := make([]string, 0, len(fnameAndDatas)/2)
+	files := make(map[string]string, len(fnameAndDatas)/2)
+	for i := 0; i+1 < len(fnameAndDatas); i += 2 {
+		fname := fnameAndDatas[i]
+		fnames = append(fnames, fname)
+		files[path.Join(dir, fname)] = fnameAndDatas[i+1]
+	}
+	return parsertest.NewMemFS(map[string][]string{dir: fnames}, files)
 }
 
 func init() {
 	cl.RegisterClassFileType(".tgmx", ".tspx", "github.com/goplus/gop/cl/internal/spx", "math")
+	cl.RegisterWorkClasses(".tgmx", cl.WorkClass{Ext: ".tworker", Base: "Worker", This: "self"})
+	cl.RegisterClassFile(".tform", "github.com/goplus/gop/cl/internal/spx", "Worker", "self")
+	cl.RegisterClassFile(".tform2", "github.com/goplus/gop/cl/internal/spx2", "Sprite", "")
+	cl.RegisterClassFileType(".t5gmx", ".t5spx", "github.com/goplus/gop/cl/internal/spx", "math")
+	cl.RegisterClassThis(".t5gmx", "self")
 }
 
 func gopSpxTest(t *testing.T, gmx, spxcode, expected string) {
@@ -47,10 +61,15 @@ func gopSpxTest(t *testing.T, gmx, spxcode, expected string) {
 }
 
 func gopSpxTestEx(t *testing.T, gmx, spxcode, expected, gmxfile, spxfile string) {
+	gopSpxTestFiles(t, expected, spxfile, spxcode, gmxfile, gmx)
+}
+
+// gopSpxTestFiles compiles all class files specified by pairs of (fname, data).
+func gopSpxTestFiles(t *testing.T, expected string, fnameAndDatas ...string) {
 	cl.SetDisableRecover(true)
 	defer cl.SetDisableRecover(false)
 
-	fs := newTwoFileFS("/foo", spxfile, spxcode, gmxfile, gmx)
+	fs := newMultiFileFS("/foo", fnameAndDatas...)
 	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
 	if err != nil {
 		scanner.PrintError(os.Stderr, err)
@@ -157,6 +176,179 @@ func (this *Kai) onMsg(msg string) {
 `, "Game.tgmx", "Kai.tspx")
 }
 
+func TestSpxClassThis(t *testing.T) {
+	gopSpxTestEx(t, `
+var (
+	Kai Kai
+)
+
+func onInit() {
+	Kai.onMsg "Hi"
+}
+`, `
+func onMsg(msg string) {
+	say msg
+	self.Say msg
+}
+`, `package main
+
+import spx "github.com/goplus/gop/cl/internal/spx"
+
+type Game struct {
+	*spx.MyGame
+	Kai Kai
+}
+type Kai struct {
+	spx.Sprite
+	*Game
+}
+
+func (self *Game) onInit() {
+	self.Kai.onMsg("Hi")
+}
+func (self *Kai) onMsg(msg string) {
+	self.Say(msg)
+	self.Say(msg)
+}
+`, "Game.t5gmx", "Kai.t5spx")
+}
+
+func TestSpxClassThisError(t *testing.T) {
+	gopSpxErrorTestEx(t, `./Game.t5gmx:3:2: field self conflicts with the receiver name of class file`, `
+var (
+	self int
+)
+`, `
+println "hi"
+`, "Game.t5gmx", "Kai.t5spx")
+
+	gopSpxErrorTestEx(t, `./Kai.t5spx:2:12: parameter self conflicts with the receiver name of class file`, `
+println "hi"
+`, `
+func onMsg(self string) {
+}
+`, "Game.t5gmx", "Kai.t5spx")
+
+	gopSpxErrorTestEx(t, `./Kai.t5spx:2:6: method self conflicts with the receiver name of class file`, `
+println "hi"
+`, `
+func self() (n int) {
+	return
+}
+`, "Game.t5gmx", "Kai.t5spx")
+
+	gopSpxErrorTestEx(t, `./Bob.tworker:2:13: result self conflicts with the receiver name of class file`, `
+println "hi"
+`, `
+func foo() (self int) {
+	return
+}
+`, "Game.tgmx", "Bob.tworker")
+}
+
+func TestRegisterClassThis(t *testing.T) {
+	for _, c := range []struct{ ext, this string }{{".unknown", "self"}, {".t5gmx", "1x"}, {".t5gmx", "_"}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("RegisterClassThis: no panic?", c)
+				}
+			}()
+			cl.RegisterClassThis(c.ext, c.this)
+		}()
+	}
+	for _, register := range []func(this string){
+		func(this string) {
+			cl.RegisterWorkClasses(".t5gmx", cl.WorkClass{Ext: ".t5worker", Base: "Worker", This: this})
+		},
+		func(this string) {
+			cl.RegisterClassFile(".t5form", "github.com/goplus/gop/cl/internal/spx", "Sprite", this)
+		},
+	} {
+		for _, this := range []string{"1x", "_", "a-b"} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Fatal("register a class with receiver name: no panic?", this)
+					}
+				}()
+				register(this)
+			}()
+		}
+	}
+}
+
+func TestSpxWorkClass(t *testing.T) {
+	gopSpxTestFiles(t, `package main
+
+import spx "github.com/goplus/gop/cl/internal/spx"
+
+type Game struct {
+	*spx.MyGame
+}
+
+func (this *Game) onInit() {
+}
+
+type Bob struct {
+	spx.Worker
+	*Game
+}
+
+func (self *Bob) onInit() {
+	self.Work("job1")
+}
+`, "Bob.tworker", `
+func onInit() {
+	work "job1"
+}
+`, "Game.tgmx", `
+func onInit() {
+}
+`)
+}
+
+func TestSpxMultiClasses(t *testing.T) {
+	fs := newMultiFileFS("/foo", "Kai.tspx", `
+func onMsg(msg string) {
+	say "Hi"
+}
+`, "Bob.tworker", `
+func onInit() {
+	work "job1"
+}
+`, "Game.tgmx", `
+var (
+	Kai Kai
+	Bob Bob
+)
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	conf := *baseConf.Ensure()
+	pkg, err := cl.NewPackage("", pkgs["main"], &conf)
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	var b bytes.Buffer
+	if err = gox.WriteTo(&b, pkg, false); err != nil {
+		t.Fatal("gox.WriteTo failed:", err)
+	}
+	result := b.String()
+	for _, expected := range []string{
+		"type Kai struct {\n\tspx.Sprite\n\t*Game\n}",
+		"type Bob struct {\n\tspx.Worker\n\t*Game\n}",
+		"func (this *Kai) onMsg(msg string) {\n\tthis.Say(\"Hi\")\n}",
+		"func (self *Bob) onInit() {\n\tself.Work(\"job1\")\n}",
+	} {
+		if !strings.Contains(result, expected) {
+			t.Fatalf("\nResult:\n%s\nExpected to contain:\n%s\n", result, expected)
+		}
+	}
+}
+
 func TestSpxBasic2(t *testing.T) {
 	gopSpxTest(t, `
 import (
@@ -370,3 +562,165 @@ func (this *Kai) onMsg(msg string) {
 }
 `, "Game.t2gmx", "Kai.t2spx")
 }
+
+func TestSpxFileLine(t *testing.T) {
+	fs := newTwoFileFS("/foo", "Kai.tspx", `
+func onMsg(msg string) {
+	println msg
+}
+
+onMsg "Hi"
+`, "Game.tgmx", `
+var (
+	Kai Kai
+)
+
+run "hzip://open.qiniu.us/weather/res.zip"
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.NoFileLine = false
+	conf.RelativePath = true
+	conf.TargetDir = "/foo"
+	pkg, err := cl.NewPackage("", pkgs["main"], &conf)
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	var b bytes.Buffer
+	if err = gox.WriteTo(&b, pkg, false); err != nil {
+		t.Fatal("gox.WriteTo failed:", err)
+	}
+	if result := b.String(); result != `package main
+
+import (
+	fmt "fmt"
+	spx "github.com/goplus/gop/cl/internal/spx"
+)
+
+type Game struct {
+	*spx.MyGame
+	Kai Kai
+}
+type Kai struct {
+	spx.Sprite
+	*Game
+}
+//line ./Game.tgmx:6
+func (this *Game) MainEntry() {
+//line ./Game.tgmx:6
+	spx.Gopt_MyGame_Run(this, "hzip://open.qiniu.us/weather/res.zip")
+}
+//line ./Game.tgmx:1
+func main() {
+	spx.Gopt_MyGame_Main(new(Game))
+}
+//line ./Kai.tspx:2
+func (this *Kai) onMsg(msg string) {
+//line ./Kai.tspx:3
+	fmt.Println(msg)
+}
+//line ./Kai.tspx:6
+func (this *Kai) Main() {
+//line ./Kai.tspx:6
+	this.onMsg("Hi")
+}
+` {
+		t.Fatal("TestSpxFileLine:\n" + result)
+	}
+}
+
+func TestStandaloneClassFile(t *testing.T) {
+	gopSpxTestFiles(t, `package main
+
+import (
+	spx2 "github.com/goplus/gop/cl/internal/spx2"
+	spx "github.com/goplus/gop/cl/internal/spx"
+)
+
+type Bar struct {
+	spx2.Sprite
+}
+
+func (this *Bar) Main() {
+	spx2.Sched()
+}
+
+type Foo struct {
+	spx.Worker
+	count int
+}
+
+func (self *Foo) Main() {
+	self.count++
+	self.Work("hi")
+}
+`, "Foo.tform", `
+var (
+	count int
+)
+
+count++
+work "hi"
+`, "Bar.tform2", `
+sched
+`)
+}
+
+func TestClassFileInfo(t *testing.T) {
+	type info struct {
+		isClass              bool
+		gamePkg, class, this string
+		ok                   bool
+	}
+	cases := []struct {
+		filename string
+		want     info
+	}{
+		{"foo.gop", info{ok: true}},
+		{"foo.go", info{ok: true}},
+		{"foo.txt", info{}},
+		{"main.gmx", info{true, "github.com/goplus/spx", "_main", "this", true}},
+		{"/foo/bar.spx", info{true, "github.com/goplus/spx", "bar", "this", true}},
+		{"Game.tgmx", info{true, "github.com/goplus/gop/cl/internal/spx", "Game", "this", true}},
+		{"Kai.tspx", info{true, "github.com/goplus/gop/cl/internal/spx", "Kai", "this", true}},
+		{"Bar.tworker", info{true, "github.com/goplus/gop/cl/internal/spx", "Bar", "self", true}},
+		{"Foo.tform", info{true, "github.com/goplus/gop/cl/internal/spx", "Foo", "self", true}},
+		{"Foo.tform2", info{true, "github.com/goplus/gop/cl/internal/spx2", "Foo", "this", true}},
+		{"Game.t5gmx", info{true, "github.com/goplus/gop/cl/internal/spx", "Game", "self", true}},
+		{"Kai.t5spx", info{true, "github.com/goplus/gop/cl/internal/spx", "Kai", "self", true}},
+	}
+	for _, c := range cases {
+		var got info
+		got.isClass, got.gamePkg, got.class, got.this, got.ok = cl.ClassFileInfo(c.filename)
+		if got != c.want {
+			t.Fatalf("ClassFileInfo(%s): got %v, want %v\n", c.filename, got, c.want)
+		}
+	}
+}
+
+func TestBuiltinImports(t *testing.T) {
+	builtins := []string{"fmt", "github.com/goplus/gop/builtin", "strconv", "strings"}
+	cases := []struct {
+		filename string
+		want     []string
+	}{
+		{"foo.gop", builtins},
+		{"foo.txt", builtins},
+		{"main.gmx", append(builtins, "github.com/goplus/spx", "math")},
+		{"Kai.tspx", append(builtins, "github.com/goplus/gop/cl/internal/spx", "math")},
+		{"Bar.tworker", append(builtins, "github.com/goplus/gop/cl/internal/spx", "math")},
+		{"Foo.tform2", append(builtins, "github.com/goplus/gop/cl/internal/spx2")},
+	}
+	for _, c := range cases {
+		if got := cl.BuiltinImports(c.filename); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("BuiltinImports(%s): got %v, want %v\n", c.filename, got, c.want)
+		}
+	}
+	cl.BuiltinImports("foo.gop")[0] = "os"
+	if got := cl.BuiltinImports("foo.gop"); got[0] != "fmt" {
+		t.Fatal("BuiltinImports: result is shared -", got)
+	}
+}
@@ -18,11 +18,14 @@ package cl_test
 
 import (
 	"bytes"
+	"errors"
+	"go/types"
 	"os"
 	"strings"
 	"sync"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/goplus/gop/cl"
 	"github.com/goplus/gop/cmd/gengo"
@@ -48,6 +51,8 @@ func init() {
 		GenGoPkg:      new(gengo.Runner).GenGoPkg,
 		CacheLoadPkgs: true,
 		NoFileLine:    true,
+		UnusedImport:  cl.StrictIgnore, // most cases are snippets to test the generated code
+		UnusedVar:     cl.StrictIgnore,
 	}
 }
 
@@ -116,6 +121,88 @@ func TestNilConf(t *testing.T) {
 	cl.NewPackage("", pkgs["main"], nil)
 }
 
+func TestTrace(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `
+type T struct{}
+
+func (T) Foo() {}
+
+println("Hi")
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	var phases []string
+	conf := *baseConf
+	conf.Trace = func(phase string, d time.Duration) {
+		if d < 0 {
+			t.Fatal("Trace:", phase, d)
+		}
+		phases = append(phases, phase)
+	}
+	if _, err = cl.NewPackage("", pkgs["main"], &conf); err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	if v := strings.Join(phases, ", "); v != "init, preload /foo/bar.gop, load /foo/bar.gop, types, inits" {
+		t.Fatal("Trace:", v)
+	}
+}
+
+type memImporter map[string]*types.Package
+
+func (p memImporter) Import(path string) (*types.Package, error) {
+	if pkg, ok := p[path]; ok {
+		return pkg, nil
+	}
+	return nil, errors.New("package not found: " + path)
+}
+
+func TestImporter(t *testing.T) {
+	mem := types.NewPackage("example.com/mem", "mem")
+	ret := types.NewTuple(types.NewVar(token.NoPos, mem, "", types.Typ[types.String]))
+	mem.Scope().Insert(types.NewFunc(token.NoPos, mem, "Hello", types.NewSignature(nil, nil, ret, false)))
+	mem.MarkComplete()
+
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `import (
+	"strings"
+
+	"example.com/mem"
+)
+
+println strings.ToUpper(mem.Hello())
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.Importer = memImporter{"example.com/mem": mem}
+	pkg, err := cl.NewPackage("", pkgs["main"], &conf)
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	var b bytes.Buffer
+	if err = gox.WriteTo(&b, pkg, false); err != nil {
+		t.Fatal("gox.WriteTo failed:", err)
+	}
+	expected := `package main
+
+import (
+	fmt "fmt"
+	strings "strings"
+	mem "example.com/mem"
+)
+
+func main() {
+	fmt.Println(strings.ToUpper(mem.Hello()))
+}
+`
+	if result := b.String(); result != expected {
+		t.Fatalf("\nResult:\n%s\nExpected:\n%s\n", result, expected)
+	}
+}
+
 func TestInitFunc(t *testing.T) {
 	gopClTest(t, `
 
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl
+
+import (
+	"sort"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/scanner"
+	"github.com/goplus/gop/token"
+	"github.com/goplus/gox"
+)
+
+// -----------------------------------------------------------------------------
+
+// Severity represents how serious a Diagnostic is.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic represents a problem reported when compiling a Go+ package.
+type Diagnostic struct {
+	Pos      token.Pos      // token.NoPos if the problem has no position
+	Position token.Position // Pos resolved by Config.Fset
+	Severity Severity
+	Msg      string // original message text, without position
+}
+
+// NewPackageWithErrors creates a Go+ package instance like NewPackage, but
+// it doesn't stop at the first broken statement. All problems found are
+// returned as diags (sorted by position), and errors among them are also
+// returned as a scanner.ErrorList (nil if there is no error).
+func NewPackageWithErrors(
+	pkgPath string, pkg *ast.Package, conf *Config) (p *gox.Package, diags []*Diagnostic, errs scanner.ErrorList) {
+	p, ctx := newPackage(pkgPath, pkg, conf, true)
+	diags = ctx.diagnostics()
+	for _, diag := range diags {
+		if diag.Severity == SeverityError {
+			errs.Add(diag.Position, diag.Msg)
+		}
+	}
+	return
+}
+
+func (p *pkgCtx) diagnostics() []*Diagnostic {
+	diags := make([]*Diagnostic, 0, len(p.errs)+len(p.warns))
+	for i, err := range append(p.errs[:len(p.errs):len(p.errs)], p.warns...) {
+		diag := &Diagnostic{Severity: SeverityError, Msg: err.Error()}
+		if i >= len(p.errs) {
+			diag.Severity = SeverityWarning
+		}
+		if e, ok := err.(*gox.CodeError); ok {
+			diag.Msg = e.Msg
+			if e.Pos != nil {
+				diag.Position = *e.Pos
+				diag.Pos = p.posOf(e.Pos)
+			}
+		}
+		diags = append(diags, diag)
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := &diags[i].Position, &diags[j].Position
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return diags
+}
+
+// posOf converts a position (whose filename may be relative to workingDir)
+// back to a token.Pos.
+func (p *nodeInterp) posOf(pos *token.Position) token.Pos {
+	for fname := range p.files {
+		if fname != pos.Filename && relFile(p.workingDir, fname) != pos.Filename {
+			continue
+		}
+		f := p.fset.File(filePos(p.files[fname])) // fname may be parsed more than once
+		if f == nil || pos.Offset < 0 || pos.Offset > f.Size() {
+			return token.NoPos
+		}
+		return f.Pos(pos.Offset)
+	}
+	return token.NoPos
+}
+
+// filePos returns a position in the file f, or token.NoPos if f is empty.
+func filePos(f *ast.File) token.Pos {
+	if f.Package.IsValid() {
+		return f.Package
+	}
+	for _, decl := range f.Decls {
+		if pos := decl.Pos(); pos.IsValid() {
+			return pos
+		}
+	}
+	return token.NoPos
+}
+
+// -----------------------------------------------------------------------------
@@ -17,6 +17,7 @@
 package cl_test
 
 import (
+	"bytes"
 	"os"
 	"testing"
 
@@ -24,6 +25,7 @@ import (
 	"github.com/goplus/gop/parser"
 	"github.com/goplus/gop/parser/parsertest"
 	"github.com/goplus/gop/scanner"
+	"github.com/goplus/gox"
 )
 
 func codeErrorTest(t *testing.T, msg, src string) {
@@ -806,3 +808,176 @@ import "fmt"
 n, err := fmt.println
 `)
 }
+
+func TestNewPackageWithErrors(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `func main() {
+	a = 1
+	println "Hi"
+	foo()
+}
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("parser.ParseFSDir failed:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.WorkingDir = "/foo"
+	conf.TargetDir = "/foo"
+	_, diags, errs := cl.NewPackageWithErrors("", pkgs["main"], &conf)
+	if len(diags) != 2 || len(errs) != 2 {
+		t.Fatal("NewPackageWithErrors:", diags, errs)
+	}
+	if diags[0].Msg != "undefined: a" || diags[1].Msg != "undefined: foo" {
+		t.Fatal("NewPackageWithErrors:", diags[0].Msg, diags[1].Msg)
+	}
+	for _, diag := range diags {
+		if diag.Severity != cl.SeverityError || !diag.Pos.IsValid() {
+			t.Fatal("NewPackageWithErrors:", diag)
+		}
+		if pos := gblFset.Position(diag.Pos); pos.Line != diag.Position.Line || pos.Column != diag.Position.Column {
+			t.Fatal("NewPackageWithErrors:", pos, diag.Position)
+		}
+	}
+	if errs[1].Error() != "./bar.gop:4:2: undefined: foo" {
+		t.Fatal("NewPackageWithErrors:", errs[1])
+	}
+}
+
+func TestErrGoVersion(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `
+a := 0b1011
+println a
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("parser.ParseFSDir failed:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.WorkingDir = "/foo"
+	conf.TargetDir = "/foo"
+	conf.GoVersion = "go1.12"
+	_, err = cl.NewPackage("", pkgs["main"], &conf)
+	const msg = "./bar.gop:2:6: binary, octal, hex-float or _-separated number literal requires go1.13 or later (target Go version is go1.12)"
+	if err == nil || err.Error() != msg {
+		t.Fatal("NewPackage:", err)
+	}
+	conf.GoVersion = "go1.13"
+	if _, err = cl.NewPackage("", pkgs["main"], &conf); err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	conf.GoVersion = "1.x"
+	if _, err = cl.NewPackage("", pkgs["main"], &conf); err == nil || err.Error() != `invalid Go version "1.x", should be like go1.16` {
+		t.Fatal("NewPackage:", err)
+	}
+}
+
+func TestErrUnused(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `import (
+	"fmt"
+	s "strings"
+	"os"
+)
+
+func foo() int {
+	x, n := 1, 2
+	if y := 3; n > 0 {
+		n++
+	}
+	for i, v := range [1, 2] {
+		println v
+	}
+	return 0
+}
+
+println os.Args
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("parser.ParseFSDir failed:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.WorkingDir = "/foo"
+	conf.TargetDir = "/foo"
+	conf.UnusedImport, conf.UnusedVar = cl.StrictError, cl.StrictError
+	_, err = cl.NewPackage("", pkgs["main"], &conf)
+	const msg = `./bar.gop:12:6: i declared but not used
+./bar.gop:8:2: x declared but not used
+./bar.gop:9:5: y declared but not used
+./bar.gop:2:2: "fmt" imported but not used
+./bar.gop:3:2: "strings" imported but not used as s`
+	if err == nil || err.Error() != msg {
+		t.Fatal("NewPackage:", err)
+	}
+
+	conf.UnusedImport, conf.UnusedVar = cl.StrictWarning, cl.StrictWarning
+	pkg, diags, errs := cl.NewPackageWithErrors("", pkgs["main"], &conf)
+	if errs != nil || len(diags) != 5 {
+		t.Fatal("NewPackageWithErrors:", diags, errs)
+	}
+	for _, diag := range diags {
+		if diag.Severity != cl.SeverityWarning {
+			t.Fatal("NewPackageWithErrors:", diag)
+		}
+	}
+	var b bytes.Buffer
+	if err = gox.WriteTo(&b, pkg, false); err != nil {
+		t.Fatal("gox.WriteTo failed:", err)
+	}
+	if ret := b.String(); ret != `package main
+
+import (
+	fmt "fmt"
+	os "os"
+)
+
+func foo() int {
+	x, n := 1, 2
+	if y := 3; n > 0 {
+		n++
+		_ = y
+	}
+	for i, v := range []int{1, 2} {
+		fmt.Println(v)
+		_ = i
+	}
+	_ = x
+	return 0
+}
+func main() {
+	fmt.Println(os.Args)
+}
+` {
+		t.Fatal("NewPackageWithErrors:", ret)
+	}
+}
+
+func TestWarningsAsErrors(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `import "fmt"
+
+func foo() {
+	x := 1
+}
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("parser.ParseFSDir failed:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.WorkingDir = "/foo"
+	conf.TargetDir = "/foo"
+	conf.UnusedImport, conf.UnusedVar = cl.StrictWarning, cl.StrictIgnore
+	if _, err = cl.NewPackage("", pkgs["main"], &conf); err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+
+	// WarningsAsErrors overrides StrictWarning, but not StrictIgnore.
+	conf.WarningsAsErrors = true
+	_, err = cl.NewPackage("", pkgs["main"], &conf)
+	if err == nil || err.Error() != `./bar.gop:1:8: "fmt" imported but not used` {
+		t.Fatal("NewPackage:", err)
+	}
+	_, diags, errs := cl.NewPackageWithErrors("", pkgs["main"], &conf)
+	if len(errs) != 1 || len(diags) != 1 || diags[0].Severity != cl.SeverityError {
+		t.Fatal("NewPackageWithErrors:", diags, errs)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/goplus/gop/cl"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/token"
+	"github.com/goplus/gox"
+)
+
+// This example compiles a Go+ project of multiple files in a zip archive,
+// without extracting the archive.
+func Example_zip() {
+	// A zip archive of the project, which is usually read from a file or
+	// received from the network.
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range []struct{ name, data string }{
+		{"hello/main.gop", "println greet(\"Go+\")\n"},
+		{"hello/greet.gop", "func greet(name string) string {\n\treturn \"Hello, \" + name\n}\n"},
+		{"hello/README.md", "# hello\n"},
+	} {
+		w, _ := zw.Create(file.name)
+		w.Write([]byte(file.data))
+	}
+	zw.Close()
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		fmt.Println("zip.NewReader:", err)
+		return
+	}
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseFSDir(fset, parser.FromZip(r), "hello", nil, 0)
+	if err != nil {
+		fmt.Println("ParseFSDir:", err)
+		return
+	}
+	pkg, err := cl.NewPackage("", pkgs["main"], &cl.Config{Fset: fset, NoFileLine: true})
+	if err != nil {
+		fmt.Println("NewPackage:", err)
+		return
+	}
+	gox.WriteTo(os.Stdout, pkg, false)
+	// Output:
+	// package main
+	//
+	// import fmt "fmt"
+	//
+	// func greet(name string) string {
+	// 	return "Hello, " + name
+	// }
+	// func main() {
+	// 	fmt.Println(greet("Go+"))
+	// }
+}
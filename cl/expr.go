@@ -86,6 +86,7 @@ func compileIdent(ctx *blockCtx, ident *ast.Ident, flags int) *gox.PkgRef {
 			if recv := sig.Recv(); recv != nil {
 				ctx.cb.Val(recv)
 				if compileMember(ctx, ident, name, flags) == nil { // class member object
+					ctx.recordMember(ident, recv.Type())
 					return nil
 				}
 				ctx.cb.InternalStack().PopN(1)
@@ -128,7 +129,9 @@ func compileIdent(ctx *blockCtx, ident *ast.Ident, flags int) *gox.PkgRef {
 	}
 
 find:
+	ctx.recordUse(ident, o)
 	if fvalue {
+		ctx.useLocal(o)
 		ctx.cb.Val(o, ident)
 	} else {
 		ctx.cb.VarRef(o, ident)
@@ -227,6 +230,7 @@ func compileExpr(ctx *blockCtx, expr ast.Expr, twoValue ...bool) {
 	default:
 		log.Panicln("compileExpr failed: unknown -", reflect.TypeOf(v))
 	}
+	ctx.recordType(expr)
 }
 
 func compileExprOrNone(ctx *blockCtx, expr ast.Expr) {
@@ -299,7 +303,9 @@ func compileSelectorExprLHS(ctx *blockCtx, v *ast.SelectorExpr) {
 	default:
 		compileExpr(ctx, v.X)
 	}
+	x := ctx.cb.Get(-1).Type
 	ctx.cb.MemberRef(v.Sel.Name, v)
+	ctx.recordMember(v.Sel, x)
 }
 
 func compileSelectorExpr(ctx *blockCtx, v *ast.SelectorExpr, flags int) {
@@ -317,9 +323,11 @@ func compileSelectorExpr(ctx *blockCtx, v *ast.SelectorExpr, flags int) {
 	default:
 		compileExpr(ctx, v.X)
 	}
+	x := ctx.cb.Get(-1).Type
 	if err := compileMember(ctx, v, v.Sel.Name, flags); err != nil {
 		panic(err)
 	}
+	ctx.recordMember(v.Sel, x)
 }
 
 func pkgRef(at *gox.PkgRef, name string) (o types.Object, alias bool) {
@@ -352,6 +360,7 @@ func lookupPkgRef(ctx *blockCtx, pkg *gox.PkgRef, x *ast.Ident) (o types.Object,
 
 func compilePkgRef(ctx *blockCtx, at *gox.PkgRef, x *ast.Ident, flags int) bool {
 	if v, alias := lookupPkgRef(ctx, at, x); v != nil {
+		ctx.recordUse(x, v)
 		cb := ctx.cb
 		if (flags & clIdentLHS) != 0 {
 			cb.VarRef(v, x)
@@ -551,9 +560,25 @@ func compileBasicLit(ctx *blockCtx, v *ast.BasicLit) {
 		ctx.cb.UntypedBigInt(bi, v)
 		return
 	}
+	if isGo113NumberLit(v) {
+		ctx.checkGoVersion(v.Pos(), "binary, octal, hex-float or _-separated number literal", 13)
+	}
 	ctx.cb.Val(&goast.BasicLit{Kind: gotoken.Token(v.Kind), Value: v.Value}, v)
 }
 
+// isGo113NumberLit checks if v uses the number literal syntax introduced by go1.13.
+func isGo113NumberLit(v *ast.BasicLit) bool {
+	switch v.Kind {
+	case token.INT, token.FLOAT, token.IMAG:
+		val := strings.ToLower(v.Value)
+		if strings.Contains(val, "_") || strings.HasPrefix(val, "0b") || strings.HasPrefix(val, "0o") {
+			return true
+		}
+		return strings.HasPrefix(val, "0x") && strings.ContainsAny(val, ".p")
+	}
+	return false
+}
+
 const (
 	compositeLitVal    = 0
 	compositeLitKeyVal = 1
@@ -597,12 +622,13 @@ func compileCompositeLitElts(ctx *blockCtx, elts []ast.Expr, kind int, expected
 func compileStructLitInKeyVal(ctx *blockCtx, elts []ast.Expr, t *types.Struct, typ types.Type) {
 	for _, elt := range elts {
 		kv := elt.(*ast.KeyValueExpr)
-		name := kv.Key.(*ast.Ident).Name
-		idx := lookupField(t, name)
+		key := kv.Key.(*ast.Ident)
+		idx := lookupField(t, key.Name)
 		if idx >= 0 {
+			ctx.recordUse(key, t.Field(idx))
 			ctx.cb.Val(idx)
 		} else {
-			log.Panicln("TODO: struct member not found -", name)
+			log.Panicln("TODO: struct member not found -", key.Name)
 		}
 		switch expr := kv.Value.(type) {
 		case *ast.LambdaExpr, *ast.LambdaExpr2:
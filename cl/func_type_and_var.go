@@ -34,7 +34,9 @@ import (
 func toFuncType(ctx *blockCtx, typ *ast.FuncType, recv *types.Var) *types.Signature {
 	params, variadic := toParams(ctx, typ.Params.List)
 	results := toResults(ctx, typ.Results)
-	return types.NewSignature(recv, params, results, variadic)
+	sig := types.NewSignature(recv, params, results, variadic)
+	ctx.recordParams(typ, sig)
+	return sig
 }
 
 func toRecv(ctx *blockCtx, recv *ast.FieldList) *types.Var {
@@ -43,7 +45,11 @@ func toRecv(ctx *blockCtx, recv *ast.FieldList) *types.Var {
 	if len(v.Names) > 0 {
 		name = v.Names[0].Name
 	}
-	return ctx.pkg.NewParam(v.Pos(), name, toType(ctx, v.Type))
+	ret := ctx.pkg.NewParam(v.Pos(), name, toType(ctx, v.Type))
+	if len(v.Names) > 0 {
+		ctx.recordDef(v.Names[0], ret)
+	}
+	return ret
 }
 
 func getRecvTypeName(ctx *pkgCtx, recv *ast.FieldList, handleErr bool) (string, bool) {
@@ -149,6 +155,7 @@ func toExternalType(ctx *blockCtx, v *ast.SelectorExpr) types.Type {
 	if pr, ok := ctx.findImport(name); ok {
 		o := pr.TryRef(v.Sel.Name)
 		if t, ok := o.(*types.TypeName); ok {
+			ctx.recordUse(v.Sel, t)
 			return t.Type()
 		}
 		panic(ctx.newCodeErrorf(v.Pos(), "%s.%s is not a type", name, v.Sel.Name))
@@ -171,10 +178,12 @@ func toIdentType(ctx *blockCtx, ident *ast.Ident) types.Type {
 		panic(ctx.newCodeErrorf(ident.Pos(), "use of builtin %s not in function call", ident.Name))
 	}
 	if t, ok := v.(*types.TypeName); ok {
+		ctx.recordUse(ident, t)
 		return t.Type()
 	}
 	if v, _ := lookupPkgRef(ctx, nil, ident); v != nil {
 		if t, ok := v.(*types.TypeName); ok {
+			ctx.recordUse(ident, t)
 			return t.Type()
 		}
 	}
@@ -214,13 +223,14 @@ func toStructType(ctx *blockCtx, v *ast.StructType) *types.Struct {
 		if field.Names == nil { // embedded
 			fld := types.NewField(token.NoPos, pkg, getTypeName(typ), typ, true)
 			fields = append(fields, fld)
-			tags = append(tags, toFieldTag(field.Tag))
+			tags = append(tags, toFieldTag(field.Tag)) // embedded fields aren't tagged, see Config.StructTags
 			continue
 		}
 		for _, name := range field.Names {
-			fld := types.NewField(token.NoPos, pkg, name.Name, typ, false)
+			fld := types.NewField(name.Pos(), pkg, name.Name, typ, false)
+			ctx.recordDef(name, fld)
 			fields = append(fields, fld)
-			tags = append(tags, toFieldTag(field.Tag))
+			tags = append(tags, ctx.structTag(name.Name, toFieldTag(field.Tag)))
 		}
 	}
 	return types.NewStruct(fields, tags)
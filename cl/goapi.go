@@ -0,0 +1,385 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl
+
+import (
+	"bytes"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/token"
+	"github.com/goplus/gox"
+)
+
+// -----------------------------------------------------------------------------
+
+// synthesizedPrefix is the prefix of the names synthesized by Go+, eg. the
+// operator method Gop_Add, or the type builtin.Gop_bigint of bigint.
+const synthesizedPrefix = "Gop_"
+
+// checkGoAPI reports the exported declarations of pkg whose Go API isn't the
+// one declared in Go+, as names synthesized by Go+ appear in it (see
+// Config.GoAPI): operator methods, and synthesized types in signatures, types
+// of vars and exported fields, and underlying types.
+func (p *pkgCtx) checkGoAPI(pkg *types.Package) {
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		o := scope.Lookup(name)
+		if !o.Exported() {
+			continue
+		}
+		t, ok := o.(*types.TypeName)
+		if !ok {
+			p.checkGoAPIType(o.Pos(), objKind(o)+" "+name, o.Type())
+			continue
+		}
+		named, ok := t.Type().(*types.Named)
+		if t.IsAlias() || !ok {
+			p.checkGoAPIType(o.Pos(), "type "+name, t.Type())
+			continue
+		}
+		switch u := named.Underlying().(type) {
+		case *types.Struct:
+			for i, n := 0, u.NumFields(); i < n; i++ {
+				if fld := u.Field(i); fld.Exported() {
+					p.checkGoAPIType(fld.Pos(), "field "+name+"."+fld.Name(), fld.Type())
+				}
+			}
+		case *types.Interface:
+			for i, n := 0, u.NumExplicitMethods(); i < n; i++ {
+				if m := u.ExplicitMethod(i); m.Exported() {
+					p.checkGoAPIType(m.Pos(), "method "+name+"."+m.Name(), m.Type())
+				}
+			}
+		default:
+			p.checkGoAPIType(o.Pos(), "type "+name, u)
+		}
+		for i, n := 0, named.NumMethods(); i < n; i++ {
+			m := named.Method(i)
+			if !m.Exported() {
+				continue
+			}
+			if strings.HasPrefix(m.Name(), synthesizedPrefix) {
+				pos := p.Position(m.Pos())
+				p.handleCodeErrorf(&pos, "exported method %s.%s is synthesized by Go+ for an operator", name, m.Name())
+				continue
+			}
+			p.checkGoAPIType(m.Pos(), "method "+name+"."+m.Name(), m.Type())
+		}
+	}
+}
+
+func (p *pkgCtx) checkGoAPIType(at token.Pos, what string, typ types.Type) {
+	if o := synthesizedType(typ); o != nil {
+		pos := p.Position(at)
+		p.handleCodeErrorf(&pos, "exported %s refers to %s.%s synthesized by Go+", what, o.Pkg().Name(), o.Name())
+	}
+}
+
+func objKind(o types.Object) string {
+	switch o.(type) {
+	case *types.Func:
+		return "func"
+	case *types.Const:
+		return "const"
+	default:
+		return "var"
+	}
+}
+
+// synthesizedType returns the first named type synthesized by Go+ which typ
+// refers to, or nil if there is none. Named types which aren't synthesized are
+// checked by their declarations, if needed, so they aren't looked into.
+func synthesizedType(typ types.Type) *types.TypeName {
+	switch t := typ.(type) {
+	case *types.Named:
+		if o := t.Obj(); o.Pkg() != nil && strings.HasPrefix(o.Name(), synthesizedPrefix) {
+			return o
+		}
+	case *types.Pointer:
+		return synthesizedType(t.Elem())
+	case *types.Slice:
+		return synthesizedType(t.Elem())
+	case *types.Array:
+		return synthesizedType(t.Elem())
+	case *types.Chan:
+		return synthesizedType(t.Elem())
+	case *types.Map:
+		if o := synthesizedType(t.Key()); o != nil {
+			return o
+		}
+		return synthesizedType(t.Elem())
+	case *types.Signature:
+		if o := synthesizedTuple(t.Params()); o != nil {
+			return o
+		}
+		return synthesizedTuple(t.Results())
+	case *types.Struct:
+		for i, n := 0, t.NumFields(); i < n; i++ {
+			if o := synthesizedType(t.Field(i).Type()); o != nil {
+				return o
+			}
+		}
+	case *types.Interface:
+		for i, n := 0, t.NumEmbeddeds(); i < n; i++ {
+			if o := synthesizedType(t.EmbeddedType(i)); o != nil {
+				return o
+			}
+		}
+		for i, n := 0, t.NumExplicitMethods(); i < n; i++ {
+			if o := synthesizedType(t.ExplicitMethod(i).Type()); o != nil {
+				return o
+			}
+		}
+	}
+	return nil
+}
+
+func synthesizedTuple(t *types.Tuple) *types.TypeName {
+	for i, n := 0, t.Len(); i < n; i++ {
+		if o := synthesizedType(t.At(i).Type()); o != nil {
+			return o
+		}
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+const (
+	// docDirective and commentDirective carry a comment of a const/var spec,
+	// a struct field or an interface method to WriteTo, which moves it there
+	// (see goAPIDocs), as gox prints the comments of top-level declarations
+	// only. They are followed by the name of the spec, or Type.Member, and the
+	// quoted comment.
+	docDirective     = "//gop:doc "
+	commentDirective = "//gop:comment "
+)
+
+type docs struct {
+	doc, comment *ast.CommentGroup
+}
+
+// copyDocs carries over the comments of consts, vars, struct fields and
+// interface methods declared in pkg onto the Go declarations of p, as they
+// are documentation of the Go API (see Config.GoAPI). The doc comments of
+// types and funcs are always carried over.
+func copyDocs(p *gox.Package, pkg *ast.Package) {
+	decls := make(map[string]*ast.CommentGroup) // first name => doc of the const/var declaration
+	specs := make(map[string]docs)              // first name of a const/var spec, or Type.Member
+	for _, f := range pkg.Files {
+		for _, decl := range f.Decls {
+			d, ok := decl.(*ast.GenDecl)
+			if !ok || len(d.Specs) == 0 {
+				continue
+			}
+			switch d.Tok {
+			case token.CONST, token.VAR:
+				if d.Doc != nil {
+					decls[d.Specs[0].(*ast.ValueSpec).Names[0].Name] = d.Doc
+				}
+				for _, spec := range d.Specs {
+					v := spec.(*ast.ValueSpec)
+					specs[v.Names[0].Name] = docs{v.Doc, v.Comment}
+				}
+			case token.TYPE:
+				for _, spec := range d.Specs {
+					t := spec.(*ast.TypeSpec)
+					var list *ast.FieldList
+					switch v := t.Type.(type) {
+					case *ast.StructType:
+						list = v.Fields
+					case *ast.InterfaceType:
+						list = v.Methods
+					default:
+						continue
+					}
+					for _, fld := range list.List {
+						for _, name := range fld.Names {
+							specs[t.Name.Name+"."+name.Name] = docs{fld.Doc, fld.Comment}
+						}
+					}
+				}
+			}
+		}
+	}
+	for _, decl := range gox.ASTFile(p, false).Decls {
+		d, ok := decl.(*goast.GenDecl)
+		if !ok {
+			continue
+		}
+		var marks []*goast.Comment
+		mark := func(key string, c docs) {
+			marks = appendDocMarks(marks, docDirective, key, c.doc)
+			marks = appendDocMarks(marks, commentDirective, key, c.comment)
+		}
+		for _, spec := range d.Specs {
+			switch v := spec.(type) {
+			case *goast.ValueSpec:
+				name := v.Names[0].Name
+				if doc, ok := decls[name]; ok && d.Doc == nil {
+					d.Doc = &goast.CommentGroup{List: unpositioned(doc)}
+				}
+				mark(name, specs[name])
+			case *goast.TypeSpec:
+				var list *goast.FieldList
+				switch t := v.Type.(type) {
+				case *goast.StructType:
+					list = t.Fields
+				case *goast.InterfaceType:
+					list = t.Methods
+				default:
+					continue
+				}
+				for _, fld := range list.List {
+					if len(fld.Names) > 0 {
+						key := v.Name.Name + "." + fld.Names[0].Name
+						mark(key, specs[key])
+					}
+				}
+			}
+		}
+		if marks != nil {
+			if d.Doc == nil {
+				d.Doc = &goast.CommentGroup{}
+			}
+			d.Doc.List = append(d.Doc.List, marks...)
+		}
+	}
+}
+
+func appendDocMarks(marks []*goast.Comment, directive, key string, c *ast.CommentGroup) []*goast.Comment {
+	if c != nil {
+		for _, v := range c.List {
+			marks = append(marks, &goast.Comment{Text: directive + key + " " + strconv.Quote(v.Text)})
+		}
+	}
+	return marks
+}
+
+// unpositioned returns a copy of the comments c without positions, as the Go
+// code generated by gox has none.
+func unpositioned(c *ast.CommentGroup) []*goast.Comment {
+	ret := make([]*goast.Comment, len(c.List))
+	for i, v := range c.List {
+		ret[i] = &goast.Comment{Text: v.Text}
+	}
+	return ret
+}
+
+// goAPIDocs moves the comments carried by the directives of copyDocs in Go
+// code src to the const/var specs, struct fields and interface methods they
+// belong to, and removes the directives.
+func goAPIDocs(src []byte) []byte {
+	if !bytes.Contains(src, []byte(docDirective)) && !bytes.Contains(src, []byte(commentDirective)) {
+		return src
+	}
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "gop_autogen.go", src, goparser.ParseComments)
+	if err != nil {
+		return src
+	}
+	var edits []textEdit
+	offset := func(pos gotoken.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	docs := make(map[string][]string)
+	comments := make(map[string][]string)
+	for _, g := range f.Comments {
+		for _, c := range g.List {
+			var m map[string][]string
+			var rest string
+			if strings.HasPrefix(c.Text, docDirective) {
+				m, rest = docs, c.Text[len(docDirective):]
+			} else if strings.HasPrefix(c.Text, commentDirective) {
+				m, rest = comments, c.Text[len(commentDirective):]
+			} else {
+				continue
+			}
+			start, end := offset(c.Pos()), offset(c.End())
+			for start > 0 && (src[start-1] == ' ' || src[start-1] == '\t') {
+				start--
+			}
+			if end < len(src) && src[end] == '\n' {
+				end++
+			}
+			edits = append(edits, textEdit{start: start, end: end})
+			if pos := strings.IndexByte(rest, ' '); pos > 0 {
+				if text, err := strconv.Unquote(rest[pos+1:]); err == nil {
+					m[rest[:pos]] = append(m[rest[:pos]], text)
+				}
+			}
+		}
+	}
+	move := func(key string, node goast.Node) {
+		if list := docs[key]; list != nil {
+			pos := offset(node.Pos())
+			start := bytes.LastIndexByte(src[:pos], '\n') + 1
+			var b strings.Builder
+			for _, text := range list {
+				b.Write(src[start:pos]) // indentation
+				b.WriteString(text)
+				b.WriteByte('\n')
+			}
+			edits = append(edits, textEdit{start: start, end: start, text: b.String()})
+		}
+		if list := comments[key]; list != nil {
+			end := offset(node.End())
+			if i := bytes.IndexByte(src[end:], '\n'); i >= 0 {
+				end += i
+			} else {
+				end = len(src)
+			}
+			edits = append(edits, textEdit{start: end, end: end, text: " " + strings.Join(list, " ")})
+		}
+	}
+	for _, decl := range f.Decls {
+		d, ok := decl.(*goast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range d.Specs {
+			switch v := spec.(type) {
+			case *goast.ValueSpec:
+				move(v.Names[0].Name, v)
+			case *goast.TypeSpec:
+				var list *goast.FieldList
+				switch t := v.Type.(type) {
+				case *goast.StructType:
+					list = t.Fields
+				case *goast.InterfaceType:
+					list = t.Methods
+				default:
+					continue
+				}
+				for _, fld := range list.List {
+					if len(fld.Names) > 0 {
+						move(v.Name.Name+"."+fld.Names[0].Name, fld)
+					}
+				}
+			}
+		}
+	}
+	return applyEdits(src, edits)
+}
+
+// -----------------------------------------------------------------------------
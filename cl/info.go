@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl
+
+import (
+	"go/constant"
+	"go/types"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/token"
+	"github.com/goplus/gox"
+)
+
+// -----------------------------------------------------------------------------
+
+// Info holds type information of a compiled Go+ package. It's like types.Info,
+// but keyed by nodes of the Go+ AST, so positions of the nodes are positions
+// in the original Go+ files.
+//
+// The type-checked package itself is the Types field of the *gox.Package
+// returned by NewPackage.
+type Info struct {
+	// Types maps expressions to their types, and for constant expressions,
+	// also their values.
+	Types map[ast.Expr]types.TypeAndValue
+
+	// Defs maps identifiers to the objects they define. Identifiers
+	// synthesized by the compiler (eg. the receiver of methods in class
+	// files) are not recorded, but class fields and methods are.
+	Defs map[*ast.Ident]types.Object
+
+	// Uses maps identifiers to the objects they denote. In class files,
+	// an identifier referring to a class member maps to the field or method.
+	Uses map[*ast.Ident]types.Object
+}
+
+// TypeOf returns the type of expression e, or nil if not found.
+func (info *Info) TypeOf(e ast.Expr) types.Type {
+	if t, ok := info.Types[e]; ok {
+		return t.Type
+	}
+	if id, _ := e.(*ast.Ident); id != nil {
+		if obj := info.ObjectOf(id); obj != nil {
+			return obj.Type()
+		}
+	}
+	return nil
+}
+
+// ObjectOf returns the object denoted by the identifier id, or nil if not
+// found.
+func (info *Info) ObjectOf(id *ast.Ident) types.Object {
+	if obj := info.Defs[id]; obj != nil {
+		return obj
+	}
+	return info.Uses[id]
+}
+
+// Consts returns the values of the constants declared by identifiers in Defs,
+// keyed by the identifiers. Both typed and untyped constants are included,
+// with the values they are evaluated to (eg. by iota in a const group), so
+// tools can show the values instead of the expressions declaring them.
+func (info *Info) Consts() map[*ast.Ident]constant.Value {
+	ret := make(map[*ast.Ident]constant.Value)
+	for id, obj := range info.Defs {
+		if c, ok := obj.(*types.Const); ok {
+			ret[id] = c.Val()
+		}
+	}
+	return ret
+}
+
+// -----------------------------------------------------------------------------
+
+func (p *pkgCtx) recordDef(id *ast.Ident, obj types.Object) {
+	if p.info != nil && p.info.Defs != nil && obj != nil && id.Pos() != token.NoPos {
+		p.info.Defs[id] = obj
+	}
+}
+
+func (p *pkgCtx) recordUse(id *ast.Ident, obj types.Object) {
+	if p.info != nil && p.info.Uses != nil && obj != nil {
+		p.info.Uses[id] = obj
+	}
+}
+
+// recordDefs records objects of names defined in scope.
+func (p *pkgCtx) recordDefs(scope *types.Scope, names []*ast.Ident) {
+	if p.info != nil {
+		for _, name := range names {
+			p.recordDef(name, scope.Lookup(name.Name))
+		}
+	}
+}
+
+// recordParams records the parameters and results of sig defined by typ.
+func (p *pkgCtx) recordParams(typ *ast.FuncType, sig *types.Signature) {
+	if p.info == nil {
+		return
+	}
+	recordVars := func(in *ast.FieldList, vars *types.Tuple) {
+		if in == nil || vars == nil {
+			return
+		}
+		i := 0
+		for _, fld := range in.List {
+			if len(fld.Names) == 0 {
+				i++
+				continue
+			}
+			for _, name := range fld.Names {
+				if i < vars.Len() {
+					p.recordDef(name, vars.At(i))
+				}
+				i++
+			}
+		}
+	}
+	recordVars(typ.Params, sig.Params())
+	recordVars(typ.Results, sig.Results())
+}
+
+// lookupLocals returns objects of names already declared in the current block,
+// before a define statement (:=) redeclares them.
+func (p *blockCtx) lookupLocals(names []ast.Expr) []types.Object {
+	if p.info == nil {
+		return nil
+	}
+	scope := p.cb.Scope()
+	olds := make([]types.Object, len(names))
+	for i, name := range names {
+		if id, ok := name.(*ast.Ident); ok {
+			olds[i] = scope.Lookup(id.Name)
+		}
+	}
+	return olds
+}
+
+// recordLocals records names defined by a define statement (:=) or a range
+// clause, and starts to check if they are used. Names redeclared (see
+// lookupLocals) are recorded as uses.
+func (p *blockCtx) recordLocals(names []ast.Expr, olds []types.Object) {
+	scope := p.cb.Scope()
+	for i, name := range names {
+		id, ok := name.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		if olds != nil && olds[i] != nil {
+			p.recordUse(id, olds[i])
+		} else {
+			_, o := scope.LookupParent(id.Name, token.NoPos)
+			p.recordDef(id, o)
+			p.defineLocal(id, o) // a redeclared one is checked since it's defined
+		}
+	}
+}
+
+// recordType records the type of expr, which is on the top of the stack.
+func (p *blockCtx) recordType(expr ast.Expr) {
+	if p.info == nil || p.info.Types == nil {
+		return
+	}
+	if e := p.cb.Get(-1); e != nil && e.Type != nil {
+		typ := e.Type
+		if t, ok := typ.(*gox.TypeType); ok {
+			typ = t.Type()
+		}
+		p.info.Types[expr] = types.TypeAndValue{Type: typ, Value: e.CVal}
+	}
+}
+
+// recordMember records the field or method name of typ used by sel.
+func (p *blockCtx) recordMember(sel *ast.Ident, typ types.Type) {
+	if p.info == nil || typ == nil {
+		return
+	}
+	if t, ok := typ.(*gox.TypeType); ok { // method expression
+		typ = t.Type()
+	}
+	switch typ.(type) {
+	case *types.Named, *types.Pointer, *types.Struct, *types.Interface:
+	default: // types of gox instructions, overload funcs, etc.
+		return
+	}
+	name := sel.Name
+	o, _, _ := types.LookupFieldOrMethod(typ, true, p.pkg.Types, name)
+	if o == nil {
+		if c := name[0]; c >= 'a' && c <= 'z' { // method alias, eg. println => Println
+			name = string(rune(c)+('A'-'a')) + name[1:]
+			o, _, _ = types.LookupFieldOrMethod(typ, true, p.pkg.Types, name)
+		}
+	}
+	p.recordUse(sel, o)
+}
+
+// -----------------------------------------------------------------------------
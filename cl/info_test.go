@@ -0,0 +1,258 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl_test
+
+import (
+	"go/types"
+	"sort"
+	"testing"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/cl"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/parser/parsertest"
+)
+
+func newInfo() *cl.Info {
+	return &cl.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+}
+
+func compileWithInfo(t *testing.T, fs parser.FileSystem) (*types.Package, *cl.Info) {
+	cl.SetDisableRecover(true)
+	defer cl.SetDisableRecover(false)
+
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("parser.ParseFSDir failed:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.Info = newInfo()
+	pkg, err := cl.NewPackage("", pkgs["main"], &conf)
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	return pkg.Types, conf.Info
+}
+
+// lookupIdent returns the nth identifier named name in m, in order of
+// positions, and the object it maps to.
+func lookupIdent(m map[*ast.Ident]types.Object, name string, nth int) (*ast.Ident, types.Object) {
+	var idents []*ast.Ident
+	for id := range m {
+		if id.Name == name {
+			idents = append(idents, id)
+		}
+	}
+	sort.Slice(idents, func(i, j int) bool {
+		return idents[i].Pos() < idents[j].Pos()
+	})
+	if nth < len(idents) {
+		return idents[nth], m[idents[nth]]
+	}
+	return nil, nil
+}
+
+func TestInfo(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `type Foo struct {
+	X int
+}
+
+func (p *Foo) Get() int {
+	return p.X
+}
+
+const N = 10
+
+func main() {
+	a := &Foo{X: N}
+	println a.Get()
+}
+`)
+	pkg, info := compileWithInfo(t, fs)
+	if o := pkg.Scope().Lookup("Foo"); o == nil {
+		t.Fatal("Foo not found")
+	}
+
+	id, o := lookupIdent(info.Defs, "Foo", 0)
+	if _, ok := o.(*types.TypeName); !ok || o != pkg.Scope().Lookup("Foo") {
+		t.Fatal("Defs[Foo]:", o)
+	}
+	if pos := gblFset.Position(id.Pos()); pos.Filename != "/foo/bar.gop" || pos.Line != 1 || pos.Column != 6 {
+		t.Fatal("Defs[Foo] position:", pos)
+	}
+	_, x := lookupIdent(info.Defs, "X", 0)
+	if v, ok := x.(*types.Var); !ok || !v.IsField() {
+		t.Fatal("Defs[X]:", x)
+	}
+	_, get := lookupIdent(info.Defs, "Get", 0)
+	if fn, ok := get.(*types.Func); !ok || fn.Type().(*types.Signature).Recv() == nil {
+		t.Fatal("Defs[Get]:", get)
+	}
+	_, p := lookupIdent(info.Defs, "p", 0)
+	if _, ok := p.(*types.Var); !ok {
+		t.Fatal("Defs[p]:", p)
+	}
+	_, a := lookupIdent(info.Defs, "a", 0)
+	if _, ok := a.(*types.Var); !ok {
+		t.Fatal("Defs[a]:", a)
+	}
+	if _, o := lookupIdent(info.Defs, "N", 0); o != pkg.Scope().Lookup("N") {
+		t.Fatal("Defs[N]:", o)
+	}
+
+	if _, o := lookupIdent(info.Uses, "X", 0); o != x {
+		t.Fatal("Uses[X]:", o)
+	}
+	if _, o := lookupIdent(info.Uses, "X", 1); o != x { // key of the struct literal
+		t.Fatal("Uses[X]:", o)
+	}
+	if _, o := lookupIdent(info.Uses, "p", 0); o != p {
+		t.Fatal("Uses[p]:", o)
+	}
+	if _, o := lookupIdent(info.Uses, "a", 0); o != a {
+		t.Fatal("Uses[a]:", o)
+	}
+	if _, o := lookupIdent(info.Uses, "Get", 0); o != get {
+		t.Fatal("Uses[Get]:", o)
+	}
+	id, n := lookupIdent(info.Uses, "N", 0)
+	if n != pkg.Scope().Lookup("N") {
+		t.Fatal("Uses[N]:", n)
+	}
+	if tv, ok := info.Types[id]; !ok || tv.Value == nil || tv.Value.ExactString() != "10" {
+		t.Fatal("Types[N]:", tv)
+	}
+	if typ := info.TypeOf(id); typ == nil || typ.String() != "untyped int" {
+		t.Fatal("TypeOf(N):", typ)
+	}
+}
+
+func TestInfoConsts(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `type Weekday int
+
+const (
+	Sunday Weekday = iota
+	Monday
+	Tuesday
+)
+
+const (
+	KB = 1 << (10 * (iota + 1))
+	MB
+)
+
+const Greeting = "Hello, " + "Go+"
+const Pi float64 = 3.14
+
+func main() {
+	const local = KB * 2
+	println local, Pi, Greeting, Monday, MB
+}
+`)
+	pkg, info := compileWithInfo(t, fs)
+	consts := info.Consts()
+	values := make(map[string]string)
+	for id, val := range consts {
+		values[id.Name] = val.String()
+	}
+	expected := map[string]string{
+		"Sunday": "0", "Monday": "1", "Tuesday": "2", "KB": "1024", "MB": "1048576",
+		"Greeting": `"Hello, Go+"`, "Pi": "3.14", "local": "2048",
+	}
+	if len(values) != len(expected) {
+		t.Fatal("Consts:", values)
+	}
+	for name, val := range expected {
+		if values[name] != val {
+			t.Fatal("Consts:", name, values[name])
+		}
+	}
+	scope := pkg.Scope()
+	if typ := scope.Lookup("Monday").Type(); typ != scope.Lookup("Weekday").Type() {
+		t.Fatal("type of Monday:", typ)
+	}
+	if typ := scope.Lookup("KB").Type(); typ != types.Typ[types.UntypedInt] {
+		t.Fatal("type of KB:", typ)
+	}
+}
+
+func TestInfoClassFile(t *testing.T) {
+	fs := newMultiFileFS("/foo", "Game.tgmx", `
+var (
+	Score int
+)
+
+func onInit() {
+	Score = 1
+}
+`, "Kai.tspx", `
+var (
+	speed int
+)
+
+func onMsg(msg string) {
+	speed = Score
+	say "Hi"
+}
+`)
+	pkg, info := compileWithInfo(t, fs)
+	kai := pkg.Scope().Lookup("Kai")
+	if kai == nil {
+		t.Fatal("class Kai not found")
+	}
+
+	id, speed := lookupIdent(info.Defs, "speed", 0)
+	if v, ok := speed.(*types.Var); !ok || !v.IsField() {
+		t.Fatal("Defs[speed]:", speed)
+	}
+	if pos := gblFset.Position(id.Pos()); pos.Filename != "/foo/Kai.tspx" || pos.Line != 3 {
+		t.Fatal("Defs[speed] position:", pos)
+	}
+	if o, _, _ := types.LookupFieldOrMethod(kai.Type(), true, pkg, "speed"); o != speed {
+		t.Fatal("Kai.speed:", o)
+	}
+	_, onMsg := lookupIdent(info.Defs, "onMsg", 0)
+	if fn, ok := onMsg.(*types.Func); !ok || fn.Type().(*types.Signature).Recv() == nil {
+		t.Fatal("Defs[onMsg]:", onMsg)
+	}
+	if _, o := lookupIdent(info.Defs, "msg", 0); o == nil {
+		t.Fatal("Defs[msg] not found")
+	}
+	for id := range info.Defs {
+		if id.Name == "this" {
+			t.Fatal("synthesized receiver is recorded:", gblFset.Position(id.Pos()))
+		}
+	}
+
+	if _, o := lookupIdent(info.Uses, "speed", 0); o != speed {
+		t.Fatal("Uses[speed]:", o)
+	}
+	_, score := lookupIdent(info.Defs, "Score", 0)
+	if _, o := lookupIdent(info.Uses, "Score", 0); o == nil || o != score {
+		t.Fatal("Uses[Score] (in Game.tgmx):", o, score)
+	}
+	if _, o := lookupIdent(info.Uses, "Score", 1); o == nil || o != score {
+		t.Fatal("Uses[Score] (in Kai.tspx):", o, score)
+	}
+	if _, o := lookupIdent(info.Uses, "say", 0); o == nil || o.Name() != "Say" {
+		t.Fatal("Uses[say]:", o)
+	}
+}
@@ -0,0 +1,896 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl
+
+import (
+	"bytes"
+	goast "go/ast"
+	"go/format"
+	goparser "go/parser"
+	gotoken "go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gox"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// -----------------------------------------------------------------------------
+
+const (
+	// inlineMaxNodes is the max size of the expression returned by a function
+	// to inline, in number of AST nodes.
+	inlineMaxNodes = 16
+
+	// inlineDirective marks a function of the generated code to inline by
+	// WriteTo, see Config.InlineFuncs.
+	inlineDirective = "//gop:inline"
+)
+
+// markInlineFuncs marks the functions of pkg which may be inlined, as it's
+// done by WriteTo, in the code printed by gox. Functions named in keep aren't,
+// see goFileNames.
+func markInlineFuncs(pkg *gox.Package, keep map[string]bool) {
+	for _, decl := range gox.ASTFile(pkg, false).Decls {
+		fn, ok := decl.(*goast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Body == nil || len(fn.Body.List) != 1 || fn.Name.IsExported() {
+			continue
+		}
+		if keep[fn.Name.Name] {
+			continue
+		}
+		if _, ok := fn.Body.List[0].(*goast.ReturnStmt); !ok {
+			continue
+		}
+		if fn.Doc == nil {
+			fn.Doc = &goast.CommentGroup{}
+		}
+		fn.Doc.List = append(fn.Doc.List, &goast.Comment{Text: inlineDirective})
+	}
+}
+
+// goFileNames returns the names referred to by the Go files of pkg, and the Go
+// files of the package in targetDir not generated by Go+, which are built with
+// the generated code. A function they may call must be kept, so it isn't
+// inlined.
+func goFileNames(pkg *ast.Package, targetDir string) map[string]bool {
+	names := make(map[string]bool)
+	for _, f := range pkg.Files {
+		if f.FileType == ast.FileTypeGo {
+			ast.Inspect(f, func(node ast.Node) bool {
+				if id, ok := node.(*ast.Ident); ok {
+					names[id.Name] = true
+				}
+				return true
+			})
+		}
+	}
+	fis, _ := os.ReadDir(targetDir)
+	fset := gotoken.NewFileSet()
+	for _, fi := range fis {
+		fname := fi.Name()
+		if fi.IsDir() || filepath.Ext(fname) != ".go" || strings.HasPrefix(fname, "gop_autogen") {
+			continue
+		}
+		f, err := goparser.ParseFile(fset, filepath.Join(targetDir, fname), nil, 0)
+		if err != nil || f.Name.Name != pkg.Name {
+			continue
+		}
+		goast.Inspect(f, func(node goast.Node) bool {
+			if id, ok := node.(*goast.Ident); ok {
+				names[id.Name] = true
+			}
+			return true
+		})
+	}
+	return names
+}
+
+// inlineFunc is a function to inline: `func f(params) T { return result }`.
+type inlineFunc struct {
+	decl    *goast.FuncDecl
+	params  []*types.Var    // nil if the parameter has no name
+	ptypes  []goast.Expr    // types of params
+	rtype   goast.Expr      // type of the result
+	result  goast.Expr      // the expression returned
+	free    map[string]bool // names of the package, file or universe scope it refers to
+	hasCall bool            // result calls a function (but not a conversion or a pure builtin)
+	inlined int             // number of calls inlined
+}
+
+type inliner struct {
+	fset     *gotoken.FileSet
+	info     *types.Info
+	pkgScope *types.Scope
+	funcs    map[*types.Func]*inlineFunc
+	edits    []textEdit
+}
+
+// textEdit replaces src[start:end] with text.
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// inlineFuncs inlines calls of the functions marked by markInlineFuncs in Go
+// code src of pkg, for readability. The code is type-checked by go/types to
+// do it safely, and it's conservative: a function is inlined only if it just
+// returns a small expression, which has no closures, recursion, or taking
+// address of parameters. A call is inlined only if its arguments are variables
+// or literals, so they can be evaluated as many times as the parameters are
+// used, and the names the function refers to aren't redefined by the caller.
+// As Go doesn't specify when a variable operand is read relative to calls of
+// the same expression, a call with an argument of a variable which calls may
+// change isn't inlined either if the expression or statement has other calls
+// or receives, nor with any variable if it's assigned to (see unordered).
+// Arguments and the result are converted if their types are different from
+// the ones of the function. A function whose calls are all inlined is removed,
+// and the marks of the others are removed.
+func inlineFuncs(src []byte, pkg *gox.Package) []byte {
+	if !bytes.Contains(src, []byte(inlineDirective)) {
+		return src
+	}
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "gop_autogen.go", src, goparser.ParseComments)
+	if err != nil {
+		return src
+	}
+	p := &inliner{fset: fset, funcs: make(map[*types.Func]*inlineFunc)}
+	if p.check(f, pkg) {
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*goast.FuncDecl); ok && inlineMarked(fn) != nil {
+				p.addFunc(fn)
+			}
+		}
+		p.removeNested()
+		for _, decl := range f.Decls { // calls in the same file only, as imports may differ
+			p.inlineCalls(decl)
+		}
+	}
+	uses := make(map[*types.Func]int)
+	if p.info != nil {
+		for _, o := range p.info.Uses {
+			if fn, ok := o.(*types.Func); ok {
+				uses[fn]++
+			}
+		}
+	}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*goast.FuncDecl)
+		if !ok {
+			continue
+		}
+		mark := inlineMarked(fn)
+		if mark == nil {
+			continue
+		}
+		var obj *types.Func
+		if p.info != nil {
+			obj, _ = p.info.Defs[fn.Name].(*types.Func)
+		}
+		if v := p.funcs[obj]; v != nil && v.inlined > 0 && v.inlined == uses[obj] {
+			p.remove(src, fn.Doc.Pos(), fn.End())
+		} else {
+			p.remove(src, mark.Pos(), mark.End())
+		}
+	}
+	return p.apply(src)
+}
+
+// inlineMarked returns the mark of fn by markInlineFuncs, or nil if it isn't
+// marked.
+func inlineMarked(fn *goast.FuncDecl) *goast.Comment {
+	if fn.Doc != nil {
+		if c := fn.Doc.List[len(fn.Doc.List)-1]; c.Text == inlineDirective {
+			return c
+		}
+	}
+	return nil
+}
+
+// check type-checks file f of pkg, with the testing file of pkg if any, as it
+// may call the functions to inline.
+func (p *inliner) check(f *goast.File, pkg *gox.Package) bool {
+	files := []*goast.File{f}
+	if pkg.HasTestingFile() {
+		var b bytes.Buffer
+		if err := gox.WriteTo(&b, pkg, true); err != nil {
+			return false
+		}
+		testFile, err := goparser.ParseFile(p.fset, "gop_autogen_test.go", b.Bytes(), 0)
+		if err != nil {
+			return false
+		}
+		files = append(files, testFile)
+	}
+	for _, f := range files {
+		for _, spec := range f.Imports {
+			if spec.Path.Value == `"C"` { // cgo can't be type-checked here
+				return false
+			}
+		}
+	}
+	info := &types.Info{
+		Types:      make(map[goast.Expr]types.TypeAndValue),
+		Defs:       make(map[*goast.Ident]types.Object),
+		Uses:       make(map[*goast.Ident]types.Object),
+		Selections: make(map[*goast.SelectorExpr]*types.Selection),
+	}
+	conf := &types.Config{Importer: goxImporter{pkg}, Error: func(err error) {}}
+	goPkg, err := conf.Check(pkg.Types.Path(), p.fset, files, info)
+	if err != nil {
+		return false
+	}
+	p.info, p.pkgScope = info, goPkg.Scope()
+	return true
+}
+
+// remove removes the code of src from pos to end, with the newlines after it.
+func (p *inliner) remove(src []byte, pos, end gotoken.Pos) {
+	start, stop := p.fset.Position(pos).Offset, p.fset.Position(end).Offset
+	for stop < len(src) && src[stop] == '\n' {
+		stop++
+	}
+	p.edits = append(p.edits, textEdit{start: start, end: stop})
+}
+
+// apply returns src with the edits applied.
+func (p *inliner) apply(src []byte) []byte {
+	return applyEdits(src, p.edits)
+}
+
+// applyEdits returns src with edits applied, and formatted. The edits must not
+// overlap. Insertions at the same offset are applied in order.
+func applyEdits(src []byte, edits []textEdit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+	var b bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		b.Write(src[last:e.start])
+		b.WriteString(e.text)
+		last = e.end
+	}
+	b.Write(src[last:])
+	ret, err := format.Source(b.Bytes()) // the edited code isn't formatted in its context
+	if err != nil {
+		return b.Bytes()
+	}
+	return ret
+}
+
+// goxImporter imports packages of the generated code, which are loaded by pkg
+// already.
+type goxImporter struct {
+	pkg *gox.Package
+}
+
+func (p goxImporter) Import(pkgPath string) (*types.Package, error) {
+	if pkgPath == "unsafe" {
+		return types.Unsafe, nil
+	}
+	ref := p.pkg.Import(pkgPath)
+	ref.EnsureImported()
+	ref.Types.MarkComplete() // it's loaded, but go/types only uses complete ones
+	return ref.Types, nil
+}
+
+// -----------------------------------------------------------------------------
+
+func (p *inliner) addFunc(decl *goast.FuncDecl) {
+	if decl.Recv != nil || decl.Body == nil || len(decl.Body.List) != 1 || decl.Name.IsExported() {
+		return
+	}
+	switch decl.Name.Name {
+	case "main", "init", "_":
+		return
+	}
+	obj, ok := p.info.Defs[decl.Name].(*types.Func)
+	if !ok {
+		return
+	}
+	ret, ok := decl.Body.List[0].(*goast.ReturnStmt)
+	results := decl.Type.Results
+	if !ok || len(ret.Results) != 1 || results.NumFields() != 1 || len(results.List[0].Names) != 0 {
+		return
+	}
+	fn := &inlineFunc{
+		decl: decl, rtype: results.List[0].Type, result: ret.Results[0], free: make(map[string]bool),
+	}
+	for _, field := range decl.Type.Params.List {
+		if _, ok := field.Type.(*goast.Ellipsis); ok {
+			return
+		}
+		if len(field.Names) == 0 {
+			fn.params = append(fn.params, nil)
+			fn.ptypes = append(fn.ptypes, field.Type)
+			continue
+		}
+		for _, name := range field.Names {
+			v, _ := p.info.Defs[name].(*types.Var)
+			fn.params = append(fn.params, v)
+			fn.ptypes = append(fn.ptypes, field.Type)
+		}
+	}
+	if !p.checkResult(obj, fn) {
+		return
+	}
+	for _, list := range []*goast.FieldList{decl.Type.Params, decl.Type.Results} {
+		for _, field := range list.List {
+			p.addFreeNames(fn, field.Type)
+		}
+	}
+	p.funcs[obj] = fn
+}
+
+// checkResult reports whether the result of fn can be inlined, and records
+// the names it refers to.
+func (p *inliner) checkResult(obj *types.Func, fn *inlineFunc) bool {
+	n, ok := 0, true
+	var stack []goast.Node
+	goast.Inspect(fn.result, func(node goast.Node) bool {
+		if node == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if n++; n > inlineMaxNodes {
+			ok = false
+			return false
+		}
+		switch v := node.(type) {
+		case *goast.Ident:
+			if len(stack) > 0 {
+				if sel, isSel := stack[len(stack)-1].(*goast.SelectorExpr); isSel && sel.Sel == v {
+					break // a field, method, or name of an imported package
+				}
+			}
+			ok = p.checkIdent(obj, fn, v)
+		case *goast.BasicLit, *goast.BinaryExpr, *goast.ParenExpr, *goast.IndexExpr, *goast.StarExpr:
+		case *goast.UnaryExpr:
+			ok = v.Op != gotoken.AND && v.Op != gotoken.ARROW
+		case *goast.SelectorExpr:
+			ok = !p.addressesRecv(v)
+		case *goast.SliceExpr: // slicing an array parameter needs it to be addressable
+			_, isArray := p.info.TypeOf(v.X).Underlying().(*types.Array)
+			ok = !isArray
+		case *goast.CallExpr:
+			tv := p.info.Types[v.Fun]
+			if tv.IsBuiltin() {
+				id, _ := astutil.Unparen(v.Fun).(*goast.Ident)
+				ok = id != nil && pureBuiltins[id.Name]
+			} else if !tv.IsType() {
+				fn.hasCall = true
+			}
+		default:
+			ok = false
+		}
+		if !ok {
+			return false
+		}
+		stack = append(stack, node)
+		return true
+	})
+	return ok
+}
+
+// pureBuiltins are the builtin functions which have no side effects.
+var pureBuiltins = map[string]bool{
+	"len": true, "cap": true, "real": true, "imag": true, "complex": true,
+}
+
+func (p *inliner) checkIdent(obj *types.Func, fn *inlineFunc, id *goast.Ident) bool {
+	o := p.info.Uses[id]
+	if o == nil || o == types.Object(obj) {
+		return false
+	}
+	if v, ok := o.(*types.Var); ok && paramIndex(fn, v) >= 0 {
+		return true
+	}
+	if o.Parent() == nil { // not in the package, file or universe scope
+		return false
+	}
+	fn.free[id.Name] = true
+	return true
+}
+
+func (p *inliner) addFreeNames(fn *inlineFunc, typ goast.Expr) {
+	goast.Inspect(typ, func(node goast.Node) bool {
+		switch v := node.(type) {
+		case *goast.SelectorExpr:
+			p.addFreeNames(fn, v.X)
+			return false
+		case *goast.Field: // of a struct or func type
+			if v.Type != nil {
+				p.addFreeNames(fn, v.Type)
+			}
+			return false
+		case *goast.Ident:
+			if p.info.Uses[v] != nil {
+				fn.free[v.Name] = true
+			}
+		}
+		return true
+	})
+}
+
+// addressesRecv reports whether sel is a method with a pointer receiver of a
+// value, which takes address of the value implicitly.
+func (p *inliner) addressesRecv(sel *goast.SelectorExpr) bool {
+	s := p.info.Selections[sel]
+	if s == nil || s.Kind() != types.MethodVal {
+		return false
+	}
+	recv := s.Obj().Type().(*types.Signature).Recv()
+	if _, ok := recv.Type().(*types.Pointer); !ok {
+		return false
+	}
+	_, ok := s.Recv().Underlying().(*types.Pointer)
+	return !ok
+}
+
+func paramIndex(fn *inlineFunc, v *types.Var) int {
+	for i, param := range fn.params {
+		if param == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeNested removes the functions calling others to inline, so that the
+// inlined code is never inlined again.
+func (p *inliner) removeNested() {
+	var nested []*types.Func
+	for obj, fn := range p.funcs {
+		goast.Inspect(fn.result, func(node goast.Node) bool {
+			if id, ok := node.(*goast.Ident); ok {
+				if o, ok := p.info.Uses[id].(*types.Func); ok && p.funcs[o] != nil {
+					nested = append(nested, obj)
+				}
+			}
+			return true
+		})
+	}
+	for _, obj := range nested {
+		delete(p.funcs, obj)
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// inlineCalls inlines the calls in decl of the functions to inline.
+func (p *inliner) inlineCalls(decl goast.Decl) {
+	if fn, ok := decl.(*goast.FuncDecl); ok {
+		if obj, ok := p.info.Defs[fn.Name].(*types.Func); ok && p.funcs[obj] != nil {
+			return
+		}
+	}
+	var defined map[string]bool
+	var escaped map[*types.Var]bool
+	var stack []goast.Node // ancestors of the node visited
+	astutil.Apply(decl, func(c *astutil.Cursor) bool {
+		stack = append(stack, c.Node())
+		return true
+	}, func(c *astutil.Cursor) bool {
+		stack = stack[:len(stack)-1]
+		call, ok := c.Node().(*goast.CallExpr)
+		if !ok || c.Name() == "Call" { // go f(), defer f()
+			return true
+		}
+		if _, ok := c.Parent().(*goast.ExprStmt); ok {
+			return true
+		}
+		id, ok := astutil.Unparen(call.Fun).(*goast.Ident)
+		if !ok {
+			return true
+		}
+		obj, _ := p.info.Uses[id].(*types.Func)
+		fn := p.funcs[obj]
+		if fn == nil {
+			return true
+		}
+		if defined == nil {
+			defined, escaped = p.definedNames(decl), p.escapedVars(decl)
+		}
+		if expr := p.inlineCall(fn, call, stack, defined, escaped); expr != nil {
+			if needParen(expr, c) {
+				expr = &goast.ParenExpr{X: expr}
+			}
+			var b bytes.Buffer
+			if err := format.Node(&b, gotoken.NewFileSet(), expr); err != nil {
+				return true
+			}
+			start, end := p.fset.Position(call.Pos()).Offset, p.fset.Position(call.End()).Offset
+			p.edits = append(p.edits, textEdit{start: start, end: end, text: b.String()})
+			fn.inlined++
+		}
+		return true
+	})
+}
+
+// inlineCall returns the inlined code of call, or nil if it can't be inlined.
+// ancestors are the nodes containing call, from the declaration.
+func (p *inliner) inlineCall(
+	fn *inlineFunc, call *goast.CallExpr, ancestors []goast.Node,
+	defined map[string]bool, escaped map[*types.Var]bool) goast.Expr {
+	if call.Ellipsis.IsValid() || len(call.Args) != len(fn.params) {
+		return nil
+	}
+	for name := range fn.free {
+		if defined[name] {
+			return nil
+		}
+	}
+	args := make(map[*types.Var]goast.Expr, len(call.Args))
+	for i, arg := range call.Args {
+		var x goast.Expr
+		switch v := arg.(type) {
+		case *goast.Ident:
+			x = goast.NewIdent(v.Name)
+		case *goast.BasicLit:
+			lit := *v
+			x = &lit
+		default: // may have side effects
+			return nil
+		}
+		typ := p.argType(arg)
+		if typ == nil {
+			return nil
+		}
+		if p.info.Types[arg].Value == nil {
+			v, ok := p.info.Uses[arg.(*goast.Ident)].(*types.Var)
+			if fn.hasCall && (!ok || v.Parent() == p.pkgScope || escaped[v]) { // the call may change the variable, unless it's local
+				return nil
+			}
+			if ok && p.unordered(call, ancestors, v, v.Parent() == p.pkgScope || escaped[v]) {
+				return nil
+			}
+		}
+		param := fn.params[i]
+		if param == nil {
+			continue
+		}
+		if !sameType(typ, param.Type()) {
+			if x = convert(fn.ptypes[i], x); x == nil {
+				return nil
+			}
+		}
+		args[param] = x
+	}
+	ret := p.subst(fn.result, args)
+	if tv := p.info.Types[fn.result]; tv.Value != nil || p.hasUntypedShift(fn.result) {
+		// untyped constants take their types from the context
+		ret = convert(fn.rtype, ret)
+	} else if !types.Identical(tv.Type, p.info.TypeOf(fn.rtype)) {
+		ret = convert(fn.rtype, ret)
+	}
+	return ret
+}
+
+// unordered reports whether reading variable v, an argument of call, may be
+// reordered by inlining call, in the enclosing statement (or the expression
+// of a compound statement) of call: it assigns to v, or v is shared (may be
+// changed by calls) and there are other calls (but not conversions or calls
+// without side effects) or receives, whose order relative to reading a
+// variable operand Go doesn't specify.
+func (p *inliner) unordered(call *goast.CallExpr, ancestors []goast.Node, v *types.Var, shared bool) bool {
+	scope := ancestors[0]
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		if stmt, ok := ancestors[i].(goast.Stmt); ok {
+			scope = stmt
+			if !isSimpleStmt(stmt) && i+1 < len(ancestors) {
+				scope = ancestors[i+1]
+			}
+			break
+		}
+	}
+	switch stmt := scope.(type) {
+	case *goast.AssignStmt:
+		if p.refersTo(stmt.Lhs, v) {
+			return true
+		}
+	case *goast.IncDecStmt:
+		if p.refersTo([]goast.Expr{stmt.X}, v) {
+			return true
+		}
+	}
+	if !shared {
+		return false
+	}
+	found := false
+	goast.Inspect(scope, func(node goast.Node) bool {
+		switch n := node.(type) {
+		case *goast.FuncLit: // not run unless it's called
+			return false
+		case *goast.UnaryExpr:
+			found = found || n.Op == gotoken.ARROW
+		case *goast.CallExpr:
+			if n == call {
+				return false
+			}
+			for _, a := range ancestors { // called after its arguments are evaluated
+				if a == node {
+					return true
+				}
+			}
+			found = found || p.hasSideEffects(n)
+		}
+		return !found
+	})
+	return found
+}
+
+// isSimpleStmt reports whether stmt is a statement whose expressions are all
+// evaluated at once, so calls of any of them may be ordered before the others.
+func isSimpleStmt(stmt goast.Stmt) bool {
+	switch stmt.(type) {
+	case *goast.ExprStmt, *goast.AssignStmt, *goast.IncDecStmt, *goast.SendStmt,
+		*goast.ReturnStmt, *goast.GoStmt, *goast.DeferStmt, *goast.DeclStmt:
+		return true
+	}
+	return false
+}
+
+// hasSideEffects reports whether call may have side effects: it isn't a
+// conversion, a pure builtin, or a call of a function to inline without calls.
+func (p *inliner) hasSideEffects(call *goast.CallExpr) bool {
+	tv := p.info.Types[call.Fun]
+	if tv.IsType() {
+		return false
+	}
+	if id, ok := astutil.Unparen(call.Fun).(*goast.Ident); ok {
+		if tv.IsBuiltin() {
+			return !pureBuiltins[id.Name]
+		}
+		if obj, ok := p.info.Uses[id].(*types.Func); ok {
+			if fn := p.funcs[obj]; fn != nil {
+				return fn.hasCall
+			}
+		}
+	}
+	return true
+}
+
+func (p *inliner) refersTo(exprs []goast.Expr, v *types.Var) bool {
+	found := false
+	for _, x := range exprs {
+		goast.Inspect(x, func(node goast.Node) bool {
+			if id, ok := node.(*goast.Ident); ok && p.info.Uses[id] == types.Object(v) {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// argType returns the type of arg, which is a variable or literal. Unlike
+// types.Info does, an untyped constant isn't converted to the parameter type.
+func (p *inliner) argType(arg goast.Expr) types.Type {
+	switch v := arg.(type) {
+	case *goast.BasicLit:
+		switch v.Kind {
+		case gotoken.INT:
+			return types.Typ[types.UntypedInt]
+		case gotoken.FLOAT:
+			return types.Typ[types.UntypedFloat]
+		case gotoken.IMAG:
+			return types.Typ[types.UntypedComplex]
+		case gotoken.CHAR:
+			return types.Typ[types.UntypedRune]
+		case gotoken.STRING:
+			return types.Typ[types.UntypedString]
+		}
+	case *goast.Ident:
+		if o := p.info.Uses[v]; o != nil {
+			return o.Type()
+		}
+	}
+	return nil
+}
+
+// sameType reports whether an argument of type arg is passed to a parameter of
+// type param as it is. An untyped string or bool constant is, if it's of the
+// default type, as its value doesn't depend on types.
+func sameType(arg, param types.Type) bool {
+	if types.Identical(arg, param) {
+		return true
+	}
+	if t, ok := arg.(*types.Basic); ok && t.Info()&types.IsUntyped != 0 {
+		switch t.Kind() {
+		case types.UntypedString, types.UntypedBool:
+			return types.Identical(types.Default(t), param)
+		}
+	}
+	return false
+}
+
+// convert converts x to typ, or returns nil if typ isn't a (pointer to a)
+// type name.
+func convert(typ goast.Expr, x goast.Expr) goast.Expr {
+	if x == nil {
+		return nil
+	}
+	fun := typeName(typ)
+	if fun == nil {
+		if star, ok := typ.(*goast.StarExpr); ok {
+			if elem := typeName(star.X); elem != nil {
+				fun = &goast.ParenExpr{X: &goast.StarExpr{X: elem}}
+			}
+		}
+		if fun == nil {
+			return nil
+		}
+	}
+	return &goast.CallExpr{Fun: fun, Args: []goast.Expr{x}}
+}
+
+func typeName(typ goast.Expr) goast.Expr {
+	switch v := typ.(type) {
+	case *goast.Ident:
+		return goast.NewIdent(v.Name)
+	case *goast.SelectorExpr:
+		if x, ok := v.X.(*goast.Ident); ok {
+			return &goast.SelectorExpr{X: goast.NewIdent(x.Name), Sel: goast.NewIdent(v.Sel.Name)}
+		}
+	}
+	return nil
+}
+
+// hasUntypedShift reports whether expr has a non-constant shift of an untyped
+// constant, which takes its type from the context, eg. 1 << n.
+func (p *inliner) hasUntypedShift(expr goast.Expr) (ret bool) {
+	goast.Inspect(expr, func(node goast.Node) bool {
+		if v, ok := node.(*goast.BinaryExpr); ok && (v.Op == gotoken.SHL || v.Op == gotoken.SHR) {
+			if p.info.Types[v].Value == nil && p.info.Types[v.X].Value != nil {
+				ret = true
+			}
+		}
+		return !ret
+	})
+	return
+}
+
+// subst returns a copy of expr, with parameters replaced by args.
+func (p *inliner) subst(expr goast.Expr, args map[*types.Var]goast.Expr) goast.Expr {
+	switch v := expr.(type) {
+	case nil:
+		return nil
+	case *goast.Ident:
+		if o, ok := p.info.Uses[v].(*types.Var); ok {
+			if x, ok := args[o]; ok {
+				return x
+			}
+		}
+		return goast.NewIdent(v.Name)
+	case *goast.BasicLit:
+		lit := *v
+		return &lit
+	case *goast.BinaryExpr:
+		return &goast.BinaryExpr{X: p.subst(v.X, args), Op: v.Op, Y: p.subst(v.Y, args)}
+	case *goast.UnaryExpr:
+		return &goast.UnaryExpr{Op: v.Op, X: p.subst(v.X, args)}
+	case *goast.ParenExpr:
+		return &goast.ParenExpr{X: p.subst(v.X, args)}
+	case *goast.StarExpr:
+		return &goast.StarExpr{X: p.subst(v.X, args)}
+	case *goast.SelectorExpr:
+		return &goast.SelectorExpr{X: p.subst(v.X, args), Sel: goast.NewIdent(v.Sel.Name)}
+	case *goast.IndexExpr:
+		return &goast.IndexExpr{X: p.subst(v.X, args), Index: p.subst(v.Index, args)}
+	case *goast.SliceExpr:
+		return &goast.SliceExpr{
+			X: p.subst(v.X, args), Low: p.subst(v.Low, args), High: p.subst(v.High, args),
+			Max: p.subst(v.Max, args), Slice3: v.Slice3,
+		}
+	case *goast.CallExpr:
+		ret := &goast.CallExpr{Fun: p.subst(v.Fun, args), Ellipsis: v.Ellipsis}
+		for _, arg := range v.Args {
+			ret.Args = append(ret.Args, p.subst(arg, args))
+		}
+		return ret
+	}
+	panic("unreachable") // see checkResult
+}
+
+// needParen reports whether the inlined code expr needs parentheses to replace
+// the call at c.
+func needParen(expr goast.Expr, c *astutil.Cursor) bool {
+	switch expr.(type) {
+	case *goast.BinaryExpr, *goast.UnaryExpr, *goast.StarExpr:
+	default:
+		return false
+	}
+	switch c.Parent().(type) {
+	case *goast.BinaryExpr:
+		_, ok := expr.(*goast.BinaryExpr)
+		return ok
+	case *goast.UnaryExpr, *goast.StarExpr:
+		return true
+	case *goast.SelectorExpr, *goast.IndexExpr, *goast.SliceExpr, *goast.TypeAssertExpr:
+		return c.Name() == "X"
+	case *goast.CallExpr:
+		return c.Name() == "Fun"
+	}
+	return false
+}
+
+// definedNames returns the names defined in the local scopes of decl, which
+// may hide the names a function to inline refers to.
+func (p *inliner) definedNames(decl goast.Decl) map[string]bool {
+	names := make(map[string]bool)
+	goast.Inspect(decl, func(node goast.Node) bool {
+		if id, ok := node.(*goast.Ident); ok {
+			if o := p.info.Defs[id]; o != nil && o.Parent() != nil && o.Parent() != p.pkgScope {
+				names[id.Name] = true
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// escapedVars returns the local variables of decl which may be changed by
+// calls: ones referred to by closures, or whose addresses are taken.
+func (p *inliner) escapedVars(decl goast.Decl) map[*types.Var]bool {
+	escaped := make(map[*types.Var]bool)
+	var stack []goast.Node
+	closures := 0
+	goast.Inspect(decl, func(node goast.Node) bool {
+		if node == nil {
+			if _, ok := stack[len(stack)-1].(*goast.FuncLit); ok {
+				closures--
+			}
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		switch v := node.(type) {
+		case *goast.FuncLit:
+			closures++
+		case *goast.Ident:
+			o, ok := p.info.Uses[v].(*types.Var)
+			if !ok || o.Parent() == p.pkgScope {
+				break
+			}
+			if closures > 0 {
+				escaped[o] = true
+				break
+			}
+			for _, parent := range stack { // eg. &x, &x.f, x.a[:], x.f.M()
+				switch x := parent.(type) {
+				case *goast.UnaryExpr:
+					escaped[o] = escaped[o] || x.Op == gotoken.AND
+				case *goast.SliceExpr:
+					_, isArray := p.info.TypeOf(x.X).Underlying().(*types.Array)
+					escaped[o] = escaped[o] || isArray
+				case *goast.SelectorExpr:
+					escaped[o] = escaped[o] || p.addressesRecv(x)
+				}
+			}
+		}
+		stack = append(stack, node)
+		return true
+	})
+	return escaped
+}
+
+// -----------------------------------------------------------------------------
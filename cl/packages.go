@@ -18,6 +18,7 @@ package cl
 
 import (
 	"fmt"
+	"go/types"
 	"io/ioutil"
 	"log"
 	"os"
@@ -159,3 +160,41 @@ func (p *PkgsLoader) loadPkgsNoCache(at *gox.Package, imports map[string]*gox.Pk
 }
 
 // -----------------------------------------------------------------------------
+
+// importerLoadPkgs returns a gox.LoadPkgsFunc which imports packages by imp,
+// and loads the packages imp fails to import by load.
+func importerLoadPkgs(imp types.Importer, load gox.LoadPkgsFunc) gox.LoadPkgsFunc {
+	return func(at *gox.Package, imports map[string]*gox.PkgRef, pkgPaths ...string) int {
+		var rest []string
+		for _, pkgPath := range pkgPaths {
+			pkg, err := imp.Import(pkgPath)
+			if err != nil || pkg == nil {
+				rest = append(rest, pkgPath)
+				continue
+			}
+			gox.LoadGoPkg(at, imports, goPkgOf(pkg, make(map[*types.Package]*packages.Package)))
+		}
+		if rest == nil {
+			return 0
+		}
+		return load(at, imports, rest...)
+	}
+}
+
+// goPkgOf converts pkg (and its imports) into a *packages.Package.
+func goPkgOf(pkg *types.Package, visited map[*types.Package]*packages.Package) *packages.Package {
+	if ret, ok := visited[pkg]; ok {
+		return ret
+	}
+	ret := &packages.Package{ID: pkg.Path(), Name: pkg.Name(), PkgPath: pkg.Path(), Types: pkg}
+	visited[pkg] = ret
+	if imps := pkg.Imports(); len(imps) > 0 {
+		ret.Imports = make(map[string]*packages.Package, len(imps))
+		for _, imp := range imps {
+			ret.Imports[imp.Path()] = goPkgOf(imp, visited)
+		}
+	}
+	return ret
+}
+
+// -----------------------------------------------------------------------------
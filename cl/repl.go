@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl
+
+import (
+	"go/constant"
+	"go/types"
+	"strings"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/token"
+	"github.com/goplus/gox"
+)
+
+// -----------------------------------------------------------------------------
+
+const replFile = "repl.gop"
+
+type replDecl struct {
+	names []string
+	src   string
+}
+
+// Repl compiles Go+ code snippets one by one, each in the context of the
+// snippets compiled before, for implementing a Go+ REPL.
+//
+// A snippet can be declarations (imports, types, funcs, vars or consts),
+// statements, or an expression. Declarations replace the ones of the same
+// names declared before. Each statement is compiled in a new block nested
+// in the block of the statements before, so `x := ...` can redefine x.
+type Repl struct {
+	conf    *Config
+	imports []string
+	decls   []replDecl
+	stmts   []string
+}
+
+// ReplResult is the result of compiling a snippet by Repl.Compile.
+type ReplResult struct {
+	// Pkg is the package generated, its main func runs the statements
+	// compiled so far, and then prints the value of the expression, if any.
+	// Use WriteTo to get the Go code of it.
+	Pkg *gox.Package
+
+	// Type is the type of the expression, or nil if the snippet isn't an
+	// expression. It's an untyped type for an untyped constant expression
+	// like `1 + 2`.
+	Type types.Type
+
+	// Value is the value of the expression if it's a constant, or nil.
+	Value constant.Value
+}
+
+// NewRepl creates a Repl to compile snippets with conf.
+func NewRepl(conf *Config) *Repl {
+	if conf == nil {
+		conf = new(Config)
+	}
+	if conf.Fset == nil {
+		conf.Fset = token.NewFileSet()
+	}
+	return &Repl{conf: conf}
+}
+
+// Compile compiles snippet src. If src can't be compiled, an error is returned
+// and the context of the Repl is unchanged.
+func (p *Repl) Compile(src string) (ret *ReplResult, err error) {
+	base := p.conf.Fset.Base() // base of the file to parse
+	f, err := parser.ParseFile(p.conf.Fset, replFile, src, 0)
+	if err != nil {
+		return
+	}
+	srcOf := func(node ast.Node) string {
+		return src[int(node.Pos())-base : int(node.End())-base]
+	}
+	imports, decls := p.imports, p.decls
+	var stmts []ast.Stmt
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				imports = append(imports[:len(imports):len(imports)], srcOf(d))
+				continue
+			}
+			decls = replaceDecl(decls, declNames(d), srcOf(d))
+		case *ast.FuncDecl:
+			if f.NoEntrypoint && d.Recv == nil && d.Name.Name == "main" && d.Type.Func == token.NoPos {
+				stmts = d.Body.List
+				continue
+			}
+			decls = replaceDecl(decls, declNames(d), srcOf(d))
+		}
+	}
+
+	var expr string
+	newStmts := p.stmts
+	if len(stmts) == 1 && isReplExpr(stmts[0]) {
+		expr = srcOf(stmts[0].(*ast.ExprStmt).X)
+	} else {
+		for _, stmt := range stmts {
+			newStmts = append(newStmts[:len(newStmts):len(newStmts)], srcOf(stmt))
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("package main\n\n")
+	for _, imp := range imports {
+		b.WriteString(imp)
+		b.WriteString("\n")
+	}
+	for _, decl := range decls {
+		b.WriteString("\n")
+		b.WriteString(decl.src)
+		b.WriteString("\n")
+	}
+	b.WriteString("\nfunc main() {\n")
+	for i, stmt := range newStmts {
+		if i > 0 {
+			b.WriteString("{\n")
+		}
+		b.WriteString(stmt)
+		b.WriteString("\n")
+	}
+	var exprPos int
+	if expr != "" {
+		b.WriteString("println(")
+		exprPos = b.Len()
+		b.WriteString(expr)
+		b.WriteString(")\n")
+	}
+	for i := 1; i < len(newStmts); i++ {
+		b.WriteString("}\n")
+	}
+	b.WriteString("}\n")
+
+	out, info, err := p.compile(b.String())
+	if err != nil {
+		return
+	}
+	ret = &ReplResult{Pkg: out}
+	if expr != "" {
+		for e, tv := range info.Types {
+			if pos := p.conf.Fset.Position(e.Pos()); pos.Filename == replFile &&
+				pos.Offset == exprPos && p.conf.Fset.Position(e.End()).Offset == exprPos+len(expr) {
+				ret.Type, ret.Value = tv.Type, tv.Value
+				break
+			}
+		}
+	}
+	p.imports, p.decls, p.stmts = imports, decls, newStmts
+	return
+}
+
+func (p *Repl) compile(src string) (out *gox.Package, info *Info, err error) {
+	f, err := parser.ParseFile(p.conf.Fset, replFile, src, 0)
+	if err != nil {
+		return
+	}
+	pkg := &ast.Package{Name: "main", Files: map[string]*ast.File{replFile: f}}
+	info = &Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	conf := *p.conf
+	conf.Info = info
+	conf.UnusedImport, conf.UnusedVar = StrictIgnore, StrictIgnore // snippets may be used later
+	out, err = NewPackage("", pkg, &conf)
+	if conf.PkgsLoader != nil {
+		p.conf.PkgsLoader = conf.PkgsLoader // reuse the loader for later snippets
+	}
+	return
+}
+
+// isReplExpr reports whether stmt is an expression to print the value of.
+func isReplExpr(stmt ast.Stmt) bool {
+	if s, ok := stmt.(*ast.ExprStmt); ok {
+		_, isCall := s.X.(*ast.CallExpr)
+		return !isCall
+	}
+	return false
+}
+
+func declNames(decl ast.Decl) (names []string) {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		name := d.Name.Name
+		if d.Recv != nil && len(d.Recv.List) == 1 {
+			typ := d.Recv.List[0].Type
+			if t, ok := typ.(*ast.StarExpr); ok {
+				typ = t.X
+			}
+			if t, ok := typ.(*ast.Ident); ok {
+				name = t.Name + "." + name
+			}
+		}
+		names = append(names, name)
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				names = append(names, s.Name.Name)
+			case *ast.ValueSpec:
+				for _, name := range s.Names {
+					names = append(names, name.Name)
+				}
+			}
+		}
+	}
+	return
+}
+
+// replaceDecl removes declarations declaring any of names from decls, and
+// then appends the new declaration.
+func replaceDecl(decls []replDecl, names []string, src string) []replDecl {
+	ret := make([]replDecl, 0, len(decls)+1)
+	for _, decl := range decls {
+		if !hasCommonName(decl.names, names) {
+			ret = append(ret, decl)
+		}
+	}
+	return append(ret, replDecl{names: names, src: src})
+}
+
+func hasCommonName(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y && x != "_" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
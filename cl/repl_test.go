@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl_test
+
+import (
+	"testing"
+
+	"github.com/goplus/gop/cl"
+)
+
+func replCompile(t *testing.T, repl *cl.Repl, src string) *cl.ReplResult {
+	ret, err := repl.Compile(src)
+	if err != nil {
+		t.Fatalf("Compile `%s` failed: %v", src, err)
+	}
+	return ret
+}
+
+func TestRepl(t *testing.T) {
+	conf := *baseConf.Ensure()
+	repl := cl.NewRepl(&conf)
+
+	ret := replCompile(t, repl, "1 + 2")
+	if ret.Type == nil || ret.Type.String() != "untyped int" || ret.Value.ExactString() != "3" {
+		t.Fatal("type of `1 + 2`:", ret.Type, ret.Value)
+	}
+	if ret = replCompile(t, repl, "x := 1"); ret.Type != nil {
+		t.Fatal("type of `x := 1`:", ret.Type)
+	}
+	if ret = replCompile(t, repl, "x"); ret.Type == nil || ret.Type.String() != "int" {
+		t.Fatal("type of x:", ret.Type)
+	}
+	replCompile(t, repl, `x := "Hi"`)
+	if ret = replCompile(t, repl, "x"); ret.Type == nil || ret.Type.String() != "string" {
+		t.Fatal("type of redefined x:", ret.Type)
+	}
+	replCompile(t, repl, "func f() int { return 1 }")
+	replCompile(t, repl, "func f() float64 { return 1 }")
+	if ret = replCompile(t, repl, "f()"); ret.Type != nil {
+		t.Fatal("type of f():", ret.Type)
+	}
+	if ret = replCompile(t, repl, "[f()]"); ret.Type == nil || ret.Type.String() != "[]float64" {
+		t.Fatal("type of [f()]:", ret.Type)
+	}
+
+	if _, err := repl.Compile("y"); err == nil {
+		t.Fatal("Compile `y`: no error")
+	}
+	if ret = replCompile(t, repl, "x"); ret.Type == nil || ret.Type.String() != "string" {
+		t.Fatal("type of x after an error:", ret.Type)
+	}
+}
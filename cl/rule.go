@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl
+
+import (
+	"go/types"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// Rule is a custom check over a type-checked Go+ package, eg. to enforce lint
+// rules of an organization at compile time (see Config.Rules).
+type Rule interface {
+	Check(pass *Pass)
+}
+
+// RuleFunc is an adapter to use an ordinary function as a Rule.
+type RuleFunc func(pass *Pass)
+
+// Check calls f(pass).
+func (f RuleFunc) Check(pass *Pass) {
+	f(pass)
+}
+
+// Pass provides a Rule with the package to check, and receives the findings.
+type Pass struct {
+	Fset  *token.FileSet
+	Files map[string]*ast.File // files of the package, keyed by file path
+	Pkg   *types.Package       // the type-checked package
+	Info  *Info                // all maps of Info are filled
+
+	ctx *pkgCtx
+}
+
+// Reportf reports a finding at pos. With SeverityError, it fails NewPackage
+// as a compile error does. With SeverityWarning, it's only returned by
+// NewPackageWithErrors, unless Config.WarningsAsErrors is set.
+func (p *Pass) Reportf(pos token.Pos, severity Severity, format string, args ...interface{}) {
+	s := StrictError
+	if severity == SeverityWarning {
+		s = StrictWarning
+	}
+	p.ctx.handleStrict(s, pos, format, args...)
+}
+
+// checkRules runs rules over the package pkg if it's compiled without errors.
+func (p *pkgCtx) checkRules(rules []Rule, pkg *ast.Package, pkgTypes *types.Package) {
+	if p.errs != nil {
+		return
+	}
+	pass := &Pass{Fset: p.fset, Files: pkg.Files, Pkg: pkgTypes, Info: p.info, ctx: p}
+	for _, rule := range rules {
+		rule.Check(pass)
+	}
+}
+
+// ruleInfo returns the Info to record type information in for rules: all of
+// its maps are filled, and the non-nil maps of info are shared.
+func ruleInfo(info *Info) *Info {
+	ret := &Info{}
+	if info != nil {
+		*ret = *info
+	}
+	if ret.Types == nil {
+		ret.Types = make(map[ast.Expr]types.TypeAndValue)
+	}
+	if ret.Defs == nil {
+		ret.Defs = make(map[*ast.Ident]types.Object)
+	}
+	if ret.Uses == nil {
+		ret.Uses = make(map[*ast.Ident]types.Object)
+	}
+	return ret
+}
+
+// -----------------------------------------------------------------------------
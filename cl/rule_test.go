@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl_test
+
+import (
+	"go/types"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/cl"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/parser/parsertest"
+)
+
+// forbidImport is an example rule forbidding to import a package.
+type forbidImport struct {
+	pkgPath  string
+	severity cl.Severity
+}
+
+func (p *forbidImport) Check(pass *cl.Pass) {
+	for _, f := range pass.Files {
+		for _, imp := range f.Imports {
+			if path, _ := strconv.Unquote(imp.Path.Value); path == p.pkgPath {
+				pass.Reportf(imp.Pos(), p.severity, "import of %s is forbidden", path)
+			}
+		}
+	}
+}
+
+// forbidFunc reports calls to a function, found by the type information.
+func forbidFunc(pkgPath, name string) cl.Rule {
+	return cl.RuleFunc(func(pass *cl.Pass) {
+		for id, obj := range pass.Info.Uses {
+			if fn, ok := obj.(*types.Func); ok && fn.Pkg() != nil && fn.Pkg().Path() == pkgPath && fn.Name() == name {
+				pass.Reportf(id.Pos(), cl.SeverityWarning, "%s.%s is deprecated", pkgPath, name)
+			}
+		}
+	})
+}
+
+const ruleSrc = `import (
+	"io/ioutil"
+	"strings"
+)
+
+b, _ := ioutil.ReadFile("foo.txt")
+println strings.Title(string(b))
+`
+
+func newRuleTestPkg(t *testing.T) *ast.Package {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", ruleSrc)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	return pkgs["main"]
+}
+
+func TestRules(t *testing.T) {
+	pkg := newRuleTestPkg(t)
+	conf := *baseConf.Ensure()
+	conf.Rules = []cl.Rule{
+		&forbidImport{pkgPath: "io/ioutil", severity: cl.SeverityError},
+		forbidFunc("strings", "Title"),
+	}
+	_, err := cl.NewPackage("", pkg, &conf)
+	if err == nil || !strings.HasSuffix(err.Error(), "bar.gop:2:2: import of io/ioutil is forbidden") {
+		t.Fatal("NewPackage:", err)
+	}
+
+	_, diags, errs := cl.NewPackageWithErrors("", newRuleTestPkg(t), &conf)
+	if len(errs) != 1 || len(diags) != 2 {
+		t.Fatal("NewPackageWithErrors:", diags, errs)
+	}
+	if d := diags[1]; d.Severity != cl.SeverityWarning || d.Msg != "strings.Title is deprecated" ||
+		d.Position.Line != 7 || d.Position.Column != 17 {
+		t.Fatal("NewPackageWithErrors:", d)
+	}
+}
+
+func TestRulesWarning(t *testing.T) {
+	conf := *baseConf.Ensure()
+	conf.Info = &cl.Info{Defs: make(map[*ast.Ident]types.Object)}
+	conf.Rules = []cl.Rule{
+		&forbidImport{pkgPath: "io/ioutil", severity: cl.SeverityWarning},
+	}
+	if _, err := cl.NewPackage("", newRuleTestPkg(t), &conf); err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	if conf.Info.Types != nil || conf.Info.Uses != nil || len(conf.Info.Defs) == 0 {
+		t.Fatal("Info:", conf.Info)
+	}
+	conf.WarningsAsErrors = true
+	_, err := cl.NewPackage("", newRuleTestPkg(t), &conf)
+	if err == nil || !strings.HasSuffix(err.Error(), "bar.gop:2:2: import of io/ioutil is forbidden") {
+		t.Fatal("NewPackage:", err)
+	}
+}
+
+func TestRulesNotRun(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `import "io/ioutil"
+
+x := undefined
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.Rules = []cl.Rule{cl.RuleFunc(func(pass *cl.Pass) {
+		t.Fatal("rule runs over a package with errors")
+	})}
+	if _, _, errs := cl.NewPackageWithErrors("", pkgs["main"], &conf); len(errs) == 0 {
+		t.Fatal("NewPackageWithErrors: no error?")
+	}
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goplus/gop/token"
+	"github.com/goplus/gox"
+)
+
+// -----------------------------------------------------------------------------
+
+// SourceLine maps a line of the generated Go code to a Go+ source position.
+type SourceLine struct {
+	GoLine int            // line of the generated Go code, starting at 1
+	Pos    token.Position // Go+ source position of the statement at GoLine
+}
+
+// SourceMap maps lines of the generated Go code back to Go+ source positions.
+// It works at statement granularity.
+type SourceMap struct {
+	Lines []SourceLine // sorted by GoLine
+}
+
+// Lookup returns the Go+ source position of the statement which contains
+// the generated Go code at goLine.
+func (p *SourceMap) Lookup(goLine int) (pos token.Position, ok bool) {
+	i := sort.Search(len(p.Lines), func(i int) bool {
+		return p.Lines[i].GoLine > goLine
+	})
+	if i == 0 {
+		return
+	}
+	return p.Lines[i-1].Pos, true
+}
+
+// WriteTo writes the source map in text form, one `goLine file:line[:column]`
+// mapping per line.
+func (p *SourceMap) WriteTo(w io.Writer) (n int64, err error) {
+	var buf bytes.Buffer
+	for _, l := range p.Lines {
+		fmt.Fprintf(&buf, "%d %v\n", l.GoLine, l.Pos)
+	}
+	return buf.WriteTo(w)
+}
+
+// BuildSourceMap removes `//line` comments (generated when Config.NoFileLine
+// is false) from the Go code, and returns the code left with the SourceMap
+// made from these comments.
+func BuildSourceMap(gocode []byte) (code []byte, m *SourceMap) {
+	var out bytes.Buffer
+	var pending *token.Position
+	m = new(SourceMap)
+	goLine := 0
+	scanner := bufio.NewScanner(bytes.NewReader(gocode))
+	scanner.Buffer(nil, len(gocode)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if text := strings.TrimSpace(line); strings.HasPrefix(text, "//line ") {
+			if pos, ok := parseLineDirective(text[7:]); ok {
+				pending = &pos
+				continue
+			}
+		}
+		goLine++
+		if pending != nil {
+			m.Lines = append(m.Lines, SourceLine{GoLine: goLine, Pos: *pending})
+			pending = nil
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), m
+}
+
+// parseLineDirective parses `file:line` or `file:line:column`.
+func parseLineDirective(s string) (pos token.Position, ok bool) {
+	file, n, ok := splitLineNum(s)
+	if !ok {
+		return
+	}
+	if f, n2, ok2 := splitLineNum(file); ok2 {
+		file, pos.Line, pos.Column = f, n2, n
+	} else {
+		pos.Line = n
+	}
+	pos.Filename = file
+	return pos, file != ""
+}
+
+func splitLineNum(s string) (file string, n int, ok bool) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return
+	}
+	n, err := strconv.Atoi(s[i+1:])
+	if err != nil || n <= 0 {
+		return
+	}
+	return s[:i], n, true
+}
+
+// WriteFileWithSourceMap writes the Go code of pkg to file without `//line`
+// comments, and writes its source map to file + ".map".
+func WriteFileWithSourceMap(file string, pkg *gox.Package, testingFile bool) (err error) {
+	var buf bytes.Buffer
+	if err = WriteTo(&buf, pkg, testingFile); err != nil {
+		return
+	}
+	code, m := BuildSourceMap(buf.Bytes())
+	if err = os.WriteFile(file, code, 0644); err != nil {
+		return
+	}
+	var mbuf bytes.Buffer
+	m.WriteTo(&mbuf)
+	return os.WriteFile(file+".map", mbuf.Bytes(), 0644)
+}
+
+// -----------------------------------------------------------------------------
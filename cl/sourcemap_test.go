@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/goplus/gop/cl"
+	"github.com/goplus/gop/parser"
+)
+
+func TestBuildSourceMap(t *testing.T) {
+	code, m := cl.BuildSourceMap([]byte(`package main
+
+func main() {
+//line /foo/bar.gop:3
+	a := 1
+//line /foo/bar.gop:4:2
+	println(a,
+		2)
+}
+
+type Kai struct {
+}
+
+func (this *Kai) onMsg() {
+//line C:\foo\Kai.spx:2
+	this.Say("Hi")
+}
+`))
+	const expected = `package main
+
+func main() {
+	a := 1
+	println(a,
+		2)
+}
+
+type Kai struct {
+}
+
+func (this *Kai) onMsg() {
+	this.Say("Hi")
+}
+`
+	if string(code) != expected {
+		t.Fatalf("BuildSourceMap:\n%s", code)
+	}
+	var b bytes.Buffer
+	m.WriteTo(&b)
+	if b.String() != `4 /foo/bar.gop:3
+5 /foo/bar.gop:4:2
+13 C:\foo\Kai.spx:2
+` {
+		t.Fatalf("SourceMap.WriteTo:\n%s", b.String())
+	}
+	if _, ok := m.Lookup(3); ok {
+		t.Fatal("Lookup(3): found?")
+	}
+	if pos, ok := m.Lookup(6); !ok || pos.Filename != "/foo/bar.gop" || pos.Line != 4 || pos.Column != 2 {
+		t.Fatal("Lookup(6):", pos, ok)
+	}
+	if pos, ok := m.Lookup(20); !ok || pos.Filename != `C:\foo\Kai.spx` || pos.Line != 2 {
+		t.Fatal("Lookup(20):", pos, ok)
+	}
+}
+
+func TestWriteFileWithSourceMap(t *testing.T) {
+	fs := newMultiFileFS("/foo",
+		"a.gop", `func add(a, b int) int {
+	return a + b
+}
+`,
+		"b.gop", `func sub(a, b int) int {
+	return a - b
+}
+`,
+		"Kai.tspx", `func greet() {
+	say "Hi"
+}
+`,
+		"Game.tgmx", `var (
+	Kai Kai
+)
+
+run "hzip://open.qiniu.us/weather/res.zip"
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.NoFileLine = false
+	pkg, err := cl.NewPackage("", pkgs["main"], &conf)
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	file := filepath.Join(t.TempDir(), "gop_autogen.go")
+	if err = cl.WriteFileWithSourceMap(file, pkg, false); err != nil {
+		t.Fatal("WriteFileWithSourceMap:", err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal("ReadFile:", err)
+	}
+	code := string(b)
+	if strings.Contains(code, "//line ") {
+		t.Fatalf("WriteFileWithSourceMap: //line comments are left:\n%s", code)
+	}
+	b, err = os.ReadFile(file + ".map")
+	if err != nil {
+		t.Fatal("ReadFile:", err)
+	}
+	m := readSourceMap(t, string(b))
+	lines := strings.Split(code, "\n")
+	for _, c := range []struct {
+		stmt string
+		file string
+		line int
+	}{
+		{"return a + b", "/foo/a.gop", 2},
+		{"return a - b", "/foo/b.gop", 2},
+		{`this.Say("Hi")`, "/foo/Kai.tspx", 2},
+		{`spx.Gopt_MyGame_Run(this, "hzip://open.qiniu.us/weather/res.zip")`, "/foo/Game.tgmx", 5},
+	} {
+		goLine := 0
+		for i, line := range lines {
+			if strings.TrimSpace(line) == c.stmt {
+				goLine = i + 1
+				break
+			}
+		}
+		if goLine == 0 {
+			t.Fatalf("statement %q not found in:\n%s", c.stmt, code)
+		}
+		if pos, ok := m.Lookup(goLine); !ok || pos.Filename != c.file || pos.Line != c.line {
+			t.Fatalf("Lookup(%d) of %q: %v, %v\n%s", goLine, c.stmt, pos, ok, b)
+		}
+	}
+}
+
+// readSourceMap reads a source map written by SourceMap.WriteTo, by making
+// Go code with the `//line` comments back.
+func readSourceMap(t *testing.T, text string) *cl.SourceMap {
+	code := []byte("package main\n")
+	goLine := 1
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		pos := strings.SplitN(line, " ", 2)
+		if len(pos) != 2 {
+			t.Fatal("invalid source map:", line)
+		}
+		n, err := strconv.Atoi(pos[0])
+		if err != nil || n <= goLine {
+			t.Fatal("invalid source map:", line)
+		}
+		for ; goLine < n-1; goLine++ {
+			code = append(code, '\n')
+		}
+		code = append(code, "//line "+pos[1]+"\n"+pos[0]+"\n"...)
+		goLine++
+	}
+	_, m := cl.BuildSourceMap(code)
+	return m
+}
@@ -42,21 +42,51 @@ func relFile(dir string, file string) string {
 	return file
 }
 
+func lineDirective(ctx *blockCtx, start token.Pos) string {
+	pos := ctx.fset.Position(start)
+	if ctx.relativePath {
+		pos.Filename = relFile(ctx.targetDir, pos.Filename)
+	}
+	return fmt.Sprintf("//line %s:%d", pos.Filename, pos.Line)
+}
+
 func commentStmt(ctx *blockCtx, stmt ast.Stmt) {
 	if ctx.fileLine {
-		start := stmt.Pos()
-		pos := ctx.fset.Position(start)
-		if ctx.relativePath {
-			pos.Filename = relFile(ctx.targetDir, pos.Filename)
-		}
-		line := fmt.Sprintf("\n//line %s:%d", pos.Filename, pos.Line)
 		comments := &goast.CommentGroup{
-			List: []*goast.Comment{{Text: line}},
+			List: []*goast.Comment{{Text: "\n" + lineDirective(ctx, stmt.Pos())}},
 		}
 		ctx.cb.SetComments(comments, false)
 	}
 }
 
+// commentFunc sets doc comments of fn. A `//line` comment is appended to them
+// to locate the function header, or it would be located by the last `//line`
+// comment before it, which may be in another function, even in another file.
+func commentFunc(ctx *blockCtx, fn *gox.Func, decl *ast.FuncDecl) {
+	doc := decl.Doc
+	if ctx.fileLine {
+		start := decl.Pos()
+		if !start.IsValid() { // entrypoint of a file without func main
+			start = decl.Name.Pos()
+		}
+		if start.IsValid() {
+			doc = withLineDirective(doc, lineDirective(ctx, start))
+		}
+	}
+	if doc != nil {
+		fn.SetComments(doc)
+	}
+}
+
+func withLineDirective(doc *goast.CommentGroup, line string) *goast.CommentGroup {
+	ret := &goast.CommentGroup{}
+	if doc != nil {
+		ret.List = append(ret.List, doc.List...)
+	}
+	ret.List = append(ret.List, &goast.Comment{Text: line})
+	return ret
+}
+
 func compileStmts(ctx *blockCtx, body []ast.Stmt) {
 	for _, stmt := range body {
 		if v, ok := stmt.(*ast.LabeledStmt); ok {
@@ -64,9 +94,17 @@ func compileStmts(ctx *blockCtx, body []ast.Stmt) {
 			ctx.cb.NewLabel(expr.Pos(), expr.Name)
 		}
 	}
-	for _, stmt := range body {
+	scope := ctx.cb.Scope()
+	ctx.stmtScopes[scope] = true
+	defer delete(ctx.stmtScopes, scope)
+	for i, stmt := range body {
+		if i == len(body)-1 && mayTerminate(stmt) {
+			ctx.assignUnusedLocals()
+		}
 		compileStmt(ctx, stmt)
 	}
+	ctx.assignUnusedLocals()
+	ctx.checkUnusedLocals(nil)
 }
 
 func compileStmt(ctx *blockCtx, stmt ast.Stmt) {
@@ -193,6 +231,7 @@ func compileAssignStmt(ctx *blockCtx, expr *ast.AssignStmt) {
 				log.Panicln("TODO: non-name $v on left side of :=")
 			}
 		}
+		olds := ctx.lookupLocals(expr.Lhs)
 		ctx.cb.DefineVarStart(expr.Pos(), names...)
 		if enableRecover {
 			defer func() {
@@ -206,6 +245,7 @@ func compileAssignStmt(ctx *blockCtx, expr *ast.AssignStmt) {
 			compileExpr(ctx, rhs, twoValue)
 		}
 		ctx.cb.EndInit(len(expr.Rhs))
+		ctx.recordLocals(expr.Lhs, olds)
 		return
 	}
 	for _, lhs := range expr.Lhs {
@@ -287,6 +327,9 @@ func compileRangeStmt(ctx *blockCtx, v *ast.RangeStmt) {
 		pos = v.For
 	}
 	cb.RangeAssignThen(pos)
+	if v.Tok == token.DEFINE {
+		ctx.recordLocals([]ast.Expr{v.Key, v.Value}, nil)
+	}
 	compileStmts(ctx, v.Body.List)
 	cb.SetComments(comments, true)
 	setBodyHandler(ctx)
@@ -713,8 +756,12 @@ func compileDeclStmt(ctx *blockCtx, expr *ast.DeclStmt) {
 				compileType(ctx, spec.(*ast.TypeSpec))
 			}
 		case token.CONST:
-			cdecl := ctx.pkg.NewConstDecl(ctx.cb.Scope())
+			scope := ctx.cb.Scope()
+			cdecl := ctx.pkg.NewConstDecl(scope)
 			loadConstSpecs(ctx, cdecl, d.Specs)
+			for _, spec := range d.Specs {
+				ctx.recordDefs(scope, spec.(*ast.ValueSpec).Names)
+			}
 		case token.VAR:
 			for _, spec := range d.Specs {
 				v := spec.(*ast.ValueSpec)
@@ -729,9 +776,12 @@ func compileDeclStmt(ctx *blockCtx, expr *ast.DeclStmt) {
 func compileType(ctx *blockCtx, t *ast.TypeSpec) {
 	name := t.Name.Name
 	if t.Assign != token.NoPos { // alias type
-		ctx.cb.AliasType(name, toType(ctx, t.Type))
+		ctx.cb.AliasType(name, toType(ctx, t.Type), t.Name.Pos())
+		ctx.recordDefs(ctx.cb.Scope(), []*ast.Ident{t.Name})
 	} else {
-		ctx.cb.NewType(name).InitType(ctx.pkg, toType(ctx, t.Type))
+		decl := ctx.cb.NewType(name, t.Name.Pos())
+		ctx.recordDef(t.Name, decl.Type().Obj())
+		decl.InitType(ctx.pkg, toType(ctx, t.Type))
 	}
 }
 
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// FieldNaming is a policy to name a field in the struct tags generated for it,
+// see Config.StructTags.
+type FieldNaming int
+
+const (
+	// FieldName uses the name of the field as it is, eg. UserID.
+	FieldName FieldNaming = iota
+	// FieldCamelCase lowers the first word of the name of the field, eg.
+	// userID (and httpServer of HTTPServer).
+	FieldCamelCase
+	// FieldSnakeCase lowers all words of the name of the field, joined by
+	// underscores, eg. user_id (and http_server of HTTPServer).
+	FieldSnakeCase
+)
+
+// structTag returns tag of the field name (not an embedded one) with the ones
+// of Config.StructTags added. Unexported fields aren't tagged, and the keys
+// tag already has are kept.
+func (p *pkgCtx) structTag(name, tag string) string {
+	if len(p.structTags) == 0 || !token.IsExported(name) {
+		return tag
+	}
+	keys := make([]string, 0, len(p.structTags))
+	for key := range p.structTags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := reflect.StructTag(tag).Lookup(key); ok {
+			continue
+		}
+		if tag != "" {
+			tag += " "
+		}
+		tag += key + ":" + strconv.Quote(fieldName(name, p.structTags[key]))
+	}
+	return tag
+}
+
+func fieldName(name string, naming FieldNaming) string {
+	switch naming {
+	case FieldCamelCase:
+		words := splitWords(name)
+		words[0] = strings.ToLower(words[0])
+		return strings.Join(words, "")
+	case FieldSnakeCase:
+		words := splitWords(name)
+		for i, word := range words {
+			words[i] = strings.ToLower(word)
+		}
+		return strings.Join(words, "_")
+	}
+	return name
+}
+
+// splitWords splits a mixed caps name into words, eg. HTTPServer2Go into HTTP,
+// Server2 and Go. Underscores separate words too.
+func splitWords(name string) (words []string) {
+	runes := []rune(name)
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		if i < len(runes) && runes[i] != '_' && !isWordStart(runes, i) {
+			continue
+		}
+		if start < i {
+			words = append(words, string(runes[start:i]))
+		}
+		start = i
+		if i < len(runes) && runes[i] == '_' {
+			start++
+		}
+	}
+	if words == nil { // eg. _
+		words = []string{name}
+	}
+	return
+}
+
+func isWordStart(runes []rune, i int) bool {
+	if !unicode.IsUpper(runes[i]) {
+		return false
+	}
+	prev := runes[i-1]
+	return unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+		unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) // end of an acronym
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/goplus/gop/cl"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/parser/parsertest"
+	"github.com/goplus/gox"
+)
+
+func testStructTags(t *testing.T, tags map[string]cl.FieldNaming, fs parser.FileSystem, expected string) {
+	cl.SetDisableRecover(true)
+	defer cl.SetDisableRecover(false)
+
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.StructTags = tags
+	pkg, err := cl.NewPackage("", pkgs["main"], &conf)
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	var b bytes.Buffer
+	if err = gox.WriteTo(&b, pkg, false); err != nil {
+		t.Fatal("gox.WriteTo failed:", err)
+	}
+	if result := b.String(); result != expected {
+		t.Fatalf("\nResult:\n%s\nExpected:\n%s\n", result, expected)
+	}
+}
+
+const structTagsSrc = `import "bytes"
+
+type User struct {
+	bytes.Buffer
+	*Base
+	UserID     int
+	HTTPServer string
+	Name, name string
+	Age        int "json:\"-\""
+	Avatar2URL string "db:\"avatar\""
+}
+
+type Base struct {
+	Created int
+}
+
+var x struct {
+	LastLogin int
+}
+`
+
+func TestStructTags(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", structTagsSrc)
+	testStructTags(t, nil, fs, `package main
+
+import bytes "bytes"
+
+type User struct {
+	bytes.Buffer
+	*Base
+	UserID     int
+	HTTPServer string
+	Name       string
+	name       string
+	Age        int    "json:\"-\""
+	Avatar2URL string "db:\"avatar\""
+}
+type Base struct {
+	Created int
+}
+
+var x struct {
+	LastLogin int
+}
+`)
+	testStructTags(t, map[string]cl.FieldNaming{"json": cl.FieldCamelCase}, fs, `package main
+
+import bytes "bytes"
+
+type User struct {
+	bytes.Buffer
+	*Base
+	UserID     int    "json:\"userID\""
+	HTTPServer string "json:\"httpServer\""
+	Name       string "json:\"name\""
+	name       string
+	Age        int    "json:\"-\""
+	Avatar2URL string "db:\"avatar\" json:\"avatar2URL\""
+}
+type Base struct {
+	Created int "json:\"created\""
+}
+
+var x struct {
+	LastLogin int "json:\"lastLogin\""
+}
+`)
+	testStructTags(t, map[string]cl.FieldNaming{"json": cl.FieldSnakeCase, "db": cl.FieldSnakeCase, "xml": cl.FieldName}, fs, `package main
+
+import bytes "bytes"
+
+type User struct {
+	bytes.Buffer
+	*Base
+	UserID     int    "db:\"user_id\" json:\"user_id\" xml:\"UserID\""
+	HTTPServer string "db:\"http_server\" json:\"http_server\" xml:\"HTTPServer\""
+	Name       string "db:\"name\" json:\"name\" xml:\"Name\""
+	name       string
+	Age        int    "json:\"-\" db:\"age\" xml:\"Age\""
+	Avatar2URL string "db:\"avatar\" json:\"avatar2_url\" xml:\"Avatar2URL\""
+}
+type Base struct {
+	Created int "db:\"created\" json:\"created\" xml:\"Created\""
+}
+
+var x struct {
+	LastLogin int "db:\"last_login\" json:\"last_login\" xml:\"LastLogin\""
+}
+`)
+}
+
+func TestStructTagsClass(t *testing.T) {
+	fs := newMultiFileFS("/foo", "Foo.tform", `
+var (
+	MaxCount int
+	count    int
+)
+
+count++
+`)
+	testStructTags(t, map[string]cl.FieldNaming{"json": cl.FieldSnakeCase}, fs, `package main
+
+import spx "github.com/goplus/gop/cl/internal/spx"
+
+type Foo struct {
+	spx.Worker
+	MaxCount int "json:\"max_count\""
+	count    int
+}
+
+func (self *Foo) Main() {
+	self.count++
+}
+`)
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl
+
+import (
+	"go/types"
+	"sort"
+	"strconv"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/token"
+	"github.com/goplus/gox"
+)
+
+// -----------------------------------------------------------------------------
+
+// Strictness specifies how a problem that Go rejects, but that Go+ can still
+// generate valid code for, is reported.
+type Strictness int
+
+const (
+	// StrictError reports the problem as an error, as Go does.
+	StrictError Strictness = iota
+	// StrictWarning reports the problem as a warning (see NewPackageWithErrors),
+	// or an error if Config.WarningsAsErrors is set.
+	StrictWarning
+	// StrictIgnore doesn't check the problem, and the generated code is kept
+	// as it's written (but unused imports are still removed), which Go may
+	// reject.
+	StrictIgnore
+)
+
+func (p *pkgCtx) handleStrict(s Strictness, pos token.Pos, format string, args ...interface{}) {
+	switch s {
+	case StrictError:
+		p.handleErr(p.newCodeErrorf(pos, format, args...))
+	case StrictWarning:
+		if p.warningsAsErrors {
+			p.handleErr(p.newCodeErrorf(pos, format, args...))
+		} else {
+			p.warns = append(p.warns, p.newCodeErrorf(pos, format, args...))
+		}
+	}
+}
+
+// localVar is a local variable checked by Config.UnusedVar.
+type localVar struct {
+	id       *ast.Ident
+	used     bool
+	assigned bool // assigned to _ to be used in the generated code
+}
+
+// defineLocal starts to check if the local variable o defined by id is used.
+func (p *pkgCtx) defineLocal(id *ast.Ident, o types.Object) {
+	if p.unusedVar == StrictIgnore {
+		return
+	}
+	if v, ok := o.(*types.Var); ok && id.Name != "_" {
+		if _, ok := p.locals[v]; !ok {
+			p.locals[v] = &localVar{id: id}
+		}
+	}
+}
+
+func (p *pkgCtx) useLocal(o types.Object) {
+	if v, ok := p.locals[o]; ok {
+		v.used = true
+	}
+}
+
+// assignUnusedLocals assigns local variables of the current block, which are
+// not used (yet), to _, so that the generated code is valid even if they are
+// not used at last. It's called before the last statement of the block if
+// it may be a terminating statement, and at the end of the block. Variables
+// of the enclosing blocks which have no statements, eg. `if x := f(); ...`,
+// are assigned too.
+func (p *blockCtx) assignUnusedLocals() {
+	if p.unusedVar != StrictWarning {
+		return
+	}
+	cb := p.cb
+	pkgScope := p.pkg.Types.Scope()
+	for scope := cb.Scope(); scope != nil && scope != pkgScope; scope = scope.Parent() {
+		if scope != cb.Scope() && p.stmtScopes[scope] {
+			break
+		}
+		for _, name := range scope.Names() {
+			o := scope.Lookup(name)
+			if v, ok := p.locals[o]; ok && !v.used && !v.assigned {
+				v.assigned = true
+				cb.VarRef(nil).Val(o).Assign(1)
+			}
+		}
+	}
+}
+
+// checkUnusedLocals reports local variables which are not used in the current
+// block if scope is nil, or in the function whose scope is scope.
+func (p *blockCtx) checkUnusedLocals(scope *types.Scope) {
+	var in func(o types.Object) bool
+	if scope == nil {
+		scope = p.cb.Scope()
+		in = func(o types.Object) bool {
+			return o.Parent() == scope
+		}
+	} else { // variables in a block not compiled by compileStmts, eg. `if x := f(); ...`
+		in = func(o types.Object) bool {
+			for s := o.Parent(); s != nil; s = s.Parent() {
+				if s == scope {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	var unused []*localVar
+	for o, v := range p.locals {
+		if in(o) {
+			if !v.used {
+				unused = append(unused, v)
+			}
+			delete(p.locals, o)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool { // in the order of definition
+		return unused[i].id.Pos() < unused[j].id.Pos()
+	})
+	for _, v := range unused {
+		p.handleStrict(p.unusedVar, v.id.Pos(), "%s declared but not used", v.id.Name)
+	}
+}
+
+// mayTerminate reports whether stmt may be a terminating statement, after
+// which no statement is allowed at the end of a function.
+func mayTerminate(stmt ast.Stmt) bool {
+	switch v := stmt.(type) {
+	case *ast.AssignStmt, *ast.DeclStmt, *ast.IncDecStmt, *ast.SendStmt, *ast.EmptyStmt:
+		return false
+	case *ast.ExprStmt:
+		if call, ok := v.X.(*ast.CallExpr); ok {
+			if fn, ok := call.Fun.(*ast.Ident); ok {
+				return fn.Name == "panic"
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// useImport marks the import pr as used.
+func (p *blockCtx) useImport(pr *gox.PkgRef) {
+	delete(p.unusedImports, pr)
+}
+
+// checkUnusedImports reports imports of the file which are not used.
+func (p *blockCtx) checkUnusedImports() {
+	specs := make([]*ast.ImportSpec, 0, len(p.unusedImports))
+	for _, spec := range p.unusedImports {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { // in the order of imports
+		return specs[i].Pos() < specs[j].Pos()
+	})
+	for _, spec := range specs {
+		pkgPath := strconv.Quote(toString(spec.Path))
+		if spec.Name != nil {
+			p.handleStrict(p.unusedImport, spec.Pos(), "%s imported but not used as %s", pkgPath, spec.Name.Name)
+		} else {
+			p.handleStrict(p.unusedImport, spec.Pos(), "%s imported but not used", pkgPath)
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
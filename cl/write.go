@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl
+
+import (
+	"bytes"
+	goast "go/ast"
+	"go/format"
+	goparser "go/parser"
+	gotoken "go/token"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goplus/gox"
+)
+
+// -----------------------------------------------------------------------------
+
+// WriteTo writes the Go code of pkg to dst like gox.WriteTo, but imports are
+// sorted as goimports does: standard packages first, and then the others,
+// sorted by path in each group. So the same package is always written to the
+// same code, which gox.WriteTo doesn't guarantee as its imports are in the
+// order they are referred to. Calls of the functions marked by
+// Config.InlineFuncs are inlined, and the comments carried over by
+// Config.GoAPI are placed.
+func WriteTo(dst io.Writer, pkg *gox.Package, testingFile bool) (err error) {
+	var buf bytes.Buffer
+	if err = gox.WriteTo(&buf, pkg, testingFile); err != nil {
+		return
+	}
+	_, err = dst.Write(sortImports(goAPIDocs(inlineFuncs(buf.Bytes(), pkg))))
+	return
+}
+
+// WriteFile writes the Go code of pkg to file like gox.WriteFile, with imports
+// sorted as WriteTo does.
+func WriteFile(file string, pkg *gox.Package, testingFile bool) (err error) {
+	var buf bytes.Buffer
+	if err = WriteTo(&buf, pkg, testingFile); err != nil {
+		return
+	}
+	return os.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// ASTFile returns the Go code of pkg written by WriteTo as a Go AST in fset,
+// eg. to type-check it by go/types. As gox builds the Go AST without positions,
+// the code is parsed to get them, and the `//line` directives in it (see
+// Config.NoFileLine) map positions of the AST back to the Go+ source, as
+// fset.Position reports. The file is named gop_autogen.go, or
+// gop_autogen_test.go if testingFile is true.
+func ASTFile(fset *gotoken.FileSet, pkg *gox.Package, testingFile bool) (*goast.File, error) {
+	var buf bytes.Buffer
+	if err := WriteTo(&buf, pkg, testingFile); err != nil {
+		return nil, err
+	}
+	fname := "gop_autogen.go"
+	if testingFile {
+		fname = "gop_autogen_test.go"
+	}
+	return goparser.ParseFile(fset, fname, buf.Bytes(), goparser.ParseComments)
+}
+
+// sortImports sorts the specs of the import declaration of Go code src into
+// the standard group and the others, sorted by path in each group. The specs
+// are taken from the AST of src with their comments: the doc comments and the
+// comments before a spec move with it, and so does the line comment after it.
+// Comments after the last spec stay at the end of the block.
+func sortImports(src []byte) []byte {
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, "", src, goparser.ImportsOnly|goparser.ParseComments)
+	if err != nil || len(f.Decls) == 0 {
+		return src
+	}
+	decl, ok := f.Decls[0].(*goast.GenDecl)
+	if !ok || decl.Tok != gotoken.IMPORT || !decl.Lparen.IsValid() || len(decl.Specs) < 2 {
+		return src
+	}
+	offset := func(pos gotoken.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	text := func(node goast.Node) string {
+		return string(src[offset(node.Pos()):offset(node.End())])
+	}
+	type importSpec struct {
+		path, code string
+		leading    []string
+		trailing   string
+	}
+	specs := make([]*importSpec, len(decl.Specs))
+	for i, spec := range decl.Specs {
+		s := spec.(*goast.ImportSpec)
+		path, err := strconv.Unquote(s.Path.Value)
+		if err != nil {
+			return src
+		}
+		specs[i] = &importSpec{path: path, code: text(s)}
+		if s.Comment != nil {
+			specs[i].trailing = text(s.Comment)
+		}
+	}
+	var tail []string // comments after the last spec
+	for _, cg := range f.Comments {
+		if cg.Pos() <= decl.Lparen || cg.End() >= decl.Rparen {
+			continue
+		}
+		i := 0
+		for i < len(decl.Specs) && decl.Specs[i].Pos() < cg.Pos() {
+			i++
+		}
+		if i > 0 && decl.Specs[i-1].(*goast.ImportSpec).Comment == cg {
+			continue // the line comment of the spec
+		}
+		if i < len(specs) {
+			specs[i].leading = append(specs[i].leading, text(cg))
+		} else {
+			tail = append(tail, text(cg))
+		}
+	}
+	var std, others []*importSpec
+	for _, spec := range specs {
+		if isStdPkg(spec.path) {
+			std = append(std, spec)
+		} else {
+			others = append(others, spec)
+		}
+	}
+	var b bytes.Buffer
+	b.Write(src[:offset(decl.Pos())])
+	b.WriteString("import (\n")
+	for i, group := range [][]*importSpec{std, others} {
+		if len(group) == 0 {
+			continue
+		}
+		if i > 0 && len(std) > 0 {
+			b.WriteString("\n")
+		}
+		sort.SliceStable(group, func(i, j int) bool {
+			if group[i].path != group[j].path {
+				return group[i].path < group[j].path
+			}
+			return group[i].code < group[j].code
+		})
+		for _, spec := range group {
+			for _, c := range spec.leading {
+				writeIndented(&b, c)
+			}
+			b.WriteString("\t")
+			b.WriteString(spec.code)
+			if spec.trailing != "" {
+				b.WriteString(" ")
+				b.WriteString(spec.trailing)
+			}
+			b.WriteString("\n")
+		}
+	}
+	for _, c := range tail {
+		writeIndented(&b, c)
+	}
+	b.WriteString(")")
+	b.Write(src[offset(decl.End()):])
+	if len(f.Comments) > 0 { // align the line comments
+		if ret, err := format.Source(b.Bytes()); err == nil {
+			return ret
+		}
+	}
+	return b.Bytes()
+}
+
+// writeIndented writes the comments text to b, indented in the import block.
+// Lines of a /*-style comment after the first one are written as they are.
+func writeIndented(b *bytes.Buffer, text string) {
+	for i, line := range strings.Split(text, "\n") {
+		if trimmed := strings.TrimLeft(line, " \t"); i == 0 || strings.HasPrefix(trimmed, "//") {
+			line = "\t" + trimmed
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+}
+
+// isStdPkg reports whether pkgPath is a standard package. As goimports does,
+// a path is a standard one if its first element has no dot.
+func isStdPkg(pkgPath string) bool {
+	elem := pkgPath
+	if pos := strings.IndexByte(elem, '/'); pos >= 0 {
+		elem = elem[:pos]
+	}
+	return !strings.Contains(elem, ".")
+}
+
+// -----------------------------------------------------------------------------
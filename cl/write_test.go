@@ -0,0 +1,476 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cl_test
+
+import (
+	"bytes"
+	goast "go/ast"
+	"go/format"
+	gotoken "go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goplus/gop/cl"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/parser/parsertest"
+)
+
+func TestWriteToStable(t *testing.T) {
+	fs := parsertest.NewMemFS(map[string][]string{
+		"/foo": {"a.gop", "b.gop", "c.gop"},
+	}, map[string]string{
+		"/foo/a.gop": `import "strings"
+
+func a() string {
+	return strings.ToUpper("a")
+}
+`,
+		"/foo/b.gop": `import "github.com/goplus/gop/cl/internal/spx"
+
+func b() *spx.MyGame {
+	return nil
+}
+`,
+		"/foo/c.gop": `import "errors"
+
+func c() error {
+	println a(), b()
+	return errors.New("c")
+}
+`,
+	})
+	var last string
+	for i := 0; i < 5; i++ {
+		pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+		if err != nil {
+			t.Fatal("ParseFSDir:", err)
+		}
+		pkg, err := cl.NewPackage("", pkgs["main"], baseConf)
+		if err != nil {
+			t.Fatal("NewPackage:", err)
+		}
+		var b bytes.Buffer
+		if err = cl.WriteTo(&b, pkg, false); err != nil {
+			t.Fatal("WriteTo:", err)
+		}
+		if i > 0 && b.String() != last {
+			t.Fatalf("WriteTo isn't stable:\n%s\nPrevious:\n%s\n", b.String(), last)
+		}
+		last = b.String()
+	}
+	const imports = `package main
+
+import (
+	errors "errors"
+	fmt "fmt"
+	strings "strings"
+
+	spx "github.com/goplus/gop/cl/internal/spx"
+)
+`
+	if !bytes.HasPrefix([]byte(last), []byte(imports)) {
+		t.Fatal("WriteTo: imports aren't sorted:\n", last)
+	}
+}
+
+func TestASTFile(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `import "strings"
+
+func upper(s string) string {
+	return strings.ToUpper(s)
+}
+
+println upper("Hi")
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.NoFileLine = false
+	pkg, err := cl.NewPackage("", pkgs["main"], &conf)
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	fset := gotoken.NewFileSet()
+	f, err := cl.ASTFile(fset, pkg, false)
+	if err != nil {
+		t.Fatal("ASTFile:", err)
+	}
+	if f.Name.Name != "main" || len(f.Imports) != 2 {
+		t.Fatal("ASTFile:", f.Name, f.Imports)
+	}
+	var ret *goast.ReturnStmt
+	goast.Inspect(f, func(n goast.Node) bool {
+		if stmt, ok := n.(*goast.ReturnStmt); ok {
+			ret = stmt
+		}
+		return ret == nil
+	})
+	if ret == nil {
+		t.Fatal("ASTFile: return statement not found")
+	}
+	if pos := fset.Position(ret.Pos()); pos.Filename != "/foo/bar.gop" || pos.Line != 4 {
+		t.Fatal("ASTFile: position of the return statement -", pos)
+	}
+	if pos := fset.PositionFor(ret.Pos(), false); pos.Filename != "gop_autogen.go" {
+		t.Fatal("ASTFile: unadjusted position of the return statement -", pos)
+	}
+	if f, err = cl.ASTFile(fset, pkg, true); err != nil || len(f.Decls) != 0 {
+		t.Fatal("ASTFile testing file:", f, err)
+	}
+}
+
+func TestInlineFuncs(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `import "strings"
+
+type T struct {
+	n int
+}
+
+func (t *T) inc() int {
+	t.n++
+	return t.n
+}
+
+func add(a, b int) int {
+	return a + b
+}
+
+func half(x float64) float64 {
+	return x / 2
+}
+
+func upper(s string) string {
+	return strings.ToUpper(s)
+}
+
+func fact(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return n * fact(n-1)
+}
+
+func twice(a int) int {
+	return a * 2
+}
+
+func next(t T) int {
+	return t.inc()
+}
+
+var a = 1
+
+func incA() int {
+	a++
+	return a
+}
+
+func id(x int) int {
+	return x + 0
+}
+
+x := 3
+s := "hi"
+println add(x, 1)*2, half(1), upper(s), fact(x), twice(x), next(T{})
+f := twice
+println f(x), twice(x+1)
+println id(a), incA()
+println id(a), twice(x)
+a = id(a)
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.InlineFuncs = true
+	pkg, err := cl.NewPackage("", pkgs["main"], &conf)
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	var b bytes.Buffer
+	if err = cl.WriteTo(&b, pkg, false); err != nil {
+		t.Fatal("WriteTo:", err)
+	}
+	const expected = `package main
+
+import (
+	fmt "fmt"
+	strings "strings"
+)
+
+type T struct {
+	n int
+}
+
+func (t *T) inc() int {
+	t.n++
+	return t.n
+}
+func fact(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return n * fact(n-1)
+}
+func twice(a int) int {
+	return a * 2
+}
+func next(t T) int {
+	return t.inc()
+}
+
+var a = 1
+
+func incA() int {
+	a++
+	return a
+}
+func id(x int) int {
+	return x + 0
+}
+func main() {
+	x := 3
+	s := "hi"
+	fmt.Println((x+int(1))*2, float64(1)/2, strings.ToUpper(s), fact(x), x*2, next(T{}))
+	f := twice
+	fmt.Println(f(x), twice(x+1))
+	fmt.Println(id(a), incA())
+	fmt.Println(a+0, x*2)
+	a = id(a)
+}
+`
+	if b.String() != expected {
+		t.Fatalf("WriteTo:\n%s\nExpected:\n%s\n", b.String(), expected)
+	}
+}
+
+func TestInlineFuncsGoFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, code := range map[string]string{
+		"helper.go":      "package main\n\nvar three = add(1, 2)\n",
+		"gop_autogen.go": "package main\n\nvar four = twice(2)\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `func add(a, b int) int {
+	return a + b
+}
+
+func twice(a int) int {
+	return a * 2
+}
+
+x := 3
+println add(x, 1), twice(x)
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.InlineFuncs = true
+	conf.TargetDir = dir
+	pkg, err := cl.NewPackage("", pkgs["main"], &conf)
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	var b bytes.Buffer
+	if err = cl.WriteTo(&b, pkg, false); err != nil {
+		t.Fatal("WriteTo:", err)
+	}
+	const expected = `package main
+
+import fmt "fmt"
+
+func add(a int, b int) int {
+	return a + b
+}
+func main() {
+	x := 3
+	fmt.Println(add(x, 1), x*2)
+}
+`
+	if b.String() != expected { // add is called by helper.go, but not by the generated gop_autogen.go
+		t.Fatalf("WriteTo:\n%s\nExpected:\n%s\n", b.String(), expected)
+	}
+}
+
+func TestGoAPI(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `package foo
+
+// Pi is pi.
+const Pi = 3.14
+
+// Group of consts.
+const (
+	// A is a.
+	A = 1
+	B = 2 // B is b.
+)
+
+// Point is a point.
+type Point struct {
+	// X is x.
+	X int
+	Y int // Y is y.
+}
+
+// Shape is a shape.
+type Shape interface {
+	// Area returns the area.
+	Area() float64
+}
+
+// Sum returns the sum of a and b.
+//
+// It's exported to Go.
+func Sum(a, b int, p *Point) (int, error) {
+	return a + b, nil
+}
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.NoFileLine = true
+	conf.GoAPI = true
+	pkg, err := cl.NewPackage("", pkgs["foo"], &conf)
+	if err != nil {
+		t.Fatal("NewPackage:", err)
+	}
+	fset := gotoken.NewFileSet()
+	f, err := cl.ASTFile(fset, pkg, false)
+	if err != nil {
+		t.Fatal("ASTFile:", err)
+	}
+	var sum *goast.FuncDecl
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*goast.FuncDecl); ok && fn.Name.Name == "Sum" {
+			sum = fn
+		}
+	}
+	if sum == nil || sum.Doc.Text() != "Sum returns the sum of a and b.\n\nIt's exported to Go.\n" {
+		t.Fatal("Sum doc:", sum)
+	}
+	var b bytes.Buffer
+	if err = format.Node(&b, fset, sum.Type); err != nil {
+		t.Fatal("format.Node:", err)
+	}
+	if sig := b.String(); sig != "func(a int, b int, p *Point) (int, error)" {
+		t.Fatal("Sum signature:", sig)
+	}
+
+	b.Reset()
+	if err = cl.WriteTo(&b, pkg, false); err != nil {
+		t.Fatal("WriteTo:", err)
+	}
+	const expected = `package foo
+
+// Pi is pi.
+const Pi = 3.14
+
+// Group of consts.
+const (
+	// A is a.
+	A = 1
+	B = 2 // B is b.
+)
+
+// Point is a point.
+type Point struct {
+	// X is x.
+	X int
+	Y int // Y is y.
+}
+
+// Shape is a shape.
+type Shape interface {
+	// Area returns the area.
+	Area() float64
+}
+
+// Sum returns the sum of a and b.
+//
+// It's exported to Go.
+func Sum(a int, b int, p *Point) (int, error) {
+	return a + b, nil
+}
+`
+	if b.String() != expected {
+		t.Fatalf("WriteTo:\n%s\nExpected:\n%s\n", b.String(), expected)
+	}
+}
+
+func TestGoAPIError(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `package foo
+
+type Point struct {
+	X, Y int
+}
+
+func (a Point) + (b Point) Point {
+	return Point{a.X + b.X, a.Y + b.Y}
+}
+
+type Nums struct {
+	N bigint
+	n bigint
+}
+
+func Big(x int) bigint {
+	return bigint(x)
+}
+
+func big(x int) bigint {
+	return bigint(x)
+}
+
+var Bigs []bigint
+`)
+	pkgs, err := parser.ParseFSDir(gblFset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir:", err)
+	}
+	conf := *baseConf.Ensure()
+	conf.GoAPI = true
+	_, err = cl.NewPackage("", pkgs["foo"], &conf)
+	if err == nil {
+		t.Fatal("NewPackage: no error?")
+	}
+	msg := err.Error()
+	for _, want := range []string{
+		"bar.gop:16:1: exported func Big refers to builtin.Gop_bigint synthesized by Go+",
+		"bar.gop:24:5: exported var Bigs refers to builtin.Gop_bigint synthesized by Go+",
+		"bar.gop:12:2: exported field Nums.N refers to builtin.Gop_bigint synthesized by Go+",
+		"bar.gop:7:1: exported method Point.Gop_Add is synthesized by Go+ for an operator",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("NewPackage: %s\nExpected: %s", msg, want)
+		}
+	}
+	if strings.Contains(msg, "big ") || strings.Contains(msg, "Nums.n") {
+		t.Fatal("NewPackage: unexported API reported -", msg)
+	}
+}
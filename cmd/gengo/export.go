@@ -0,0 +1,282 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gengo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	goparser "go/parser"
+	gotoken "go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+
+	"github.com/goplus/gop/env"
+)
+
+const (
+	gopModPath = "github.com/goplus/gop"
+
+	// gopDevVersion is the version of github.com/goplus/gop required by an
+	// exported module when Go+ isn't a released version, which is replaced by
+	// GOPROOT then.
+	gopDevVersion = "v0.0.0-00010101000000-000000000000"
+
+	// generatedHeader marks Go files generated from Go+ code, see
+	// https://golang.org/s/generatedcode.
+	generatedHeader = "// Code generated by gop (Go+); DO NOT EDIT.\n\n"
+)
+
+// Export exports the Go+ packages in srcDir (and its subdirectories), whose Go
+// files are generated by GenGo, into outDir as a Go module which can be built
+// by the go command without Go+:
+//
+//   - Go+ source files are left out, and other files (.go files, embedded
+//     files, etc.) are copied, in the same directory structure.
+//   - Generated Go files are marked as generated by a header comment.
+//   - go.mod is made from the one of the module srcDir belongs to, with the
+//     module path of srcDir, and relative paths of replace directives made
+//     absolute. github.com/goplus/gop is required if the generated code
+//     imports it, at the version of Go+ (see env.Version), or replaced by
+//     GOPROOT if Go+ isn't a released version.
+//   - go.sum is the one of the module, with the checksums of Go+ and its
+//     dependencies added if it's required. The ones of a released Go+ are
+//     looked up by go mod download.
+func Export(srcDir, outDir string) (err error) {
+	if srcDir, err = filepath.Abs(srcDir); err != nil {
+		return
+	}
+	if outDir, err = filepath.Abs(outDir); err != nil {
+		return
+	}
+	if outDir == srcDir {
+		return errors.New("gop go: output directory can't be the source directory")
+	}
+	modRoot, err := env.FindModRoot(srcDir)
+	if err != nil {
+		return
+	}
+	gomod := filepath.Join(modRoot, "go.mod")
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return
+	}
+	mod, err := modfile.Parse(gomod, data, nil)
+	if err != nil {
+		return
+	}
+	usesGop := false
+	err = filepath.WalkDir(srcDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if file != srcDir && (strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") || file == outDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || isSourceFile(name) || file == gomod {
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, file)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		switch name {
+		case autoGenFile, autoGenTestFile, autoGen2TestFile:
+			if importsGop(file, data) {
+				usesGop = true
+			}
+			data = append([]byte(generatedHeader), data...)
+		}
+		target := filepath.Join(outDir, rel)
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+	if err != nil {
+		return
+	}
+	return exportModFile(mod, modRoot, srcDir, outDir, usesGop)
+}
+
+// isSourceFile reports whether a file is a Go+ source file (or gop.mod), which
+// is left out by Export.
+func isSourceFile(name string) bool {
+	if name == "gop.mod" {
+		return true
+	}
+	flag, ok := extPkgFlags[filepath.Ext(name)]
+	return ok && flag != PkgFlagGo
+}
+
+func importsGop(file string, data []byte) bool {
+	f, err := goparser.ParseFile(gotoken.NewFileSet(), file, data, goparser.ImportsOnly)
+	if err != nil {
+		return false
+	}
+	for _, imp := range f.Imports {
+		if pkgPath, err := strconv.Unquote(imp.Path.Value); err == nil {
+			if pkgPath == gopModPath || strings.HasPrefix(pkgPath, gopModPath+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func exportModFile(mod *modfile.File, modRoot, srcDir, outDir string, usesGop bool) (err error) {
+	if mod.Module == nil {
+		return errors.New("gop go: no module path in " + filepath.Join(modRoot, "go.mod"))
+	}
+	rel, err := filepath.Rel(modRoot, srcDir)
+	if err != nil {
+		return
+	}
+	if rel != "." {
+		if err = mod.AddModuleStmt(path.Join(mod.Module.Mod.Path, filepath.ToSlash(rel))); err != nil {
+			return
+		}
+	}
+	for _, r := range mod.Replace {
+		if r.New.Version == "" && modfile.IsDirectoryPath(r.New.Path) && !filepath.IsAbs(r.New.Path) {
+			dir := filepath.Join(modRoot, filepath.FromSlash(r.New.Path))
+			if err = mod.AddReplace(r.Old.Path, r.Old.Version, dir, ""); err != nil {
+				return
+			}
+		}
+	}
+	var sums []string
+	if usesGop && mod.Module.Mod.Path != gopModPath && !requires(mod, gopModPath) {
+		if sums, err = requireGop(mod); err != nil {
+			return
+		}
+	}
+	mod.Cleanup()
+	data, err := mod.Format()
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(outDir, 0755); err != nil {
+		return
+	}
+	if err = os.WriteFile(filepath.Join(outDir, "go.mod"), data, 0644); err != nil {
+		return
+	}
+	gosum, err := os.ReadFile(filepath.Join(modRoot, "go.sum"))
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if sums == nil {
+		if gosum == nil {
+			return nil
+		}
+		return os.WriteFile(filepath.Join(outDir, "go.sum"), gosum, 0644)
+	}
+	return os.WriteFile(filepath.Join(outDir, "go.sum"), mergeSums(gosum, sums), 0644)
+}
+
+// requireGop adds the requirement of github.com/goplus/gop to mod, and returns
+// the go.sum lines it needs: the ones of GOPROOT (the dependencies of Go+),
+// and the ones of Go+ itself if it's a released version.
+func requireGop(mod *modfile.File) (sums []string, err error) {
+	gopRoot := env.GOPROOT()
+	gosum, err := os.ReadFile(filepath.Join(gopRoot, "go.sum"))
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	sums = strings.Split(string(gosum), "\n")
+	ver := env.Version()
+	if !semver.IsValid(ver) || semver.Build(ver) != "" {
+		if err = mod.AddRequire(gopModPath, gopDevVersion); err != nil {
+			return
+		}
+		err = mod.AddReplace(gopModPath, "", gopRoot, "")
+		return
+	}
+	if err = mod.AddRequire(gopModPath, ver); err != nil {
+		return
+	}
+	gopSums, err := downloadSums(gopModPath, ver)
+	if err != nil {
+		return
+	}
+	return append(sums, gopSums...), nil
+}
+
+// downloadSums returns the go.sum lines of module modPath@ver, downloading it
+// into the module cache if it isn't there.
+func downloadSums(modPath, ver string) ([]string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("go", "mod", "download", "-json", modPath+"@"+ver)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gop go: go mod download %s@%s failed: %v\n%s", modPath, ver, err, stderr.Bytes())
+	}
+	var info struct {
+		Sum, GoModSum string
+	}
+	if err = json.Unmarshal(out, &info); err != nil {
+		return nil, err
+	}
+	return []string{
+		modPath + " " + ver + " " + info.Sum,
+		modPath + " " + ver + "/go.mod " + info.GoModSum,
+	}, nil
+}
+
+// mergeSums returns go.sum with lines added, sorted and without duplicates as
+// the go command writes it.
+func mergeSums(gosum []byte, lines []string) []byte {
+	all := append(strings.Split(string(gosum), "\n"), lines...)
+	sort.Strings(all)
+	var b bytes.Buffer
+	for i, line := range all {
+		if line != "" && (i == 0 || line != all[i-1]) {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
+
+func requires(mod *modfile.File, modPath string) bool {
+	for _, r := range mod.Require {
+		if r.Mod.Path == modPath {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gengo_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goplus/gop/cmd/gengo"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"go.mod":              "module example.com/foo\n\ngo 1.16\n",
+		"app/main.gop":        `println "Hi"`,
+		"app/data.txt":        "data",
+		"app/_skip/skip.txt":  "skip",
+		"app/lib/lib.go":      "package lib\n\nconst Name = \"lib\"\n",
+		"app/gop_autogen.go":  "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/foo/app/lib\"\n\t\"github.com/goplus/gop/env\"\n)\n\nfunc main() {\n\tfmt.Println(lib.Name, env.Version())\n}\n",
+		"app/lib/gop_test.go": "package lib\n",
+	})
+	out := filepath.Join(t.TempDir(), "out")
+	if err := gengo.Export(filepath.Join(src, "app"), out); err != nil {
+		t.Fatal("Export:", err)
+	}
+	for _, name := range []string{"main.gop", "_skip/skip.txt"} {
+		if _, err := os.Stat(filepath.Join(out, name)); !os.IsNotExist(err) {
+			t.Fatal("Export: not left out -", name, err)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(out, "data.txt")); err != nil || string(data) != "data" {
+		t.Fatal("Export: data.txt -", string(data), err)
+	}
+	data, err := os.ReadFile(filepath.Join(out, "gop_autogen.go"))
+	if err != nil || !strings.HasPrefix(string(data), "// Code generated by gop (Go+); DO NOT EDIT.\n\npackage main\n") {
+		t.Fatal("Export: gop_autogen.go -", string(data), err)
+	}
+	data, err = os.ReadFile(filepath.Join(out, "go.mod"))
+	if err != nil || !strings.HasPrefix(string(data), "module example.com/foo/app\n") ||
+		!strings.Contains(string(data), "github.com/goplus/gop") {
+		t.Fatal("Export: go.mod -", string(data), err)
+	}
+
+	// the exported module builds without Go+, and without fetching anything
+	cmd := exec.Command("go", "build", "-o", os.DevNull, ".")
+	cmd.Dir = out
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=readonly", "GOPROXY=off")
+	if data, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, data)
+	}
+}
+
+func TestExportError(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"go.mod":  "module example.com/foo\n",
+		"foo.gop": `println "Hi"`,
+	})
+	if err := gengo.Export(src, src); err == nil {
+		t.Fatal("Export: no error exporting into the source directory")
+	}
+	if err := gengo.Export(filepath.Join(src, "nodir"), t.TempDir()); err == nil {
+		t.Fatal("Export: no error exporting a directory not found")
+	}
+	writeFiles(t, src, map[string]string{"go.mod": "go 1.16\n"})
+	if err := gengo.Export(src, t.TempDir()); err == nil || !strings.Contains(err.Error(), "no module path") {
+		t.Fatal("Export:", err)
+	}
+}
@@ -89,6 +89,7 @@ func (p *Runner) GenGo(dir string, recursive bool, base *cl.Config) {
 	var gopTime time.Time
 	var gogenTime time.Time
 	var pkgFlags int
+	var hasGopTest, hasGenTest bool
 	for _, fi := range fis {
 		fname := fi.Name()
 		if strings.HasPrefix(fname, "_") {
@@ -112,11 +113,13 @@ func (p *Runner) GenGo(dir string, recursive bool, base *cl.Config) {
 					if (pkgFlags&PkgFlagGoGen) == 0 || gogenTime.After(modTime) {
 						gogenTime = modTime
 					}
+					hasGenTest = hasGenTest || fname != autoGenFile
 				}
 			default:
 				if modTime.After(gopTime) {
 					gopTime = modTime
 				}
+				hasGopTest = hasGopTest || strings.HasSuffix(fname, "_test.gop")
 			}
 			pkgFlags |= flag
 		}
@@ -124,7 +127,7 @@ func (p *Runner) GenGo(dir string, recursive bool, base *cl.Config) {
 	if pkgFlags != 0 {
 		if (pkgFlags & PkgFlagGo) != 0 { // a Go package
 			// TODO: depency check
-		} else if gopTime.After(gogenTime) { // update a Go+ package
+		} else if gopTime.After(gogenTime) || hasGenTest && !hasGopTest { // update a Go+ package, or remove stale tests
 			fmt.Printf("GenGoPkg %s\n", dir)
 			pkgFlags |= PkgFlagGopModified
 			p.GenGoPkg(dir, base)
@@ -203,10 +206,12 @@ func (p *Runner) GenGoPkg(pkgDir string, base *cl.Config) (err error) {
 		if err != nil {
 			return p.addError(pkgDir, "compile", err)
 		}
-		err = gox.WriteFile(filepath.Join(pkgDir, autoGen2TestFile), out, true)
+		err = cl.WriteFile(filepath.Join(pkgDir, autoGen2TestFile), out, true)
 		if err != nil {
 			return p.addError(pkgDir, "save", err)
 		}
+	} else if err = removeStale(filepath.Join(pkgDir, autoGen2TestFile)); err != nil {
+		return p.addError(pkgDir, "save", err)
 	}
 	return nil
 }
@@ -222,12 +227,21 @@ func saveGoFile(dir string, pkg *gox.Package) error {
 	if err != nil {
 		return err
 	}
-	err = gox.WriteFile(filepath.Join(dir, autoGenFile), pkg, false)
+	err = cl.WriteFile(filepath.Join(dir, autoGenFile), pkg, false)
 	if err != nil {
 		return err
 	}
 	if pkg.HasTestingFile() {
-		return gox.WriteFile(filepath.Join(dir, autoGenTestFile), pkg, true)
+		return cl.WriteFile(filepath.Join(dir, autoGenTestFile), pkg, true)
+	}
+	return removeStale(filepath.Join(dir, autoGenTestFile))
+}
+
+// removeStale removes a Go file generated from Go+ files which don't exist
+// any more (eg. *_test.gop files), so it isn't compiled with the package.
+func removeStale(file string) error {
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
 	}
 	return nil
 }
@@ -28,11 +28,15 @@ import (
 	"github.com/goplus/gop/cmd/internal/base"
 	"github.com/goplus/gop/cmd/internal/build"
 	"github.com/goplus/gop/cmd/internal/clean"
+	"github.com/goplus/gop/cmd/internal/doc"
 	"github.com/goplus/gop/cmd/internal/env"
+	"github.com/goplus/gop/cmd/internal/fix"
+	"github.com/goplus/gop/cmd/internal/generate"
 	"github.com/goplus/gop/cmd/internal/gengo"
 	"github.com/goplus/gop/cmd/internal/gopfmt"
 	"github.com/goplus/gop/cmd/internal/help"
 	"github.com/goplus/gop/cmd/internal/install"
+	"github.com/goplus/gop/cmd/internal/list"
 	"github.com/goplus/gop/cmd/internal/mod"
 	"github.com/goplus/gop/cmd/internal/run"
 	"github.com/goplus/gop/cmd/internal/test"
@@ -50,12 +54,16 @@ func init() {
 		run.Cmd,
 		gengo.Cmd,
 		gopfmt.Cmd,
+		fix.Cmd,
 		mod.Cmd,
 		install.Cmd,
 		build.Cmd,
 		bug.Cmd,
 		clean.Cmd,
+		doc.Cmd,
 		env.Cmd,
+		generate.Cmd,
+		list.Cmd,
 		test.Cmd,
 		version.Cmd,
 	}
@@ -99,6 +107,10 @@ BigCmdLoop:
 			if !cmd.Runnable() {
 				continue
 			}
+			args, err := cmd.WithEnvFlags(args)
+			if err != nil {
+				log.Fatalln(err)
+			}
 			cmd.Run(cmd, args)
 			return
 		}
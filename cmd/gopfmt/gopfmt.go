@@ -17,6 +17,7 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"io"
@@ -26,7 +27,10 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/goplus/gop/cmd/internal/diff"
 	"github.com/goplus/gop/format"
+
+	xformat "github.com/goplus/gop/x/format"
 )
 
 var (
@@ -43,7 +47,15 @@ var (
 
 var (
 	// main operation modes
-	write = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	write  = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	doDiff = flag.Bool("d", false, "display diffs instead of rewriting files")
+
+	// additional operations
+	simplifyAST = flag.Bool("s", false, "simplify code")
+	imports     = flag.String("imports", "keep", "group imports: keep, single or std (standard library, third-party and local ones)")
+	localPrefix = flag.String("local", "", "put imports beginning with this string after third-party ones in -imports std mode (comma-separated)")
+
+	importOpts xformat.ImportOptions
 )
 
 func usage() {
@@ -52,7 +64,7 @@ func usage() {
 }
 
 func report(err error) {
-	fmt.Println(err)
+	fmt.Fprintln(os.Stderr, err)
 	os.Exit(2)
 }
 
@@ -69,11 +81,29 @@ func processFile(filename string, in io.Reader, out io.Writer) error {
 		return err
 	}
 
-	res, err := format.Source(src, filename)
+	// Like gofmt, the result always ends with exactly one newline, whether src
+	// misses it or not, so formatting is the same for files and stdin.
+	var res []byte
+	if *simplifyAST {
+		res, err = xformat.SimplifySource(src, filename)
+	} else {
+		res, err = format.Source(src, filename)
+	}
+	if err == nil && importOpts.Grouping != xformat.ImportsKept {
+		res, err = xformat.GroupImportsSource(res, &importOpts, filename)
+	}
 	if err != nil {
 		return err
 	}
 
+	if *doDiff {
+		if bytes.Equal(src, res) {
+			return nil
+		}
+		_, err = out.Write(diff.Diff(filename+".orig", src, filename, res))
+		return err
+	}
+
 	if *write {
 		dir, file := filepath.Split(filename)
 		f, err := ioutil.TempFile(dir, file)
@@ -123,8 +153,14 @@ func main() {
 	flag.Usage = usage
 	flag.Parse()
 
+	grouping, err := xformat.ParseImportGrouping(*imports)
+	if err != nil {
+		report(err)
+	}
+	importOpts = xformat.ImportOptions{Grouping: grouping, LocalPrefix: *localPrefix}
+
 	args := flag.Args()
-	if len(args) == 0 {
+	if len(args) == 0 || (len(args) == 1 && args[0] == "-") {
 		if *write {
 			report(fmt.Errorf("error: cannot use -w with standard input"))
 			return
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Run as gopfmt with the arguments in GOPFMT_TEST_ARGS, see runGopfmt.
+	if args, ok := os.LookupEnv("GOPFMT_TEST_ARGS"); ok {
+		os.Args = append([]string{"gopfmt"}, strings.Fields(args)...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runGopfmt runs gopfmt with args in a child process, and returns its stdout
+// and exit code.
+func runGopfmt(t *testing.T, stdin string, args ...string) (string, int) {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "GOPFMT_TEST_ARGS="+strings.Join(args, " "))
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	if e, ok := err.(*exec.ExitError); ok {
+		return stdout.String(), e.ExitCode()
+	} else if err != nil {
+		t.Fatal("run gopfmt:", err)
+	}
+	return stdout.String(), 0
+}
+
+func TestStdin(t *testing.T) {
+	for _, args := range [][]string{nil, {"-"}} {
+		for _, in := range []string{"println  \"Hi\"", "println \"Hi\"\n", "println \"Hi\"\n\n\n"} {
+			out, code := runGopfmt(t, in, args...)
+			if code != 0 || out != "println \"Hi\"\n" {
+				t.Fatalf("gopfmt %v < %q: %q, exit code %d", args, in, out, code)
+			}
+		}
+	}
+	if out, code := runGopfmt(t, "println (", "-"); code == 0 || out != "" {
+		t.Fatalf("gopfmt - with syntax errors: %q, exit code %d", out, code)
+	}
+	if _, code := runGopfmt(t, "println 1\n", "-w", "-"); code == 0 {
+		t.Fatal("gopfmt -w -: no error?")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.gop")
+	src := "println  \"Hi\"\nprintln \"Go+\""
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, code := runGopfmt(t, "", "-d", file)
+	expected := `--- ` + file + `.orig
++++ ` + file + `
+@@ -1,2 +1,2 @@
+-println  "Hi"
+-println "Go+"
+\ No newline at end of file
++println "Hi"
++println "Go+"
+`
+	if code != 0 || out != expected {
+		t.Fatalf("gopfmt -d: exit code %d\n%s", code, out)
+	}
+	if b, _ := os.ReadFile(file); string(b) != src {
+		t.Fatal("gopfmt -d changes the file:", string(b))
+	}
+
+	out, code = runGopfmt(t, src, "-d")
+	if code != 0 || !strings.HasPrefix(out, "--- <standard input>.orig\n+++ <standard input>\n@@ -1,2 +1,2 @@\n") {
+		t.Fatalf("gopfmt -d < stdin: exit code %d\n%s", code, out)
+	}
+
+	runGopfmt(t, "", "-w", file)
+	if out, code = runGopfmt(t, "", "-d", file); code != 0 || out != "" {
+		t.Fatalf("gopfmt -d of a formatted file: exit code %d\n%s", code, out)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goplus/gop/x/gopmod"
+	"github.com/goplus/gop/x/gopproj"
+)
+
+// -----------------------------------------------------------------------------
+
+var (
+	errInvalidCount = errors.New("-count requires a positive number")
+	errWatchCount   = errors.New("cannot watch the program run more than once (-count)")
+	errInvalidDir   = errors.New("-dir requires a directory")
+)
+
+// runFlags are the flags of goprun before the package, see parseRunFlags.
+type runFlags struct {
+	count     int    // -count N: run the program N times
+	keepGoing bool   // -keep-going: keep running after a failed run
+	dir       string // -dir dir: working directory of the program, the current one if empty
+	watch     bool   // -w: rerun the program whenever its source files change
+}
+
+// parseRunFlags extracts the leading -w, -count N (or -count=N), -keep-going
+// and -dir dir (or -dir=dir) flags from args, in any order. Build tags (-tags tag,list) may be
+// mixed with them, and the last one is kept in next, so that -tags on the
+// command line overrides the one in GOPFLAGS (see withEnvFlags).
+func parseRunFlags(args []string) (flags runFlags, next []string, err error) {
+	flags.count = 1
+	var tags []string
+	for len(args) > 0 {
+		arg := args[0]
+		name := gopproj.FlagName(arg)
+		if name == "" || arg == gopproj.Stdin {
+			break
+		}
+		n := 1
+		switch name {
+		case "count", "dir":
+			var val string
+			if pos := strings.IndexByte(arg, '='); pos >= 0 {
+				val = arg[pos+1:]
+			} else if len(args) > 1 {
+				val, n = args[1], 2
+			}
+			if name == "dir" {
+				if val == "" {
+					return runFlags{}, nil, errInvalidDir
+				}
+				flags.dir = val
+			} else if flags.count, err = strconv.Atoi(val); err != nil || flags.count < 1 {
+				return runFlags{}, nil, errInvalidCount
+			}
+		case "keep-going":
+			flags.keepGoing = true
+		case "w":
+			flags.watch = true
+		case "tags":
+			if !strings.Contains(arg, "=") && len(args) > 1 {
+				n = 2
+			}
+			tags = args[:n]
+		default:
+			return flags, append(tags, args...), nil
+		}
+		args = args[n:]
+	}
+	return flags, append(tags, args...), nil
+}
+
+// runCount builds goProj once, and runs the built program count times in
+// sequence with args (see repeat) in the directory goProj.ExecDir.
+func runCount(ctx *gopmod.Context, goProj *gopmod.Project, args []string, count int, keepGoing bool) error {
+	dir, err := os.MkdirTemp("", "goprun")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	outFile := filepath.Join(dir, "main")
+	if runtime.GOOS == "windows" {
+		outFile += ".exe"
+	}
+	build := ctx.BuildProject(outFile, goProj)
+	build.Stdout = os.Stderr
+	build.Stderr = os.Stderr
+	if err = build.Run(); err != nil {
+		return fmt.Errorf("build failed: %v", err)
+	}
+	return repeat(os.Stderr, count, keepGoing, func() *exec.Cmd {
+		cmd := exec.Command(outFile, args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = os.Environ()
+		cmd.Dir = goProj.ExecDir
+		return cmd
+	})
+}
+
+// repeat runs the commands returned by newCmd count times in sequence, and
+// reports the wall time of each run and the aggregate to w. It stops at the
+// first failed run unless keepGoing is set, and returns the error of the last
+// failed run. A run killed by a signal (eg. Ctrl-C) always stops it.
+func repeat(w io.Writer, count int, keepGoing bool, newCmd func() *exec.Cmd) (err error) {
+	var total, min, max time.Duration
+	runs := 0
+	for runs < count {
+		start := time.Now()
+		e := runCmd(&procCmd{Cmd: newCmd()})
+		d := time.Since(start)
+		runs++
+		total += d
+		if runs == 1 || d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+		if e != nil {
+			fmt.Fprintf(w, "[goprun] run %d: %v (%v)\n", runs, d, e)
+			err = e
+			if !keepGoing || isSignaled(e) {
+				break
+			}
+			continue
+		}
+		fmt.Fprintf(w, "[goprun] run %d: %v\n", runs, d)
+	}
+	fmt.Fprintf(w, "[goprun] %d runs: total %v, min %v, avg %v, max %v\n", runs, total, min, total/time.Duration(runs), max)
+	return
+}
+
+func isSignaled(err error) bool {
+	if e, ok := err.(*exec.ExitError); ok {
+		ws, ok := e.Sys().(interface{ Signaled() bool })
+		return ok && ws.Signaled()
+	}
+	return false
+}
+
+// procCmd is an exec.Cmd which can be signaled (see runCmd) while running.
+type procCmd struct {
+	*exec.Cmd
+	mutex   sync.Mutex
+	started bool
+}
+
+func (p *procCmd) Run() error {
+	p.mutex.Lock()
+	err := p.Start()
+	p.started = err == nil
+	p.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return p.Wait()
+}
+
+func (p *procCmd) Signal(sig os.Signal) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.started {
+		return os.ErrProcessDone
+	}
+	return p.Process.Signal(sig)
+}
+
+// -----------------------------------------------------------------------------
@@ -4,40 +4,112 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
+	"strings"
 
 	"github.com/goplus/gop/x/gopmod"
 	"github.com/goplus/gop/x/gopproj"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprint(os.Stderr, "Usage: goprun package [arguments ...]\n\n")
+	args, err := withEnvFlags(os.Args[1:])
+	if err != nil {
+		log.Fatalln(err)
+	}
+	flags, args, err := parseRunFlags(args)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	flagWatch := flags.watch
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, "Usage: goprun [-w] [-count N [-keep-going]] [-dir dir] [-tags tag,list] package|- [arguments ...]\n\n")
 		return
 	}
-	proj, args, err := gopproj.ParseOne(os.Args[1:]...)
+	if flagWatch && flags.count > 1 {
+		log.Fatalln(errWatchCount)
+	}
+	if flags.dir != "" {
+		if fi, err := os.Stat(flags.dir); err != nil || !fi.IsDir() {
+			log.Fatalln("-dir: not a directory:", flags.dir)
+		}
+	}
+	proj, args, err := gopproj.ParseOne(args...)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	cleanup := func() {}
+	if v, ok := proj.(*gopproj.FilesProj); ok && v.IsStdin() { // read the program from stdin: echo 'println "Hi"' | goprun -
+		if flagWatch {
+			log.Fatalln(errWatchStdin)
+		}
+		if cleanup, err = gopproj.ReadStdin(v, os.Stdin, ""); err != nil {
+			log.Fatalln("read stdin failed:", err)
+		}
+		defer cleanup()
+	}
+	if flagWatch { // rerun whenever source files change
+		watch(proj, args, flags.dir)
+		return
+	}
 	var ctx = gopmod.New("")
 	goProj, err := ctx.OpenProject(0, proj)
 	if err != nil {
 		fmt.Fprint(os.Stderr, "OpenProject failed:", err)
 		return
 	}
+	if err = goProj.CheckRunnable(); err != nil {
+		cleanup()
+		log.Fatalln(err)
+	}
+	goProj.ExecDir = flags.dir
+	if flags.count > 1 { // build once, and run it count times
+		if err = runCount(ctx, goProj, args, flags.count, flags.keepGoing); err != nil {
+			cleanup()
+			exitWith(err)
+		}
+		return
+	}
 	goProj.ExecArgs = args
 	cmd := ctx.GoCommand("run", goProj)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Env = os.Environ()
-	err = cmd.Run()
-	if err != nil {
-		switch e := err.(type) {
-		case *exec.ExitError:
-			os.Exit(e.ExitCode())
-		default:
-			log.Fatalln(err)
+	if err = runCmd(cmd); err != nil {
+		cleanup()
+		exitWith(err)
+	}
+}
+
+// withEnvFlags returns args with the flags of goprun in GOPFLAGS (see
+// gopproj.FlagsEnv), -w and -tags, put before them.
+//
+// Precedence: -tags on the command line (in args) overrides -tags=... in
+// GOPFLAGS, and -w in either of them enables watching. Other flags in
+// GOPFLAGS are ignored, as they may be for other commands.
+func withEnvFlags(args []string) ([]string, error) {
+	flags, err := gopproj.EnvFlags()
+	if err != nil || len(flags) == 0 {
+		return args, err
+	}
+	var watch bool
+	var tags string
+	for _, flag := range flags {
+		switch name := gopproj.FlagName(flag); {
+		case flag == "-w":
+			watch = true
+		case name == "tags" && strings.Contains(flag, "="):
+			tags = flag
 		}
 	}
+	if _, next, err := parseRunFlags(args); err == nil && len(next) > 0 && gopproj.FlagName(next[0]) == "tags" {
+		tags = "" // errors are reported when parsing the flags again
+	}
+	ret := make([]string, 0, len(args)+2)
+	if watch {
+		ret = append(ret, "-w")
+	}
+	if tags != "" {
+		ret = append(ret, tags)
+	}
+	return append(ret, args...), nil
 }
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/goplus/gop/x/gopproj"
+)
+
+func TestWithEnvFlags(t *testing.T) {
+	old, ok := os.LookupEnv(gopproj.FlagsEnv)
+	defer func() {
+		if ok {
+			os.Setenv(gopproj.FlagsEnv, old)
+		} else {
+			os.Unsetenv(gopproj.FlagsEnv)
+		}
+	}()
+	cases := []struct {
+		env, args, expected string
+	}{
+		{"", "a.gop x", "a.gop x"},
+		{"-v -tags=foo", "a.gop", "-tags=foo a.gop"},
+		{"-tags=foo -w", "-tags bar a.gop", "-w -tags bar a.gop"},
+		{"-tags='foo,bar'", "-w --tags=baz a.gop", "-w --tags=baz a.gop"},
+		{"-tags=foo", "-w a.gop -tags", "-tags=foo -w a.gop -tags"},
+		{"-tags=foo", "-count 2 -w -tags=bar a.gop", "-count 2 -w -tags=bar a.gop"},
+	}
+	for _, c := range cases {
+		os.Setenv(gopproj.FlagsEnv, c.env)
+		args, err := withEnvFlags(strings.Fields(c.args))
+		if err != nil || strings.Join(args, " ") != c.expected {
+			t.Fatalf("withEnvFlags(%s) with %q: %v %v", c.args, c.env, args, err)
+		}
+	}
+	os.Setenv(gopproj.FlagsEnv, "-tags='foo")
+	if _, err := withEnvFlags(nil); err == nil {
+		t.Fatal("withEnvFlags: no error?")
+	}
+}
+
+func TestParseRunFlags(t *testing.T) {
+	cases := []struct {
+		args, next string
+		count      int
+		keepGoing  bool
+		dir        string
+		watch      bool
+	}{
+		{"a.gop x", "a.gop x", 1, false, "", false},
+		{"-count 3 a.gop -count 2", "a.gop -count 2", 3, false, "", false},
+		{"-tags=foo -count=2 -keep-going -tags bar a.gop", "-tags bar a.gop", 2, true, "", false},
+		{"--count=5 -tags foo - x", "-tags foo - x", 5, false, "", false},
+		{"-keep-going -v a.gop", "-v a.gop", 1, true, "", false},
+		{"-tags=foo -dir /tmp a.gop -dir x", "-tags=foo a.gop -dir x", 1, false, "/tmp", false},
+		{"-dir=assets -count 2 a.gop", "a.gop", 2, false, "assets", false},
+		{"-w a.gop -w", "a.gop -w", 1, false, "", true},
+		{"-tags foo -dir=assets -w a.gop", "-tags foo a.gop", 1, false, "assets", true},
+	}
+	for _, c := range cases {
+		flags, next, err := parseRunFlags(strings.Fields(c.args))
+		if err != nil || flags.count != c.count || flags.keepGoing != c.keepGoing || flags.dir != c.dir || flags.watch != c.watch || strings.Join(next, " ") != c.next {
+			t.Fatalf("parseRunFlags(%s): %+v %v %v", c.args, flags, next, err)
+		}
+	}
+	for _, args := range []string{"-count", "-count 0 a.gop", "-count=x a.gop"} {
+		if _, _, err := parseRunFlags(strings.Fields(args)); err != errInvalidCount {
+			t.Fatalf("parseRunFlags(%s): %v", args, err)
+		}
+	}
+	for _, args := range []string{"-dir", "-dir= a.gop"} {
+		if _, _, err := parseRunFlags(strings.Fields(args)); err != errInvalidDir {
+			t.Fatalf("parseRunFlags(%s): %v", args, err)
+		}
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	var runs int
+	newCmd := func(fail int) func() *exec.Cmd {
+		runs = 0
+		return func() *exec.Cmd {
+			runs++
+			if runs == fail {
+				return exec.Command("go", "nosuchcmd")
+			}
+			return exec.Command("go", "version")
+		}
+	}
+	var out bytes.Buffer
+	if err := repeat(&out, 3, false, newCmd(0)); err != nil || runs != 3 {
+		t.Fatal("repeat:", runs, err)
+	}
+	if !strings.Contains(out.String(), "[goprun] 3 runs: total ") {
+		t.Fatal("repeat: no aggregate -", out.String())
+	}
+	out.Reset()
+	if err := repeat(&out, 3, false, newCmd(2)); err == nil || runs != 2 {
+		t.Fatal("repeat without -keep-going:", runs, err)
+	}
+	if !strings.Contains(out.String(), "[goprun] run 2: ") || !strings.Contains(out.String(), "[goprun] 2 runs: ") {
+		t.Fatal("repeat without -keep-going:", out.String())
+	}
+	if err := repeat(&out, 3, true, newCmd(2)); err == nil || runs != 3 {
+		t.Fatal("repeat with -keep-going:", runs, err)
+	}
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+type signaler interface {
+	Run() error
+	Signal(sig os.Signal) error
+}
+
+// runCmd runs cmd, and forwards signals (see forwardSignals) received by
+// goprun to it, so that Ctrl-C stops the running program cleanly.
+func runCmd(cmd signaler) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardSignals...)
+	defer func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}()
+	go func() {
+		for sig := range sigs {
+			cmd.Signal(sig)
+		}
+	}()
+	return cmd.Run()
+}
+
+// exitWith exits goprun the same way as the program it ran, which failed
+// with err: with the same exit code, or by the same signal.
+func exitWith(err error) {
+	switch e := err.(type) {
+	case *exec.ExitError:
+		exitSignaled(e.ProcessState)
+		os.Exit(e.ExitCode())
+	default:
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build windows || plan9 || js
+// +build windows plan9 js
+
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+)
+
+// On Windows, Ctrl-C is sent to the whole console, so goprun only needs to
+// wait for the program to exit (forwarding os.Interrupt isn't supported).
+var forwardSignals = []os.Signal{os.Interrupt}
+
+func exitSignaled(ps *os.ProcessState) {
+}
@@ -0,0 +1,104 @@
+//go:build !windows && !plan9 && !js
+// +build !windows,!plan9,!js
+
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type execCmd struct {
+	*exec.Cmd
+	started chan struct{}
+}
+
+func (p execCmd) Run() error {
+	if err := p.Start(); err != nil {
+		return err
+	}
+	close(p.started)
+	return p.Wait()
+}
+
+func (p execCmd) Signal(sig os.Signal) error {
+	<-p.started
+	return p.Process.Signal(sig)
+}
+
+// TestHelperProcess isn't a real test. It's used as goprun running the shell
+// script GOPRUN_TEST_SCRIPT.
+func TestHelperProcess(t *testing.T) {
+	script := os.Getenv("GOPRUN_TEST_SCRIPT")
+	if script == "" {
+		return
+	}
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := runCmd(execCmd{cmd, make(chan struct{})}); err != nil {
+		exitWith(err)
+	}
+	os.Exit(0)
+}
+
+func helperCommand(script string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), "GOPRUN_TEST_SCRIPT="+script)
+	return cmd
+}
+
+func TestExitCode(t *testing.T) {
+	err := helperCommand("exit 3").Run()
+	if e, ok := err.(*exec.ExitError); !ok || e.ExitCode() != 3 {
+		t.Fatal("helperCommand:", err)
+	}
+}
+
+func TestForwardSignal(t *testing.T) {
+	cmd := helperCommand("echo ready; exec sleep 10")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal("StdoutPipe:", err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal("Start:", err)
+	}
+	if line, err := bufio.NewReader(out).ReadString('\n'); err != nil || line != "ready\n" {
+		t.Fatal("ReadString:", line, err)
+	}
+	start := time.Now()
+	cmd.Process.Signal(syscall.SIGINT)
+	err = cmd.Wait()
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("SIGINT isn't forwarded")
+	}
+	e, ok := err.(*exec.ExitError)
+	if !ok {
+		t.Fatal("Wait:", err)
+	}
+	ws := e.Sys().(syscall.WaitStatus)
+	if !ws.Signaled() || ws.Signal() != syscall.SIGINT {
+		t.Fatal("Wait:", err)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build !windows && !plan9 && !js
+// +build !windows,!plan9,!js
+
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var forwardSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+
+// exitSignaled re-raises the signal that terminated a process to goprun
+// itself, so shell scripts and CI see the same termination. If goprun
+// survives the signal, it exits with 128+signum, as a shell does.
+func exitSignaled(ps *os.ProcessState) {
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return
+	}
+	sig := ws.Signal()
+	signal.Reset(sig)
+	if syscall.Kill(os.Getpid(), sig) == nil {
+		time.Sleep(100 * time.Millisecond) // the signal may be handled by another thread
+	}
+	os.Exit(128 + int(sig))
+}
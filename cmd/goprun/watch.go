@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/goplus/gop/x/gopmod"
+	"github.com/goplus/gop/x/gopproj"
+)
+
+const (
+	watchInterval = 300 * time.Millisecond // interval of checking source files
+	watchDebounce = 200 * time.Millisecond // wait until no file changes for this long
+)
+
+var errWatchStdin = errors.New("cannot watch the program read from stdin")
+
+// watchExts are extensions of the source files to watch.
+var watchExts = []string{".gop", ".gmx", ".spx", ".go"}
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// watcher runs a Go+ project, and reruns it whenever its source files change.
+type watcher struct {
+	proj  gopproj.Proj
+	args  []string
+	dirs  []string // directories to watch, for a DirProj
+	files []string // files to watch, for a FilesProj
+	dir   string   // working directory of the program, the current one if empty
+
+	cmd  gopmod.GoCmd
+	done chan struct{} // closed when cmd exits
+}
+
+func watch(proj gopproj.Proj, args []string, dir string) {
+	w := &watcher{proj: proj, args: args, dir: dir}
+	switch p := proj.(type) {
+	case *gopproj.DirProj:
+		w.dirs = []string{p.Dir}
+	case *gopproj.FilesProj:
+		w.files = p.Files
+	default:
+		log.Fatalln("goprun -w: only a directory or files can be watched")
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardSignals...)
+	defer signal.Stop(sigs)
+	w.run(sigs)
+}
+
+// run runs the project, and reruns it whenever its source files change, until
+// a signal is received from stop. Then it kills the program, and waits for the
+// go command to clean up the executable it built.
+func (p *watcher) run(stop <-chan os.Signal) {
+	last := p.snapshot()
+	fmt.Fprintln(os.Stderr, "[goprun] watching for changes...")
+	p.start()
+	for {
+		select {
+		case <-stop:
+			p.stop()
+			return
+		case <-time.After(watchInterval):
+		}
+		cur := p.snapshot()
+		if sameSnapshot(last, cur) {
+			continue
+		}
+		for { // debounce rapid saves
+			time.Sleep(watchDebounce)
+			next := p.snapshot()
+			if sameSnapshot(cur, next) {
+				break
+			}
+			cur = next
+		}
+		last = cur
+		p.stop()
+		fmt.Fprintf(os.Stderr, "[goprun] %s: source changed, rebuilding...\n", time.Now().Format("15:04:05"))
+		p.start()
+	}
+}
+
+// start builds the project and runs it. If the project can't be built, the
+// error is printed, and it waits for the next change.
+func (p *watcher) start() {
+	cmd, err := p.command()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "[goprun] build failed:", err)
+		return
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	done := make(chan struct{})
+	go func() {
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintln(os.Stderr, "[goprun] exited:", err)
+		}
+		close(done)
+	}()
+	p.cmd, p.done = cmd, done
+}
+
+// stop kills the running program (or the go command building it), if any,
+// and waits for it to exit.
+func (p *watcher) stop() {
+	if p.done == nil {
+		return
+	}
+	for {
+		p.cmd.Signal(os.Kill)
+		select {
+		case <-p.done:
+			p.cmd, p.done = gopmod.GoCmd{}, nil
+			return
+		case <-time.After(watchInterval): // it was between building and running the program
+		}
+	}
+}
+
+// command returns the command to run the project. The program is built before
+// it's run (see Project.ExecDir), so that stop kills the program itself rather
+// than go run.
+func (p *watcher) command() (cmd gopmod.GoCmd, err error) {
+	defer func() { // gopmod panics on parsing or compiling errors
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	ctx := gopmod.New("")
+	goProj, err := ctx.OpenProject(0, p.proj)
+	if err != nil {
+		return
+	}
+	if err = goProj.CheckRunnable(); err != nil {
+		return
+	}
+	goProj.ExecArgs = p.args
+	goProj.ExecDir = p.dir
+	if goProj.ExecDir == "" {
+		goProj.ExecDir = "."
+	}
+	return ctx.GoCommand("run", goProj), nil
+}
+
+// snapshot returns states of the source files to watch. Deleted files are
+// just absent, so deleting and restoring a file are both changes.
+func (p *watcher) snapshot() map[string]fileStat {
+	ret := make(map[string]fileStat)
+	add := func(file string, fi os.FileInfo) {
+		ret[file] = fileStat{modTime: fi.ModTime(), size: fi.Size()}
+	}
+	for _, file := range p.files {
+		if fi, err := os.Stat(file); err == nil {
+			add(file, fi)
+		}
+	}
+	for _, dir := range p.dirs {
+		fis, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range fis {
+			name := e.Name()
+			if e.IsDir() || !isWatched(name) {
+				continue
+			}
+			if fi, err := e.Info(); err == nil {
+				add(filepath.Join(dir, name), fi)
+			}
+		}
+	}
+	return ret
+}
+
+func isWatched(name string) bool {
+	if strings.HasPrefix(name, "gop_autogen") || strings.HasPrefix(name, ".") {
+		return false
+	}
+	ext := filepath.Ext(name)
+	for _, v := range watchExts {
+		if ext == v {
+			return true
+		}
+	}
+	return false
+}
+
+func sameSnapshot(a, b map[string]fileStat) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, st := range a {
+		if v, ok := b[file]; !ok || v.size != st.size || !v.modTime.Equal(st.modTime) {
+			return false
+		}
+	}
+	return true
+}
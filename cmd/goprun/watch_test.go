@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goplus/gop/x/gopmod"
+	"github.com/goplus/gop/x/gopproj"
+)
+
+func TestWatchRestore(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	runCache, dir := t.TempDir(), t.TempDir()
+	gomod := "module goplus.org/userapp\n\ngo 1.16\n\nrequire github.com/goplus/gop v1.0.0" +
+		"\n\nreplace github.com/goplus/gop => " + filepath.ToSlash(gopmod.GOPROOT) + "\n"
+	if err := os.WriteFile(filepath.Join(runCache, "go.mod"), []byte(gomod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if gosum, err := os.ReadFile(filepath.Join(gopmod.GOPROOT, "go.sum")); err == nil {
+		os.WriteFile(filepath.Join(runCache, "go.sum"), gosum, 0644)
+	}
+	old, ok := os.LookupEnv("GOPRUNCACHE")
+	os.Setenv("GOPRUNCACHE", runCache)
+	defer func() {
+		if ok {
+			os.Setenv("GOPRUNCACHE", old)
+		} else {
+			os.Unsetenv("GOPRUNCACHE")
+		}
+	}()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil { // not in a module, so the project is built in the run cache
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	src := filepath.Join(dir, "main.gop")
+	write := func(msg string) {
+		code := "import \"os\"\n\nos.WriteFile \"out.txt\", []byte(\"" + msg + "\"), 0644\n"
+		if err := os.WriteFile(src, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitOutput := func(msg string) {
+		for i := 0; i < 300; i++ {
+			if b, _ := os.ReadFile(filepath.Join(dir, "out.txt")); string(b) == msg {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatal("the program isn't run with:", msg)
+	}
+	write("v1")
+	w := &watcher{proj: &gopproj.DirProj{Dir: dir}, dirs: []string{dir}}
+	stop, done := make(chan os.Signal), make(chan struct{})
+	go func() {
+		w.run(stop)
+		close(done)
+	}()
+	waitOutput("v1")
+
+	if err := os.Remove(src); err != nil { // fails to build without source files
+		t.Fatal(err)
+	}
+	time.Sleep(2 * (watchInterval + watchDebounce))
+	write("v2.0") // and recovers once they are restored
+	waitOutput("v2.0")
+
+	stop <- os.Interrupt
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("watcher doesn't stop")
+	}
+}
@@ -24,6 +24,8 @@ import (
 	"io"
 	"os"
 	"strings"
+
+	"github.com/goplus/gop/x/gopproj"
 )
 
 // A Command is an implementation of a gop command
@@ -90,6 +92,26 @@ func (c *Command) Usage(w io.Writer) {
 	os.Exit(2)
 }
 
+// WithEnvFlags returns args with the flags of c in GOPFLAGS (see
+// gopproj.FlagsEnv) put before them.
+//
+// Precedence: flags are parsed in order, so a flag on the command line (in
+// args) overrides the same flag in GOPFLAGS. Flags in GOPFLAGS that c doesn't
+// define are ignored, as they may be for other commands.
+func (c *Command) WithEnvFlags(args []string) ([]string, error) {
+	flags, err := gopproj.EnvFlags()
+	if err != nil || len(flags) == 0 {
+		return args, err
+	}
+	ret := make([]string, 0, len(flags)+len(args))
+	for _, flag := range flags {
+		if c.Flag.Lookup(gopproj.FlagName(flag)) != nil {
+			ret = append(ret, flag)
+		}
+	}
+	return append(ret, args...), nil
+}
+
 // Runnable reports whether the command can be run; otherwise
 // it is a documentation pseudo-command.
 func (c *Command) Runnable() bool {
@@ -27,6 +27,7 @@ import (
 
 	"github.com/goplus/gop/cl"
 	"github.com/goplus/gop/cmd/gengo"
+	"github.com/goplus/gop/x/gopproj"
 )
 
 // SkipSwitches skips all switches and returns non-switch arguments.
@@ -34,7 +35,7 @@ func SkipSwitches(args []string, f *flag.FlagSet) []string {
 	out := make([]string, 0, len(args))
 	for _, arg := range args {
 		if strings.HasPrefix(arg, "-") {
-			if f.Lookup(arg[1:]) == nil { // flag not found
+			if f.Lookup(gopproj.FlagName(arg)) == nil { // flag not found
 				continue
 			}
 		}
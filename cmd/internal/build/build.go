@@ -18,14 +18,20 @@
 package build
 
 import (
+	goflag "flag"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/qiniu/x/log"
 
 	"github.com/goplus/gop/cl"
 	"github.com/goplus/gop/cmd/internal/base"
 	"github.com/goplus/gop/cmd/internal/modload"
+	"github.com/goplus/gop/x/gopmod"
+	"github.com/goplus/gop/x/gopproj"
 	"github.com/goplus/gox"
 )
 
@@ -33,37 +39,272 @@ import (
 
 // Cmd - gop build
 var Cmd = &base.Command{
-	UsageLine: "gop build [-v] [-o output] <gopSrcDir|gopSrcFile>",
+	UsageLine: "gop build [-v -nocgo] [-o output] [-ldflags flags] [-goos os -goarch arch] [-tags tag,list] [-pkgname name] <gopSrcDir|gopSrcFile ...|->",
 	Short:     "Build Go+ files",
 }
 
 var (
 	flagBuildOutput string
 	flagVerbose     = flag.Bool("v", false, "print verbose information")
+	flagNoCgo       = flag.Bool("nocgo", false, "build without cgo (CGO_ENABLED=0), and fail if the generated Go code imports \"C\"")
+	flagLdflags     = flag.String("ldflags", "", "arguments to pass on each go tool link invocation")
+	flagGOOS        = flag.String("goos", "", "target operating system, $GOOS if empty")
+	flagGOARCH      = flag.String("goarch", "", "target architecture, $GOARCH if empty")
+	flagTags        = flag.String("tags", "", "a comma-separated list of build tags")
+	flagPkgName     = flag.String("pkgname", "", "package of the source read from stdin (-) if it has no package clause, main if empty")
 	flag            = &Cmd.Flag
 )
 
 func init() {
-	flag.StringVar(&flagBuildOutput, "o", "", "gop build output file")
+	flag.StringVar(&flagBuildOutput, "o", "", "gop build output file, or the directory to put it in")
 	Cmd.Run = runCmd
 }
 
+// runCmd builds a Go+ command (package main) into an executable, by the go
+// build of the Go code generated from it, which is removed after building if
+// it's not in the run cache. Switches gop build doesn't know are passed to go
+// build, and they should be in the form -flag=value.
+//
+// Libraries, and packages of a directory tree (dir/...), are built in place as
+// gop install does, and the generated Go code is kept to import them.
 func runCmd(_ *base.Command, args []string) {
-	err := flag.Parse(base.SkipSwitches(args, flag))
+	gopArgs, goArgs := splitSwitches(args)
+	err := flag.Parse(gopArgs)
 	if err != nil {
 		log.Fatalln("parse input arguments failed:", err)
 	}
 	ssargs := flag.Args()
-	dir, recursive := base.GetBuildDir(ssargs)
 
 	if *flagVerbose {
 		gox.SetDebug(gox.DbgFlagAll &^ gox.DbgFlagComments)
 		cl.SetDebug(cl.DbgFlagAll)
 		cl.SetDisableRecover(true)
 	}
+	if len(ssargs) == 0 {
+		ssargs = []string{"."}
+	}
+	if !strings.HasSuffix(ssargs[0], "/...") {
+		if proj, next, err := gopproj.ParseOne(ssargs...); err == nil && len(next) == 0 {
+			if v, ok := proj.(*gopproj.FilesProj); ok && v.IsStdin() {
+				buildStdin(v, goArgs)
+				return
+			}
+			ctx := gopmod.New("")
+			if goProj, err := ctx.OpenProject(0, proj); err == nil && goProj.Kind == gopmod.KindCmd {
+				exitOnError(buildCmd(ctx, goProj, goArgs))
+				return
+			}
+		}
+	}
+	if *flagPkgName != "" {
+		log.Fatalln("-pkgname only applies to the source read from stdin (-)")
+	}
+
+	dir, recursive := base.GetBuildDir(ssargs)
 	modload.Load()
 	base.GenGoForBuild(dir, recursive, func() { fmt.Fprintln(os.Stderr, "GenGo failed, stop building") })
+	if *flagNoCgo {
+		checkNoCgo(dir, recursive)
+		os.Setenv("CGO_ENABLED", "0") // for the go command
+	}
+	if *flagGOOS != "" {
+		os.Setenv("GOOS", *flagGOOS)
+	}
+	if *flagGOARCH != "" {
+		os.Setenv("GOARCH", *flagGOARCH)
+	}
+	args = removeFlag(args, "nocgo", "goos", "goarch")
+	for i, arg := range args { // the go command runs in dir
+		if arg == ssargs[0] {
+			args[i] = "."
+			if recursive {
+				args[i] = "./..."
+			}
+			break
+		}
+	}
 	base.RunGoCmd(dir, "build", args...)
 }
 
+// buildStdin builds the Go+ source read from stdin, which is in package
+// -pkgname if it has no package clause (see gopproj.ReadStdin). A command is
+// built into an executable named after its package, and a library is only
+// checked to build as go build does, unless -o is specified.
+func buildStdin(proj *gopproj.FilesProj, buildArgs []string) {
+	cleanup, err := gopproj.ReadStdin(proj, os.Stdin, *flagPkgName)
+	if err != nil {
+		log.Fatalln("read stdin failed:", err)
+	}
+	defer cleanup()
+	ctx := gopmod.New("")
+	goProj, err := ctx.OpenProject(0, proj)
+	if err == nil {
+		err = buildCmd(ctx, goProj, buildArgs)
+	}
+	if err != nil {
+		cleanup()
+		exitOnError(err)
+	}
+}
+
+// buildCmd builds the command goProj into an executable, or the library
+// goProj if it's from stdin (see buildStdin).
+func buildCmd(ctx *gopmod.Context, goProj *gopmod.Project, buildArgs []string) error {
+	goProj.NoCgo = *flagNoCgo
+	goProj.GOOS, goProj.GOARCH = *flagGOOS, *flagGOARCH
+	if goProj.GOOS == "" {
+		goProj.GOOS = os.Getenv("GOOS")
+	}
+	if goProj.GOARCH == "" {
+		goProj.GOARCH = os.Getenv("GOARCH")
+	}
+	if *flagTags != "" {
+		goProj.BuildTags = strings.Split(*flagTags, ",")
+	}
+	if *flagLdflags != "" {
+		buildArgs = append(buildArgs, "-ldflags", *flagLdflags)
+	}
+	goProj.BuildArgs = buildArgs
+
+	goFile, inRunCache, err := ctx.GoFile(goProj)
+	if err != nil {
+		return err
+	}
+	keepGoFile := inRunCache || fileExists(goFile) // eg. generated by gop go before, or a Go file to build
+	outFile := os.DevNull
+	if goProj.Kind != gopmod.KindLib || flagBuildOutput != "" {
+		outFile = outputFile(flagBuildOutput, ctx.OutputName(goProj))
+	}
+	cmd := ctx.BuildProject(outFile, goProj)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if !keepGoFile {
+		os.Remove(goFile)
+		if dir := filepath.Dir(goFile); filepath.Base(dir) == ".gop" {
+			os.Remove(dir) // if it's empty
+		}
+	}
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return err
+		}
+		return fmt.Errorf("go build failed: %v", err)
+	}
+	return nil
+}
+
+// exitOnError exits with the exit code of the go command if err is an
+// *exec.ExitError, or prints err and exits if it's another error.
+func exitOnError(err error) {
+	if err != nil {
+		if e, ok := err.(*exec.ExitError); ok {
+			os.Exit(e.ExitCode())
+		}
+		log.Fatalln(err)
+	}
+}
+
+// outputFile returns the executable file to build into: name (see
+// gopmod.Context.OutputName) by default, or in output if it's a directory.
+func outputFile(output, name string) string {
+	if output != "" && !isDir(output) && !strings.HasSuffix(output, "/") && !strings.HasSuffix(output, string(filepath.Separator)) {
+		return output
+	}
+	if output == "" && isDir(name) {
+		log.Fatalf("build output %q already exists and is a directory\n", name)
+	}
+	return filepath.Join(output, name)
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// splitSwitches splits args into the ones of gop build, and the switches it
+// doesn't know, which are passed to go build.
+func splitSwitches(args []string) (gopArgs, goArgs []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := gopproj.FlagName(arg)
+		if name == "" {
+			gopArgs = append(gopArgs, arg)
+			continue
+		}
+		f := flag.Lookup(name)
+		if f == nil {
+			goArgs = append(goArgs, arg)
+			continue
+		}
+		gopArgs = append(gopArgs, arg)
+		if !strings.Contains(arg, "=") && !isBoolFlag(f) && i+1 < len(args) {
+			i++
+			gopArgs = append(gopArgs, args[i])
+		}
+	}
+	return
+}
+
+func fileExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// checkNoCgo exits if any Go file generated in dir (and its subdirectories
+// if recursive) imports "C".
+func checkNoCgo(dir string, recursive bool) {
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.Name() == "gop_autogen.go" {
+			return gopmod.CheckNoCgo(path)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// removeFlag removes the flags names (and their values) of gop build from
+// args, as the go command doesn't know them.
+func removeFlag(args []string, names ...string) []string {
+	ret := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := gopproj.FlagName(arg)
+		if !hasFlag(names, name) {
+			ret = append(ret, arg)
+			continue
+		}
+		if f := flag.Lookup(name); !strings.Contains(arg, "=") && !isBoolFlag(f) {
+			i++ // skip the value
+		}
+	}
+	return ret
+}
+
+func isBoolFlag(f *goflag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func hasFlag(names []string, name string) bool {
+	for _, v := range names {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
 // -----------------------------------------------------------------------------
@@ -26,6 +26,7 @@ import (
 	"github.com/qiniu/x/log"
 
 	"github.com/goplus/gop/cmd/internal/base"
+	"github.com/goplus/gop/x/gopmod"
 )
 
 const (
@@ -86,13 +87,15 @@ func removeGopDir(dir string) {
 
 // Cmd - gop clean
 var Cmd = &base.Command{
-	UsageLine: "gop clean [-v] <gopSrcDir>",
+	UsageLine: "gop clean [-v -cache -all] <gopSrcDir>",
 	Short:     "Clean all Go+ auto generated files",
 }
 
 var (
-	flag = &Cmd.Flag
-	_    = flag.Bool("v", false, "print verbose information.")
+	flag      = &Cmd.Flag
+	_         = flag.Bool("v", false, "print verbose information.")
+	flagCache = flag.Bool("cache", false, "remove the packages compiled by gop run.")
+	flagAll   = flag.Bool("all", false, "remove the entire gop run cache (including its go.mod) and the auto generated files.")
 )
 
 func init() {
@@ -104,6 +107,18 @@ func runCmd(_ *base.Command, args []string) {
 	if err != nil {
 		log.Fatalln("parse input arguments failed:", err)
 	}
+	if *flagCache || *flagAll {
+		removed, err := gopmod.CleanRunCache(*flagAll)
+		for _, path := range removed {
+			fmt.Printf("Cleaning %s ...\n", path)
+		}
+		if err != nil {
+			log.Fatalln("clean cache failed:", err)
+		}
+		if flag.NArg() == 0 && !*flagAll {
+			return
+		}
+	}
 	var dir string
 	if flag.NArg() == 0 {
 		dir = "."
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package diff computes line-oriented unified diffs in process, so commands
+// like gopfmt -d don't depend on an external diff program.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const contextLines = 3
+
+// An op is a line of the edit script: ' ' (kept), '-' (deleted) or '+'
+// (inserted).
+type op struct {
+	kind byte
+	line []byte
+}
+
+// Diff returns the unified diff of old and new, in the form of `diff -u`,
+// labelled with oldName and newName. It returns nil if old and new are equal.
+func Diff(oldName string, old []byte, newName string, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	ops := editScript(splitLines(old), splitLines(new))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	oldLine, newLine := 1, 1 // line numbers at ops[0]
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			oldLine, newLine = oldLine+1, newLine+1
+			i++
+			continue
+		}
+		// ops[i] is the first change of a hunk.
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := hunkEnd(ops, i)
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		oldCnt, newCnt := 0, 0
+		for _, o := range ops[start:end] {
+			if o.kind != '+' {
+				oldCnt++
+			}
+			if o.kind != '-' {
+				newCnt++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCnt), hunkRange(newStart, newCnt))
+		for _, o := range ops[start:end] {
+			out.WriteByte(o.kind)
+			out.Write(o.line)
+			if len(o.line) == 0 || o.line[len(o.line)-1] != '\n' {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		for _, o := range ops[i:end] {
+			if o.kind != '+' {
+				oldLine++
+			}
+			if o.kind != '-' {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return out.Bytes()
+}
+
+// hunkEnd returns the end of the hunk which starts with the change ops[i]:
+// changes separated by no more than 2*contextLines kept lines are merged.
+func hunkEnd(ops []op, i int) int {
+	for {
+		for i < len(ops) && ops[i].kind != ' ' {
+			i++
+		}
+		j := i
+		for j < len(ops) && ops[j].kind == ' ' {
+			j++
+		}
+		if j == len(ops) || j-i > 2*contextLines {
+			if i+contextLines < j {
+				return i + contextLines
+			}
+			return j
+		}
+		i = j
+	}
+}
+
+// hunkRange formats the range of a hunk like diff -u does.
+func hunkRange(start, cnt int) string {
+	switch cnt {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, cnt)
+}
+
+// splitLines splits data into lines, each one with its trailing '\n' if any.
+func splitLines(data []byte) [][]byte {
+	var lines [][]byte
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			i = len(data)
+		}
+		lines = append(lines, data[:i])
+		data = data[i:]
+	}
+	return lines
+}
+
+// editScript returns the shortest edit script from a to b, made by the
+// longest common subsequence of lines in the part where they differ.
+func editScript(a, b [][]byte) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && bytes.Equal(a[prefix], b[prefix]) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		bytes.Equal(a[len(a)-1-suffix], b[len(b)-1-suffix]) {
+		suffix++
+	}
+	ops := make([]op, 0, len(a)+len(b)-prefix-suffix)
+	for _, line := range a[:prefix] {
+		ops = append(ops, op{' ', line})
+	}
+
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(ma), len(mb)
+	// lcs[i][j] is the length of the LCS of ma[i:] and mb[j:].
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if bytes.Equal(ma[i], mb[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && bytes.Equal(ma[i], mb[j]):
+			ops = append(ops, op{' ', ma[i]})
+			i, j = i+1, j+1
+		case j == m || i < n && lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{'-', ma[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', mb[j]})
+			j++
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, op{' ', line})
+	}
+	return ops
+}
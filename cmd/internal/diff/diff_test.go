@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func lines(from, to int) string {
+	var b strings.Builder
+	for i := from; i <= to; i++ {
+		b.WriteString(string(rune('a'+i-1)) + "\n")
+	}
+	return b.String()
+}
+
+func TestDiff(t *testing.T) {
+	cases := []struct {
+		old, new, want string
+	}{
+		{"a\n", "a\n", ""},
+		{"", "a\n", "--- x.orig\n+++ x\n@@ -0,0 +1 @@\n+a\n"},
+		{"a\nb\n", "", "--- x.orig\n+++ x\n@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"a", "a\n", "--- x.orig\n+++ x\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n"},
+		{lines(1, 10), lines(1, 4) + "X\n" + lines(6, 10), `--- x.orig
++++ x
+@@ -2,7 +2,7 @@
+ b
+ c
+ d
+-e
++X
+ f
+ g
+ h
+`},
+		{ // two hunks
+			lines(1, 20), "A\n" + lines(2, 19) + "T\n", `--- x.orig
++++ x
+@@ -1,4 +1,4 @@
+-a
++A
+ b
+ c
+ d
+@@ -17,4 +17,4 @@
+ q
+ r
+ s
+-t
++T
+`},
+		{ // changes merged into one hunk
+			lines(1, 8), lines(2, 7), `--- x.orig
++++ x
+@@ -1,8 +1,6 @@
+-a
+ b
+ c
+ d
+ e
+ f
+ g
+-h
+`},
+	}
+	for _, c := range cases {
+		if got := string(Diff("x.orig", []byte(c.old), "x", []byte(c.new))); got != c.want {
+			t.Fatalf("Diff(%q, %q):\n%s\nwant:\n%s", c.old, c.new, got, c.want)
+		}
+	}
+}
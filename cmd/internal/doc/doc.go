@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package doc implements the ``gop doc'' command.
+package doc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qiniu/x/log"
+
+	"github.com/goplus/gop/cmd/internal/base"
+)
+
+// Cmd - gop doc
+var Cmd = &base.Command{
+	UsageLine: "gop doc [-u] [dir][.symbol[.method]]",
+	Short:     "Show documentation for a Go+ package or symbol",
+}
+
+var (
+	flag           = &Cmd.Flag
+	flagUnexported = flag.Bool("u", false, "show documentation for unexported as well as exported symbols.")
+)
+
+func init() {
+	Cmd.Run = runCmd
+}
+
+func runCmd(_ *base.Command, args []string) {
+	err := flag.Parse(args)
+	if err != nil {
+		log.Fatalln("parse input arguments failed:", err)
+	}
+	if flag.NArg() > 1 {
+		log.Fatalln("too many arguments, usage:", Cmd.UsageLine)
+	}
+	dir, sym := parseArg(flag.Arg(0))
+	pkg, err := loadPackage(dir, *flagUnexported)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	p := &docPrinter{pkg: pkg, w: os.Stdout}
+	if sym == "" {
+		p.printPackage()
+		return
+	}
+	if !p.printSymbol(sym) {
+		log.Fatalf("no symbol %s in package %s (%s)\n", sym, pkg.name, dir)
+	}
+}
+
+// parseArg splits the argument of gop doc into the package directory and the
+// symbol (eg. Func, Type, Type.Method, or Class.method). A symbol is specified
+// after the last path element of the directory, like `./foo.Bar`, and the
+// directory defaults to the current one.
+func parseArg(arg string) (dir, sym string) {
+	if arg == "" {
+		return ".", ""
+	}
+	if isDir(arg) {
+		return arg, ""
+	}
+	prefix, rest := "", arg
+	if pos := strings.LastIndexByte(arg, '/'); pos >= 0 {
+		prefix, rest = arg[:pos+1], arg[pos+1:]
+	}
+	if pos := strings.IndexByte(rest, '.'); pos > 0 {
+		if dir = prefix + rest[:pos]; isDir(dir) {
+			return dir, rest[pos+1:]
+		}
+	}
+	if prefix != "" {
+		return prefix, rest
+	}
+	return ".", arg
+}
+
+func isDir(dir string) bool {
+	fi, err := os.Stat(filepath.FromSlash(dir))
+	return err == nil && fi.IsDir()
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package doc
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePkg writes the files of a Go+ package into a temporary directory.
+func writePkg(t *testing.T) string {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"foo.gop": `// Package foo is a test.
+package foo
+
+// Pi is pi.
+const Pi = 3.14
+
+// Version is the version.
+var Version, build = "1.0", 1
+
+// Add adds a and b.
+func Add(a, b int) int {
+	return a + b
+}
+
+func sub(a, b int) int {
+	return a - b
+}
+
+// Point is a point.
+type Point struct {
+	X, Y int
+}
+
+// Move moves p.
+func (p *Point) Move(dx, dy int) {
+}
+
+func (p *Point) reset() {
+}
+
+// + adds two points.
+func (p Point) + (q Point) Point {
+	return {p.X + q.X, p.Y + q.Y}
+}
+`,
+		"foo_test.gop":   "package foo\n\nfunc TestX() {}\n",
+		"gop_autogen.go": "package foo\n\nfunc Gen() {}\n",
+		"Kai.spx": `package foo
+
+// Kai is a sprite.
+var (
+	// Age is the age.
+	Age int
+	name string
+)
+
+// Say says hi.
+func Say() {
+}
+
+func hi() {
+}
+`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// docOf returns the documentation of the package in dir, or of its symbol sym
+// if it isn't empty.
+func docOf(t *testing.T, dir, sym string, unexported bool) string {
+	pkg, err := loadPackage(dir, unexported)
+	if err != nil {
+		t.Fatal("loadPackage:", err)
+	}
+	var b bytes.Buffer
+	p := &docPrinter{pkg: pkg, w: &b}
+	if sym == "" {
+		p.printPackage()
+	} else if !p.printSymbol(sym) {
+		return "<not found>"
+	}
+	return b.String()
+}
+
+func TestPackageDoc(t *testing.T) {
+	dir := writePkg(t)
+	if v := docOf(t, dir, "", false); v != `package foo
+
+Package foo is a test.
+
+const Pi = 3.14
+    Pi is pi.
+
+var Version, build = "1.0", 1
+    Version is the version.
+
+func Add(a, b int) int
+    Add adds a and b.
+
+type Point struct {
+    X, Y int
+}
+    Point is a point.
+
+    func (p *Point) Move(dx, dy int)
+        Move moves p.
+
+    func (p Point) + (q Point) Point
+        + adds two points.
+
+class Kai // Kai.spx
+    Kai is a sprite.
+
+    var (
+        // Age is the age.
+        Age int
+    )
+
+    func Say()
+        Say says hi.
+
+` {
+		t.Fatal("package doc:\n" + v)
+	}
+	v := docOf(t, dir, "", true)
+	for _, sym := range []string{"func sub(a, b int) int", "func (p *Point) reset()", "name string", "func hi()"} {
+		if !strings.Contains(v, sym) {
+			t.Fatalf("package doc with -u: %s not found\n%s", sym, v)
+		}
+	}
+	for _, sym := range []string{"TestX", "Gen"} {
+		if strings.Contains(v, sym) {
+			t.Fatalf("package doc: %s of test or generated files\n%s", sym, v)
+		}
+	}
+}
+
+func TestSymbolDoc(t *testing.T) {
+	dir := writePkg(t)
+	cases := []struct {
+		sym, doc string
+	}{
+		{"Pi", "const Pi = 3.14\n    Pi is pi.\n\n"},
+		{"Version", "var Version, build = \"1.0\", 1\n    Version is the version.\n\n"},
+		{"Add", "func Add(a, b int) int\n    Add adds a and b.\n\n"},
+		{"Point.Move", "func (p *Point) Move(dx, dy int)\n    Move moves p.\n\n"},
+		{"Kai.Say", "func Say()\n    Say says hi.\n\n"},
+		{"Kai.Age", "var (\n    // Age is the age.\n    Age int\n)\n\n"},
+		{"sub", "<not found>"},
+		{"Point.reset", "<not found>"},
+		{"Kai.hi", "<not found>"},
+		{"Unknown", "<not found>"},
+	}
+	for _, c := range cases {
+		if v := docOf(t, dir, c.sym, false); v != c.doc {
+			t.Fatalf("doc of %s: %q", c.sym, v)
+		}
+	}
+	if v := docOf(t, dir, "Point", false); !strings.HasPrefix(v, "type Point struct {") || !strings.Contains(v, "    func (p *Point) Move") {
+		t.Fatal("doc of Point:\n" + v)
+	}
+	if v := docOf(t, dir, "Kai", false); !strings.HasPrefix(v, "class Kai // Kai.spx\n    Kai is a sprite.\n") {
+		t.Fatal("doc of Kai:\n" + v)
+	}
+	if v := docOf(t, dir, "sub", true); v != "func sub(a, b int) int\n\n" {
+		t.Fatalf("doc of sub with -u: %q", v)
+	}
+}
+
+func TestLoadPackageErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := loadPackage(dir, false); err == nil || !strings.HasPrefix(err.Error(), "no Go+ files in ") {
+		t.Fatal("loadPackage of an empty directory:", err)
+	}
+	os.WriteFile(filepath.Join(dir, "a.gop"), []byte("package a\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.gop"), []byte("package b\n"), 0644)
+	if _, err := loadPackage(dir, false); err == nil || !strings.HasSuffix(err.Error(), ": a, b") {
+		t.Fatal("loadPackage of multiple packages:", err)
+	}
+}
+
+func TestParseArg(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	os.MkdirAll("foo/bar", 0755)
+	os.MkdirAll("v1.2", 0755)
+	cases := []struct {
+		arg, dir, sym string
+	}{
+		{"", ".", ""},
+		{"foo", "foo", ""},
+		{"Add", ".", "Add"},
+		{"Point.Move", ".", "Point.Move"},
+		{"foo.Add", "foo", "Add"},
+		{"foo/bar.Point.Move", "foo/bar", "Point.Move"},
+		{"foo/Add", "foo/", "Add"},
+		{"./foo.Add", "./foo", "Add"},
+		{"v1.2", "v1.2", ""},
+	}
+	for _, c := range cases {
+		if dir, sym := parseArg(c.arg); dir != c.dir || sym != c.sym {
+			t.Fatalf("parseArg(%q): %q, %q", c.arg, dir, sym)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package doc
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// docPkg is the documentation of a Go+ package.
+type docPkg struct {
+	fset    *token.FileSet
+	name    string
+	doc     *ast.CommentGroup
+	consts  []*ast.GenDecl
+	vars    []*ast.GenDecl
+	funcs   []*ast.FuncDecl
+	types   []*docType
+	classes []*docClass
+}
+
+type docType struct {
+	decl    *ast.GenDecl // with only one spec
+	spec    *ast.TypeSpec
+	methods []*ast.FuncDecl
+}
+
+// docClass is a class defined by a class file. Its fields are declared by
+// the first var block, and its methods are funcs in the file, which has no
+// receiver as they are written.
+type docClass struct {
+	name    string
+	file    string
+	doc     *ast.CommentGroup
+	fields  *ast.GenDecl
+	methods []*ast.FuncDecl
+}
+
+func loadPackage(dir string, unexported bool) (pkg *docPkg, err error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, filterFile, parser.ParseComments|parser.ParseGoFiles)
+	if err != nil {
+		return
+	}
+	var names []string
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	switch len(names) {
+	case 0:
+		return nil, errors.New("no Go+ files in " + dir)
+	case 1:
+	default:
+		sort.Strings(names)
+		return nil, errors.New("multiple packages in " + dir + ": " + strings.Join(names, ", "))
+	}
+	return newDocPkg(fset, pkgs[names[0]], unexported), nil
+}
+
+func filterFile(fi os.FileInfo) bool {
+	name := fi.Name()
+	return !strings.HasPrefix(name, "gop_autogen") && !strings.HasSuffix(name, "_test"+filepath.Ext(name))
+}
+
+func newDocPkg(fset *token.FileSet, pkg *ast.Package, unexported bool) *docPkg {
+	ret := &docPkg{fset: fset, name: pkg.Name}
+	exported := func(name string) bool {
+		return unexported || ast.IsExported(name)
+	}
+	files := make([]string, 0, len(pkg.Files))
+	for file := range pkg.Files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	types := make(map[string]*docType)
+	var methods []*ast.FuncDecl
+	for _, file := range files {
+		f := pkg.Files[file]
+		cmap := ast.NewCommentMap(fset, f, f.Comments)
+		if f.Doc != nil && ret.doc == nil && f.FileType <= ast.FileTypeGop {
+			ret.doc = f.Doc
+		}
+		var class *docClass
+		decls := f.Decls
+		if f.FileType > ast.FileTypeGop { // in a class file
+			class = &docClass{name: className(file), file: filepath.Base(file), doc: f.Doc}
+			decls = class.init(f, cmap, exported)
+			ret.classes = append(ret.classes, class)
+		}
+		for _, decl := range decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				setDoc(cmap, d, &d.Doc)
+				switch d.Tok {
+				case token.CONST:
+					if v := filterValues(d, exported); v != nil {
+						ret.consts = append(ret.consts, v)
+					}
+				case token.VAR:
+					if v := filterValues(d, exported); v != nil {
+						ret.vars = append(ret.vars, v)
+					}
+				case token.TYPE:
+					for _, spec := range d.Specs {
+						t := spec.(*ast.TypeSpec)
+						if !exported(t.Name.Name) {
+							continue
+						}
+						doc := t.Doc
+						if doc == nil && len(d.Specs) == 1 {
+							doc = d.Doc
+						}
+						typ := &docType{decl: &ast.GenDecl{Doc: doc, TokPos: d.TokPos, Tok: token.TYPE, Specs: []ast.Spec{t}}, spec: t}
+						types[t.Name.Name] = typ
+						ret.types = append(ret.types, typ)
+					}
+				}
+			case *ast.FuncDecl:
+				setDoc(cmap, d, &d.Doc)
+				if isEntrypoint(d) {
+					continue
+				}
+				if class != nil {
+					if exported(d.Name.Name) {
+						class.methods = append(class.methods, d)
+					}
+				} else if d.Recv != nil {
+					methods = append(methods, d)
+				} else if exported(d.Name.Name) {
+					ret.funcs = append(ret.funcs, d)
+				}
+			}
+		}
+	}
+	for _, fn := range methods {
+		if typ, ok := types[recvTypeName(fn)]; ok && (fn.Operator || exported(fn.Name.Name)) {
+			typ.methods = append(typ.methods, fn)
+		}
+	}
+	return ret
+}
+
+// init collects fields of the class from the class file f, and returns the
+// declarations left.
+func (p *docClass) init(f *ast.File, cmap ast.CommentMap, exported func(name string) bool) []ast.Decl {
+	decls := f.Decls
+	for i, decl := range decls { // see cl.getFields
+		g, ok := decl.(*ast.GenDecl)
+		if !ok {
+			break
+		}
+		if g.Tok == token.IMPORT || g.Tok == token.CONST {
+			continue
+		}
+		if g.Tok == token.VAR {
+			setDoc(cmap, g, &g.Doc)
+			if p.doc == nil { // doc of the first var block is the class doc
+				p.doc, g.Doc = g.Doc, nil
+			}
+			p.fields = filterValues(g, exported)
+			return append(decls[:i:i], decls[i+1:]...)
+		}
+		break
+	}
+	return decls
+}
+
+// setDoc sets *doc to the comment group just before node if it isn't set by
+// the parser, eg. doc comments of declarations in a class file.
+func setDoc(cmap ast.CommentMap, node ast.Node, doc **ast.CommentGroup) {
+	if *doc != nil {
+		return
+	}
+	for _, cg := range cmap[node] {
+		if cg.End() < node.Pos() {
+			*doc = cg
+		}
+	}
+}
+
+// filterValues returns the const or var declaration d with only the exported
+// specs, or nil if there is none. The iota based specs of a const declaration
+// are meaningful only with the others, so it is returned as a whole.
+func filterValues(d *ast.GenDecl, exported func(name string) bool) *ast.GenDecl {
+	specs := make([]ast.Spec, 0, len(d.Specs))
+	for _, spec := range d.Specs {
+		v := spec.(*ast.ValueSpec)
+		for _, name := range v.Names {
+			if exported(name.Name) {
+				specs = append(specs, spec)
+				break
+			}
+		}
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+	if d.Tok == token.CONST || len(specs) == len(d.Specs) {
+		return d
+	}
+	ret := *d
+	ret.Specs = specs
+	return &ret
+}
+
+// className returns the class name defined by a class file (see
+// cl.getDefaultClass).
+func className(file string) string {
+	name := filepath.Base(file)
+	if pos := strings.IndexByte(name, '.'); pos > 0 {
+		name = name[:pos]
+	}
+	return name
+}
+
+// isEntrypoint reports whether fn is the entrypoint func synthesized by the
+// parser for statements of a file without entrypoint.
+func isEntrypoint(fn *ast.FuncDecl) bool {
+	return fn.Recv == nil && fn.Name.Name == "main" && fn.Type.Func == token.NoPos
+}
+
+func recvTypeName(fn *ast.FuncDecl) string {
+	if len(fn.Recv.List) == 0 {
+		return ""
+	}
+	typ := fn.Recv.List[0].Type
+	if t, ok := typ.(*ast.StarExpr); ok {
+		typ = t.X
+	}
+	if t, ok := typ.(*ast.Ident); ok {
+		return t.Name
+	}
+	return ""
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package doc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/printer"
+)
+
+// -----------------------------------------------------------------------------
+
+const indent = "    "
+
+var config = printer.Config{Mode: printer.UseSpaces, Tabwidth: 4}
+
+type docPrinter struct {
+	pkg *docPkg
+	w   io.Writer
+}
+
+// printPackage prints the package doc, and then all symbols of the package.
+func (p *docPrinter) printPackage() {
+	pkg := p.pkg
+	fmt.Fprintf(p.w, "package %s\n\n", pkg.name)
+	if pkg.doc != nil {
+		p.printDoc(pkg.doc, "")
+		fmt.Fprintln(p.w)
+	}
+	for _, d := range pkg.consts {
+		p.printDecl(d, d.Doc, "")
+	}
+	for _, d := range pkg.vars {
+		p.printDecl(d, d.Doc, "")
+	}
+	for _, fn := range pkg.funcs {
+		p.printDecl(funcSig(fn), fn.Doc, "")
+	}
+	for _, typ := range pkg.types {
+		p.printType(typ)
+	}
+	for _, class := range pkg.classes {
+		p.printClass(class)
+	}
+}
+
+// printSymbol prints the symbol sym (eg. Func, Type, Type.Method, or
+// Class.method), and returns false if it isn't found.
+func (p *docPrinter) printSymbol(sym string) bool {
+	name, member := sym, ""
+	if pos := strings.IndexByte(sym, '.'); pos >= 0 {
+		name, member = sym[:pos], sym[pos+1:]
+	}
+	pkg := p.pkg
+	if member == "" {
+		for _, ds := range [][]*ast.GenDecl{pkg.consts, pkg.vars} {
+			for _, d := range ds {
+				if declares(d, name) {
+					p.printDecl(d, d.Doc, "")
+					return true
+				}
+			}
+		}
+		for _, fn := range pkg.funcs {
+			if fn.Name.Name == name {
+				p.printDecl(funcSig(fn), fn.Doc, "")
+				return true
+			}
+		}
+	}
+	for _, typ := range pkg.types {
+		if typ.spec.Name.Name != name {
+			continue
+		}
+		if member == "" {
+			p.printType(typ)
+			return true
+		}
+		for _, fn := range typ.methods {
+			if fn.Name.Name == member {
+				p.printDecl(funcSig(fn), fn.Doc, "")
+				return true
+			}
+		}
+	}
+	for _, class := range pkg.classes {
+		if class.name != name {
+			continue
+		}
+		if member == "" {
+			p.printClass(class)
+			return true
+		}
+		if class.fields != nil && declares(class.fields, member) {
+			p.printDecl(class.fields, nil, "")
+			return true
+		}
+		for _, fn := range class.methods {
+			if fn.Name.Name == member {
+				p.printDecl(funcSig(fn), fn.Doc, "")
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *docPrinter) printType(typ *docType) {
+	p.printDecl(typ.decl, typ.decl.Doc, "")
+	for _, fn := range typ.methods {
+		p.printDecl(funcSig(fn), fn.Doc, indent)
+	}
+}
+
+// printClass prints a class as it is written in the class file, that is, a
+// var block of its fields and funcs of its methods, instead of the Go code
+// generated for it.
+func (p *docPrinter) printClass(class *docClass) {
+	fmt.Fprintf(p.w, "class %s // %s\n", class.name, class.file)
+	p.printDoc(class.doc, indent)
+	fmt.Fprintln(p.w)
+	if class.fields != nil {
+		p.printDecl(class.fields, nil, indent)
+	}
+	for _, fn := range class.methods {
+		p.printDecl(funcSig(fn), fn.Doc, indent)
+	}
+}
+
+// printDecl prints the declaration node with the prefix, followed by its doc
+// indented.
+func (p *docPrinter) printDecl(node ast.Node, doc *ast.CommentGroup, prefix string) {
+	if d, ok := node.(*ast.GenDecl); ok && d.Doc != nil { // doc is printed after the declaration
+		decl := *d
+		decl.Doc = nil
+		node = &decl
+	}
+	var b bytes.Buffer
+	if err := config.Fprint(&b, p.pkg.fset, node); err != nil {
+		fmt.Fprintf(&b, "<%v>", err)
+	}
+	for _, line := range strings.Split(b.String(), "\n") {
+		fmt.Fprintf(p.w, "%s%s\n", prefix, line)
+	}
+	p.printDoc(doc, prefix+indent)
+	fmt.Fprintln(p.w)
+}
+
+func (p *docPrinter) printDoc(doc *ast.CommentGroup, prefix string) {
+	if doc == nil {
+		return
+	}
+	text := strings.TrimRight(doc.Text(), "\n")
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" {
+			fmt.Fprintln(p.w)
+		} else {
+			fmt.Fprintf(p.w, "%s%s\n", prefix, line)
+		}
+	}
+}
+
+// funcSig returns the signature of fn, that is, fn without its body and doc.
+func funcSig(fn *ast.FuncDecl) *ast.FuncDecl {
+	return &ast.FuncDecl{Recv: fn.Recv, Name: fn.Name, Type: fn.Type, Operator: fn.Operator}
+}
+
+func declares(d *ast.GenDecl, name string) bool {
+	for _, spec := range d.Specs {
+		for _, id := range spec.(*ast.ValueSpec).Names {
+			if id.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
@@ -27,6 +27,7 @@ import (
 
 	"github.com/goplus/gop/cmd/internal/base"
 	"github.com/goplus/gop/env"
+	"github.com/goplus/gop/x/gopmod"
 )
 
 // Cmd - gop env
@@ -70,9 +71,11 @@ func runCmd(_ *base.Command, args []string) {
 	gopEnv["GOPVERSION"] = env.Version()
 	gopEnv["GOPROOT"] = env.GOPROOT()
 	gopEnv["GOPATH"] = env.GOPATH()
+	gopEnv["GOBIN"] = env.GOBIN()
 	gopEnv["GOMODCACHE"] = env.GOMODCACHE()
 	gopEnv["GOPMOD"], _ = env.GOPMOD("")
 	gopEnv["HOME"] = env.HOME()
+	gopEnv["GOPRUNCACHE"] = gopmod.RunCacheDir()
 
 	vars := flag.Args()
 
@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fix implements the ``gop fix'' command.
+package fix
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/qiniu/x/log"
+
+	"github.com/goplus/gop/cmd/internal/base"
+	"github.com/goplus/gop/x/fix"
+)
+
+// Cmd - gop fix
+var Cmd = &base.Command{
+	UsageLine: "gop fix [-diff] [-r rule,list] path ...",
+	Short:     "Update Go+ files from deprecated syntax to the current one",
+}
+
+var (
+	flag      = &Cmd.Flag
+	flagDiff  = flag.Bool("diff", false, "display diffs instead of rewriting files.")
+	flagRules = flag.String("r", "", "a comma-separated list of rules to apply, all rules if empty.")
+)
+
+func init() {
+	Cmd.Run = runCmd
+}
+
+var (
+	extGops = map[string]struct{}{
+		".gop": {},
+		".spx": {},
+		".gmx": {},
+	}
+)
+
+func runCmd(cmd *base.Command, args []string) {
+	err := flag.Parse(args)
+	if err != nil {
+		log.Fatalln("parse input arguments failed:", err)
+	}
+	if flag.NArg() < 1 {
+		cmd.Usage(os.Stderr)
+		printRules()
+		os.Exit(2)
+	}
+	rules, err := lookupRules(*flagRules)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		printRules()
+		os.Exit(2)
+	}
+	exitCode := 0
+	for _, path := range flag.Args() {
+		recursive := strings.HasSuffix(path, "/...")
+		if recursive {
+			path = path[:len(path)-4]
+		}
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if file != path && (!recursive || skipDir(d.Name())) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if _, ok := extGops[filepath.Ext(file)]; ok || file == path {
+				if err := fixFile(file, rules); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					exitCode = 2
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 2
+		}
+	}
+	os.Exit(exitCode)
+}
+
+// lookupRules returns the rules named in the comma-separated list names, or
+// nil (that is, all rules) if names is empty.
+func lookupRules(names string) (rules []*fix.Rule, err error) {
+	if names == "" {
+		return
+	}
+	for _, name := range strings.Split(names, ",") {
+		r := fix.Lookup(name)
+		if r == nil {
+			return nil, fmt.Errorf("gop fix: unknown rule %q", name)
+		}
+		rules = append(rules, r)
+	}
+	return
+}
+
+func printRules() {
+	fmt.Fprintln(os.Stderr, "Available rules:")
+	for _, r := range fix.Rules() {
+		fmt.Fprintf(os.Stderr, "\n%s\n\t%s\n", r.Name, r.Desc)
+	}
+}
+
+// fixFile applies rules to file, and rewrites it, or prints the diff in -diff
+// mode. The names of the rules changing file are printed to stderr.
+func fixFile(file string, rules []*fix.Rule) error {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	ret, fixed, err := fix.Source(src, file, rules...)
+	if err != nil || fixed == nil || bytes.Equal(src, ret) {
+		return err
+	}
+	if *flagDiff {
+		data, err := diff(src, ret, file)
+		if err != nil {
+			return fmt.Errorf("computing diff: %v", err)
+		}
+		fmt.Printf("diff %s fixed/%s\n", file, file)
+		os.Stdout.Write(data)
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "%s: fixed %s\n", file, strings.Join(fixed, ", "))
+	perm := os.FileMode(0644)
+	if fi, err := os.Stat(file); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	return ioutil.WriteFile(file, ret, perm)
+}
+
+// diff returns the unified diff of b1 and b2 by running `diff -u`.
+func diff(b1, b2 []byte, filename string) (data []byte, err error) {
+	f1, err := writeTempFile(b1)
+	if err != nil {
+		return
+	}
+	defer os.Remove(f1)
+
+	f2, err := writeTempFile(b2)
+	if err != nil {
+		return
+	}
+	defer os.Remove(f2)
+
+	data, err = exec.Command("diff", "-u", "-L", filename+".orig", "-L", filename, f1, f2).CombinedOutput()
+	if len(data) > 0 {
+		// diff exits with a non-zero status when the files don't match.
+		// Ignore that failure as long as we get output.
+		err = nil
+	}
+	return
+}
+
+func writeTempFile(data []byte) (string, error) {
+	file, err := ioutil.TempFile("", "gopfix")
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if err1 := file.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+func skipDir(name string) bool {
+	return name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".")
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,252 @@
+/*
+ * Copyright (c) 2021-2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package generate implements the ``gop generate'' command.
+package generate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qiniu/x/log"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/cmd/internal/base"
+	"github.com/goplus/gop/env"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// Cmd - gop generate
+var Cmd = &base.Command{
+	UsageLine: "gop generate [-n -v -x -run regexp] [gopSrcDir ...]",
+	Short:     "Generate Go+ files by processing source, like `go generate`",
+}
+
+var (
+	flag        = &Cmd.Flag
+	flagNotExec = flag.Bool("n", false, "print commands that would be executed, but don't run them.")
+	flagVerbose = flag.Bool("v", false, "print the names of packages and files as they are processed.")
+	flagExec    = flag.Bool("x", false, "print commands as they are executed.")
+	flagRun     = flag.String("run", "", "run only directives whose full text (after //gop:generate) matches `regexp`.")
+)
+
+func init() {
+	Cmd.Run = runCmd
+}
+
+const directive = "//gop:generate"
+
+func runCmd(cmd *base.Command, args []string) {
+	err := flag.Parse(args)
+	if err != nil {
+		log.Fatalln("parse input arguments failed:", err)
+	}
+	var run *regexp.Regexp
+	if *flagRun != "" {
+		if run, err = regexp.Compile(*flagRun); err != nil {
+			log.Fatalln("invalid -run:", err)
+		}
+	}
+	args = flag.Args()
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	failed := false
+	for _, arg := range args {
+		for _, dir := range pkgDirs(arg) {
+			if !generatePkg(dir, run) {
+				failed = true
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// pkgDirs returns the directory path, or the directories under it (including
+// itself) if path ends with `/...`, skipping vendor, testdata, and the ones
+// whose names start with `.` or `_`.
+func pkgDirs(path string) (dirs []string) {
+	if !strings.HasSuffix(path, "/...") {
+		return []string{path}
+	}
+	root := strings.TrimSuffix(path, "/...")
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if name := d.Name(); path != root && (name == "vendor" || name == "testdata" ||
+			strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return
+}
+
+// generatePkg runs the //gop:generate directives of the Go+ files in dir, in
+// order of file names and then positions. Files with syntax errors are
+// processed too, as the code generated may be what they lack. It stops at the
+// first failed directive, and reports whether all succeeded.
+func generatePkg(dir string, run *regexp.Regexp) bool {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, parser.ParseComments|parser.ErrorTolerant)
+	if pkgs == nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	files := make(map[string]*ast.File)
+	var names []string
+	for _, pkg := range pkgs {
+		for name, f := range pkg.Files {
+			files[name] = f
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if *flagVerbose && len(names) > 0 {
+		fmt.Fprintln(os.Stderr, dir)
+	}
+	for _, name := range names {
+		if *flagVerbose {
+			fmt.Fprintln(os.Stderr, name)
+		}
+		f := files[name]
+		for _, c := range f.Directives {
+			if !strings.HasPrefix(c.Text, directive) {
+				continue
+			}
+			line := c.Text[len(directive):]
+			if line != "" && line[0] != ' ' && line[0] != '\t' { // eg. //gop:generated
+				continue
+			}
+			line = strings.TrimSpace(line)
+			if run != nil && !run.MatchString(line) {
+				continue
+			}
+			if err := generate(fset.Position(c.Slash), f.Name.Name, line); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// generate runs the command of a //gop:generate directive at pos, in the
+// directory of the file. $NAME in line is expanded to the environment variable
+// NAME, or the ones set for the command (see genEnv), before line is split into
+// words, in which double quoted strings are Go strings.
+func generate(pos token.Position, pkgName, line string) error {
+	vars := genEnv(pos, pkgName)
+	words, err := split(os.Expand(line, func(name string) string {
+		for _, v := range vars {
+			if strings.HasPrefix(v, name+"=") {
+				return v[len(name)+1:]
+			}
+		}
+		return os.Getenv(name)
+	}))
+	if err != nil {
+		return fmt.Errorf("%v: %v", pos, err)
+	}
+	if len(words) == 0 {
+		return fmt.Errorf("%v: no arguments to directive", pos)
+	}
+	if *flagNotExec || *flagExec {
+		fmt.Fprintln(os.Stderr, strings.Join(words, " "))
+	}
+	if *flagNotExec {
+		return nil
+	}
+	cmd := exec.Command(words[0], words[1:]...)
+	cmd.Dir = filepath.Dir(pos.Filename)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), vars...)
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("%v: running %q: %v", pos, words[0], err)
+	}
+	return nil
+}
+
+// genEnv returns the environment variables set for the command of a
+// //gop:generate directive at pos, like the ones set by `go generate`.
+func genEnv(pos token.Position, pkgName string) []string {
+	return []string{
+		"GOARCH=" + runtime.GOARCH,
+		"GOOS=" + runtime.GOOS,
+		"GOFILE=" + filepath.Base(pos.Filename),
+		"GOLINE=" + strconv.Itoa(pos.Line),
+		"GOPACKAGE=" + pkgName,
+		"GOPROOT=" + env.GOPROOT(),
+		"DOLLAR=$",
+	}
+}
+
+// split splits line into words separated by spaces or tabs. A word can be a
+// double quoted Go string, eg. "a b\n".
+func split(line string) (words []string, err error) {
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return
+		}
+		if line[0] == '"' {
+			end := 1
+			for ; end < len(line) && line[end] != '"'; end++ {
+				if line[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(line) {
+				return nil, fmt.Errorf("unterminated quoted string: %s", line)
+			}
+			word, err := strconv.Unquote(line[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted string: %s", line[:end+1])
+			}
+			words, line = append(words, word), line[end+1:]
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		words, line = append(words, line[:end]), line[end:]
+	}
+}
+
+// -----------------------------------------------------------------------------
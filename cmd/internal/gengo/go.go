@@ -70,7 +70,7 @@ func testPkg(p *gengo.Runner, dir string, flags int) error {
 
 // Cmd - gop go
 var Cmd = &base.Command{
-	UsageLine: "gop go [-debug -test -slow] <gopSrcDir>",
+	UsageLine: "gop go [-debug -test -slow -goapi -o outDir] <gopSrcDir>",
 	Short:     "Convert Go+ packages into Go packages",
 }
 
@@ -79,6 +79,8 @@ var (
 	flagDebug = flag.Bool("debug", false, "set log level to debug")
 	flagTest  = flag.Bool("test", false, "test Go+ package")
 	flagSlow  = flag.Bool("slow", false, "don't cache imported packages")
+	flagGoAPI = flag.Bool("goapi", false, "generate libraries for Go callers: keep all doc comments, and report exported APIs using names synthesized by Go+")
+	flagOut   = flag.String("o", "", "export generated Go packages (with go.mod) into `outDir`, which can be built without Go+")
 )
 
 func init() {
@@ -102,9 +104,11 @@ func runCmd(cmd *base.Command, args []string) {
 	dir = strings.TrimSuffix(dir, "/...")
 	modload.Load()
 	runner := new(gengo.Runner)
+	failed := false
 	runner.SetAfter(func(p *gengo.Runner, dir string, flags int) error {
 		errs := p.ResetErrors()
 		if errs != nil {
+			failed = true
 			for _, err := range errs {
 				fmt.Fprintln(os.Stderr, err)
 			}
@@ -114,7 +118,7 @@ func runCmd(cmd *base.Command, args []string) {
 		}
 		return nil
 	})
-	runner.GenGo(dir, true, &cl.Config{CacheLoadPkgs: !*flagSlow})
+	runner.GenGo(dir, true, &cl.Config{CacheLoadPkgs: !*flagSlow, GoAPI: *flagGoAPI})
 	errs := runner.Errors()
 	if errs != nil {
 		for _, err := range errs {
@@ -122,6 +126,14 @@ func runCmd(cmd *base.Command, args []string) {
 		}
 		os.Exit(-1)
 	}
+	if *flagOut != "" {
+		if failed {
+			log.Fatalln("gop go: not exported to", *flagOut, "because of errors above")
+		}
+		if err = gengo.Export(dir, *flagOut); err != nil {
+			log.Fatalln(err)
+		}
+	}
 }
 
 // -----------------------------------------------------------------------------
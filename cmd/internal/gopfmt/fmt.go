@@ -18,13 +18,17 @@
 package gopfmt
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/qiniu/x/log"
 
@@ -36,15 +40,24 @@ import (
 
 // Cmd - gop go
 var Cmd = &base.Command{
-	UsageLine: "gop fmt [-n --smart --mvgo] path ...",
+	UsageLine: "gop fmt [-n -l -s -j n --imports keep|single|std --local prefix --smart --mvgo --check --write] path ...",
 	Short:     "Format Go+ packages",
 }
 
 var (
 	flag        = &Cmd.Flag
 	flagNotExec = flag.Bool("n", false, "prints commands that would be executed.")
+	flagList    = flag.Bool("l", false, "list files whose formatting differs from gop fmt's, and exit with a non-zero status if any.")
 	flagMoveGo  = flag.Bool("mvgo", false, "move .go files to .gop files (only available in `--smart` mode).")
 	flagSmart   = flag.Bool("smart", false, "convert Go code style into Go+ style.")
+	flagSimple  = flag.Bool("s", false, "simplify code.")
+	flagCheck   = flag.Bool("check", false, "check listed files only (read the list from stdin if path is `-`), and exit with a non-zero status if any isn't formatted.")
+	flagWrite   = flag.Bool("write", false, "fix files in place in `--check` mode.")
+	flagJobs    = flag.Int("j", runtime.NumCPU(), "the number of files to format concurrently.")
+	flagImports = flag.String("imports", "keep", "group imports: keep, single or std (standard library, third-party and local ones).")
+	flagLocal   = flag.String("local", "", "put imports beginning with this string after third-party ones in --imports std mode (comma-separated).")
+
+	importOpts xformat.ImportOptions
 )
 
 func init() {
@@ -61,50 +74,170 @@ var (
 		".gmx": {},
 	}
 	rootDir = ""
+	jobs    []*fmtJob
 )
 
-func gopfmt(path string, smart, mvgo bool) (err error) {
+// fmtJob is a file to format, collected when walking directories.
+type fmtJob struct {
+	path    string
+	smart   bool
+	mvgo    bool
+	changed bool // the file isn't formatted (and is fixed unless -l)
+	err     error
+}
+
+// gopfmt formats the file path. It reports whether the file isn't formatted,
+// and fixes it unless in -l mode.
+func gopfmt(path string, smart, mvgo bool) (changed bool, err error) {
 	src, err := ioutil.ReadFile(path)
 	if err != nil {
 		return
 	}
-	var target []byte
-	if smart {
-		target, err = xformat.GopstyleSource(src, path)
-	} else {
-		target, err = format.Source(src, path)
-	}
+	target, err := formatSource(src, path, smart)
 	if err != nil {
 		return
 	}
 	if bytes.Equal(src, target) {
 		return
 	}
-	fmt.Println(path)
+	if *flagList {
+		return true, nil
+	}
 	if mvgo {
 		newPath := strings.TrimSuffix(path, ".go") + ".gop"
-		if err = os.WriteFile(newPath, target, 0666); err != nil {
+		if err = writeFileWithBackup(newPath, target); err != nil {
 			return
 		}
-		return os.Remove(path)
+		return true, os.Remove(path)
+	}
+	return true, writeFileWithBackup(path, target)
+}
+
+// runJobs formats files of jobs concurrently, by n workers at most.
+func runJobs(jobs []*fmtJob, n int) {
+	if n < 1 {
+		n = 1
+	}
+	ch := make(chan *fmtJob)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range ch {
+				job.changed, job.err = gopfmt(job.path, job.smart, job.mvgo)
+			}
+		}()
+	}
+	for _, job := range jobs {
+		ch <- job
+	}
+	close(ch)
+	wg.Wait()
+}
+
+func formatSource(src []byte, path string, smart bool) (target []byte, err error) {
+	if smart {
+		target, err = xformat.GopstyleSource(src, path)
+	} else {
+		target, err = format.Source(src, path)
+	}
+	if err == nil && *flagSimple {
+		target, err = xformat.SimplifySource(target, path)
+	}
+	if err == nil && importOpts.Grouping != xformat.ImportsKept {
+		target, err = xformat.GroupImportsSource(target, &importOpts, path)
+	}
+	return
+}
+
+// checkFiles checks the listed files (eg. from `git diff --cached --name-only`)
+// only, and prints the ones not formatted. Files which aren't Go+ files or
+// don't exist (eg. deleted) are skipped silently. It exits with a non-zero
+// status if any file isn't formatted, unless they are fixed (see --write).
+func checkFiles(paths []string) {
+	if len(paths) == 1 && paths[0] == "-" {
+		paths = nil
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if path := strings.TrimSpace(scanner.Text()); path != "" {
+				paths = append(paths, path)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			report(err)
+		}
 	}
-	return writeFileWithBackup(path, target)
+	var files []string
+	for _, path := range paths {
+		if ext := filepath.Ext(path); ext == ".go" || !isGopFile(ext) {
+			continue
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			report(err)
+		}
+		target, err := formatSource(src, path, *flagSmart)
+		if err != nil {
+			report(err)
+		}
+		if bytes.Equal(src, target) {
+			continue
+		}
+		if *flagWrite {
+			if err = writeFileWithBackup(path, target); err != nil {
+				report(err)
+			}
+		}
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		fmt.Println(file)
+	}
+	if len(files) > 0 && !*flagWrite {
+		os.Exit(1)
+	}
+}
+
+func isGopFile(ext string) bool {
+	_, ok := extGops[ext]
+	return ok
 }
 
+// writeFileWithBackup writes target to a temporary file in the directory of
+// path first, and then renames it to path, so that an interrupted write never
+// leaves path partially written.
 func writeFileWithBackup(path string, target []byte) (err error) {
+	perm := os.FileMode(0644)
+	if fi, e := os.Stat(path); e == nil {
+		perm = fi.Mode().Perm()
+	}
 	dir, file := filepath.Split(path)
 	f, err := ioutil.TempFile(dir, file)
 	if err != nil {
 		return
 	}
 	tmpfile := f.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(tmpfile)
+		}
+	}()
 	_, err = f.Write(target)
-	f.Close()
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
 	if err != nil {
 		return
 	}
-	err = os.Remove(path)
-	if err != nil {
+	if err = os.Chmod(tmpfile, perm); err != nil {
 		return
 	}
 	return os.Rename(tmpfile, path)
@@ -114,11 +247,14 @@ func walk(path string, d fs.DirEntry, err error) error {
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	} else if d.IsDir() {
-		if !walkSubDir && path != rootDir {
+		if path != rootDir && (!walkSubDir || skipDir(d.Name())) {
 			return filepath.SkipDir
 		}
 	} else {
 		ext := filepath.Ext(path)
+		if *flagList && ext == ".go" {
+			return nil
+		}
 		smart := *flagSmart
 		mvgo := smart && *flagMoveGo
 		if _, ok := extGops[ext]; ok && (!mvgo || ext == ".go") {
@@ -126,16 +262,20 @@ func walk(path string, d fs.DirEntry, err error) error {
 			if *flagNotExec {
 				fmt.Println("gop fmt", path)
 			} else {
-				err = gopfmt(path, smart && (mvgo || ext != ".go"), mvgo)
-				if err != nil {
-					report(err)
-				}
+				jobs = append(jobs, &fmtJob{path: path, smart: smart && (mvgo || ext != ".go"), mvgo: mvgo})
 			}
 		}
 	}
 	return err
 }
 
+// skipDir reports whether the directory name is skipped when walking files
+// recursively: vendor (code not maintained in the tree), testdata (fixtures
+// may be unformatted on purpose) and hidden directories.
+func skipDir(name string) bool {
+	return name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".")
+}
+
 func report(err error) {
 	fmt.Println(err)
 	os.Exit(2)
@@ -150,11 +290,22 @@ func runCmd(cmd *base.Command, args []string) {
 	if narg < 1 {
 		cmd.Usage(os.Stderr)
 	}
+	grouping, err := xformat.ParseImportGrouping(*flagImports)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	importOpts = xformat.ImportOptions{Grouping: grouping, LocalPrefix: *flagLocal}
+	if *flagCheck {
+		checkFiles(flag.Args())
+		return
+	}
 	for i := 0; i < narg; i++ {
 		path := flag.Arg(i)
 		walkSubDir = strings.HasSuffix(path, "/...")
 		if walkSubDir {
 			path = path[:len(path)-4]
+		} else if *flagList {
+			walkSubDir = true
 		}
 		procCnt = 0
 		rootDir = path
@@ -163,6 +314,34 @@ func runCmd(cmd *base.Command, args []string) {
 			fmt.Println("no Go+ files in", path)
 		}
 	}
+	runJobs(jobs, *flagJobs)
+	reportJobs(jobs)
+}
+
+// reportJobs prints the files changed (or not formatted in -l mode) and the
+// errors of jobs, sorted by file paths so that the output is stable. It exits
+// with a non-zero status if there is any error, or any file not formatted in
+// -l mode.
+func reportJobs(jobs []*fmtJob) {
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].path < jobs[j].path
+	})
+	var changed, failed int
+	for _, job := range jobs {
+		if job.err != nil {
+			fmt.Fprintln(os.Stderr, job.err)
+			failed++
+		} else if job.changed {
+			fmt.Println(job.path)
+			changed++
+		}
+	}
+	if failed > 0 {
+		os.Exit(2)
+	}
+	if changed > 0 && *flagList {
+		os.Exit(1)
+	}
 }
 
 // -----------------------------------------------------------------------------
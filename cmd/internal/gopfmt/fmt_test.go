@@ -0,0 +1,261 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopfmt
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Run as gop fmt with the arguments in GOPFMT_TEST_ARGS, see runGopFmt.
+	if args, ok := os.LookupEnv("GOPFMT_TEST_ARGS"); ok {
+		runCmd(Cmd, strings.Fields(args))
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runGopFmt runs gop fmt with args in dir in a child process, and returns its
+// stdout and exit code.
+func runGopFmt(t *testing.T, dir, stdin string, args ...string) (string, int) {
+	cmd := exec.Command(os.Args[0])
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOPFMT_TEST_ARGS="+strings.Join(args, " "))
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	if e, ok := err.(*exec.ExitError); ok {
+		return stdout.String(), e.ExitCode()
+	} else if err != nil {
+		t.Fatal("run gop fmt:", err)
+	}
+	return stdout.String(), 0
+}
+
+// writeFiles writes files (name -> content) into dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		file := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// walkJobs walks dir like `gop fmt dir/...` (with -l if list), and returns
+// the jobs collected, sorted by paths relative to dir.
+func walkJobs(dir string, list bool) (paths []string, ret []*fmtJob) {
+	old := *flagList
+	defer func() {
+		*flagList = old
+	}()
+	*flagList = list
+	jobs, walkSubDir, rootDir = nil, true, dir
+	filepath.WalkDir(dir, walk)
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].path < jobs[j].path
+	})
+	for _, job := range jobs {
+		rel, _ := filepath.Rel(dir, job.path)
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	return paths, jobs
+}
+
+func TestWalkSkipDirs(t *testing.T) {
+	dir := t.TempDir()
+	unformatted := "println  \"Hi\"\n"
+	writeFiles(t, dir, map[string]string{
+		"a.gop":             unformatted,
+		"b.gop":             "println \"Hi\"\n",
+		"c.go":              "package main\n",
+		"sub/d.spx":         unformatted,
+		"vendor/e.gop":      unformatted,
+		"testdata/f.gop":    unformatted,
+		".hidden/g.gop":     unformatted,
+		"sub/.hidden/h.gop": unformatted,
+	})
+
+	paths, jobs := walkJobs(dir, true)
+	if v := strings.Join(paths, " "); v != "a.gop b.gop sub/d.spx" {
+		t.Fatal("walk in -l mode:", v)
+	}
+	*flagList = true
+	runJobs(jobs, 2)
+	*flagList = false
+	var changed []string
+	for _, job := range jobs {
+		if job.err != nil {
+			t.Fatal("gopfmt:", job.path, job.err)
+		}
+		if job.changed {
+			changed = append(changed, filepath.Base(job.path))
+		}
+	}
+	if v := strings.Join(changed, " "); v != "a.gop d.spx" {
+		t.Fatal("files listed:", v)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "a.gop")); string(b) != unformatted { // not fixed in -l mode
+		t.Fatal("a.gop is changed in -l mode:", string(b))
+	}
+
+	paths, _ = walkJobs(dir, false)
+	if v := strings.Join(paths, " "); v != "a.gop b.gop c.go sub/d.spx" {
+		t.Fatal("walk without -l:", v)
+	}
+}
+
+func TestSkipDir(t *testing.T) {
+	for _, name := range []string{"vendor", "testdata", ".git", ".gop"} {
+		if !skipDir(name) {
+			t.Fatal("skipDir:", name)
+		}
+	}
+	for _, name := range []string{"src", "vendors", "_testdata"} {
+		if skipDir(name) {
+			t.Fatal("skipDir:", name)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	unformatted := "println  \"Hi\"\n"
+	writeFiles(t, dir, map[string]string{
+		"a.gop":     unformatted,
+		"b.gop":     "println \"Hi\"\n",
+		"c.go":      "package  main\n",
+		"d.txt":     "not Go+ code",
+		"sub/e.spx": unformatted,
+		"f.gop":     unformatted, // not listed
+	})
+	files := "b.gop\nc.go\nd.txt\ndeleted.gop\nsub/e.spx\na.gop\n"
+
+	out, code := runGopFmt(t, dir, files, "--check", "-")
+	if code != 1 || out != "a.gop\nsub/e.spx\n" {
+		t.Fatalf("gop fmt --check: exit code %d\n%s", code, out)
+	}
+	if out, code = runGopFmt(t, dir, "", "--check", "b.gop", "c.go", "d.txt"); code != 0 || out != "" {
+		t.Fatalf("gop fmt --check of formatted files: exit code %d\n%s", code, out)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "a.gop")); string(b) != unformatted {
+		t.Fatal("gop fmt --check changes a.gop:", string(b))
+	}
+
+	out, code = runGopFmt(t, dir, files, "--check", "--write", "-")
+	if code != 0 || out != "a.gop\nsub/e.spx\n" {
+		t.Fatalf("gop fmt --check --write: exit code %d\n%s", code, out)
+	}
+	for _, name := range []string{"a.gop", "sub/e.spx", "f.gop", "c.go"} {
+		b, _ := os.ReadFile(filepath.Join(dir, name))
+		if fixed := string(b) == "println \"Hi\"\n"; fixed != (name == "a.gop" || name == "sub/e.spx") {
+			t.Fatalf("gop fmt --check --write: %s is %q", name, b)
+		}
+	}
+	if out, code = runGopFmt(t, dir, files, "--check", "-"); code != 0 || out != "" {
+		t.Fatalf("gop fmt --check after --write: exit code %d\n%s", code, out)
+	}
+
+	writeFiles(t, dir, map[string]string{"g.gop": "println ("})
+	if _, code = runGopFmt(t, dir, "", "--check", "g.gop"); code != 2 {
+		t.Fatal("gop fmt --check of a file with syntax errors: exit code", code)
+	}
+}
+
+func TestRunJobs(t *testing.T) {
+	dir := t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		files[string(rune('a'+i))+".gop"] = "println  " + strings.Repeat("1", i+1) + "\n"
+	}
+	files["b.gop"] = "println 11\n" // formatted
+	files["c.gop"] = "println ("    // syntax error
+	writeFiles(t, dir, files)
+	os.Chmod(filepath.Join(dir, "a.gop"), 0600)
+
+	paths, jobs := walkJobs(dir, false)
+	if len(paths) != 20 {
+		t.Fatal("walk:", paths)
+	}
+	runJobs(jobs, 4)
+	for _, job := range jobs {
+		name := filepath.Base(job.path)
+		if name == "c.gop" {
+			if job.err == nil {
+				t.Fatal("gopfmt c.gop: no error?")
+			}
+			continue
+		}
+		if job.err != nil || job.changed != (name != "b.gop") {
+			t.Fatal("gopfmt:", name, job.changed, job.err)
+		}
+		b, _ := os.ReadFile(job.path)
+		if want := strings.Replace(files[name], "  ", " ", 1); string(b) != want {
+			t.Fatalf("gopfmt %s: %q", name, b)
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "a.gop")); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatal("file mode of a.gop is changed:", fi.Mode(), err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "c.gop")); string(b) != files["c.gop"] {
+		t.Fatal("c.gop with syntax errors is changed:", string(b))
+	}
+	if paths, _ = walkJobs(dir, false); len(paths) != 20 { // no temporary files left
+		t.Fatal("files after gop fmt:", paths)
+	}
+}
+
+func TestWriteFileWithBackup(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.gop")
+	writeFiles(t, dir, map[string]string{"a.gop": "println 1\n", "sub/b.gop": "println 2\n"})
+	if err := writeFileWithBackup(file, []byte("println 3\n")); err != nil {
+		t.Fatal("writeFileWithBackup:", err)
+	}
+	if b, _ := os.ReadFile(file); string(b) != "println 3\n" {
+		t.Fatal("writeFileWithBackup:", string(b))
+	}
+
+	// A write failing before the rename leaves the original file intact.
+	if err := writeFileWithBackup(filepath.Join(dir, "nodir", "a.gop"), nil); err == nil {
+		t.Fatal("writeFileWithBackup in a directory not found: no error?")
+	}
+	// So does a failed rename (here the target is a directory which isn't
+	// empty), and the temporary file is removed.
+	if err := writeFileWithBackup(filepath.Join(dir, "sub"), []byte("println 4\n")); err == nil {
+		t.Fatal("writeFileWithBackup to a directory: no error?")
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "sub", "b.gop")); string(b) != "println 2\n" {
+		t.Fatal("sub/b.gop is changed:", string(b))
+	}
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if v := strings.Join(names, " "); v != "a.gop sub" {
+		t.Fatal("files left:", v)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package list implements the ``gop list'' command.
+package list
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qiniu/x/log"
+
+	"github.com/goplus/gop/cmd/internal/base"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/x/gopmod"
+	"github.com/goplus/gop/x/gopproj"
+)
+
+// -----------------------------------------------------------------------------
+
+// Cmd - gop list
+var Cmd = &base.Command{
+	UsageLine: "gop list [-deps -explain -tags tag,list] [gopSrcDir|gopSrcFile ...]",
+	Short:     "List Go+ packages in JSON, like `go list -json`",
+}
+
+var (
+	flag        = &Cmd.Flag
+	flagDeps    = flag.Bool("deps", false, "also list the transitive dependencies of the imports.")
+	flagExplain = flag.Bool("explain", false, "print whether each file in the directories is compiled, and why not if it isn't.")
+	flagTags    = flag.String("tags", "", "a comma-separated list of build tags, to list the dependencies with.")
+)
+
+func init() {
+	Cmd.Run = runCmd
+}
+
+func runCmd(cmd *base.Command, args []string) {
+	err := flag.Parse(args)
+	if err != nil {
+		log.Fatalln("parse input arguments failed:", err)
+	}
+	args = flag.Args()
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	projs, next, err := gopproj.ParseAll(args...)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(next) > 0 {
+		log.Fatalln("unexpected arguments:", strings.Join(next, " "))
+	}
+	if *flagExplain {
+		explain(projs)
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	ctx := gopmod.New("")
+	for _, proj := range projs {
+		goProj, err := ctx.OpenProject(0, proj)
+		if err != nil {
+			log.Fatalln("OpenProject failed:", err)
+		}
+		if *flagTags != "" {
+			goProj.BuildTags = strings.Split(*flagTags, ",")
+		}
+		pkg, err := ctx.List(goProj, *flagDeps)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err = enc.Encode(pkg); err != nil {
+			log.Fatalln("encode json failed:", err)
+		}
+	}
+}
+
+// explain prints whether each file in the directories projs is compiled when
+// the directory is compiled as a Go+ package (eg. by gop run or gop go), and
+// why not if it isn't, as the parser decides it (see parser.ExplainDir).
+func explain(projs []gopproj.Proj) {
+	for _, proj := range projs {
+		v, ok := proj.(*gopproj.DirProj)
+		if !ok {
+			log.Fatalln("gop list -explain: not a directory -", proj)
+		}
+		build.Default.BuildTags = v.BuildTags
+		if *flagTags != "" {
+			build.Default.BuildTags = strings.Split(*flagTags, ",")
+		}
+		files, err := parser.ExplainDir(v.Dir, nil, parser.ParseComments)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, f := range files {
+			if f.Reason == "" {
+				fmt.Printf("%s: included\n", filepath.Join(v.Dir, f.Name))
+			} else {
+				fmt.Printf("%s: excluded: %s\n", filepath.Join(v.Dir, f.Name), f.Reason)
+			}
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
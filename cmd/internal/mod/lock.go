@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mod
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/goplus/gop/cmd/internal/base"
+	"github.com/goplus/gop/x/gopmod"
+	"github.com/goplus/gop/x/gopproj"
+)
+
+var cmdLock = &base.Command{
+	UsageLine: "gop mod lock [-tags tag,list] [gopSrcDir|gopSrcFile ...]",
+	Short:     "pin the modules a Go+ program uses in the default context, for gop run -locked",
+}
+
+func init() {
+	cmdLock.Run = runLock
+}
+
+// runLock writes the lock files (eg. hello.gop.lock and hello.gop.sum for
+// hello.gop) of a Go+ program next to its source files, see
+// gopmod.Context.Lock.
+func runLock(cmd *base.Command, args []string) {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	proj, next, err := gopproj.ParseOne(args...)
+	if err != nil {
+		log.Fatalln("gop mod lock:", err)
+	}
+	if len(next) > 0 {
+		log.Fatalln("gop mod lock: unexpected arguments:", next)
+	}
+	ctx := gopmod.New("")
+	goProj, err := ctx.OpenProject(0, proj)
+	if err != nil {
+		log.Fatalln("gop mod lock:", err)
+	}
+	if err = ctx.Lock(goProj); err != nil {
+		log.Fatalln("gop mod lock:", err)
+	}
+	fmt.Fprintln(os.Stderr, "gop: written", goProj.LockFile(), "and", goProj.LockSumFile())
+}
@@ -27,5 +27,6 @@ var Cmd = &base.Command{
 		cmdInit,
 		cmdDownload,
 		cmdTidy,
+		cmdLock,
 	},
 }
@@ -13,27 +13,158 @@
  * See the License for the specific language governing permissions and
  * limitations under the License.
  */
-// gop mod tidy
+
 package mod
 
 import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/goplus/gop/cmd/internal/base"
 	"github.com/goplus/gop/cmd/internal/modload"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/token"
 	"github.com/goplus/gop/x/mod/modfetch"
 )
 
 var cmdTidy = &base.Command{
-	UsageLine: "gop mod tidy [-e] [-v]",
+	UsageLine: "gop mod tidy [-n] [-e] [-v] [-x] [-go=version] [-compat=version]",
 	Short:     "add missing and remove unused modules",
 }
 
+var (
+	tidyFlag        = &cmdTidy.Flag
+	tidyFlagNotExec = tidyFlag.Bool("n", false, "print the modules to add and remove, without changing go.mod and gop.mod.")
+	tidyFlagErrors  = tidyFlag.Bool("e", false, "proceed despite errors loading packages.")
+	tidyFlagVerbose = tidyFlag.Bool("v", false, "print the modules added and removed.")
+	tidyFlagTrace   = tidyFlag.Bool("x", false, "print the commands go mod tidy executes.")
+	tidyFlagGo      = tidyFlag.String("go", "", "set the go directive of go.mod, passed to go mod tidy.")
+	tidyFlagCompat  = tidyFlag.String("compat", "", "the Go version to keep go.sum compatible with, passed to go mod tidy.")
+)
+
 func init() {
 	cmdTidy.Run = runTidy
 }
 
 func runTidy(cmd *base.Command, args []string) {
+	err := tidyFlag.Parse(args)
+	if err != nil {
+		log.Fatalln("parse input arguments failed:", err)
+	}
 	modload.LoadModFile()
+	root := modload.ModRoot()
+	imports, err := gopImports(root)
+	if err != nil {
+		if !*tidyFlagErrors {
+			log.Fatalln("gop mod tidy:", err)
+		}
+		fmt.Fprintln(os.Stderr, "gop mod tidy:", err)
+	}
+	missing, unused := modload.TidyImports(imports)
+	if *tidyFlagNotExec || *tidyFlagVerbose {
+		for _, pkgPath := range missing {
+			fmt.Fprintln(os.Stderr, "add", pkgPath)
+		}
+		for _, mod := range unused {
+			fmt.Fprintln(os.Stderr, "remove", mod.Path, mod.Version)
+		}
+	}
+	if *tidyFlagNotExec {
+		return
+	}
+	modload.DropRequires(unused)
 	modload.SyncGoMod()
-	modfetch.TidyArgs(".", args...)
+	if len(missing) > 0 {
+		modfetch.GetArgs(root, missing...)
+	}
+	modfetch.TidyArgs(root, goTidyArgs()...) // prunes and verifies go.sum
 	modload.SyncGopMod()
 }
+
+// goTidyArgs returns the arguments passed to go mod tidy: the flags of it
+// and the arguments after the flags.
+func goTidyArgs() (args []string) {
+	for _, v := range []struct {
+		set  bool
+		flag string
+	}{
+		{*tidyFlagErrors, "-e"},
+		{*tidyFlagVerbose, "-v"},
+		{*tidyFlagTrace, "-x"},
+		{*tidyFlagGo != "", "-go=" + *tidyFlagGo},
+		{*tidyFlagCompat != "", "-compat=" + *tidyFlagCompat},
+	} {
+		if v.set {
+			args = append(args, v.flag)
+		}
+	}
+	return append(args, tidyFlag.Args()...)
+}
+
+// gopImports returns all packages imported by Go+ source code of the module
+// in the directory root.
+func gopImports(root string) ([]string, error) {
+	fset := token.NewFileSet()
+	imports := make(map[string]struct{})
+	err := filepath.WalkDir(root, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		if dir != root {
+			if name := d.Name(); isSkippedDir(name) {
+				return filepath.SkipDir
+			}
+			if isModRoot(dir) { // nested module
+				return filepath.SkipDir
+			}
+		}
+		pkgs, err := parser.ParseDir(fset, dir, isGopSource, parser.ImportsOnly|parser.ParseGoFiles)
+		if err != nil {
+			return err
+		}
+		for _, pkg := range pkgs {
+			for _, f := range pkg.Files {
+				for _, imp := range f.Imports {
+					pkgPath, err := strconv.Unquote(imp.Path.Value)
+					if err != nil {
+						return err
+					}
+					imports[pkgPath] = struct{}{}
+				}
+			}
+		}
+		return nil
+	})
+	ret := make([]string, 0, len(imports))
+	for pkgPath := range imports {
+		ret = append(ret, pkgPath)
+	}
+	sort.Strings(ret)
+	return ret, err
+}
+
+func isModRoot(dir string) bool {
+	for _, modfile := range []string{"gop.mod", "go.mod"} {
+		if _, err := os.Stat(filepath.Join(dir, modfile)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func isSkippedDir(name string) bool {
+	return name == "vendor" || name == "testdata" ||
+		strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// isGopSource reports whether fi is a Go+ source file, excluding the Go files
+// generated by Go+, which import Go+ builtin packages automatically.
+func isGopSource(fi fs.FileInfo) bool {
+	return !strings.HasPrefix(fi.Name(), "gop_autogen")
+}
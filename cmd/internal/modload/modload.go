@@ -44,29 +44,6 @@ var (
 
 var ErrNoModRoot = errors.New("gop.mod file not found in current directory or any parent directory; see 'gop help modules'")
 
-func findModuleRoot(dir string) (root string) {
-	if dir == "" {
-		panic("dir not set")
-	}
-	dir = filepath.Clean(dir)
-
-	// Look for enclosing gop.mod or go.mod.
-	for {
-		if fi, err := os.Stat(filepath.Join(dir, "gop.mod")); err == nil && !fi.IsDir() {
-			return dir
-		}
-		if fi, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil && !fi.IsDir() {
-			return dir
-		}
-		d := filepath.Dir(dir)
-		if d == dir {
-			break
-		}
-		dir = d
-	}
-	return ""
-}
-
 func SetModRoot(dir string) {
 	modRoot = dir
 }
@@ -148,8 +125,7 @@ func Init() {
 	if modRoot != "" {
 		// nothing to do
 	} else {
-		modRoot := findModuleRoot(gopRoot)
-		if modRoot != "" {
+		if modRoot, err := env.FindModRoot(gopRoot); err == nil {
 			SetModRoot(modRoot)
 		}
 	}
@@ -228,6 +204,17 @@ func Load() {
 		gengo.RegisterPkgFlags(classModFile.Classfile.WorkExt, gengo.PkgFlagSpx)
 		cl.RegisterClassFileType(classModFile.Classfile.ProjExt,
 			classModFile.Classfile.WorkExt, classModFile.Classfile.PkgPaths...)
+		if this := classModFile.This; this != nil {
+			cl.RegisterClassThis(classModFile.Classfile.ProjExt, this.Name)
+		}
+		if classes := classModFile.Class; classes != nil {
+			works := make([]cl.WorkClass, len(classes))
+			for i, c := range classes {
+				gengo.RegisterPkgFlags(c.Ext, gengo.PkgFlagSpx)
+				works[i] = cl.WorkClass{Ext: c.Ext, Base: c.Base, This: c.This}
+			}
+			cl.RegisterWorkClasses(classModFile.Classfile.ProjExt, works...)
+		}
 	}
 }
 
@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modload
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	gomodfile "golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+
+	"github.com/goplus/gop/x/mod/modfetch"
+)
+
+const (
+	gopModPath = "github.com/goplus/gop"
+)
+
+// ModRoot returns the root directory of the main module.
+func ModRoot() string {
+	if !HasModRoot() {
+		log.Fatalf("gop: %v", ErrNoModRoot)
+	}
+	return modRoot
+}
+
+// TidyImports compares the requires of gop.mod with the packages imported by
+// the Go+ source code. It returns imported packages not provided by any
+// required module, and direct requires not used by any import.
+//
+// Standard packages and packages Go+ imports automatically (the Go+ builtin
+// packages and the classfile modules) are never reported.
+func TidyImports(imports []string) (missing []string, unused []module.Version) {
+	used := make(map[string]bool)
+	for _, pkgPath := range imports {
+		if isAutoImported(pkgPath) || inModule(pkgPath, modFile.Module.Mod.Path) {
+			continue
+		}
+		if mod := requireOf(pkgPath); mod != "" {
+			used[mod] = true
+		} else {
+			missing = append(missing, pkgPath)
+		}
+	}
+	for _, r := range modFile.Require {
+		if r.Indirect || used[r.Mod.Path] || isAutoImportedMod(r.Mod.Path) {
+			continue
+		}
+		unused = append(unused, r.Mod)
+	}
+	sort.Strings(missing)
+	return
+}
+
+// DropRequires removes requires of the modules from both gop.mod and go.mod.
+func DropRequires(mods []module.Version) {
+	if len(mods) == 0 {
+		return
+	}
+	for _, mod := range mods {
+		if err := modFile.DropRequire(mod.Path); err != nil {
+			log.Fatalf("gop: %v", err)
+		}
+	}
+	WriteGopMod()
+
+	gomodPath := GoModFilePath()
+	if _, err := os.Stat(gomodPath); err != nil {
+		return
+	}
+	data, err := modfetch.Read(gomodPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var fixed bool
+	gomod, err := gomodfile.Parse(gomodPath, data, fixGoVersion(&fixed))
+	if err != nil {
+		// Errors returned by modfile.Parse begin with file:line.
+		log.Fatalf("gop: errors parsing go.mod:\n%s\n", err)
+	}
+	for _, mod := range mods {
+		if err = gomod.DropRequire(mod.Path); err != nil {
+			log.Fatalf("gop: %v", err)
+		}
+	}
+	gomod.Cleanup()
+
+	new, err := gomod.Format()
+	if err != nil {
+		log.Fatalf("gop: %v", err)
+	}
+
+	errNoChange := errors.New("no update needed")
+	err = modfetch.Transform(gomodPath, func(old []byte) ([]byte, error) {
+		if bytes.Equal(old, new) {
+			return nil, errNoChange
+		}
+		return new, nil
+	})
+	if err != nil && err != errNoChange {
+		log.Fatalf("gop: updating go.mod: %v", err)
+	}
+}
+
+// requireOf returns path of the required module which provides pkgPath.
+func requireOf(pkgPath string) (mod string) {
+	for _, r := range modFile.Require {
+		if inModule(pkgPath, r.Mod.Path) && len(r.Mod.Path) > len(mod) {
+			mod = r.Mod.Path
+		}
+	}
+	return
+}
+
+func isAutoImported(pkgPath string) bool {
+	if isStdPkg(pkgPath) {
+		return true
+	}
+	if inModule(pkgPath, gopModPath) {
+		return true
+	}
+	for _, r := range modFile.Register {
+		if inModule(pkgPath, r.ClassfileMod) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAutoImportedMod(modPath string) bool {
+	if modPath == gopModPath {
+		return true
+	}
+	for _, r := range modFile.Register {
+		if modPath == r.ClassfileMod {
+			return true
+		}
+	}
+	return false
+}
+
+// isStdPkg reports whether pkgPath is a standard package. Like the go
+// command, it assumes paths whose first element has no dot are standard.
+func isStdPkg(pkgPath string) bool {
+	elem := pkgPath
+	if i := strings.Index(elem, "/"); i >= 0 {
+		elem = elem[:i]
+	}
+	return !strings.Contains(elem, ".")
+}
+
+func inModule(pkgPath, modPath string) bool {
+	return pkgPath == modPath || strings.HasPrefix(pkgPath, modPath+"/")
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package modload
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/module"
+)
+
+const tidyModFile = `module example.com/foo
+
+go 1.16
+
+require (
+	example.com/a v1.0.0
+	example.com/a/b v1.1.0
+	example.com/unused v1.0.0
+	example.com/indirect v1.0.0 // indirect
+	github.com/goplus/gop v1.0.0
+)
+`
+
+// loadTidyMod loads the module in a new directory, with both gop.mod and
+// go.mod of tidyModFile.
+func loadTidyMod(t *testing.T) string {
+	dir := t.TempDir()
+	for _, name := range []string{"gop.mod", "go.mod"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(tidyModFile), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := modRoot
+	t.Cleanup(func() {
+		modRoot, modFile = old, nil
+	})
+	SetModRoot(dir)
+	LoadModFile()
+	return dir
+}
+
+func TestTidyImports(t *testing.T) {
+	loadTidyMod(t)
+	missing, unused := TidyImports([]string{
+		"fmt", "net/http", // standard
+		"github.com/goplus/gop/builtin", // auto imported
+		"example.com/foo/sub",           // in the module
+		"example.com/a/b/c",             // in the longest module providing it
+		"example.com/missing/pkg",
+		"example.com/b",
+	})
+	if !reflect.DeepEqual(missing, []string{"example.com/b", "example.com/missing/pkg"}) {
+		t.Fatal("TidyImports: missing", missing)
+	}
+	expected := []module.Version{
+		{Path: "example.com/a", Version: "v1.0.0"},
+		{Path: "example.com/unused", Version: "v1.0.0"},
+	}
+	if !reflect.DeepEqual(unused, expected) {
+		t.Fatal("TidyImports: unused", unused)
+	}
+}
+
+func TestDropRequires(t *testing.T) {
+	dir := loadTidyMod(t)
+	DropRequires(nil) // nothing to drop
+	DropRequires([]module.Version{{Path: "example.com/unused", Version: "v1.0.0"}})
+	for _, name := range []string{"gop.mod", "go.mod"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := string(b)
+		if strings.Contains(data, "example.com/unused") {
+			t.Fatalf("DropRequires: %s not changed:\n%s", name, data)
+		}
+		for _, mod := range []string{"example.com/a v1.0.0", "example.com/a/b v1.1.0", "example.com/indirect v1.0.0"} {
+			if !strings.Contains(data, mod) {
+				t.Fatalf("DropRequires: %s dropped from %s:\n%s", mod, name, data)
+			}
+		}
+	}
+}
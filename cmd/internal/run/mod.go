@@ -27,19 +27,40 @@ func findGoModDir(dir string) (string, bool) {
 	return filepath.Dir(modfile), nocachefile
 }
 
-func gopRun(source string, args ...string) {
+func gopRun(source string, isDir bool, args ...string) {
 	ctx := gopmod.New("")
 	flags := 0
 	if *flagGop {
 		flags = gopmod.FlagGoAsGoPlus
 	}
-	goProj, err := ctx.OpenFiles(flags, source)
+	var goProj *gopmod.Project
+	var err error
+	if isDir { // -locked only
+		goProj, err = ctx.OpenDir(flags, source)
+	} else {
+		goProj, err = ctx.OpenFiles(flags, source)
+	}
 	if err != nil {
 		log.Fatalln("OpenProject failed:", err)
 	}
+	if *flagLocked {
+		if _, err = os.Stat(goProj.LockFile()); err != nil {
+			log.Fatalln("no lock file, run gop mod lock first:", err)
+		}
+		goProj.Locked = true
+	}
+	if err = goProj.CheckRunnable(); err != nil {
+		log.Fatalln(err)
+	}
 	goProj.ExecArgs = args
 	goProj.FlagNRINC = *flagNorun
 	goProj.FlagRTOE = *flagRTOE
+	goProj.Work = *flagWork
+	goProj.NoCgo = *flagNoCgo
+	goProj.ExecDir = *flagDir
+	if *flagDumpGo {
+		goProj.DumpGo = os.Stderr
+	}
 	if goProj.FlagRTOE {
 		goProj.UseDefaultCtx = true
 	}
@@ -22,6 +22,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
 
 	"github.com/qiniu/x/log"
 	"golang.org/x/tools/go/packages"
@@ -34,6 +36,7 @@ import (
 	"github.com/goplus/gop/parser"
 	"github.com/goplus/gop/scanner"
 	"github.com/goplus/gop/token"
+	"github.com/goplus/gop/x/gopmod"
 	"github.com/goplus/gox"
 )
 
@@ -41,7 +44,7 @@ import (
 
 // Cmd - gop run
 var Cmd = &base.Command{
-	UsageLine: "gop run [-asm -quiet -debug -nr -gop -prof] <gopSrcDir|gopSrcFile>",
+	UsageLine: "gop run [-asm -quiet -debug -nr -gop -prof -dumpgo -gop:work -nocgo -locked -dir dir] <gopSrcDir|gopSrcFile>",
 	Short:     "Run a Go+ program",
 }
 
@@ -55,6 +58,11 @@ var (
 	flagRTOE    = flag.Bool("rtoe", false, "remove tempfile on error")
 	flagGop     = flag.Bool("gop", false, "parse a .go file as a .gop file")
 	flagProf    = flag.Bool("prof", false, "do profile and generate profile report")
+	flagDumpGo  = flag.Bool("dumpgo", false, "print the generated Go code to stderr before running")
+	flagWork    = flag.Bool("gop:work", false, "print the directory of the generated Go code and keep it, as well as the work directory of the go command")
+	flagNoCgo   = flag.Bool("nocgo", false, "build without cgo (CGO_ENABLED=0), and fail if the generated Go code imports \"C\"")
+	flagLocked  = flag.Bool("locked", false, "run with the module versions pinned by gop mod lock, in the default context")
+	flagDir     = flag.String("dir", "", "run the program in `dir`, instead of the current directory")
 )
 
 const (
@@ -71,7 +79,7 @@ func saveGoFile(gofile string, pkg *gox.Package) error {
 	if err != nil {
 		return err
 	}
-	return gox.WriteFile(gofile, pkg, false)
+	return cl.WriteFile(gofile, pkg, false)
 }
 
 func runCmd(cmd *base.Command, args []string) {
@@ -102,6 +110,12 @@ func runCmd(cmd *base.Command, args []string) {
 		panic("TODO: profile not impl")
 	}
 
+	if *flagDir != "" {
+		if fi, err := os.Stat(*flagDir); err != nil || !fi.IsDir() {
+			log.Fatalln("-dir: not a directory:", *flagDir)
+		}
+	}
+
 	fset := token.NewFileSet()
 	src, _ := filepath.Abs(flag.Arg(0))
 	fi, err := os.Stat(src)
@@ -112,8 +126,9 @@ func runCmd(cmd *base.Command, args []string) {
 
 	var isDirty bool
 	var srcDir, gofile string
+	var srcs []string // Go+ source files of gofile, see sourceFiles
 	var pkgs map[string]*ast.Package
-	if isDir {
+	if isDir && !*flagLocked {
 		srcDir = src
 		gofile = src + "/gop_autogen.go"
 		modload.Load()
@@ -124,7 +139,7 @@ func runCmd(cmd *base.Command, args []string) {
 			return
 		}
 	} else {
-		gopRun(src, args...)
+		gopRun(src, isDir, args...)
 		return
 	}
 	if err != nil {
@@ -156,6 +171,13 @@ func runCmd(cmd *base.Command, args []string) {
 			log.Fatalln("saveGoFile failed:", err)
 		}
 		conf.PkgsLoader.Save()
+		srcs = sourceFiles(mainPkg)
+	}
+	if *flagDumpGo { // even if the Go file isn't regenerated
+		err = gopmod.DumpGoFile(os.Stderr, gofile, srcs...)
+		if err != nil {
+			log.Fatalln("DumpGoFile failed:", err)
+		}
 	}
 
 	goRun(gofile, args)
@@ -164,18 +186,66 @@ func runCmd(cmd *base.Command, args []string) {
 	}
 }
 
+// sourceFiles returns names of the Go+ source files of pkg, in sorted order.
+func sourceFiles(pkg *ast.Package) []string {
+	files := make([]string, 0, len(pkg.Files))
+	for file := range pkg.Files {
+		files = append(files, filepath.Base(file))
+	}
+	sort.Strings(files)
+	return files
+}
+
 func goRun(file string, args []string) {
-	goArgs := make([]string, len(args)+2)
-	goArgs[0] = "run"
-	goArgs[1] = file
-	copy(goArgs[2:], args)
+	goArgs := []string{"run"}
+	var exe string
+	if *flagDir != "" { // go run runs the program in its own directory, so build it first
+		tmpDir, err := os.MkdirTemp("", "goprun")
+		if err != nil {
+			log.Fatalln("go run failed:", err)
+		}
+		defer os.RemoveAll(tmpDir)
+		exe = filepath.Join(tmpDir, "main")
+		if runtime.GOOS == "windows" {
+			exe += ".exe"
+		}
+		goArgs = []string{"build", "-o", exe}
+	}
+	if *flagWork {
+		fmt.Fprintf(os.Stderr, "GOPWORK=%s\n", filepath.Dir(file))
+		goArgs = append(goArgs, "-work")
+	}
+	goArgs = append(goArgs, file)
+	if exe == "" {
+		goArgs = append(goArgs, args...)
+	}
 	cmd := exec.Command("go", goArgs...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Env = os.Environ()
+	if *flagNoCgo {
+		if filepath.Ext(file) == ".go" { // not a Go package, see runGoPkg
+			if err := gopmod.CheckNoCgo(file); err != nil {
+				log.Fatalln(err)
+			}
+		}
+		cmd.Env = append(cmd.Env, "CGO_ENABLED=0")
+	}
 	err := cmd.Run()
+	if err == nil && exe != "" {
+		cmd = exec.Command(exe, args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = os.Environ()
+		cmd.Dir = *flagDir
+		err = cmd.Run()
+	}
 	if err != nil {
+		if exe != "" {
+			os.RemoveAll(filepath.Dir(exe)) // os.Exit doesn't run deferred calls
+		}
 		switch e := err.(type) {
 		case *exec.ExitError:
 			os.Exit(e.ExitCode())
@@ -19,51 +19,43 @@ package test
 
 import (
 	"fmt"
-	"github.com/qiniu/x/log"
 	"os"
 	"strings"
 
 	"github.com/goplus/gop/cl"
 	"github.com/goplus/gop/cmd/gengo"
 	"github.com/goplus/gop/cmd/internal/base"
-	"github.com/goplus/gox"
 )
 
-// Cmd - gop install
+// Cmd - gop test
 var Cmd = &base.Command{
-	UsageLine: "gop test [-v] <GopPackages>",
+	UsageLine: "gop test [-run regexp] [-count n] [-v] [build/test flags] [packages]",
 	Short:     "Test Go+ packages",
 }
 
-var (
-	flag        = &Cmd.Flag
-	flagVerbose = flag.Bool("v", false, "print verbose information")
-)
-
 func init() {
 	Cmd.Run = runCmd
 }
 
+// runCmd generates Go code of the Go+ packages to test, including the test
+// files (*_test.gop), and then runs `go test` with args. Flags of `go test`
+// are passed as they are. As the generated code has line directives, test
+// failures are reported at positions in Go+ files.
 func runCmd(_ *base.Command, args []string) {
-	err := flag.Parse(base.SkipSwitches(args, flag))
-	if err != nil {
-		log.Fatalln("parse input arguments failed:", err)
-	}
-	ssargs := flag.Args()
-	if len(ssargs) == 0 {
-		ssargs = []string{"."}
-	}
-	var recursive bool
-	var dir = ssargs[0]
-	if strings.HasSuffix(dir, "/...") {
-		dir = dir[:len(dir)-4]
-		recursive = true
+	if !genGo(testPackages(args)) {
+		os.Exit(1)
 	}
+	base.RunGoCmd("", "test", args...)
+}
 
-	if *flagVerbose {
-		gox.SetDebug(gox.DbgFlagAll &^ gox.DbgFlagComments)
-		cl.SetDebug(cl.DbgFlagAll)
-		cl.SetDisableRecover(true)
+// genGo generates Go code of the Go+ packages pkgs (the current directory if
+// empty), and their test files: *_test.gop files of the package are compiled
+// into gop_autogen_test.go, and those of the external test package (named
+// with a _test suffix) into gop_autogen2_test.go. It reports errors to stderr,
+// and returns false if there are any.
+func genGo(pkgs []string) bool {
+	if len(pkgs) == 0 {
+		pkgs = []string{"."}
 	}
 	hasError := false
 	runner := new(gengo.Runner)
@@ -79,12 +71,56 @@ func runCmd(_ *base.Command, args []string) {
 		return nil
 	})
 	baseConf := &cl.Config{PersistLoadPkgs: true}
-	runner.GenGo(dir, recursive, baseConf.Ensure())
+	for _, pkg := range pkgs {
+		dir, recursive := base.GetBuildDir([]string{pkg})
+		runner.GenGo(dir, recursive, baseConf.Ensure())
+	}
 	if hasError {
-		os.Exit(1)
+		return false
 	}
 	baseConf.PkgsLoader.Save()
-	base.RunGoCmd(dir, "test", args...)
+	return true
+}
+
+// testPackages returns the package arguments in args of `go test`, skipping
+// flags and their values. Arguments after -args are passed to the test binary,
+// so they aren't packages.
+func testPackages(args []string) (pkgs []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			pkgs = append(pkgs, arg)
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == "args" {
+			break
+		}
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if goTestValueFlags[strings.TrimPrefix(name, "test.")] {
+			i++ // skip the value
+		}
+	}
+	return
+}
+
+// goTestValueFlags are the flags of `go test` (build and test flags) that take
+// a value, which is the next argument unless specified as -flag=value.
+var goTestValueFlags = map[string]bool{
+	"asmflags": true, "buildmode": true, "compiler": true, "gccgoflags": true,
+	"gcflags": true, "installsuffix": true, "ldflags": true, "mod": true,
+	"modfile": true, "overlay": true, "pkgdir": true, "tags": true,
+	"toolexec": true, "o": true, "p": true, "exec": true, "vet": true,
+
+	"bench": true, "benchtime": true, "blockprofile": true, "blockprofilerate": true,
+	"count": true, "coverprofile": true, "covermode": true, "coverpkg": true,
+	"cpu": true, "cpuprofile": true, "list": true, "memprofile": true,
+	"memprofilerate": true, "mutexprofile": true, "mutexprofilefraction": true,
+	"outputdir": true, "parallel": true, "run": true, "shuffle": true,
+	"skip": true, "timeout": true, "trace": true,
+	"fuzz": true, "fuzztime": true, "fuzzminimizetime": true,
 }
 
 // -----------------------------------------------------------------------------
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTestPackages(t *testing.T) {
+	cases := []struct {
+		args []string
+		pkgs []string
+	}{
+		{nil, nil},
+		{[]string{"-v", "-run", "TestAdd", "./..."}, []string{"./..."}},
+		{[]string{"-count=1", "-tags", "foo", "a", "b"}, []string{"a", "b"}},
+		{[]string{"-test.run", "X", "a", "-args", "b"}, []string{"a"}},
+	}
+	for _, c := range cases {
+		if pkgs := testPackages(c.args); !reflect.DeepEqual(pkgs, c.pkgs) {
+			t.Fatal("testPackages:", c.args, pkgs)
+		}
+	}
+}
+
+func TestGopTest(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	root, err := filepath.Abs("../../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/foo\n\ngo 1.16\n\nrequire github.com/goplus/gop v1.0.0" +
+			"\n\nreplace github.com/goplus/gop => " + filepath.ToSlash(root) + "\n",
+		"add.gop": "package add\n\nfunc Add(a, b int) int {\n\treturn a + b\n}\n",
+		"add_test.gop": `package add
+
+import "testing"
+
+func TestAdd(t *testing.T) {
+	cases := [{"a": 1, "b": 2, "sum": 3}, {"a": -1, "b": 1, "sum": 0}]
+	for c <- cases {
+		if got := Add(c["a"], c["b"]); got != c["sum"] {
+			t.Errorf("Add(%v, %v) = %v", c["a"], c["b"], got)
+		}
+	}
+}
+
+func TestAddFail(t *testing.T) {
+	if got := Add(2, 2); got != 5 {
+		t.Errorf("Add(2, 2) = %v", got)
+	}
+}
+`,
+		"x_test.gop": `package add_test
+
+import (
+	"testing"
+
+	"example.com/foo"
+)
+
+func TestAddX(t *testing.T) {
+	if add.Add(1, 1) != 2 {
+		t.Fatal("Add(1, 1) != 2")
+	}
+}
+`,
+	}
+	if gosum, err := os.ReadFile(filepath.Join(root, "go.sum")); err == nil {
+		files["go.sum"] = string(gosum)
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	goTest := func(args ...string) (string, error) {
+		cmd := exec.Command("go", append([]string{"test", "-count=1", "-v"}, args...)...)
+		cmd.Dir = dir
+		b, err := cmd.CombinedOutput()
+		return string(b), err
+	}
+
+	if !genGo([]string{dir}) {
+		t.Fatal("genGo failed")
+	}
+	if out, err := goTest("-run", "TestAdd$|TestAddX"); err != nil ||
+		!strings.Contains(out, "--- PASS: TestAdd ") || !strings.Contains(out, "--- PASS: TestAddX ") {
+		t.Fatalf("go test: %v\n%s", err, out)
+	}
+	out, err := goTest("-run", "TestAddFail")
+	if err == nil || !strings.Contains(out, "add_test.gop:16: Add(2, 2) = 4") { // at the position in Go+ code
+		t.Fatalf("go test of a failed test: %v\n%s", err, out)
+	}
+
+	// Go files generated from tests removed are removed too.
+	os.Remove(filepath.Join(dir, "add_test.gop"))
+	os.Remove(filepath.Join(dir, "x_test.gop"))
+	if !genGo([]string{dir}) {
+		t.Fatal("genGo failed")
+	}
+	for _, name := range []string{"gop_autogen_test.go", "gop_autogen2_test.go"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Fatal("stale test file:", name, err)
+		}
+	}
+}
@@ -17,8 +17,13 @@
 package version
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"log"
+	"os/exec"
 	"runtime"
+	"strings"
 
 	"github.com/goplus/gop/cmd/internal/base"
 	"github.com/goplus/gop/env"
@@ -28,21 +33,64 @@ import (
 
 // Cmd - gop build
 var Cmd = &base.Command{
-	UsageLine: "gop version [-v]",
+	UsageLine: "gop version [-v -json]",
 	Short:     "Version prints the build information for Gop executables",
 }
 
 var (
-	flag = &Cmd.Flag
-	_    = flag.Bool("v", false, "print verbose information.")
+	flag     = &Cmd.Flag
+	_        = flag.Bool("v", false, "print verbose information.")
+	flagJson = flag.Bool("json", false, "print the build information (including the version of the go command) in JSON.")
 )
 
 func init() {
 	Cmd.Run = runCmd
 }
 
+// versionInfo is the output of `gop version -json`.
+type versionInfo struct {
+	Version   string // version of Go+
+	BuildDate string
+	GOPROOT   string
+	GOOS      string
+	GOARCH    string
+	GoVersion string // output of `go version`, empty if the go command isn't available
+}
+
 func runCmd(cmd *base.Command, args []string) {
-	fmt.Printf("gop %s %s/%s\n", env.Version(), runtime.GOOS, runtime.GOARCH)
+	err := flag.Parse(args)
+	if err != nil {
+		log.Fatalln("parse input arguments failed:", err)
+	}
+	if !*flagJson {
+		fmt.Printf("gop %s %s/%s\n", env.Version(), runtime.GOOS, runtime.GOARCH)
+		return
+	}
+	info := &versionInfo{
+		Version:   env.Version(),
+		BuildDate: env.BuildDate(),
+		GOPROOT:   env.GOPROOT(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		GoVersion: goVersion(),
+	}
+	b, err := json.MarshalIndent(info, "", "\t")
+	if err != nil {
+		log.Fatalln("encode json of version failed:", err)
+	}
+	fmt.Println(string(b))
+}
+
+// goVersion returns the output of `go version`, or "" if the go command isn't
+// found or fails.
+func goVersion() string {
+	var stdout bytes.Buffer
+	cmd := exec.Command("go", "version")
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(stdout.String())
 }
 
 // -----------------------------------------------------------------------------
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package version
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/goplus/gop/env"
+)
+
+// setenv sets the environment variable key to val during the test.
+func setenv(t *testing.T, key, val string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, val)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// output returns what `gop version args...` prints to stdout.
+func output(t *testing.T, args ...string) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+	runCmd(Cmd, args)
+	w.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestVersion(t *testing.T) {
+	if v := output(t, "-json=false"); v != "gop "+env.Version()+" "+runtime.GOOS+"/"+runtime.GOARCH+"\n" {
+		t.Fatal("gop version:", v)
+	}
+}
+
+func TestVersionJSON(t *testing.T) {
+	var info versionInfo
+	if err := json.Unmarshal([]byte(output(t, "-json")), &info); err != nil {
+		t.Fatal("gop version -json:", err)
+	}
+	if info.Version != env.Version() || info.BuildDate != env.BuildDate() || info.GOPROOT != env.GOPROOT() ||
+		info.GOOS != runtime.GOOS || info.GOARCH != runtime.GOARCH {
+		t.Fatal("gop version -json:", info)
+	}
+	if _, err := exec.LookPath("go"); err == nil && !strings.HasPrefix(info.GoVersion, "go version go") {
+		t.Fatal("gop version -json: GoVersion is", info.GoVersion)
+	}
+
+	setenv(t, "PATH", t.TempDir()) // the go command isn't found
+	out := output(t, "-json")
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatal("gop version -json without go:", err)
+	}
+	if info.GoVersion != "" || info.Version != env.Version() || !strings.Contains(out, `"GoVersion": ""`) {
+		t.Fatal("gop version -json without go:\n", out)
+	}
+}
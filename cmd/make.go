@@ -20,19 +20,74 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
+// Verbosity levels of messages printed by this script, set by -q and -v flags.
+const (
+	levelQuiet   = iota // errors only
+	levelNormal         // errors and info messages
+	levelVerbose        // also commands executed
+)
+
+var verbosity = levelNormal
+
+// infoOutput is where info and verbose messages are printed. It's stderr if
+// -json flag is set, as stdout is for the build events then.
+var infoOutput io.Writer = os.Stdout
+
+// info prints an info message to infoOutput, unless in quiet mode.
+func info(a ...interface{}) {
+	if verbosity >= levelNormal {
+		fmt.Fprintln(infoOutput, a...)
+	}
+}
+
+// infof is like info, but formats the message like fmt.Printf.
+func infof(format string, a ...interface{}) {
+	if verbosity >= levelNormal {
+		fmt.Fprintf(infoOutput, format, a...)
+	}
+}
+
+// verbosef prints a message to infoOutput in verbose mode only.
+func verbosef(format string, a ...interface{}) {
+	if verbosity >= levelVerbose {
+		fmt.Fprintf(infoOutput, format, a...)
+	}
+}
+
+// fatalln prints an error message to stderr and exits.
+func fatalln(a ...interface{}) {
+	fmt.Fprintln(os.Stderr, a...)
+	os.Exit(1)
+}
+
+// fatalf is like fatalln, but formats the message like fmt.Printf.
+func fatalf(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, a...)
+	os.Exit(1)
+}
+
 func checkPathExist(path string, isDir bool) bool {
 	stat, err := os.Stat(path)
 	isExists := !os.IsNotExist(err)
@@ -69,8 +124,7 @@ func getGopRoot() string {
 
 	for _, path := range pathsToCheck {
 		if !path.checkExists(pwd) {
-			println("Error: This script should be run at the root directory of gop repository.")
-			os.Exit(1)
+			fatalln("Error: This script should be run at the root directory of gop repository.")
 		}
 	}
 	return pwd
@@ -99,6 +153,7 @@ func init() {
 
 func execCommand(command string, arg ...string) (string, string, error) {
 	var stdout, stderr bytes.Buffer
+	verbosef("+ %s\n", strings.Join(append([]string{command}, arg...), " "))
 	cmd := exec.Command(command, arg...)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -107,6 +162,211 @@ func execCommand(command string, arg ...string) (string, string, error) {
 	return stdout.String(), stderr.String(), err
 }
 
+// commandTimeout is the time a build or test command is allowed to run, see
+// execCommandTimeout. It's set by -timeout flag, and 0 means no timeout.
+var commandTimeout = time.Hour
+
+// errCommandTimeout is wrapped by the error execCommandTimeout returns if the
+// command is killed for running longer than the timeout.
+var errCommandTimeout = errors.New("timed out")
+
+// execCommandTimeout runs the command like execCommand, but kills it with the
+// processes it starts (see killProcessTree) if it doesn't exit within
+// commandTimeout, so a hung command (eg. go build) can't wedge the CI forever.
+// The output printed before it's killed is returned.
+func execCommandTimeout(command string, arg ...string) (string, string, error) {
+	return execCommandTee(nil, command, arg...)
+}
+
+// execCommandTee is like execCommandTimeout, but also writes the stderr of the
+// command to w as it's printed, if w isn't nil.
+func execCommandTee(w io.Writer, command string, arg ...string) (string, string, error) {
+	if commandTimeout <= 0 && w == nil {
+		return execCommand(command, arg...)
+	}
+	var stdout, stderr syncBuffer
+	verbosef("+ %s\n", strings.Join(append([]string{command}, arg...), " "))
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if commandTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, commandTimeout)
+	}
+	defer cancel()
+	cmd := exec.Command(command, arg...)
+	setProcessGroup(cmd)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if w != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, w)
+	}
+	cmd.Env = commandExecuteEnv
+	if err := cmd.Start(); err != nil {
+		return "", "", err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Kill the processes the command starts too (eg. go test run by gop
+		// test, and compilers run by go build), which would keep running and
+		// hold its output open. Don't wait for them to exit in case they can't
+		// be killed.
+		killProcessTree(cmd.Process)
+		err = fmt.Errorf("%s %w after %v", command, errCommandTimeout, commandTimeout)
+	}
+	return stdout.String(), stderr.String(), err
+}
+
+// setProcessGroup makes cmd run in a new process group on Unix-like systems,
+// so that killProcessTree kills the processes it starts too. The field is set
+// by reflection, as SysProcAttr has no Setpgid on Windows, where this file is
+// built too.
+func setProcessGroup(cmd *exec.Cmd) {
+	attr := &syscall.SysProcAttr{}
+	if f := reflect.ValueOf(attr).Elem().FieldByName("Setpgid"); f.IsValid() && f.Kind() == reflect.Bool {
+		f.SetBool(true)
+		cmd.SysProcAttr = attr
+	}
+}
+
+// killProcessTree kills the process p started by setProcessGroup, and the
+// processes it starts: its process group on Unix-like systems, or its process
+// tree on Windows.
+func killProcessTree(p *os.Process) {
+	pid := strconv.Itoa(p.Pid)
+	var kill *exec.Cmd
+	if inWindows {
+		kill = exec.Command("taskkill", "/T", "/F", "/PID", pid)
+	} else {
+		kill = exec.Command("kill", "-KILL", "--", "-"+pid)
+	}
+	if kill.Run() != nil { // kill the process at least
+		p.Kill()
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use, see execCommandTimeout.
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (p *syncBuffer) Write(b []byte) (int, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.buf.Write(b)
+}
+
+func (p *syncBuffer) String() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.buf.String()
+}
+
+// lineWriter calls fn with each line written to it, without the line break.
+type lineWriter struct {
+	buf []byte
+	fn  func(line string)
+}
+
+func (p *lineWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		pos := bytes.IndexByte(p.buf, '\n')
+		if pos < 0 {
+			break
+		}
+		p.fn(strings.TrimSuffix(string(p.buf[:pos]), "\r"))
+		p.buf = p.buf[pos+1:]
+	}
+	return len(b), nil
+}
+
+// -----------------------------------------------------------------------------
+
+// buildJSON is set by -json flag, to print the progress of installing Go+
+// tools as build events (see buildEvent) to stdout, for IDEs to show it.
+var buildJSON bool
+
+// buildEvent is a progress event of installing Go+ tools, printed as a JSON
+// object per line in -json mode, like the events of `go test -json`. Action
+// is one of:
+//
+//	start    go build is started
+//	package  Package is compiled, parsed from the output of go build -v
+//	link     Package is a command, linked after it's compiled
+//	done     installing is done, or failed with Error
+type buildEvent struct {
+	Time    time.Time
+	Action  string
+	Package string  `json:",omitempty"`
+	Elapsed float64 `json:",omitempty"` // seconds since start, for done events
+	Error   string  `json:",omitempty"`
+}
+
+// buildEvents prints the build events of installing Go+ tools to stdout in
+// -json mode, and does nothing otherwise.
+type buildEvents struct {
+	mutex    sync.Mutex
+	start    time.Time
+	commands map[string]bool // import paths of the commands built
+}
+
+func (p *buildEvents) emit(ev buildEvent) {
+	if !buildJSON {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ev.Time = time.Now()
+	if ev.Action == "start" {
+		p.start = ev.Time
+	} else if ev.Action == "done" {
+		ev.Elapsed = ev.Time.Sub(p.start).Seconds()
+	}
+	b, _ := json.Marshal(ev)
+	os.Stdout.Write(append(b, '\n'))
+}
+
+// goBuildOutput returns a writer parsing the output of go build -v, which
+// prints the import path of each package compiled on its own line, to emit
+// package and link events. It's nil if not in -json mode.
+func (p *buildEvents) goBuildOutput() *lineWriter {
+	if !buildJSON {
+		return nil
+	}
+	return &lineWriter{fn: func(line string) {
+		if line == "" || strings.HasPrefix(line, "#") || strings.ContainsAny(line, " \t:") { // not an import path, eg. errors
+			return
+		}
+		p.emit(buildEvent{Action: "package", Package: line})
+		if p.commands[line] {
+			p.emit(buildEvent{Action: "link", Package: line})
+		}
+	}}
+}
+
+// commandPackages returns the import paths of the commands (main packages)
+// matched by patterns, in the current directory.
+func commandPackages(useVendor bool, patterns []string) (map[string]bool, error) {
+	args := []string{"list", "-f", "{{if eq .Name \"main\"}}{{.ImportPath}}{{end}}"}
+	if useVendor {
+		args = append(args, "-mod=vendor")
+	}
+	stdout, stderr, err := execCommand("go", append(args, patterns...)...)
+	if err != nil {
+		return nil, fmt.Errorf("%v\n%s", err, stderr)
+	}
+	ret := make(map[string]bool)
+	for _, pkg := range strings.Fields(stdout) {
+		ret[pkg] = true
+	}
+	return ret, nil
+}
+
 func getGitBranch() string {
 	branch, _, err := execCommand("git", "rev-parse", "--abbrev-ref", "HEAD")
 	if err != nil {
@@ -141,15 +401,22 @@ func getBuildVer() string {
 	return trimRight(tagRet)
 }
 
-func getGopBuildFlags() string {
+// gopBuildVersion returns the version to stamp into Go+, specified by -buildver
+// or found by findGopVersion.
+func gopBuildVersion() string {
+	if buildVersion != "" {
+		return buildVersion
+	}
+	return findGopVersion()
+}
+
+func getGopBuildFlags(version string) string {
 	defaultGopRoot := gopRoot
 	if gopRootFinal := os.Getenv("GOPROOT_FINAL"); gopRootFinal != "" {
 		defaultGopRoot = gopRootFinal
 	}
 	buildFlags := fmt.Sprintf("-X \"github.com/goplus/gop/env.defaultGopRoot=%s\"", defaultGopRoot)
 	buildFlags += fmt.Sprintf(" -X \"github.com/goplus/gop/env.buildDate=%s\"", getBuildDateTime())
-
-	version := findGopVersion()
 	buildFlags += fmt.Sprintf(" -X \"github.com/goplus/gop/env.buildVersion=%s\"", version)
 
 	return buildFlags
@@ -178,49 +445,309 @@ func detectGoBinPath() string {
 	return filepath.Join(homeDir, "go", "bin")
 }
 
-func linkGoplusToLocalBin() string {
-	println("Start Linking.")
+func linkGoplusToLocalBin(binFiles []string) string {
+	info("Start Linking.")
 
 	gopBinPath := detectGopBinPath()
 	goBinPath := detectGoBinPath()
 	if !checkPathExist(gopBinPath, true) {
-		log.Fatalf("Error: %s is not existed, you should build Go+ before linking.\n", gopBinPath)
+		fatalf("Error: %s is not existed, you should build Go+ before linking.\n", gopBinPath)
 	}
 	if !checkPathExist(goBinPath, true) {
 		if err := os.MkdirAll(goBinPath, 0755); err != nil {
-			fmt.Printf("Error: target directory %s is not existed and we can't create one.\n", goBinPath)
-			log.Fatalln(err)
+			fatalf("Error: target directory %s is not existed and we can't create one: %v\n", goBinPath, err)
 		}
 	}
 
-	for _, file := range gopBinFiles {
+	for _, file := range binFiles {
 		sourceFile := filepath.Join(gopBinPath, file)
 		if !checkPathExist(sourceFile, false) {
-			log.Fatalf("Error: %s is not existed, you should build Go+ before linking.\n", sourceFile)
+			fatalf("Error: %s is not existed, you should build Go+ before linking.\n", sourceFile)
 		}
 		targetLink := filepath.Join(goBinPath, file)
 		if checkPathExist(targetLink, false) {
 			// Delete existed one
 			if err := os.Remove(targetLink); err != nil {
-				log.Fatalln(err)
+				fatalln(err)
 			}
 		}
-		if err := os.Symlink(sourceFile, targetLink); err != nil {
-			log.Fatalln(err)
+		strategy, err := "symlink", os.Symlink(sourceFile, targetLink)
+		if err != nil && inWindows && isSymlinkPrivilegeError(err) {
+			// Creating symlinks requires developer mode or admin privilege on
+			// Windows, fall back to a hard link, or a copy across volumes.
+			if strategy, err = "hard link", os.Link(sourceFile, targetLink); err != nil {
+				strategy, err = "copy", copyBinFile(sourceFile, targetLink)
+			}
+		}
+		if err != nil {
+			fatalln(err)
 		}
-		fmt.Printf("Link %s to %s successfully.\n", sourceFile, targetLink)
+		infof("Link %s to %s successfully (%s).\n", sourceFile, targetLink, strategy)
 	}
 
-	println("End linking.")
+	info("End linking.")
 	return goBinPath
 }
 
-func buildGoplusTools(useGoProxy bool) {
+// isSymlinkPrivilegeError reports whether err is returned by os.Symlink
+// because of lacking the privilege to create symlinks.
+func isSymlinkPrivilegeError(err error) bool {
+	const errorPrivilegeNotHeld = syscall.Errno(1314) // ERROR_PRIVILEGE_NOT_HELD on Windows
+	var errno syscall.Errno
+	return os.IsPermission(err) || errors.As(err, &errno) && errno == errorPrivilegeNotHeld
+}
+
+// parseBuildTargets parses the value of -targets flag, and checks that every
+// target is a command directory under ./cmd.
+func parseBuildTargets(targets string) []string {
+	if targets == "" {
+		return nil
+	}
+	commandsDir := filepath.Join(gopRoot, "cmd")
+	names := strings.Split(targets, ",")
+	for _, name := range names {
+		if name == "" || name == "internal" || strings.ContainsAny(name, `/\.`) ||
+			!checkPathExist(filepath.Join(commandsDir, name), true) {
+			fatalf("Error: invalid target `%s`, it should be a command under ./cmd directory.\n", name)
+		}
+	}
+	return names
+}
+
+// targetBinFiles returns the Go+ binary files to link after building targets.
+func targetBinFiles(targets []string) []string {
+	if len(targets) == 0 {
+		return gopBinFiles
+	}
+	var binFiles []string
+	for _, file := range gopBinFiles {
+		for _, name := range targets {
+			if strings.TrimSuffix(file, ".exe") == name {
+				binFiles = append(binFiles, file)
+				break
+			}
+		}
+	}
+	return binFiles
+}
+
+// checkVendor checks that the vendor directory exists, for building Go+
+// offline with -mod=vendor.
+func checkVendor() {
+	if !checkPathExist(filepath.Join(gopRoot, "vendor"), true) {
+		fatalln("Error: -vendor requires the vendor directory, run `go mod vendor` first.")
+	}
+}
+
+// checkOutputDir checks that the directory specified by -o flag is writable,
+// creating it if it doesn't exist.
+func checkOutputDir(dir string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		fatalln(err)
+	}
+	if err := os.MkdirAll(absDir, 0755); err != nil {
+		fatalf("Error: can't create output directory %s: %v\n", absDir, err)
+	}
+	f, err := os.CreateTemp(absDir, ".gop-install-")
+	if err != nil {
+		fatalf("Error: output directory %s isn't writable: %v\n", absDir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return absDir
+}
+
+// copyBinFile copies a binary file to targetFile. It's written to a temporary
+// file and then renamed, so a running binary can be replaced.
+func copyBinFile(sourceFile, targetFile string) error {
+	data, err := os.ReadFile(sourceFile)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(targetFile), ".gop-install-")
+	if err != nil {
+		return err
+	}
+	tmpFile := f.Name()
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(tmpFile, 0755)
+	}
+	if err == nil {
+		err = os.Rename(tmpFile, targetFile)
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+	}
+	return err
+}
+
+// copyGoplusToDir copies the built Go+ binary files into outDir.
+func copyGoplusToDir(binFiles []string, outDir string) string {
+	info("Start copying.")
+
+	gopBinPath := detectGopBinPath()
+	for _, file := range binFiles {
+		sourceFile := filepath.Join(gopBinPath, file)
+		if !checkPathExist(sourceFile, false) {
+			fatalf("Error: %s is not existed, you should build Go+ before copying.\n", sourceFile)
+		}
+		targetFile := filepath.Join(outDir, file)
+		if err := copyBinFile(sourceFile, targetFile); err != nil {
+			fatalln(err)
+		}
+		infof("Copy %s to %s successfully.\n", sourceFile, targetFile)
+	}
+
+	info("End copying.")
+	return outDir
+}
+
+// Environment variables of the credentials to notarize Go+ binary files on
+// macOS, see notaryCredentials.
+const (
+	notaryProfileEnv  = "GOP_NOTARY_PROFILE" // keychain profile saved by `xcrun notarytool store-credentials`
+	notaryAppleIDEnv  = "GOP_NOTARY_APPLE_ID"
+	notaryTeamIDEnv   = "GOP_NOTARY_TEAM_ID"
+	notaryPasswordEnv = "GOP_NOTARY_PASSWORD" // app-specific password of the Apple ID
+)
+
+// notaryCredentials returns the arguments of `xcrun notarytool submit` to
+// authenticate, from a keychain profile, or an Apple ID with its team ID and
+// password. It returns nil if no credentials are set.
+func notaryCredentials() []string {
+	if profile := os.Getenv(notaryProfileEnv); profile != "" {
+		return []string{"--keychain-profile", profile}
+	}
+	appleID, teamID, password := os.Getenv(notaryAppleIDEnv), os.Getenv(notaryTeamIDEnv), os.Getenv(notaryPasswordEnv)
+	if appleID == "" && teamID == "" && password == "" {
+		return nil
+	}
+	if appleID == "" || teamID == "" || password == "" {
+		fatalf("Error: notarizing requires all of %s, %s and %s.\n", notaryAppleIDEnv, notaryTeamIDEnv, notaryPasswordEnv)
+	}
+	return []string{"--apple-id", appleID, "--team-id", teamID, "--password", password}
+}
+
+// codesignGoplusTools signs the built Go+ binary files with identity by
+// codesign, and then notarizes them by `xcrun notarytool` if there are
+// credentials (see notaryCredentials). It's a no-op unless Go+ is built on and
+// for macOS. Any failure aborts installing, so that unsigned binary files are
+// never installed unknowingly.
+func codesignGoplusTools(identity string, targets []string) {
+	if runtime.GOOS != "darwin" {
+		info("Info: -codesign is ignored on non-Darwin platforms.")
+		return
+	}
+	if platform := targetPlatform(); platform[0] != "darwin" {
+		infof("Gop is built for %s, skip signing it.\n", strings.Join(platform, "/"))
+		return
+	}
+	info("Start signing.")
+
+	gopBinPath := detectGopBinPath()
+	var files []string
+	for _, file := range targetBinFiles(targets) {
+		binFile := filepath.Join(gopBinPath, file)
+		// hardened runtime and secure timestamp are required by notarization
+		_, stderr, err := execCommand("codesign", "--force", "--sign", identity, "--options", "runtime", "--timestamp", binFile)
+		if err != nil {
+			fatalf("Error: sign %s failed: %v\n%s", binFile, err, stderr)
+		}
+		if _, stderr, err = execCommand("codesign", "--verify", "--strict", binFile); err != nil {
+			fatalf("Error: verify signature of %s failed: %v\n%s", binFile, err, stderr)
+		}
+		infof("Sign %s successfully.\n", binFile)
+		files = append(files, binFile)
+	}
+
+	if credentials := notaryCredentials(); credentials != nil {
+		notarizeBinFiles(files, credentials)
+	} else {
+		infof("Info: no credentials to notarize Go+, set %s (or %s, %s and %s) to notarize it.\n",
+			notaryProfileEnv, notaryAppleIDEnv, notaryTeamIDEnv, notaryPasswordEnv)
+	}
+
+	info("End signing.")
+}
+
+// notarizeBinFiles submits the signed binary files to the notary service in a
+// zip archive, and waits for the result. Tickets can't be stapled to bare
+// binary files, Gatekeeper checks them online instead.
+func notarizeBinFiles(files []string, credentials []string) {
+	f, err := os.CreateTemp("", "gop-notarize-*.zip")
+	if err != nil {
+		fatalln("Error: create archive to notarize failed:", err)
+	}
+	archive := f.Name()
+	defer os.Remove(archive)
+	err = zipBinFiles(f, files)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		fatalln("Error: create archive to notarize failed:", err)
+	}
+
+	info("Notarizing, it may take a while...")
+	args := append([]string{"notarytool", "submit", archive, "--wait", "--output-format", "json"}, credentials...)
+	out, stderr, err := execCommand("xcrun", args...)
+	if err != nil {
+		fatalf("Error: notarize failed: %v\n%s%s", err, out, stderr)
+	}
+	var ret struct {
+		ID      string `json:"id"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err = json.Unmarshal([]byte(out), &ret); err != nil {
+		fatalf("Error: invalid output of notarytool: %v\n%s", err, out)
+	}
+	if ret.Status != "Accepted" {
+		fatalf("Error: notarize failed: %s %s, run `xcrun notarytool log %s` for details.\n", ret.Status, ret.Message, ret.ID)
+	}
+	infof("Notarize successfully: %s\n", ret.ID)
+}
+
+// zipBinFiles writes files into a zip archive, keeping their modes.
+func zipBinFiles(w io.Writer, files []string) error {
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return err
+		}
+		hdr.Method = zip.Deflate
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if _, err = fw.Write(data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func buildGoplusTools(useGoProxy, useVendor, verify bool, targets []string, outDir, codesignIdentity string) {
 	commandsDir := filepath.Join(gopRoot, "cmd")
-	buildFlags := getGopBuildFlags()
+	version := gopBuildVersion()
+	buildFlags := getGopBuildFlags(version)
 
 	if useGoProxy {
-		println("Info: we will use goproxy.cn as a Go proxy to accelerate installing process.")
+		info("Info: we will use goproxy.cn as a Go proxy to accelerate installing process.")
 		commandExecuteEnv = append(commandExecuteEnv,
 			"GOPROXY=https://goproxy.cn,direct",
 		)
@@ -229,60 +756,279 @@ func buildGoplusTools(useGoProxy bool) {
 	// Install Go+ binary files under current ./bin directory.
 	gopBinPath := detectGopBinPath()
 	if err := os.Mkdir(gopBinPath, 0755); err != nil && !os.IsExist(err) {
-		println("Error: Go+ can't create ./bin directory to put build assets.")
-		log.Fatalln(err)
+		fatalf("Error: Go+ can't create ./bin directory to put build assets: %v\n", err)
 	}
 
-	println("Installing Go+ tools...\n")
+	info("Installing Go+ tools...\n")
 	os.Chdir(commandsDir)
-	buildOutput, buildErr, err := execCommand("go", "build", "-o", gopBinPath, "-v", "-ldflags", buildFlags, "./...")
-	print(buildErr)
+	buildArgs := []string{"build", "-o", gopBinPath, "-v", "-ldflags", buildFlags}
+	if useVendor {
+		buildArgs = append(buildArgs, "-mod=vendor")
+	}
+	patterns := []string{"./..."}
+	if len(targets) != 0 {
+		patterns = patterns[:0]
+		for _, name := range targets {
+			patterns = append(patterns, "./"+name)
+		}
+	}
+	buildArgs = append(buildArgs, patterns...)
+	events := new(buildEvents)
+	if buildJSON {
+		commands, err := commandPackages(useVendor, patterns)
+		if err != nil {
+			events.emit(buildEvent{Action: "done", Error: err.Error()})
+			fatalln(err)
+		}
+		events.commands = commands
+	}
+	events.emit(buildEvent{Action: "start"})
+	var buildOutput, buildErr string
+	var err error
+	if w := events.goBuildOutput(); w != nil {
+		buildOutput, buildErr, err = execCommandTee(w, "go", buildArgs...)
+	} else {
+		buildOutput, buildErr, err = execCommandTimeout("go", buildArgs...)
+	}
 	if err != nil {
-		log.Fatalln(err)
+		events.emit(buildEvent{Action: "done", Error: err.Error()})
+		fmt.Fprint(os.Stderr, buildErr)
+		fatalln(err)
+	}
+	infof("%s%s", buildErr, buildOutput)
+
+	if codesignIdentity != "" {
+		codesignGoplusTools(codesignIdentity, targets)
+	}
+
+	if verify {
+		verifyGopVersion(version, targets)
 	}
-	print(buildOutput)
 
 	// Clear gop run cache
 	cleanGopRunCache()
 
-	installPath := linkGoplusToLocalBin()
+	var installPath string
+	if outDir != "" {
+		installPath = copyGoplusToDir(targetBinFiles(targets), outDir)
+	} else {
+		installPath = linkGoplusToLocalBin(targetBinFiles(targets))
+	}
 
-	println("\nGo+ tools installed successfully!")
+	info("\nGo+ tools installed successfully!")
+	events.emit(buildEvent{Action: "done"})
 
 	if _, _, err := execCommand("gop", "version"); err != nil {
 		showHelpPostInstall(installPath)
 	}
 }
 
+// verifyGopVersion checks that the version reported by `gop version` of the
+// built gop command is the version stamped into it by getGopBuildFlags. It's
+// skipped if gop isn't built, or built for another platform.
+func verifyGopVersion(version string, targets []string) {
+	binFiles := targetBinFiles(targets)
+	if len(binFiles) == 0 || binFiles[0] != gopBinFiles[0] {
+		return
+	}
+	if version == "" {
+		info("Warning: no version is stamped into Go+, skip verifying the version of gop.")
+		return
+	}
+	if platform := targetPlatform(); platform[0] != runtime.GOOS || platform[1] != runtime.GOARCH {
+		infof("Gop is built for %s, skip verifying its version.\n", strings.Join(platform, "/"))
+		return
+	}
+	gopCommand := filepath.Join(detectGopBinPath(), gopBinFiles[0])
+	out, stderr, err := execCommand(gopCommand, "version")
+	if err != nil {
+		fatalf("Error: %s version failed: %v\n%s", gopCommand, err, stderr)
+	}
+	// gop <version> <goos>/<goarch>
+	var actual string
+	if fields := strings.Fields(out); len(fields) == 3 && fields[0] == "gop" {
+		actual = fields[1]
+	}
+	if actual != version {
+		fatalf("Error: version of the built gop doesn't match, the build flags may be wrong.\n"+
+			"  expected: %s\n  actual:   %s\n  output of `%s version`: %s\n"+
+			"Use -no-verify to skip this check.\n", version, actual, gopCommand, trimRight(out))
+	}
+	infof("Verified the version of %s: %s\n", gopCommand, actual)
+}
+
+// targetPlatform returns GOOS and GOARCH that Go+ is built for.
+func targetPlatform() []string {
+	goEnv, _, err := execCommand("go", "env", "GOOS", "GOARCH")
+	if err != nil {
+		fatalln("Error: go env failed:", err)
+	}
+	platform := strings.Fields(goEnv)
+	if len(platform) != 2 {
+		fatalf("Error: invalid output of go env: %s\n", goEnv)
+	}
+	return platform
+}
+
 func showHelpPostInstall(installPath string) {
-	println("\nNEXT STEP:")
-	println("\nWe just installed Go+ into the directory: ", installPath)
+	info("\nNEXT STEP:")
+	info("\nWe just installed Go+ into the directory: ", installPath)
 	message := `
 To setup a better Go+ development environment,
 we recommend you add the above install directory into your PATH environment variable.
 	`
-	println(message)
+	info(message)
+}
+
+// parseTestPackages parses the value of -pkg flag, and checks that it's a
+// package directory of Go+, optionally followed by `/...`. It returns `./...`
+// if pattern is empty.
+func parseTestPackages(pattern string) string {
+	if pattern == "" {
+		return "./..."
+	}
+	dir := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+	if dir == "." {
+		return pattern
+	}
+	if !strings.HasPrefix(dir, "./") || strings.Contains(dir, "...") ||
+		strings.Contains(dir, `\`) || strings.Contains(dir+"/", "/../") ||
+		!checkPathExist(filepath.Join(gopRoot, dir), true) {
+		fatalf("Error: invalid package pattern `%s`, it should be a directory of Go+, e.g. ./cl/...\n", pattern)
+	}
+	return pattern
+}
+
+// Coverage report formats besides coverage.txt, see -cover-format flag. Each
+// format is written to coverage.<format> next to coverage.txt.
+var coverFormats = map[string]func(profile, out string) error{
+	"html": coverToHTML,
+	"lcov": coverToLcov,
+}
+
+// parseCoverFormats parses the value of -cover-format flag, a comma separated
+// list of coverage report formats.
+func parseCoverFormats(formats string) []string {
+	if formats == "" {
+		return nil
+	}
+	names := strings.Split(formats, ",")
+	for _, name := range names {
+		if _, ok := coverFormats[name]; !ok {
+			fatalf("Error: invalid coverage format `%s`, it should be html or lcov.\n", name)
+		}
+	}
+	return names
 }
 
-func runTestcases() {
-	println("Start running testcases.")
+func coverToHTML(profile, out string) error {
+	_, stderr, err := execCommand("go", "tool", "cover", "-html="+profile, "-o="+out)
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, stderr)
+	}
+	return nil
+}
+
+// coverToLcov converts the coverage profile in Go's text format to lcov. The
+// source files are relative to gopRoot, as Go+ packages are in module
+// github.com/goplus/gop.
+func coverToLcov(profile, out string) error {
+	data, err := os.ReadFile(profile)
+	if err != nil {
+		return err
+	}
+	// count of each line of each file
+	files := make(map[string]map[int]int)
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines[1:] { // skip `mode: xxx`
+		if line == "" {
+			continue
+		}
+		// file:startLine.startCol,endLine.endCol numStmts count
+		var startLine, startCol, endLine, endCol, numStmts, count int
+		pos := strings.LastIndex(line, ":")
+		if pos < 0 {
+			return fmt.Errorf("invalid coverage profile line: %s", line)
+		}
+		file := strings.TrimPrefix(line[:pos], "github.com/goplus/gop/")
+		_, err = fmt.Sscanf(line[pos+1:], "%d.%d,%d.%d %d %d", &startLine, &startCol, &endLine, &endCol, &numStmts, &count)
+		if err != nil {
+			return fmt.Errorf("invalid coverage profile line: %s", line)
+		}
+		counts := files[file]
+		if counts == nil {
+			counts = make(map[int]int)
+			files[file] = counts
+		}
+		for i := startLine; i <= endLine; i++ {
+			if old, ok := counts[i]; !ok || count > old {
+				counts[i] = count
+			}
+		}
+	}
+	var buf bytes.Buffer
+	names := make([]string, 0, len(files))
+	for file := range files {
+		names = append(names, file)
+	}
+	sort.Strings(names)
+	for _, file := range names {
+		counts := files[file]
+		lineNos := make([]int, 0, len(counts))
+		for lineNo := range counts {
+			lineNos = append(lineNos, lineNo)
+		}
+		sort.Ints(lineNos)
+		fmt.Fprintf(&buf, "TN:\nSF:%s\n", file)
+		hit := 0
+		for _, lineNo := range lineNos {
+			if counts[lineNo] > 0 {
+				hit++
+			}
+			fmt.Fprintf(&buf, "DA:%d,%d\n", lineNo, counts[lineNo])
+		}
+		fmt.Fprintf(&buf, "LF:%d\nLH:%d\nend_of_record\n", len(lineNos), hit)
+	}
+	return os.WriteFile(out, buf.Bytes(), 0644)
+}
+
+func runTestcases(parallel int, pkgs string, useVendor bool, formats []string) {
+	info("Start running testcases.")
 	os.Chdir(gopRoot)
 
 	coverage := "-coverprofile=coverage.txt"
 	gopCommand := filepath.Join(detectGopBinPath(), gopBinFiles[0])
 	if !checkPathExist(gopCommand, false) {
-		println("Error: Go+ must be installed before running testcases.")
-		os.Exit(1)
+		fatalln("Error: Go+ must be installed before running testcases.")
 	}
 
-	testOutput, testErr, err := execCommand(gopCommand, "test", coverage, "-covermode=atomic", "./...")
-	println(testOutput)
-	println(testErr)
+	// Use `-flag=value` form here, as `gop test` passes unknown switches to `go test`
+	// without their values.
+	testArgs := []string{"test", coverage, "-covermode=atomic"}
+	if parallel > 0 { // or the defaults of go test
+		testArgs = append(testArgs, fmt.Sprintf("-p=%d", parallel), fmt.Sprintf("-parallel=%d", parallel))
+	}
+	if useVendor {
+		testArgs = append(testArgs, "-mod=vendor")
+	}
+	testOutput, testErr, err := execCommandTimeout(gopCommand, append(testArgs, pkgs)...)
 	if err != nil {
-		println(err.Error())
+		fmt.Fprintln(os.Stderr, testOutput)
+		fmt.Fprintln(os.Stderr, testErr)
+		fmt.Fprintln(os.Stderr, err)
+	} else {
+		info(testOutput)
+		info(testErr)
+		for _, format := range formats {
+			out := "coverage." + format
+			if err = coverFormats[format]("coverage.txt", out); err != nil {
+				fatalf("Error: generate %s failed: %v\n", out, err)
+			}
+			infof("Coverage report generated: %s\n", out)
+		}
 	}
 
-	println("End running testcases.")
+	info("End running testcases.")
 }
 
 func clean() {
@@ -294,7 +1040,7 @@ func clean() {
 		targetLink := filepath.Join(goBinPath, file)
 		if checkPathExist(targetLink, false) {
 			if err := os.Remove(targetLink); err != nil {
-				log.Fatalln(err)
+				fatalln(err)
 			}
 		}
 	}
@@ -302,31 +1048,36 @@ func clean() {
 	// Clean build binary files
 	if checkPathExist(gopBinPath, true) {
 		if err := os.RemoveAll(gopBinPath); err != nil {
-			log.Fatalln(err)
+			fatalln(err)
 		}
 	}
 
 	cleanGopRunCache()
 }
 
+// gopRunCacheFiles are the files in the run cache, removed as `gop clean -all`
+// does (see gopmod.CleanRunCache): the go.mod & go.sum of the default context,
+// compiled packages cached by `gop run`, go.mod overlays, module copies,
+// fingerprints of generated Go files and contexts of lock files.
+var gopRunCacheFiles = []string{"go.mod", "go.sum", "dummy", "cache", "ovl", "mod", "gen", "lock"}
+
 func cleanGopRunCache() {
-	homeDir, _ := os.UserHomeDir()
-	runCacheDir := filepath.Join(homeDir, ".gop", "run")
-	files := []string{"go.mod", "go.sum"}
-	for _, file := range files {
-		fullPath := filepath.Join(runCacheDir, file)
-		if checkPathExist(fullPath, false) {
-			if err := os.Remove(fullPath); err != nil {
-				log.Fatalln(err)
-			}
+	runCacheDir := os.Getenv("GOPRUNCACHE")
+	if runCacheDir == "" {
+		homeDir, _ := os.UserHomeDir()
+		runCacheDir = filepath.Join(homeDir, ".gop", "run")
+	}
+	for _, file := range gopRunCacheFiles {
+		if err := os.RemoveAll(filepath.Join(runCacheDir, file)); err != nil {
+			fatalln(err)
 		}
 	}
 }
 
 func uninstall() {
-	println("Uninstalling Go+ and related tools.")
+	info("Uninstalling Go+ and related tools.")
 	clean()
-	println("Go+ and related tools uninstalled successfully.")
+	info("Go+ and related tools uninstalled successfully.")
 }
 
 func isInChina() bool {
@@ -342,6 +1093,32 @@ func isInChina() bool {
 	return false
 }
 
+// buildVersion is the version specified by -buildver, which is stamped into
+// Go+ instead of the one found by findGopVersion if it isn't empty.
+var buildVersion string
+
+var mainVersionRE = regexp.MustCompile(`MainVersion = "([^"]+)"`)
+
+// checkBuildVersion checks the version specified by -buildver. As Go+ panics
+// on a version of another main version (see env/version.go), it should be a
+// version of the main version of the source tree.
+func checkBuildVersion(version string) {
+	if !versionRE.MatchString(version) {
+		fatalf("Error: -buildver %s isn't a valid version of the form vx.y.z[-suffix]\n", version)
+	}
+	data, err := os.ReadFile(filepath.Join(gopRoot, "env", "version.go"))
+	if err != nil {
+		fatalln("Error: read main version failed:", err)
+	}
+	m := mainVersionRE.FindSubmatch(data)
+	if m == nil {
+		fatalln("Error: main version not found in env/version.go")
+	}
+	if prefix := "v" + string(m[1]) + "."; !strings.HasPrefix(version, prefix) {
+		fatalf("Error: -buildver %s should be a version of %s\n", version, prefix+"x")
+	}
+}
+
 // findGopVersion returns current version of gop
 func findGopVersion() string {
 	// Read version from VERSION file
@@ -355,52 +1132,82 @@ func findGopVersion() string {
 
 	// Read version from git repo
 	if !isGitRepo() {
-		log.Fatal("Error: must be a git repo or a VERSION file existed.")
+		fatalln("Error: must be a git repo or a VERSION file existed.")
 	}
 	version := getBuildVer() // Closet tag on git log
 	return version
 }
 
-// releaseNewVersion tags the repo with provided new tag, and writes new tag into VERSION file.
-func releaseNewVersion(tag string) {
+func branchExists(branch string) bool {
+	_, _, err := execCommand("git", "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	return err == nil
+}
+
+var (
+	versionRE       = regexp.MustCompile(`^v\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?$`)
+	releaseBranchRE = regexp.MustCompile(`^v\d+?\.\d+?`)
+)
+
+// checkReleaseTag checks if a new version can be released with tag, and
+// returns the release branch of it.
+func checkReleaseTag(tag string) (releaseBranch string) {
 	if !isGitRepo() {
-		log.Fatal("Error: Releasing a new version could only be operated under a git repo.")
+		fatalln("Error: Releasing a new version could only be operated under a git repo.")
 	}
-	println("Start releasing new version")
-
-	version := tag
+	if !versionRE.MatchString(tag) {
+		fatalln("Error: A valid version should be has form: vx.y.z")
+	}
+	releaseBranch = releaseBranchRE.FindString(tag)
+	if !branchExists(releaseBranch) {
+		fatalf("Error: release branch %s doesn't exist.\n", releaseBranch)
+	}
+	return
+}
 
-	re := regexp.MustCompile(`^v\d+?\.\d+?`)
-	releaseBranch := re.FindString(version)
+// checkNewVersion validates tag like releaseNewVersion, and prints what
+// releaseNewVersion would do, without changing the repo or VERSION file.
+func checkNewVersion(tag string) {
+	releaseBranch := checkReleaseTag(tag)
 	sourceBranch := getGitBranch()
 
-	if releaseBranch == "" {
-		log.Fatal("Error: A valid version should be has form: vx.y.z")
-	}
+	infof("Would release new version: %s\n", tag)
+	infof("  checkout to release branch: %s\n", releaseBranch)
+	infof("  write %s into %s\n", tag, versionFile)
+	infof("  tag the source code with %s\n", tag)
+	infof("  checkout back to source branch: %s\n", sourceBranch)
+}
+
+// releaseNewVersion tags the repo with provided new tag, and writes new tag into VERSION file.
+func releaseNewVersion(tag string) {
+	releaseBranch := checkReleaseTag(tag)
+	info("Start releasing new version")
+
+	version := tag
+	sourceBranch := getGitBranch()
 
 	// Checkout to release breanch
 	if stderr, err := checkoutBranch(releaseBranch); err != nil {
-		log.Fatalf("Error: checkout to release branch: %s failed with error: %v.", releaseBranch, stderr)
+		fatalf("Error: checkout to release branch: %s failed with error: %v.\n", releaseBranch, stderr)
 	}
 
-	fmt.Printf("\nReleasing new version: %s\n\n", version)
+	infof("\nReleasing new version: %s\n\n", version)
 
 	// Cache new version
 	if err := os.WriteFile(versionFile, []byte(version), 0644); err != nil {
-		log.Fatalf("Error: cache new version with error: %v\n", err)
+		fatalf("Error: cache new version with error: %v\n", err)
 	}
 
 	// Tag the source code
 	if _, stderr, err := execCommand("git", "tag", version); err != nil {
-		log.Fatalf("Error: tag the source code with error: %v\n", stderr)
+		fatalf("Error: tag the source code with error: %v\n", stderr)
 	}
 
 	// Checkout back to source branch
 	if stderr, err := checkoutBranch(sourceBranch); err != nil {
-		log.Fatalf("Error: checkout to source branch: %s failed with error: %v.", sourceBranch, stderr)
+		fatalf("Error: checkout to source branch: %s failed with error: %v.\n", sourceBranch, stderr)
 	}
 
-	println("End releasing new version:", tag)
+	info("End releasing new version:", tag)
 }
 
 func main() {
@@ -409,18 +1216,67 @@ func main() {
 	isUninstall := flag.Bool("uninstall", false, "Uninstall Go+")
 	isGoProxy := flag.Bool("proxy", false, "Set GOPROXY for people in China")
 	isAutoProxy := flag.Bool("autoproxy", false, "Check to set GOPROXY automatically")
+	isVendor := flag.Bool("vendor", false, "Build and test offline with -mod=vendor, GOPROXY is never set")
 	tag := flag.String("tag", "", "Release an new version with specified tag")
+	isDryRun := flag.Bool("dry-run", false, "Check the tag to release and print what to do, without releasing it")
+	targets := flag.String("targets", "", "Build specified commands only, e.g. gop,gopfmt")
+	parallel := flag.Int("parallel", 0, "Number of testcases to run in parallel, 0 means the defaults of go test")
+	isQuiet := flag.Bool("q", false, "Print errors only")
+	isVerbose := flag.Bool("v", false, "Print commands executed besides the messages printed normally")
+	pkg := flag.String("pkg", "", "Run testcases of specified packages only, e.g. ./cl/...")
+	coverFormat := flag.String("cover-format", "", "Also convert coverage.txt into specified formats after testcases pass, e.g. html,lcov")
+	output := flag.String("o", "", "Copy Go+ binary files into specified directory when installing, instead of linking them into GOBIN")
+	noVerify := flag.Bool("no-verify", false, "Don't verify the version stamped into the built gop command when installing")
+	codesign := flag.String("codesign", "", "Sign Go+ binary files with specified identity when installing on macOS, and notarize them if credentials are set by GOP_NOTARY_* environment variables")
+	flag.DurationVar(&commandTimeout, "timeout", commandTimeout, "Kill the build and test commands if they run longer than specified duration, e.g. 30m, 0 means no timeout")
+	flag.BoolVar(&buildJSON, "json", false, "Print the progress of installing to stdout as build events in JSON, one per line, for IDEs to show it, and other messages to stderr")
+	flag.StringVar(&buildVersion, "buildver", "", "Stamp specified version into Go+ when installing, instead of the one in VERSION file or git tags")
 
 	flag.Parse()
 
+	switch {
+	case *isQuiet && *isVerbose:
+		fatalln("Error: -q and -v can't be specified at the same time.")
+	case *isQuiet:
+		verbosity = levelQuiet
+	case *isVerbose:
+		verbosity = levelVerbose
+	}
+	if buildJSON {
+		infoOutput = os.Stderr
+	}
+
+	if buildVersion != "" {
+		checkBuildVersion(buildVersion)
+	}
+
+	if commandTimeout < 0 {
+		fatalf("Error: -timeout should not be negative, but got %v.\n", commandTimeout)
+	}
+
+	if *parallel < 0 {
+		fatalf("Error: -parallel should not be negative, but got %d.\n", *parallel)
+	}
+
+	useVendor := *isVendor
 	useGoProxy := *isGoProxy
-	if !useGoProxy && *isAutoProxy {
+	if useVendor {
+		checkVendor()
+		useGoProxy = false
+	} else if !useGoProxy && *isAutoProxy {
 		useGoProxy = isInChina()
 	}
+	buildTargets := parseBuildTargets(*targets)
+	testPkgs := parseTestPackages(*pkg)
+	testCoverFormats := parseCoverFormats(*coverFormat)
+	var outDir string
+	if *output != "" && *isInstall {
+		outDir = checkOutputDir(*output)
+	}
 	flagActionMap := map[*bool]func(){
-		isInstall:   func() { buildGoplusTools(useGoProxy) },
+		isInstall:   func() { buildGoplusTools(useGoProxy, useVendor, !*noVerify, buildTargets, outDir, *codesign) },
 		isUninstall: uninstall,
-		isTest:      runTestcases,
+		isTest:      func() { runTestcases(*parallel, testPkgs, useVendor, testCoverFormats) },
 	}
 
 	// Sort flags, for example: install flag should be checked earlier than test flag.
@@ -428,7 +1284,11 @@ func main() {
 	hasActionDone := false
 
 	if *tag != "" {
-		releaseNewVersion(*tag)
+		if *isDryRun {
+			checkNewVersion(*tag)
+		} else {
+			releaseNewVersion(*tag)
+		}
 		hasActionDone = true
 	}
 
@@ -440,7 +1300,7 @@ func main() {
 	}
 
 	if !hasActionDone {
-		println("Usage:\n")
+		fmt.Fprint(os.Stderr, "Usage:\n\n")
 		flag.PrintDefaults()
 	}
 }
@@ -4,6 +4,7 @@
 package make_test
 
 import (
+	"encoding/json"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -89,6 +90,41 @@ func cleanGopRunCacheFiles(t *testing.T) {
 	}
 }
 
+// fakeGopCommand installs a fake gop command into ./bin, which prints its
+// arguments and writes a coverage profile of one block, so testcases can be
+// "run" without building Go+. The original one, if any, is restored after the
+// test, and the coverage reports are removed.
+func fakeGopCommand(t *testing.T) {
+	if inWindows {
+		t.Skip("the fake gop command is a shell script")
+	}
+	gopCommand := filepath.Join(gopRoot, "bin", gopBinFiles[0])
+	backup := gopCommand + ".orig"
+	if err := os.Rename(gopCommand, backup); err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var reports []string
+	for _, ext := range []string{"txt", "html", "lcov"} {
+		if report := filepath.Join(gopRoot, "coverage."+ext); !checkPathExist(report, false) {
+			reports = append(reports, report)
+		}
+	}
+	t.Cleanup(func() {
+		os.Remove(gopCommand)
+		os.Rename(backup, gopCommand)
+		os.Remove(filepath.Dir(gopCommand)) // if it's created for the fake one
+		for _, report := range reports {
+			os.Remove(report)
+		}
+	})
+	os.MkdirAll(filepath.Dir(gopCommand), 0755)
+	script := "#!/bin/sh\necho gop \"$@\"\n" +
+		"printf 'mode: atomic\\ngithub.com/goplus/gop/scanner/errors.go:60.2,62.3 2 1\\n' > coverage.txt\n"
+	if err := os.WriteFile(gopCommand, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestAllScript(t *testing.T) {
 	os.Chdir(gopRoot)
 	cmd := exec.Command(filepath.Join(gopRoot, script))
@@ -289,6 +325,20 @@ func TestInstallInNonGitRepo(t *testing.T) {
 		}
 	})
 
+	t.Run("install with -buildver", func(t *testing.T) {
+		version := "v1.0.99-fork"
+		cmd := exec.Command("go", "run", installer, "--install", "--buildver", version)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Failed: %v, output: %s\n", err, output)
+		}
+
+		cmd = exec.Command(filepath.Join(gopRoot, "bin", gopBinFiles[0]), "version")
+		output, err := cmd.CombinedOutput()
+		if err != nil || !strings.Contains(string(output), version) {
+			t.Fatalf("Failed: %v, output: %s\n", err, output)
+		}
+	})
+
 	t.Run("install with VERSION file", func(t *testing.T) {
 		version := "v1.0.98"
 		// Create VERSION file
@@ -357,3 +407,265 @@ func TestHandleMultiFlags(t *testing.T) {
 		t.Fatalf("Failed: content of VERSION file: '%s' not match tag: %s", data, nextVersion)
 	}
 }
+
+func TestCodesignOnNonDarwin(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("signing requires an identity in the keychain on macOS")
+	}
+	os.Chdir(gopRoot)
+
+	outDir := t.TempDir()
+	cmd := exec.Command("go", "run", installer, "--install", "--no-verify", "--codesign", "Developer ID Application: Nobody", "-o", outDir)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed: %v, output: %s\n", err, output)
+	}
+	if !strings.Contains(string(output), "-codesign is ignored") {
+		t.Fatalf("Failed: -codesign should be ignored on %s, output: %s\n", runtime.GOOS, output)
+	}
+	for _, file := range gopBinFiles {
+		if !checkPathExist(filepath.Join(outDir, file), false) {
+			t.Fatalf("Failed: %s isn't installed into %s\n", file, outDir)
+		}
+	}
+}
+
+func TestInstallJSON(t *testing.T) {
+	os.Chdir(gopRoot)
+
+	cmd := exec.Command("go", "run", installer, "--install", "--no-verify", "--json", "--targets", "gop", "-o", t.TempDir())
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Failed: %v, output: %s%s\n", err, output, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "Go+ tools installed successfully") {
+		t.Fatalf("Failed: messages should be printed to stderr in -json mode: %s\n", stderr.String())
+	}
+	var actions []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		var ev struct {
+			Action, Package, Error string
+		}
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("Failed: invalid build event %q: %v\n", line, err)
+		}
+		if ev.Package == "github.com/goplus/gop/cmd/gop" || ev.Package == "" {
+			actions = append(actions, ev.Action+ev.Error)
+		}
+	}
+	if strings.Join(actions, " ") != "start package link done" {
+		t.Fatalf("Failed: build events of installing gop: %v, output: %s\n", actions, output)
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	os.Chdir(gopRoot)
+
+	cmd := exec.Command("go", "run", installer, "--install", "--no-verify", "--timeout", "1ms", "-o", t.TempDir())
+	output, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "go timed out after 1ms") {
+		t.Fatalf("Failed: go build should be killed for timeout, err: %v, output: %s\n", err, output)
+	}
+}
+
+func TestTestParallel(t *testing.T) {
+	fakeGopCommand(t)
+	os.Chdir(gopRoot)
+
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "gop test -coverprofile=coverage.txt -covermode=atomic ./...\n"},
+		{[]string{"--parallel", "1"}, "gop test -coverprofile=coverage.txt -covermode=atomic -p=1 -parallel=1 ./...\n"},
+		{[]string{"--parallel=4"}, "gop test -coverprofile=coverage.txt -covermode=atomic -p=4 -parallel=4 ./...\n"},
+	}
+	for _, c := range cases {
+		cmd := exec.Command("go", append([]string{"run", installer, "--test"}, c.args...)...)
+		output, err := cmd.CombinedOutput()
+		if err != nil || !strings.Contains(string(output), c.expected) {
+			t.Fatalf("Failed: %v %v, output: %s\n", c.args, err, output)
+		}
+	}
+
+	cmd := exec.Command("go", "run", installer, "--test", "--parallel", "-1")
+	output, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "-parallel should not be negative") {
+		t.Fatalf("Failed: -parallel -1 should be rejected, err: %v, output: %s\n", err, output)
+	}
+}
+
+func TestFlagErrors(t *testing.T) {
+	os.Chdir(gopRoot)
+
+	notDir := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(notDir, nil, 0644)
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--install", "--targets", "foo"}, "invalid target `foo`"},
+		{[]string{"--install", "--targets", "gop,internal"}, "invalid target `internal`"},
+		{[]string{"--install", "--targets", "gop,,gopfmt"}, "invalid target ``"},
+		{[]string{"--test", "--pkg", "../x"}, "invalid package pattern `../x`"},
+		{[]string{"--test", "--pkg", "./no-such-dir/..."}, "invalid package pattern `./no-such-dir/...`"},
+		{[]string{"--install", "-o", notDir}, "can't create output directory"},
+		{[]string{"--test", "-q", "-v"}, "-q and -v can't be specified at the same time"},
+		{[]string{"--install", "--buildver", "1.0.1"}, "isn't a valid version"},
+		{[]string{"--install", "--buildver", "v9.0.1"}, "should be a version of v1.0.x"},
+		{[]string{"--test", "--cover-format", "html,xml"}, "invalid coverage format `xml`"},
+		{[]string{"--install", "--timeout", "-1s"}, "-timeout should not be negative"},
+	}
+	if !checkPathExist(filepath.Join(gopRoot, "vendor"), true) {
+		cases = append(cases, struct {
+			args     []string
+			expected string
+		}{[]string{"--install", "--vendor"}, "-vendor requires the vendor directory"})
+	}
+	for _, c := range cases {
+		cmd := exec.Command("go", append([]string{"run", installer}, c.args...)...)
+		output, err := cmd.CombinedOutput()
+		if err == nil || !strings.Contains(string(output), c.expected) {
+			t.Fatalf("Failed: %v should be rejected with %q, err: %v, output: %s\n", c.args, c.expected, err, output)
+		}
+	}
+}
+
+func TestTestFlags(t *testing.T) {
+	fakeGopCommand(t)
+	os.Chdir(gopRoot)
+	gopCommand := filepath.Join(gopRoot, "bin", gopBinFiles[0])
+
+	run := func(args ...string) string {
+		cmd := exec.Command("go", append([]string{"run", installer, "--test"}, args...)...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Failed: %v, err: %v, output: %s\n", args, err, output)
+		}
+		return string(output)
+	}
+
+	t.Run("test a package subtree", func(t *testing.T) {
+		if output := run("--pkg", "./scanner/..."); !strings.Contains(output, "gop test -coverprofile=coverage.txt -covermode=atomic ./scanner/...\n") {
+			t.Fatalf("Failed: output: %s\n", output)
+		}
+	})
+
+	t.Run("print commands in verbose mode", func(t *testing.T) {
+		if output := run("-v"); !strings.Contains(output, "+ "+gopCommand+" test ") {
+			t.Fatalf("Failed: output: %s\n", output)
+		}
+	})
+
+	t.Run("print errors only in quiet mode", func(t *testing.T) {
+		if output := run("-q"); output != "" {
+			t.Fatalf("Failed: output: %s\n", output)
+		}
+	})
+
+	t.Run("test with -mod=vendor", func(t *testing.T) {
+		vendorDir := filepath.Join(gopRoot, "vendor")
+		if !checkPathExist(vendorDir, true) {
+			os.Mkdir(vendorDir, 0755)
+			defer os.Remove(vendorDir)
+		}
+		if output := run("--vendor"); !strings.Contains(output, " -mod=vendor ./...\n") {
+			t.Fatalf("Failed: output: %s\n", output)
+		}
+	})
+
+	t.Run("convert coverage reports", func(t *testing.T) {
+		output := run("--cover-format", "lcov")
+		if !strings.Contains(output, "Coverage report generated: coverage.lcov") {
+			t.Fatalf("Failed: output: %s\n", output)
+		}
+		data, _ := os.ReadFile(filepath.Join(gopRoot, "coverage.lcov"))
+		if string(data) != "TN:\nSF:scanner/errors.go\nDA:60,1\nDA:61,1\nDA:62,1\nLF:3\nLH:3\nend_of_record\n" {
+			t.Fatalf("Failed: coverage.lcov: %s\n", data)
+		}
+	})
+}
+
+func TestReleaseDryRun(t *testing.T) {
+	os.Chdir(gopRoot)
+
+	tag := "v1.0.90"
+	releaseBranch := "v1.0"
+	sourceBranch := getBranch()
+	if gitCmd := exec.Command("git", "branch", releaseBranch); gitCmd.Run() == nil {
+		t.Cleanup(func() {
+			exec.Command("git", "branch", "-D", releaseBranch).Run()
+		})
+	}
+
+	cmd := exec.Command("go", "run", installer, "--tag", tag, "--dry-run")
+	output, err := cmd.CombinedOutput()
+	if err != nil || !strings.Contains(string(output), "Would release new version: "+tag) {
+		t.Fatalf("Failed: %v, output: %s\n", err, output)
+	}
+	if checkPathExist(versionFile, false) {
+		os.Remove(versionFile)
+		t.Fatal("Failed: VERSION file is written in dry-run mode.")
+	}
+	if out, _ := exec.Command("git", "tag", "-l", tag).Output(); trimRight(string(out)) != "" {
+		exec.Command("git", "tag", "-d", tag).Run()
+		t.Fatal("Failed: the repo is tagged in dry-run mode.")
+	}
+	if branch := getBranch(); branch != sourceBranch {
+		t.Fatalf("Failed: checked out to %s in dry-run mode.\n", branch)
+	}
+}
+
+func TestInstallTargets(t *testing.T) {
+	os.Chdir(gopRoot)
+
+	t.Run("install specified targets into a directory", func(t *testing.T) {
+		outDir := t.TempDir()
+		cmd := exec.Command("go", "run", installer, "--install", "--targets", "gopfmt", "-o", outDir)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Failed: %v, output: %s\n", err, output)
+		}
+		if strings.Contains(string(output), "Verified the version") { // gop isn't built
+			t.Fatalf("Failed: version of gop is verified, output: %s\n", output)
+		}
+		files, _ := os.ReadDir(outDir)
+		if len(files) != 1 || files[0].Name() != gopBinFiles[1] || !files[0].Type().IsRegular() {
+			t.Fatalf("Failed: files installed: %v\n", files)
+		}
+	})
+
+	t.Run("verify the version stamped", func(t *testing.T) {
+		version := "v1.0.97-test"
+		outDir := t.TempDir()
+		cmd := exec.Command("go", "run", installer, "--install", "--targets", "gop", "--buildver", version, "-o", outDir)
+		output, err := cmd.CombinedOutput()
+		if err != nil || !strings.Contains(string(output), "Verified the version of ") || !strings.Contains(string(output), ": "+version+"\n") {
+			t.Fatalf("Failed: %v, output: %s\n", err, output)
+		}
+
+		cmd = exec.Command("go", "run", installer, "--install", "--no-verify", "--targets", "gop", "-o", outDir)
+		if output, err = cmd.CombinedOutput(); err != nil || strings.Contains(string(output), "Verified the version") {
+			t.Fatalf("Failed: -no-verify, %v, output: %s\n", err, output)
+		}
+	})
+
+	t.Run("replace stale files in GOBIN", func(t *testing.T) {
+		goBin := t.TempDir()
+		stale := filepath.Join(goBin, gopBinFiles[0])
+		if err := os.WriteFile(stale, []byte("stale"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command("go", "run", installer, "--install", "--no-verify", "--targets", "gop")
+		cmd.Env = append(os.Environ(), "GOBIN="+goBin)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Failed: %v, output: %s\n", err, output)
+		}
+		built, _ := os.ReadFile(filepath.Join(gopRoot, "bin", gopBinFiles[0]))
+		if data, err := os.ReadFile(stale); err != nil || len(data) == 0 || string(data) != string(built) {
+			t.Fatalf("Failed: %s isn't replaced, err: %v\n", stale, err)
+		}
+	})
+}
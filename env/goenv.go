@@ -61,6 +61,16 @@ func GOMODCACHE() string {
 	return val
 }
 
+// GOBIN returns the directory where `go install` installs commands: $GOBIN,
+// or the bin directory of the first $GOPATH entry if $GOBIN isn't set.
+func GOBIN() string {
+	val := os.Getenv("GOBIN")
+	if val == "" {
+		return gopathJoin("bin")
+	}
+	return val
+}
+
 func gopathJoin(rel string) string {
 	list := filepath.SplitList(GOPATH())
 	if len(list) == 0 || list[0] == "" {
@@ -97,3 +97,17 @@ func TestGOMODCACHE(t *testing.T) {
 	}
 	*/
 }
+
+func TestGOBIN(t *testing.T) {
+	gobin := os.Getenv("GOBIN")
+	defer os.Setenv("GOBIN", gobin)
+	os.Setenv("GOBIN", "")
+	if v := GOBIN(); v != filepath.Join(GOPATH(), "bin") {
+		t.Fatal("TestGOBIN failed:", v)
+	}
+	const ugobin = "/abc/bin"
+	os.Setenv("GOBIN", ugobin)
+	if v := GOBIN(); v != ugobin {
+		t.Fatal("TestGOBIN (ugobin) failed:", v)
+	}
+}
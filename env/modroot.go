@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// -----------------------------------------------------------------------------
+
+var (
+	ErrNoModRoot = errors.New("gop.mod or go.mod file not found in the directory or any parent directory")
+)
+
+// modFiles are files marking the root directory of a module.
+var modFiles = []string{"gop.mod", "go.mod"}
+
+// FindModRoot returns the root directory of the module which dir belongs to,
+// that is, the nearest directory containing gop.mod or go.mod, walking up
+// from dir to the root of the filesystem. dir can be a file path, whose
+// directory is used.
+//
+// As the go command does, parents of dir are the ones in its path, even if
+// dir is in a symlinked directory. If no module is found in them, the path
+// with symlinks resolved is walked up too. An error wrapping ErrNoModRoot is
+// returned if there is still no module found.
+func FindModRoot(dir string) (root string, err error) {
+	if dir == "" {
+		dir = "."
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return
+	}
+	if fi, e := os.Stat(dir); e == nil && !fi.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	if root = findModRoot(dir); root != "" {
+		return
+	}
+	if real, e := filepath.EvalSymlinks(dir); e == nil && real != dir {
+		if root = findModRoot(real); root != "" {
+			return
+		}
+	}
+	return "", fmt.Errorf("%s: %w", dir, ErrNoModRoot)
+}
+
+func findModRoot(dir string) string {
+	for {
+		for _, file := range modFiles {
+			if fi, err := os.Stat(filepath.Join(dir, file)); err == nil && !fi.IsDir() {
+				return dir
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir { // root of the filesystem
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// -----------------------------------------------------------------------------
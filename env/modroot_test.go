@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindModRoot(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod := filepath.Join(dir, "mod")
+	sub := filepath.Join(mod, "a", "b")
+	os.MkdirAll(sub, 0755)
+	os.MkdirAll(filepath.Join(dir, "nomod"), 0755)
+	os.WriteFile(filepath.Join(mod, "go.mod"), []byte("module example.com/foo\n"), 0644)
+	os.WriteFile(filepath.Join(sub, "foo.gop"), []byte(`println "Hi"`), 0644)
+	for _, path := range []string{mod, sub, filepath.Join(sub, "foo.gop")} {
+		if root, err := FindModRoot(path); err != nil || root != mod {
+			t.Fatal("FindModRoot:", path, root, err)
+		}
+	}
+	if _, err = FindModRoot(filepath.Join(dir, "nomod")); !errors.Is(err, ErrNoModRoot) {
+		t.Fatal("FindModRoot:", err)
+	}
+	link := filepath.Join(dir, "nomod", "link")
+	if err = os.Symlink(sub, link); err != nil {
+		t.Skip("symlink:", err)
+	}
+	if root, err := FindModRoot(link); err != nil || root != mod {
+		t.Fatal("FindModRoot:", link, root, err)
+	}
+}
@@ -20,14 +20,34 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"syscall"
 )
 
 var (
 	// This is set by the linker.
 	defaultGopRoot string
+
+	// sourceGopRoot is the Go+ source tree this package is compiled from, so
+	// that tests of Go+ packages run without an installation. It's not a valid
+	// Go+ root in a binary built with -trimpath or on another machine.
+	sourceGopRoot = func() string {
+		if _, file, _, ok := runtime.Caller(0); ok {
+			return filepath.Dir(filepath.Dir(file))
+		}
+		return ""
+	}()
 )
 
+// GOPROOT returns the root of the Go+ installation. It's resolved at runtime,
+// in order of:
+//   - the GOPROOT environment variable, which panics if it isn't valid;
+//   - the parent directory of the executable (eg. $GOPROOT/bin/gop);
+//   - defaultGopRoot, set by the linker when building;
+//   - the source tree of Go+ the program is compiled from, eg. for tests;
+//   - $HOME/gop or $HOME/goplus, for compatibility.
+//
+// So a relocated Go+ installation can be used by setting GOPROOT.
 func GOPROOT() string {
 	gopRoot, err := findGopRoot()
 	if err != nil {
@@ -65,6 +85,11 @@ func findGopRoot() (string, error) {
 		return defaultGopRoot, nil
 	}
 
+	// check the source tree, if it is valid (see sourceGopRoot), use it
+	if sourceGopRoot != "" && isValidGopRoot(sourceGopRoot) {
+		return sourceGopRoot, nil
+	}
+
 	// Compatible with old GOPROOT
 	if home := HOME(); home != "" {
 		gopRoot := filepath.Join(home, "gop")
@@ -67,6 +67,7 @@ func cleanup() {
 	os.Setenv("GOPROOT", "")
 	os.Setenv(envHOME, "")
 	defaultGopRoot = ""
+	sourceGopRoot = ""
 }
 
 func TestBasic(t *testing.T) {
@@ -77,6 +78,36 @@ func TestBasic(t *testing.T) {
 	defaultGopRoot = ""
 }
 
+func TestGOPROOTEnv(t *testing.T) {
+	origExecutable := executable
+	t.Cleanup(func() {
+		cleanup()
+		executable = origExecutable
+	})
+	cleanup()
+	executable = func() (string, error) {
+		return "", os.ErrNotExist
+	}
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	buildRoot := filepath.Join(root, "build_goproot")
+	movedRoot := filepath.Join(root, "moved_goproot")
+	makeValidGopRoot(buildRoot)
+	makeValidGopRoot(movedRoot)
+
+	defaultGopRoot = buildRoot
+	if v := GOPROOT(); v != buildRoot {
+		t.Fatal("GOPROOT should fall back to defaultGopRoot, got:", v)
+	}
+	os.Setenv("GOPROOT", movedRoot)
+	if v := GOPROOT(); v != movedRoot {
+		t.Fatal("GOPROOT should be overridden by $GOPROOT, got:", v)
+	}
+	os.Setenv("GOPROOT", "")
+	if v := GOPROOT(); v != buildRoot {
+		t.Fatal("GOPROOT should fall back to defaultGopRoot after unsetting $GOPROOT, got:", v)
+	}
+}
+
 func TestFindGoModFileInGoModDir(t *testing.T) {
 	cleanup()
 
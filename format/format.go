@@ -48,6 +48,10 @@ const parserMode = parser.ParseComments
 // nodes representing partial source files (for instance, if the node is
 // not an *ast.File or a *printer.CommentedNode not wrapping an *ast.File).
 //
+// Go+ specific nodes are supported too, eg. *ast.ForPhrase. The entrypoint
+// func which the parser synthesizes for a file without one (see
+// ast.File.NoEntrypoint, eg. a class file) is formatted as its statements.
+//
 // The function may return early (before the entire result is written)
 // and return a formatting error, for instance due to an incorrect AST.
 //
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package parser
+
+import (
+	"bytes"
+	"go/build"
+	"go/build/constraint"
+)
+
+// -----------------------------------------------------------------------------
+
+var (
+	gopBuildPrefix = []byte("//gop:build")
+	goBuildPrefix  = []byte("//go:build")
+)
+
+// buildConstraint returns the build constraint line of src if any. It must be
+// in the leading run of blank lines and line comments of the file, that is,
+// before the package clause, and after the shebang line (eg. #!/usr/bin/env
+// goprun) if any. A //gop:build line takes precedence over a //go:build line.
+func buildConstraint(src []byte) (line []byte) {
+	if bytes.HasPrefix(src, []byte("#!")) {
+		if i := bytes.IndexByte(src, '\n'); i >= 0 {
+			src = src[i+1:]
+		} else {
+			src = nil
+		}
+	}
+	for len(src) > 0 {
+		cur := src
+		if i := bytes.IndexByte(src, '\n'); i >= 0 {
+			cur, src = src[:i], src[i+1:]
+		} else {
+			src = nil
+		}
+		cur = bytes.TrimSpace(cur)
+		if len(cur) == 0 {
+			continue
+		}
+		if !bytes.HasPrefix(cur, []byte("//")) {
+			break
+		}
+		if isBuildLine(cur, gopBuildPrefix) {
+			return cur
+		}
+		if line == nil && isBuildLine(cur, goBuildPrefix) {
+			line = cur
+		}
+	}
+	return
+}
+
+func isBuildLine(line, prefix []byte) bool {
+	if !bytes.HasPrefix(line, prefix) {
+		return false
+	}
+	rest := line[len(prefix):]
+	return len(rest) == 0 || rest[0] == ' ' || rest[0] == '\t'
+}
+
+// matchBuildConstraint reports whether the build constraint of src (see
+// buildConstraint) is satisfied by the GOOS, GOARCH and build tags of ctxt.
+// A file without a build constraint always matches.
+func matchBuildConstraint(ctxt *build.Context, src []byte) (bool, error) {
+	line := buildConstraint(src)
+	if line == nil {
+		return true, nil
+	}
+	if bytes.HasPrefix(line, gopBuildPrefix) {
+		line = append(append([]byte(nil), goBuildPrefix...), line[len(gopBuildPrefix):]...)
+	}
+	expr, err := constraint.Parse(string(line))
+	if err != nil {
+		return false, err
+	}
+	return expr.Eval(func(name string) bool {
+		return matchTag(ctxt, name)
+	}), nil
+}
+
+// matchTag reports whether the build tag name is satisfied by ctxt, as
+// go/build does.
+func matchTag(ctxt *build.Context, name string) bool {
+	if ctxt.CgoEnabled && name == "cgo" {
+		return true
+	}
+	if name == ctxt.GOOS || name == ctxt.GOARCH || name == ctxt.Compiler {
+		return true
+	}
+	if ctxt.GOOS == "android" && name == "linux" {
+		return true
+	}
+	if ctxt.GOOS == "illumos" && name == "solaris" {
+		return true
+	}
+	if ctxt.GOOS == "ios" && name == "darwin" {
+		return true
+	}
+	for _, tag := range ctxt.BuildTags {
+		if tag == name {
+			return true
+		}
+	}
+	for _, tag := range ctxt.ReleaseTags {
+		if tag == name {
+			return true
+		}
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
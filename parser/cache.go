@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package parser
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// Cache caches the ASTs of parsed files, so that a file whose content doesn't
+// change isn't parsed again, eg. when a language server reparses open files
+// on every edit. An AST is cached by the file name and parse mode, and reused
+// if both the SHA-256 hash of the content and the FileSet are the same (as
+// positions in an AST are only valid in the FileSet it's parsed with).
+//
+// It holds at most a fixed number of ASTs, evicting the least recently used
+// ones. A Cache is safe for concurrent use. The ASTs it returns are shared, so
+// they must not be modified.
+type Cache struct {
+	mutex   sync.Mutex
+	max     int
+	entries map[cacheKey]*list.Element // values of the elements are *cacheEntry
+	lru     list.List                  // the most recently used ones are at front
+}
+
+type cacheKey struct {
+	filename string
+	mode     Mode
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	hash [sha256.Size]byte
+	fset *token.FileSet
+	f    *ast.File
+	err  error
+}
+
+// NewCache returns a Cache holding at most maxEntries ASTs. It's unbounded if
+// maxEntries <= 0.
+func NewCache(maxEntries int) *Cache {
+	return &Cache{max: maxEntries, entries: make(map[cacheKey]*list.Element)}
+}
+
+// ParseFile is like ParseFile, but returns the cached AST (and errors) if the
+// file was parsed with the same content, mode and fset before.
+func (p *Cache) ParseFile(fset *token.FileSet, filename string, src interface{}, mode Mode) (f *ast.File, err error) {
+	return p.ParseFSFile(fset, local, filename, src, mode)
+}
+
+// ParseFSFile is like ParseFSFile, but returns the cached AST (and errors) if
+// the file was parsed with the same content, mode and fset before.
+func (p *Cache) ParseFSFile(fset *token.FileSet, fs FileSystem, filename string, src interface{}, mode Mode) (f *ast.File, err error) {
+	var code []byte
+	if src == nil {
+		code, err = fs.ReadFile(filename)
+	} else {
+		code, err = readSource(src)
+	}
+	if err != nil {
+		return
+	}
+	key, hash := cacheKey{filename, mode}, sha256.Sum256(code)
+	p.mutex.Lock()
+	if elem, ok := p.entries[key]; ok {
+		if e := elem.Value.(*cacheEntry); e.hash == hash && e.fset == fset {
+			p.lru.MoveToFront(elem)
+			p.mutex.Unlock()
+			return e.f, e.err
+		}
+	}
+	p.mutex.Unlock()
+
+	f, err = ParseFSFile(fset, fs, filename, code, mode)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	e := &cacheEntry{key: key, hash: hash, fset: fset, f: f, err: err}
+	if elem, ok := p.entries[key]; ok {
+		elem.Value = e
+		p.lru.MoveToFront(elem)
+		return
+	}
+	p.entries[key] = p.lru.PushFront(e)
+	if p.max > 0 && p.lru.Len() > p.max {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		delete(p.entries, oldest.Value.(*cacheEntry).key)
+	}
+	return
+}
+
+// Len returns the number of ASTs in the cache.
+func (p *Cache) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.lru.Len()
+}
+
+// Remove removes the ASTs of filename from the cache, eg. when it's closed.
+func (p *Cache) Remove(filename string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for key, elem := range p.entries {
+		if key.filename == filename {
+			p.lru.Remove(elem)
+			delete(p.entries, key)
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package parser
+
+import (
+	"testing"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/parser/parsertest"
+	"github.com/goplus/gop/token"
+)
+
+func TestCache(t *testing.T) {
+	fset := token.NewFileSet()
+	c := NewCache(2)
+	f1, err := c.ParseFile(fset, "/foo/a.gop", `println "Hi"`, 0)
+	if err != nil {
+		t.Fatal("ParseFile:", err)
+	}
+	if f, err := c.ParseFile(fset, "/foo/a.gop", []byte(`println "Hi"`), 0); err != nil || f != f1 {
+		t.Fatal("ParseFile: not cached -", f, err)
+	}
+	if f, _ := c.ParseFile(fset, "/foo/a.gop", `println "Hi"`, ParseComments); f == f1 {
+		t.Fatal("ParseFile: cached with another mode")
+	}
+	if f, _ := c.ParseFile(token.NewFileSet(), "/foo/a.gop", `println "Hi"`, 0); f == f1 {
+		t.Fatal("ParseFile: cached with another FileSet")
+	}
+	f2, _ := c.ParseFile(fset, "/foo/a.gop", `println "Hello"`, 0)
+	if f2 == f1 || c.Len() != 2 {
+		t.Fatal("ParseFile: cached with changed content -", c.Len())
+	}
+	if f, _ := c.ParseFile(fset, "/foo/a.gop", `println "Hello"`, 0); f != f2 {
+		t.Fatal("ParseFile: changed content not cached")
+	}
+
+	// errors are cached with the ASTs
+	const bad = "x :=\n"
+	fb1, err1 := c.ParseFile(fset, "/foo/b.gop", bad, ErrorTolerant)
+	fb2, err2 := c.ParseFile(fset, "/foo/b.gop", bad, ErrorTolerant)
+	if err1 == nil || fb1 != fb2 || err1.Error() != err2.Error() {
+		t.Fatal("ParseFile: error not cached -", err1, err2)
+	}
+
+	// (a.gop, ParseComments) is the least recently used, and is evicted
+	if c.Len() != 2 {
+		t.Fatal("Len:", c.Len())
+	}
+	if f, _ := c.ParseFile(fset, "/foo/a.gop", `println "Hello"`, 0); f != f2 {
+		t.Fatal("ParseFile: evicted the recently used")
+	}
+	c.Remove("/foo/a.gop")
+	if f, _ := c.ParseFile(fset, "/foo/a.gop", `println "Hello"`, 0); f == f2 || c.Len() != 2 {
+		t.Fatal("Remove:", c.Len())
+	}
+
+	fs := parsertest.NewSingleFileFS("/foo", "c.spx", `println "Hi"`)
+	fc, err := c.ParseFSFile(fset, fs, "/foo/c.spx", nil, 0)
+	if err != nil || fc.FileType != ast.FileTypeSpx {
+		t.Fatal("ParseFSFile:", fc, err)
+	}
+	if f, _ := c.ParseFSFile(fset, fs, "/foo/c.spx", nil, 0); f != fc {
+		t.Fatal("ParseFSFile: not cached")
+	}
+	fs.WriteFile("/foo/c.spx", `println "Hello"`)
+	if f, _ := c.ParseFSFile(fset, fs, "/foo/c.spx", nil, 0); f == fc {
+		t.Fatal("ParseFSFile: cached with changed content")
+	}
+	if _, err := c.ParseFSFile(fset, fs, "/foo/d.spx", nil, 0); err == nil {
+		t.Fatal("ParseFSFile: no error for a missing file")
+	}
+}
@@ -0,0 +1,77 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goplus/gop/scanner"
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// FuzzParseFile checks that ParseFile never panics, and returns an AST, with
+// an ErrorList if the source has errors. Run it by:
+//
+//	go test -run=NONE -fuzz=FuzzParseFile ./parser
+func FuzzParseFile(f *testing.F) {
+	// Debug flags (see init) panic on parse errors, and log too much to fuzz.
+	SetDebug(0)
+	f.Cleanup(func() {
+		SetDebug(DbgFlagAll)
+	})
+	files, err := filepath.Glob("_testdata/*/*.*")
+	if err != nil {
+		f.Fatal("Glob failed:", err)
+	}
+	for _, file := range files {
+		ext := filepath.Ext(file)
+		if _, ok := extGopFiles[ext]; !ok {
+			continue
+		}
+		src, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal("ReadFile failed:", err)
+		}
+		f.Add(ext, src)
+	}
+	f.Fuzz(func(t *testing.T, ext string, src []byte) {
+		if _, ok := extGopFiles[ext]; !ok {
+			ext = ".gop"
+		}
+		for _, mode := range []Mode{ParseComments | AllErrors | ParseGoFiles, ParseComments | ErrorTolerant} {
+			fset := token.NewFileSet()
+			file, err := ParseFile(fset, "/foo/bar"+ext, src, mode)
+			if file == nil {
+				t.Fatalf("ParseFile(mode=%d): no AST, err: %v", mode, err)
+			}
+			if err != nil {
+				if _, ok := err.(scanner.ErrorList); !ok {
+					t.Fatalf("ParseFile(mode=%d): error isn't an ErrorList: %T %v", mode, err, err)
+				}
+			}
+		}
+	})
+}
+
+// -----------------------------------------------------------------------------
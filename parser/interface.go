@@ -44,6 +44,11 @@ const (
 	AllErrors
 	// ParseGoFiles - parse *.go files
 	ParseGoFiles
+	// ErrorTolerant - build a best-effort AST of source code with syntax errors
+	// (implies AllErrors). A declaration keyword at column 1 is taken as the
+	// start of a top-level declaration, so that unclosed blocks before it don't
+	// swallow it, and files with errors are kept when parsing a directory.
+	ErrorTolerant
 )
 
 // ParseFile parses the source code of a single Go source file and returns
@@ -81,7 +86,11 @@ func parseFile(fset *token.FileSet, filename string, src interface{}, mode Mode)
 		if e := recover(); e != nil {
 			// resume same panic if it's not a bailout
 			if _, ok := e.(bailout); !ok {
-				panic(e)
+				msg, ok := e.(string) // unsupported syntax, eg. "TODO: tupleExpr"
+				if !ok || mode&ErrorTolerant == 0 {
+					panic(e)
+				}
+				p.errors.Add(p.file.Position(p.pos), msg)
 			}
 		}
 
@@ -54,6 +54,7 @@ type parser struct {
 
 	// Comments
 	comments    []*ast.CommentGroup
+	directives  []*ast.Comment    // //gop:xxx directives
 	leadComment *ast.CommentGroup // last lead comment
 	lineComment *ast.CommentGroup // last line comment
 
@@ -75,8 +76,9 @@ type parser struct {
 	syncCnt int       // number of parser.advance calls without progress
 
 	// Non-syntactic parser control
-	exprLev int  // < 0: in control clause, >= 0: in expression
-	inRHS   bool // if set, the parser is parsing a rhs expression
+	exprLev  int  // < 0: in control clause, >= 0: in expression
+	inRHS    bool // if set, the parser is parsing a rhs expression
+	blockLev int  // nesting level of blocks
 
 	// Ordinary identifier scopes
 	pkgScope   *ast.Scope        // pkgScope.Outer == nil
@@ -99,6 +101,9 @@ func (p *parser) init(fset *token.FileSet, filename string, src []byte, mode Mod
 	eh := func(pos token.Position, msg string) { p.errors.Add(pos, msg) }
 	p.scanner.Init(p.file, src, eh, m)
 
+	if mode&ErrorTolerant != 0 {
+		mode |= AllErrors
+	}
 	p.mode = mode
 	p.trace = mode&Trace != 0 // for convenience (p.trace is used frequently)
 
@@ -293,7 +298,7 @@ func (p *parser) consumeComment() (comment *ast.Comment, endline int) {
 	// /*-style comments may end on a different line than where they start.
 	// Scan the comment for '\n' chars and adjust endline accordingly.
 	endline = p.file.Line(p.pos)
-	if p.lit[1] == '*' {
+	if len(p.lit) > 1 && p.lit[1] == '*' { // not an empty # comment
 		// don't use range here - no need to decode Unicode code points
 		for i := 0; i < len(p.lit); i++ {
 			if p.lit[i] == '\n' {
@@ -303,11 +308,26 @@ func (p *parser) consumeComment() (comment *ast.Comment, endline int) {
 	}
 
 	comment = &ast.Comment{Slash: p.pos, Text: p.lit}
+	if isDirective(p.lit) && p.file.Position(p.pos).Column == 1 {
+		p.directives = append(p.directives, comment)
+	}
 	p.next0()
 
 	return
 }
 
+// isDirective reports whether comment is a Go+ directive, eg. //gop:generate.
+func isDirective(comment string) bool {
+	if !strings.HasPrefix(comment, "//gop:") {
+		return false
+	}
+	name := comment[len("//gop:"):]
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name = name[:i]
+	}
+	return name != ""
+}
+
 // Consume a group of adjacent comments, add it to the parser's
 // comments list, and return it together with the line at which
 // the last comment in the group ends. A non-comment token or n
@@ -365,6 +385,12 @@ func (p *parser) next() {
 			}
 		}
 
+		if p.tok == token.COMMENT && p.file.Offset(p.pos) == 0 && strings.HasPrefix(p.lit, "#!") {
+			// A shebang line (eg. #!/usr/bin/env goprun) of a script is a
+			// comment group by itself, and never a lead comment.
+			p.consumeCommentGroup(0)
+		}
+
 		// consume successor comments, if any
 		endline = -1
 		for p.tok == token.COMMENT {
@@ -466,7 +492,9 @@ func (p *parser) expectSemi() {
 			p.next()
 		default:
 			p.errorExpected(p.pos, "';'", 3)
-			p.advance(stmtStart)
+			if !p.atTopDecl() {
+				p.advance(stmtStart)
+			}
 		}
 	}
 }
@@ -501,7 +529,7 @@ func assert(cond bool, msg string) {
 // is in the 'to' set, or token.EOF. For error recovery.
 func (p *parser) advance(to map[token.Token]bool) {
 	for ; p.tok != token.EOF; p.next() {
-		if to[p.tok] {
+		if to[p.tok] || p.atTopDecl() {
 			// Return only if parser made some progress since last
 			// sync or if it has not reached 10 advance calls without
 			// progress. Otherwise consume at least one token to
@@ -550,6 +578,20 @@ var declStart = map[token.Token]bool{
 	token.VAR:   true,
 }
 
+var topDeclStart = map[token.Token]bool{
+	token.CONST:  true,
+	token.FUNC:   true,
+	token.IMPORT: true,
+	token.TYPE:   true,
+	token.VAR:    true,
+}
+
+// atTopDecl reports whether a top-level declaration starts at the current
+// token in ErrorTolerant mode, that is, a declaration keyword at column 1.
+func (p *parser) atTopDecl() bool {
+	return p.mode&ErrorTolerant != 0 && topDeclStart[p.tok] && p.file.Position(p.pos).Column == 1
+}
+
 var exprEnd = map[token.Token]bool{
 	token.COMMA:     true,
 	token.COLON:     true,
@@ -856,7 +898,8 @@ func (p *parser) parseArrayTypeOrSliceLit(state int, slice ast.Expr) (expr ast.E
 		elt = p.tryType()
 		if elt == nil {
 			if len == nil {
-				log.Panicln("TODO: expect slice index")
+				p.errorExpected(p.pos, "slice index", 2)
+				len = &ast.BadExpr{From: p.pos, To: p.pos}
 			}
 			if debugParseOutput {
 				log.Printf("ast.IndexExpr{X: %v, Index: %v}\n", slice, len)
@@ -1295,12 +1338,25 @@ func (p *parser) parseStmtList() (list []ast.Stmt) {
 	}
 
 	for p.tok != token.CASE && p.tok != token.DEFAULT && p.tok != token.RBRACE && p.tok != token.EOF {
+		if p.blockLev > 0 && p.atTopDecl() { // unclosed block
+			break
+		}
 		list = append(list, p.parseStmt(true))
 	}
 
 	return
 }
 
+// expectBlockEnd is like expect2(token.RBRACE), but it doesn't consume the
+// top-level declaration ending an unclosed block in ErrorTolerant mode.
+func (p *parser) expectBlockEnd() token.Pos {
+	if p.atTopDecl() {
+		p.errorExpected(p.pos, "'}'", 3)
+		return token.NoPos
+	}
+	return p.expect2(token.RBRACE)
+}
+
 func (p *parser) parseBody(scope *ast.Scope) *ast.BlockStmt {
 	if p.trace {
 		defer un(trace(p, "Body"))
@@ -1309,10 +1365,12 @@ func (p *parser) parseBody(scope *ast.Scope) *ast.BlockStmt {
 	lbrace := p.expect(token.LBRACE)
 	p.topScope = scope // open function scope
 	p.openLabelScope()
+	p.blockLev++
 	list := p.parseStmtList()
+	p.blockLev--
 	p.closeLabelScope()
 	p.closeScope()
-	rbrace := p.expect2(token.RBRACE)
+	rbrace := p.expectBlockEnd()
 
 	return &ast.BlockStmt{Lbrace: lbrace, List: list, Rbrace: rbrace}
 }
@@ -1324,9 +1382,11 @@ func (p *parser) parseBlockStmt() *ast.BlockStmt {
 
 	lbrace := p.expect(token.LBRACE)
 	p.openScope()
+	p.blockLev++
 	list := p.parseStmtList()
+	p.blockLev--
 	p.closeScope()
-	rbrace := p.expect2(token.RBRACE)
+	rbrace := p.expectBlockEnd()
 
 	return &ast.BlockStmt{Lbrace: lbrace, List: list, Rbrace: rbrace}
 }
@@ -1405,8 +1465,9 @@ func (p *parser) parseOperand(lhs, allowTuple, allowCmd bool) ast.Expr {
 		lparen := p.pos
 		p.next()
 		if allowTuple && p.tok == token.RPAREN { // () => expr
+			rparen := p.pos
 			p.next()
-			return &tupleExpr{}
+			return newTupleExpr(lparen, rparen, nil)
 		}
 		p.exprLev++
 		x := p.parseRHSOrType() // types may be parenthesized: (some type)
@@ -1419,8 +1480,8 @@ func (p *parser) parseOperand(lhs, allowTuple, allowCmd bool) ast.Expr {
 				items = append(items, p.parseIdent())
 			}
 			p.exprLev--
-			p.expect(token.RPAREN)
-			return &tupleExpr{items: items}
+			rparen := p.expect(token.RPAREN)
+			return newTupleExpr(lparen, rparen, items)
 		}
 		p.exprLev--
 		rparen := p.expect(token.RPAREN)
@@ -1702,7 +1763,7 @@ func (p *parser) parseElementListOrComprehension() (list []ast.Expr, mce *ast.Co
 		list = append(list, p.parseElement())
 		if p.tok == token.FOR { // for k, v <- container
 			if len(list) != 1 {
-				log.Panicln("TODO: invalid comprehension: too may elements.")
+				p.error(list[1].Pos(), "invalid comprehension: too many elements")
 			}
 			phrases := p.parseForPhrases()
 			return nil, &ast.ComprehensionExpr{Elt: list[0], Fors: phrases}
@@ -2065,11 +2126,17 @@ func (p *parser) parseRangeExpr(allowCmd bool) ast.Expr {
 	return &ast.RangeExpr{First: low, To: to, Last: high, Colon2: colon2, Expr3: expr3}
 }
 
+// tupleExpr is the parameter list of a lambda expression, eg. (x, y) of
+// (x, y) => x + y. It's a *ast.BadExpr if it isn't followed by =>.
 type tupleExpr struct {
 	ast.Expr
 	items []*ast.Ident
 }
 
+func newTupleExpr(lparen, rparen token.Pos, items []*ast.Ident) *tupleExpr {
+	return &tupleExpr{Expr: &ast.BadExpr{From: lparen, To: rparen + 1}, items: items}
+}
+
 func (p *parser) parseLambdaExpr(allowCmd, allowRangeExpr bool) ast.Expr {
 	var x ast.Expr
 	var first = p.pos
@@ -2140,8 +2207,9 @@ func (p *parser) parseLambdaExpr(allowCmd, allowRangeExpr bool) ast.Expr {
 			RhsHasParen: rhsHasParen,
 		}
 	}
-	if _, ok := x.(*tupleExpr); ok {
-		panic("TODO: tupleExpr")
+	if t, ok := x.(*tupleExpr); ok {
+		p.errorExpected(p.pos, "'=>'", 2)
+		return t.Expr
 	}
 	return x
 }
@@ -2756,7 +2824,7 @@ func (p *parser) parseForPhraseStmtPart(lhs []ast.Expr) *ast.ForPhraseStmt {
 	case 2:
 		stmt.Key, stmt.Value = p.toIdent(lhs[0]), p.toIdent(lhs[1])
 	default:
-		log.Panicln("TODO: parseForPhraseStmt - too many variables, 1 or 2 is required")
+		p.error(tokPos, "too many variables in for phrase, 1 or 2 is required")
 	}
 	return stmt
 }
@@ -3147,7 +3215,8 @@ func (p *parser) parseFuncDeclOrCall() (*ast.FuncDecl, *ast.CallExpr) {
 				p.unget(oldpos, oldtok, "")
 				typ := p.tryType()
 				if typ == nil {
-					panic("TODO: invalid result type")
+					p.errorExpected(p.pos, "type", 2)
+					typ = &ast.BadExpr{From: p.pos, To: p.pos}
 				}
 				isFunLit, results = true, &ast.FieldList{List: []*ast.Field{{Type: typ}}}
 			}
@@ -3180,7 +3249,7 @@ func (p *parser) parseFuncDeclOrCall() (*ast.FuncDecl, *ast.CallExpr) {
 
 	if isOp {
 		if params == nil || len(params.List) != 1 {
-			log.Panicln("TODO: overload operator can only have one parameter")
+			p.error(pos, "overload operator can only have one parameter")
 		}
 	}
 	var body *ast.BlockStmt
@@ -3243,7 +3312,9 @@ func (p *parser) parseDecl(sync map[token.Token]bool) ast.Decl {
 		decl, call := p.parseFuncDeclOrCall()
 		if decl != nil {
 			if p.errors.Len() != 0 {
-				p.errorExpected(pos, "declaration", 2)
+				if p.mode&ErrorTolerant == 0 { // errors are reported where they are
+					p.errorExpected(pos, "declaration", 2)
+				}
 				p.advance(sync)
 			}
 			return decl
@@ -3260,6 +3331,11 @@ func (p *parser) parseGlobalStmts(sync map[token.Token]bool, pos token.Pos, stmt
 	doc := p.leadComment
 	p.openLabelScope()
 	list := p.parseStmtList()
+	switch p.tok {
+	case token.CASE, token.DEFAULT, token.RBRACE: // not closing any block at top level
+		p.errorExpected(p.pos, "statement", 2)
+		p.next()
+	}
 	p.closeLabelScope()
 	p.closeScope()
 	if stmts != nil {
@@ -3360,6 +3436,7 @@ func (p *parser) parseFile() *ast.File {
 		Imports:      p.imports,
 		Unresolved:   p.unresolved[0:i],
 		Comments:     p.comments,
+		Directives:   p.directives,
 		NoEntrypoint: p.noEntrypoint,
 		NoPkgDecl:    noPkgDecl,
 	}
@@ -19,9 +19,13 @@ package parser
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"go/build"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -70,6 +74,52 @@ func (p localFS) Join(elem ...string) string {
 
 var local FileSystem = localFS{}
 
+type ioFS struct {
+	fsys fs.FS
+}
+
+// FromFS adapts a standard fs.FS (eg. an embed.FS) to a FileSystem.
+// Paths passed to the returned FileSystem are slash-separated and unrooted,
+// as described by fs.ValidPath.
+func FromFS(fsys fs.FS) FileSystem {
+	return ioFS{fsys: fsys}
+}
+
+func (p ioFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	entries, err := fs.ReadDir(p.fsys, dirname)
+	if err != nil {
+		return nil, pathError("readdir", dirname, err)
+	}
+	fis := make([]os.FileInfo, len(entries))
+	for i, entry := range entries {
+		fi, err := entry.Info()
+		if err != nil {
+			return nil, pathError("readdir", path.Join(dirname, entry.Name()), err)
+		}
+		fis[i] = fi
+	}
+	return fis, nil
+}
+
+func (p ioFS) ReadFile(filename string) ([]byte, error) {
+	b, err := fs.ReadFile(p.fsys, filename)
+	if err != nil {
+		return nil, pathError("read", filename, err)
+	}
+	return b, nil
+}
+
+func (p ioFS) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+func pathError(op, name string, err error) error {
+	if _, ok := err.(*fs.PathError); ok {
+		return err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
 // Parse parses a single Go+ source file. The target specifies the Go+ source file.
 // If the file couldn't be read, a nil map and the respective error are returned.
 func Parse(fset *token.FileSet, target string, src interface{}, mode Mode) (pkgs map[string]*ast.Package, err error) {
@@ -100,20 +150,60 @@ func ParseDir(fset *token.FileSet, path string, filter func(os.FileInfo) bool, m
 	return ParseFSDir(fset, local, path, filter, mode)
 }
 
+// ParseIoFSDir calls ParseFSDir by passing a standard fs.FS (eg. an embed.FS).
+//
+func ParseIoFSDir(fset *token.FileSet, fsys fs.FS, path string, filter func(os.FileInfo) bool, mode Mode) (pkgs map[string]*ast.Package, first error) {
+	return ParseFSDir(fset, FromFS(fsys), path, filter, mode)
+}
+
 // ParseFSDir calls ParseFile for all files with names ending in ".gop" in the
 // directory specified by path and returns a map of package name -> package
 // AST with all the packages found.
 //
 // If filter != nil, only the files with os.FileInfo entries passing through
-// the filter (and ending in ".gop") are considered. The mode bits are passed
-// to ParseFile unchanged. Position information is recorded in fset, which
-// must not be nil.
+// the filter (and ending in ".gop") are considered. Files whose build
+// constraint, a //gop:build (or //go:build) line before the package clause,
+// isn't satisfied by the current GOOS, GOARCH and build tags are excluded as
+// well. The mode bits are passed to ParseFile unchanged. Position information
+// is recorded in fset, which must not be nil.
 //
 // If the directory couldn't be read, a nil map and the respective error are
 // returned. If a parse error occurred, a non-nil but incomplete map and the
 // first error encountered are returned.
 //
 func ParseFSDir(fset *token.FileSet, fs FileSystem, path string, filter func(os.FileInfo) bool, mode Mode) (pkgs map[string]*ast.Package, first error) {
+	return ParseFSDirEx(fset, fs, path, Config{Filter: filter, Mode: mode})
+}
+
+// Config represents the configuration of ParseDirEx and ParseFSDirEx.
+type Config struct {
+	Filter func(os.FileInfo) bool // see ParseFSDir
+	Mode   Mode
+
+	// Context provides the GOOS, GOARCH and build tags that build constraints
+	// are evaluated against. If it's nil, build.Default is used.
+	Context *build.Context
+}
+
+func (p *Config) buildContext() *build.Context {
+	if p.Context != nil {
+		return p.Context
+	}
+	return &build.Default
+}
+
+// ParseDirEx calls ParseFSDirEx by passing a local filesystem.
+//
+func ParseDirEx(fset *token.FileSet, path string, conf Config) (pkgs map[string]*ast.Package, first error) {
+	return ParseFSDirEx(fset, local, path, conf)
+}
+
+// ParseFSDirEx is like ParseFSDir, but evaluates build constraints against
+// conf.Context rather than the current GOOS, GOARCH and build tags, so that a
+// package can be parsed for another platform or with custom tags.
+//
+func ParseFSDirEx(fset *token.FileSet, fs FileSystem, path string, conf Config) (pkgs map[string]*ast.Package, first error) {
+	mode := conf.Mode
 	list, err := fs.ReadDir(path)
 	if err != nil {
 		return nil, err
@@ -123,37 +213,99 @@ func ParseFSDir(fset *token.FileSet, fs FileSystem, path string, filter func(os.
 		if d.IsDir() {
 			continue
 		}
-		fname := d.Name()
-		ext := filepath.Ext(fname)
-		ft, isOk := extGopFiles[ext]
-		if ft == ast.FileTypeGo && (mode&ParseGoFiles) == 0 {
-			isOk = false
+		filename := fs.Join(path, d.Name())
+		filedata, reason, err := readDirFile(fs, filename, d, &conf)
+		if reason != "" {
+			if err != nil && first == nil {
+				first = err
+			}
+			continue
+		}
+		src, err := ParseFSFile(fset, fs, filename, filedata, mode)
+		if err != nil && first == nil {
+			first = err
 		}
-		if isOk && !strings.HasPrefix(fname, "_") && (filter == nil || filter(d)) {
-			filename := fs.Join(path, fname)
-			if filedata, err := fs.ReadFile(filename); err == nil {
-				if src, err := ParseFSFile(fset, fs, filename, filedata, mode); err == nil {
-					name := src.Name.Name
-					pkg, found := pkgs[name]
-					if !found {
-						pkg = &ast.Package{
-							Name:  name,
-							Files: make(map[string]*ast.File),
-						}
-						pkgs[name] = pkg
-					}
-					pkg.Files[filename] = src
-				} else if first == nil {
-					first = err
+		if err == nil || (src != nil && mode&ErrorTolerant != 0) {
+			name := src.Name.Name
+			pkg, found := pkgs[name]
+			if !found {
+				pkg = &ast.Package{
+					Name:  name,
+					Files: make(map[string]*ast.File),
 				}
-			} else if first == nil {
-				first = err
+				pkgs[name] = pkg
 			}
+			pkg.Files[filename] = src
+		}
+	}
+	return
+}
+
+// readDirFile reads the file filename (whose entry is d) in a directory to be
+// parsed by ParseFSDir, unless it's excluded. If it's excluded, reason is why,
+// and err is the error to report, if any.
+func readDirFile(fs FileSystem, filename string, d os.FileInfo, conf *Config) (filedata []byte, reason string, err error) {
+	filter, mode := conf.Filter, conf.Mode
+	fname := d.Name()
+	ext := filepath.Ext(fname)
+	ft, isOk := extGopFiles[ext]
+	if !isOk {
+		return nil, fmt.Sprintf("unsupported file extension %q", ext), nil
+	}
+	if ft == ast.FileTypeGo && (mode&ParseGoFiles) == 0 {
+		return nil, "Go file, not parsed without ParseGoFiles mode", nil
+	}
+	if strings.HasPrefix(fname, "_") {
+		return nil, "file name begins with _", nil
+	}
+	if filter != nil && !filter(d) {
+		return nil, "excluded by the filter", nil
+	}
+	if filedata, err = fs.ReadFile(filename); err != nil {
+		return nil, fmt.Sprintf("can't read file: %v", err), err
+	}
+	if match, err := matchBuildConstraint(conf.buildContext(), filedata); !match {
+		if err != nil {
+			err = fmt.Errorf("%s: parsing build constraint: %v", filename, err)
+			return nil, fmt.Sprintf("invalid build constraint: %s", buildConstraint(filedata)), err
 		}
+		return nil, fmt.Sprintf("build constraint not satisfied: %s", buildConstraint(filedata)), nil
 	}
 	return
 }
 
+// A FileExplain tells whether a file in a directory is parsed by ParseFSDir.
+type FileExplain struct {
+	Name   string // file name, without the directory
+	Reason string // why the file is excluded, or "" if it's parsed
+}
+
+// ExplainDir calls ExplainFSDir by passing a local filesystem.
+func ExplainDir(path string, filter func(os.FileInfo) bool, mode Mode) ([]FileExplain, error) {
+	return ExplainFSDir(local, path, filter, mode)
+}
+
+// ExplainFSDir tells whether each file in the directory specified by path is
+// parsed by ParseFSDir with the same filter and mode, and why it's excluded if
+// it isn't (eg. its extension, or its build constraint). Subdirectories aren't
+// listed. It's meant to diagnose why a file isn't part of a package.
+func ExplainFSDir(fs FileSystem, path string, filter func(os.FileInfo) bool, mode Mode) ([]FileExplain, error) {
+	list, err := fs.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	conf := &Config{Filter: filter, Mode: mode}
+	ret := make([]FileExplain, 0, len(list))
+	for _, d := range list {
+		if d.IsDir() {
+			continue
+		}
+		_, reason, _ := readDirFile(fs, fs.Join(path, d.Name()), d, conf)
+		ret = append(ret, FileExplain{Name: d.Name(), Reason: reason})
+	}
+	return ret, nil
+}
+
 var (
 	extGopFiles = map[string]ast.FileType{
 		".go":  ast.FileTypeGo,
@@ -182,10 +334,16 @@ func ParseFiles(fset *token.FileSet, files []string, mode Mode) (map[string]*ast
 
 func ParseFSFiles(fset *token.FileSet, fs FileSystem, files []string, mode Mode) (map[string]*ast.Package, error) {
 	ret := map[string]*ast.Package{}
+	var first error
 	for _, file := range files {
 		f, err := ParseFSFile(fset, fs, file, nil, mode)
 		if err != nil {
-			return nil, err
+			if f == nil || mode&ErrorTolerant == 0 {
+				return nil, err
+			}
+			if first == nil {
+				first = err
+			}
 		}
 		pkgName := f.Name.Name
 		pkg, ok := ret[pkgName]
@@ -195,7 +353,7 @@ func ParseFSFiles(fset *token.FileSet, fs FileSystem, files []string, mode Mode)
 		}
 		pkg.Files[file] = f
 	}
-	return ret, nil
+	return ret, first
 }
 
 // -----------------------------------------------------------------------------
@@ -17,8 +17,11 @@
 package parser
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
 
+	"github.com/goplus/gop/ast"
 	"github.com/goplus/gop/parser/parsertest"
 	"github.com/goplus/gop/token"
 )
@@ -50,6 +53,49 @@ func testErrCode(t *testing.T, code string, errExp, panicExp string) {
 	}
 }
 
+func TestErrorTolerant(t *testing.T) {
+	const code = `func foo() {
+	x :=
+	println x
+
+func bar(a int) int {
+	if a > 0 {
+		return a +
+
+type T struct {
+	X int
+}
+`
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "/foo/bar.gop", code, ErrorTolerant)
+	if err == nil {
+		t.Fatal("ParseFile: no error?")
+	}
+	if len(f.Decls) != 3 {
+		t.Fatal("ParseFile: decls -", len(f.Decls))
+	}
+	foo, ok1 := f.Decls[0].(*ast.FuncDecl)
+	bar, ok2 := f.Decls[1].(*ast.FuncDecl)
+	typ, ok3 := f.Decls[2].(*ast.GenDecl)
+	if !ok1 || !ok2 || !ok3 || foo.Name.Name != "foo" || bar.Name.Name != "bar" || typ.Tok != token.TYPE {
+		t.Fatal("ParseFile: unexpected decls")
+	}
+	for i, decl := range f.Decls {
+		start, end := fset.Position(decl.Pos()), fset.Position(decl.End())
+		if line := []int{1, 5, 9}[i]; start.Line != line || !end.IsValid() {
+			t.Fatal("ParseFile: invalid range of decl", i, start, end)
+		}
+		if i+1 < len(f.Decls) && decl.End() > f.Decls[i+1].Pos() {
+			t.Fatal("ParseFile: decl", i, "overlaps the next one")
+		}
+	}
+
+	f, _ = ParseFile(fset, "/foo/bar.gop", code, 0)
+	if len(f.Decls) >= 3 {
+		t.Fatal("ParseFile: decls -", len(f.Decls))
+	}
+}
+
 func TestErrOperand(t *testing.T) {
 	testErrCode(t, `a :=`, `/foo/bar.gop:1:5: expected operand, found 'EOF'`, ``)
 }
@@ -85,6 +131,85 @@ test "hello", (x, "y") => {
 `, `/foo/bar.gop:3:19: expected 'IDENT', found "y"`, ``)
 }
 
+func TestErrNoPanic(t *testing.T) { // found by FuzzParseFile
+	testErrCode(t, `a := (x, y)`, `/foo/bar.gop:1:12: expected '=>', found newline`, ``)
+	testErrCode(t, `foo((a, b) + 1)`, `/foo/bar.gop:1:5: expected expression`, ``)
+	testErrCode(t, `a := {x, y for x <- b}`, `/foo/bar.gop:1:10: invalid comprehension: too many elements`, ``)
+	testErrCode(t, `func (a T) +() T {}`, `/foo/bar.gop:1:1: overload operator can only have one parameter`, ``)
+	testErrCode(t, `func (a) + 1`, `/foo/bar.gop:1:10: expected type, found '+'`, ``)
+	testErrCode(t, "println 1\n}\nprintln 2", `/foo/bar.gop:2:1: expected statement, found '}'`, ``)
+	testErrCode(t, "case 1\nprintln 2", `/foo/bar.gop:1:1: expected statement, found 'case'`, ``)
+
+	fset := token.NewFileSet()
+	if _, err := Parse(fset, "/foo/bar.gop", "x := 1 #", ParseComments); err != nil {
+		t.Fatal("Parse empty # comment failed:", err)
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	const src = `//gop:build linux
+package foo
+
+//gop:generate stringer -type=Color
+//gop:generate   echo "$GOFILE"
+type Color int
+
+  //gop:generate indented
+//gop: empty
+// gop:generate spaced
+/*gop:generate block*/
+func f() {
+//gop:generate inner
+}
+`
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "/foo/bar.gop", src, ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile failed:", err)
+	}
+	var directives []string
+	for _, c := range f.Directives {
+		directives = append(directives, fmt.Sprintf("%d: %s", fset.Position(c.Slash).Line, c.Text))
+	}
+	expected := []string{
+		"1: //gop:build linux",
+		"4: //gop:generate stringer -type=Color",
+		`5: //gop:generate   echo "$GOFILE"`,
+		"13: //gop:generate inner",
+	}
+	if !reflect.DeepEqual(directives, expected) {
+		t.Fatal("Directives:", directives)
+	}
+
+	if f, _ = ParseFile(fset, "/foo/bar.gop", src, 0); f.Directives != nil {
+		t.Fatal("Directives without ParseComments:", f.Directives)
+	}
+}
+
+func TestShebang(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "/foo/bar.gop", "#!/usr/bin/env goprun\nfunc greet() {\n\tprintln \"Hi\"\n}\n\ngreet\n", ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile failed:", err)
+	}
+	if len(f.Comments) != 1 || f.Comments[0].Text() != "#!/usr/bin/env goprun\n" {
+		t.Fatal("Comments:", f.Comments)
+	}
+	if fn := f.Decls[0].(*ast.FuncDecl); fn.Name.Name != "greet" || fn.Doc != nil || fset.Position(fn.Pos()).Line != 2 {
+		t.Fatal("FuncDecl:", fn.Name, fn.Doc, fset.Position(fn.Pos()))
+	}
+	if f.Doc != nil {
+		t.Fatal("Doc:", f.Doc.Text())
+	}
+
+	f, err = ParseFile(fset, "/foo/bar.gop", "#!/usr/bin/env goprun\n// Package main is a script.\npackage main\n", ParseComments)
+	if err != nil || f.Doc == nil || f.Doc.Text() != "Package main is a script.\n" {
+		t.Fatal("ParseFile:", f.Doc, err)
+	}
+
+	testErrCode(t, "#!/usr/bin/env goprun\nx :=\n", `/foo/bar.gop:2:6: expected operand, found 'EOF'`, ``)
+}
+
 func TestErrTooMany(t *testing.T) {
 	testErrCode(t, `
 func f() { var }
@@ -370,3 +495,120 @@ ast.FuncDecl:
 }
 
 // -----------------------------------------------------------------------------
+
+// reachableNodes returns all nodes reachable from node through fields of the
+// syntax tree, but not through Scope, Obj, or the lists of File which hold
+// nodes in its declarations (Imports, Unresolved, and Comments).
+func reachableNodes(node ast.Node) map[ast.Node]bool {
+	nodes := make(map[ast.Node]bool)
+	nodeType := reflect.TypeOf((*ast.Node)(nil)).Elem()
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Interface:
+			if !v.IsNil() {
+				walk(v.Elem())
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i))
+			}
+		case reflect.Ptr:
+			if v.IsNil() || !v.Type().Implements(nodeType) {
+				return
+			}
+			n := v.Interface().(ast.Node)
+			if nodes[n] {
+				return
+			}
+			nodes[n] = true
+			v = v.Elem()
+			if v.Kind() != reflect.Struct {
+				return
+			}
+			for i := 0; i < v.NumField(); i++ {
+				switch v.Type().Field(i).Name {
+				case "Scope", "Obj", "Imports", "Unresolved", "Comments":
+					continue
+				}
+				walk(v.Field(i))
+			}
+		}
+	}
+	walk(reflect.ValueOf(node))
+	return nodes
+}
+
+func TestInspectClassFile(t *testing.T) {
+	const code = `import "strings"
+
+var (
+	Kai Sprite
+	n   int
+)
+
+// onMsg is called when a message is received.
+func onMsg(msg string) {
+	say strings.ToUpper(msg)
+	for i <- 1:5, i%2 == 1 {
+		n += i
+	}
+	sq := [x*x for x <- [1, 3, 5], x > 1]
+	m := {k: v for k, v <- {"a": 1}}
+	foo x => x * 2
+	bar((x, y) => {
+		return x + y
+	})
+	_, _ = sq, m
+	v := strconv.Atoi(msg)?:0
+	println v, 1r, 2i
+}
+`
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "/foo/Kai.spx", code, ParseComments)
+	if err != nil {
+		t.Fatal("ParseFile failed:", err)
+	}
+	if f.FileType != ast.FileTypeSpx {
+		t.Fatal("FileType:", f.FileType)
+	}
+	visited := make(map[ast.Node]bool)
+	types := make(map[string]int)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n != nil {
+			visited[n] = true
+			types[reflect.TypeOf(n).Elem().Name()]++
+		}
+		return true
+	})
+	for n := range reachableNodes(f) {
+		if !visited[n] {
+			t.Errorf("ast.Inspect doesn't visit %T at %v", n, fset.Position(n.Pos()))
+		}
+	}
+	for _, typ := range []string{
+		"ForPhraseStmt", "RangeExpr", "ComprehensionExpr", "ForPhrase",
+		"SliceLit", "LambdaExpr", "LambdaExpr2", "ErrWrapExpr",
+	} {
+		if types[typ] == 0 {
+			t.Error("ast.Inspect doesn't visit any", typ)
+		}
+	}
+
+	funcs, idents := 0, 0
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.FuncDecl:
+			funcs++
+			return false // skip the children
+		case *ast.Ident:
+			idents++
+		}
+		return true
+	})
+	if funcs != 1 || idents != 5 { // foo, Kai, Sprite, n, int
+		t.Fatal("ast.Inspect with skipping:", funcs, idents)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -17,13 +17,19 @@
 package parser
 
 import (
+	"archive/zip"
 	"bytes"
+	"go/build"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
 	"reflect"
+	"runtime"
+	"sort"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/qiniu/x/log"
 
@@ -84,6 +90,222 @@ func TestParseDir(t *testing.T) {
 	}
 }
 
+func TestParseIoFSDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/b/foo.gop":  {Data: []byte(`println "Hi"`)},
+		"a/b/bar.spx":  {Data: []byte(`println "spx"`)},
+		"a/b/_x.gop":   {Data: []byte(`?`)},
+		"a/b/readme":   {Data: []byte(`?`)},
+		"a/b/c/x.gop":  {Data: []byte(`?`)},
+		"a/root.gop":   {Data: []byte(`println "root"`)},
+		"a/b/c/d/y.go": {Data: []byte(`package d`)},
+	}
+	fset := token.NewFileSet()
+	pkgs, err := ParseIoFSDir(fset, fsys, "a/b", nil, 0)
+	if err != nil || len(pkgs) != 1 {
+		t.Fatal("ParseIoFSDir failed:", pkgs, err)
+	}
+	pkg := pkgs["main"]
+	if pkg == nil || len(pkg.Files) != 2 || pkg.Files["a/b/foo.gop"] == nil || pkg.Files["a/b/bar.spx"] == nil {
+		t.Fatal("ParseIoFSDir failed:", pkg)
+	}
+	_, err = ParseIoFSDir(fset, fsys, "a/not-exists", nil, 0)
+	if e, ok := err.(*fs.PathError); !ok || e.Path != "a/not-exists" {
+		t.Fatal("ParseIoFSDir failed:", err)
+	}
+	if _, err = FromFS(fsys).ReadFile("a/b/not-exists.gop"); !strings.Contains(err.Error(), "a/b/not-exists.gop") {
+		t.Fatal("ReadFile failed:", err)
+	}
+}
+
+func TestBuildConstraint(t *testing.T) {
+	otherOS := "plan9"
+	if runtime.GOOS == otherOS {
+		otherOS = "windows"
+	}
+	fsys := fstest.MapFS{
+		"foo/other.gop":    {Data: []byte("//gop:build " + otherOS + "\n\npackage foo\n\nfunc Other() {}\n")},
+		"foo/notother.gop": {Data: []byte("//go:build !" + otherOS + "\n\npackage foo\n\nfunc NotOther() {}\n")},
+		"foo/cur.gop":      {Data: []byte("// Copyright\n\n//gop:build " + runtime.GOOS + " && " + runtime.GOARCH + "\n\npackage foo\n\nfunc Cur() {}\n")},
+		"foo/gopfirst.gop": {Data: []byte("//go:build " + runtime.GOOS + "\n//gop:build " + otherOS + "\n\npackage foo\n\nfunc GopFirst() {}\n")},
+		"foo/late.gop":     {Data: []byte("package foo\n\n//gop:build " + otherOS + "\n\nfunc Late() {}\n")},
+		"foo/none.gop":     {Data: []byte("package foo\n\nfunc None() {}\n")},
+		"foo/script.gop":   {Data: []byte("#!/usr/bin/env goprun\n//gop:build " + otherOS + "\n\npackage foo\n\nfunc Script() {}\n")},
+	}
+	fset := token.NewFileSet()
+	pkgs, err := ParseIoFSDir(fset, fsys, "foo", nil, 0)
+	if err != nil || len(pkgs) != 1 {
+		t.Fatal("ParseIoFSDir failed:", pkgs, err)
+	}
+	var decls []string
+	for _, f := range pkgs["foo"].Files {
+		for _, decl := range f.Decls {
+			decls = append(decls, decl.(*ast.FuncDecl).Name.Name)
+		}
+	}
+	sort.Strings(decls)
+	if v := strings.Join(decls, " "); v != "Cur Late None NotOther" {
+		t.Fatal("ParseIoFSDir:", v)
+	}
+
+	fsys["foo/bad.gop"] = &fstest.MapFile{Data: []byte("//gop:build (linux\n\npackage foo\n\nfunc Bad() {}\n")}
+	pkgs, err = ParseIoFSDir(fset, fsys, "foo", nil, 0)
+	if err == nil || !strings.HasPrefix(err.Error(), "foo/bad.gop: parsing build constraint:") {
+		t.Fatal("ParseIoFSDir:", err)
+	}
+	if len(pkgs["foo"].Files) != 4 {
+		t.Fatal("ParseIoFSDir:", pkgs["foo"].Files)
+	}
+}
+
+func TestBuildConstraintContext(t *testing.T) {
+	fsys := fstest.MapFS{
+		"foo/linux.gop":   {Data: []byte("//gop:build linux && arm64\n\npackage foo\n\nfunc Linux() {}\n")},
+		"foo/windows.gop": {Data: []byte("//gop:build windows\n\npackage foo\n\nfunc Windows() {}\n")},
+		"foo/tagged.gop":  {Data: []byte("//go:build foo && !bar\n\npackage foo\n\nfunc Tagged() {}\n")},
+		"foo/cgo.gop":     {Data: []byte("//gop:build cgo\n\npackage foo\n\nfunc Cgo() {}\n")},
+	}
+	parse := func(goos, goarch string, tags ...string) string {
+		ctxt := build.Default
+		ctxt.GOOS, ctxt.GOARCH, ctxt.BuildTags, ctxt.CgoEnabled = goos, goarch, tags, false
+		pkgs, err := ParseFSDirEx(token.NewFileSet(), FromFS(fsys), "foo", Config{Context: &ctxt})
+		if err != nil {
+			t.Fatal("ParseFSDirEx failed:", err)
+		}
+		var decls []string
+		for _, pkg := range pkgs {
+			for _, f := range pkg.Files {
+				for _, decl := range f.Decls {
+					decls = append(decls, decl.(*ast.FuncDecl).Name.Name)
+				}
+			}
+		}
+		sort.Strings(decls)
+		return strings.Join(decls, " ")
+	}
+	if v := parse("linux", "arm64"); v != "Linux" {
+		t.Fatal("linux/arm64:", v)
+	}
+	if v := parse("android", "arm64", "foo"); v != "Linux Tagged" {
+		t.Fatal("android/arm64 foo:", v)
+	}
+	if v := parse("windows", "amd64", "foo", "bar"); v != "Windows" {
+		t.Fatal("windows/amd64 foo,bar:", v)
+	}
+}
+
+func TestExplainFSDir(t *testing.T) {
+	otherOS := "plan9"
+	if runtime.GOOS == otherOS {
+		otherOS = "windows"
+	}
+	fsys := fstest.MapFS{
+		"foo/a.gop":        {Data: []byte("package foo\n")},
+		"foo/b.spx":        {Data: []byte("println 1\n")},
+		"foo/c.go":         {Data: []byte("package foo\n")},
+		"foo/_d.gop":       {Data: []byte("package foo\n")},
+		"foo/e.txt":        {Data: []byte("?")},
+		"foo/f.gop":        {Data: []byte("//gop:build " + otherOS + "\n\npackage foo\n")},
+		"foo/g.gop":        {Data: []byte("//gop:build (linux\n\npackage foo\n")},
+		"foo/h_test.gop":   {Data: []byte("package foo\n")},
+		"foo/sub/main.gop": {Data: []byte("package main\n")},
+	}
+	ret, err := ExplainFSDir(FromFS(fsys), "foo", func(fi os.FileInfo) bool {
+		return fi.Name() != "h_test.gop"
+	}, 0)
+	if err != nil {
+		t.Fatal("ExplainFSDir:", err)
+	}
+	var lines []string
+	for _, v := range ret {
+		lines = append(lines, v.Name+": "+v.Reason)
+	}
+	expected := `_d.gop: file name begins with _
+a.gop: 
+b.spx: 
+c.go: Go file, not parsed without ParseGoFiles mode
+e.txt: unsupported file extension ".txt"
+f.gop: build constraint not satisfied: //gop:build ` + otherOS + `
+g.gop: invalid build constraint: //gop:build (linux
+h_test.gop: excluded by the filter`
+	if v := strings.Join(lines, "\n"); v != expected {
+		t.Fatalf("ExplainFSDir:\n%s\nExpected:\n%s", v, expected)
+	}
+	if ret, err = ExplainFSDir(FromFS(fsys), "foo", nil, ParseGoFiles); err != nil || ret[3].Name != "c.go" || ret[3].Reason != "" {
+		t.Fatal("ExplainFSDir:", ret, err)
+	}
+	if _, err = ExplainDir("/foo/bar/not-exists", nil, 0); err == nil {
+		t.Fatal("ExplainDir: no error?")
+	}
+}
+
+func newZipReader(t *testing.T, files ...string) *zip.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(files); i += 2 {
+		w, err := zw.Create(files[i])
+		if err != nil {
+			t.Fatal("zip.Create:", err)
+		}
+		w.Write([]byte(files[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal("zip.Close:", err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal("zip.NewReader:", err)
+	}
+	return r
+}
+
+func TestFromZip(t *testing.T) {
+	r := newZipReader(t,
+		"./a/b/foo.gop", `println "Hi"`,
+		`a\b\bar.spx`, `println "spx"`,
+		"a/b/_x.gop", `?`,
+		"a/b/readme", `?`,
+		"a/b/c/", "",
+		"a/root.gop", `println "root"`,
+		"../evil.gop", `?`,
+		"/a/b/c/d/y.go", `package d`,
+	)
+	fsys := FromZip(r)
+	fset := token.NewFileSet()
+	pkgs, err := ParseFSDir(fset, fsys, "a/b", nil, 0)
+	if err != nil || len(pkgs) != 1 {
+		t.Fatal("ParseFSDir failed:", pkgs, err)
+	}
+	pkg := pkgs["main"]
+	if pkg == nil || len(pkg.Files) != 2 || pkg.Files["a/b/foo.gop"] == nil || pkg.Files["a/b/bar.spx"] == nil {
+		t.Fatal("ParseFSDir failed:", pkg)
+	}
+	pkgs, err = ParseFSDir(fset, fsys, "./a/b/c/d/", nil, ParseGoFiles)
+	if err != nil || pkgs["d"] == nil || pkgs["d"].Files["a/b/c/d/y.go"] == nil {
+		t.Fatal("ParseFSDir failed:", pkgs, err)
+	}
+	fis, err := fsys.ReadDir(".")
+	if err != nil || len(fis) != 1 || fis[0].Name() != "a" || !fis[0].IsDir() {
+		t.Fatal("ReadDir failed:", fis, err)
+	}
+	var names []string
+	if fis, err = fsys.ReadDir("a/b"); err == nil {
+		for _, fi := range fis {
+			names = append(names, fi.Name())
+		}
+	}
+	if strings.Join(names, " ") != "_x.gop bar.spx c foo.gop readme" {
+		t.Fatal("ReadDir failed:", names, err)
+	}
+	_, err = ParseFSDir(fset, fsys, "a/not-exists", nil, 0)
+	if e, ok := err.(*fs.PathError); !ok || e.Path != "a/not-exists" || !os.IsNotExist(err) {
+		t.Fatal("ParseFSDir failed:", err)
+	}
+	if _, err = fsys.ReadFile("evil.gop"); !os.IsNotExist(err) {
+		t.Fatal("ReadFile failed:", err)
+	}
+}
+
 func testFrom(t *testing.T, pkgDir, sel string, exclude Mode) {
 	if sel != "" && !strings.Contains(pkgDir, sel) {
 		return
@@ -153,6 +375,89 @@ func TestFromTestdata(t *testing.T) {
 	}
 }
 
+func TestParseMemFSDirChanged(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `println "Hi"`)
+	fs.WriteFile("/foo/baz.gop", `println "baz"`)
+	fset := token.NewFileSet()
+	pkgs, err := ParseFSDir(fset, fs, "/foo", nil, 0)
+	if err != nil || len(pkgs["main"].Files) != 2 || pkgs["main"].Files["/foo/baz.gop"] == nil {
+		t.Fatal("ParseFSDir failed:", pkgs, err)
+	}
+	if err = fs.Remove("/foo/bar.gop"); err != nil {
+		t.Fatal("Remove failed:", err)
+	}
+	if err = fs.Remove("/foo/bar.gop"); err == nil {
+		t.Fatal("Remove: no error?")
+	}
+	pkgs, err = ParseFSDir(fset, fs, "/foo", nil, 0)
+	if err != nil || len(pkgs["main"].Files) != 1 || pkgs["main"].Files["/foo/baz.gop"] == nil {
+		t.Fatal("ParseFSDir failed:", pkgs, err)
+	}
+}
+
+func TestParseMemFSDirErrorTolerant(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", `println "Hi"`)
+	fs.WriteFile("/foo/baz.gop", "func foo() {\n\tx :=\n")
+	fset := token.NewFileSet()
+	pkgs, err := ParseFSDir(fset, fs, "/foo", nil, 0)
+	if err == nil || len(pkgs["main"].Files) != 1 {
+		t.Fatal("ParseFSDir failed:", pkgs, err)
+	}
+	pkgs, err = ParseFSDir(fset, fs, "/foo", nil, ErrorTolerant)
+	if err == nil || len(pkgs["main"].Files) != 2 || pkgs["main"].Files["/foo/baz.gop"] == nil {
+		t.Fatal("ParseFSDir failed:", pkgs, err)
+	}
+	pkgs, err = ParseFSFiles(fset, fs, []string{"/foo/bar.gop", "/foo/baz.gop"}, ErrorTolerant)
+	if err == nil || len(pkgs["main"].Files) != 2 {
+		t.Fatal("ParseFSFiles failed:", pkgs, err)
+	}
+}
+
+func TestMemFSPos(t *testing.T) {
+	fs := parsertest.NewSingleFileFS("/foo", "bar.gop", "x := \"中文\"\nif x != \"\" {\n\tprintln x\n}\n")
+	fset := token.NewFileSet()
+	if pos := fs.Pos(fset, "/foo/bar.gop", 1, 1); pos != token.NoPos {
+		t.Fatal("Pos: not parsed yet?", pos)
+	}
+	pkgs, err := ParseFSDir(fset, fs, "/foo", nil, 0)
+	if err != nil {
+		t.Fatal("ParseFSDir failed:", err)
+	}
+	f := pkgs["main"].Files["/foo/bar.gop"]
+	body := f.Decls[0].(*ast.FuncDecl).Body.List
+	assign := body[0].(*ast.AssignStmt)
+	ifStmt := body[1].(*ast.IfStmt)
+	call := ifStmt.Body.List[0].(*ast.ExprStmt).X.(*ast.CallExpr)
+	cases := []struct {
+		line, column int
+		pos          token.Pos
+	}{
+		{1, 1, assign.Lhs[0].Pos()},
+		{1, 6, assign.Rhs[0].Pos()},
+		{1, 14, assign.Rhs[0].End()}, // "中文" is 6 bytes
+		{2, 1, ifStmt.Pos()},
+		{3, 2, call.Fun.Pos()}, // a tab is one column
+		{3, 10, call.Args[0].Pos()},
+	}
+	for _, c := range cases {
+		pos := fs.Pos(fset, "/foo/bar.gop", c.line, c.column)
+		if pos != c.pos {
+			t.Fatalf("Pos(%d, %d): got %v, want %v\n", c.line, c.column, fset.Position(pos), fset.Position(c.pos))
+		}
+		if p := fset.Position(pos); p.Line != c.line || p.Column != c.column {
+			t.Fatal("Position mismatch:", p, c.line, c.column)
+		}
+	}
+	for _, c := range [][2]int{{0, 1}, {1, 0}, {1, 15}, {6, 1}} {
+		if pos := fs.Pos(fset, "/foo/bar.gop", c[0], c[1]); pos != token.NoPos {
+			t.Fatal("Pos: out of the file?", c, fset.Position(pos))
+		}
+	}
+	if pos := fs.Pos(fset, "/foo/baz.gop", 1, 1); pos != token.NoPos {
+		t.Fatal("Pos: no file?", pos)
+	}
+}
+
 func TestRegisterFileType(t *testing.T) {
 	RegisterFileType(".gsh", ast.FileTypeSpx)
 	func() {
@@ -19,8 +19,12 @@ package parsertest
 import (
 	"os"
 	"path"
+	"sort"
+	"strings"
 	"syscall"
 	"time"
+
+	"github.com/goplus/gop/token"
 )
 
 // -----------------------------------------------------------------------------
@@ -88,6 +92,80 @@ func (p *MemFS) ReadFile(filename string) ([]byte, error) {
 	return nil, syscall.ENOENT
 }
 
+// WriteFile writes data to the file named by filename, creating it if it
+// doesn't exist. The file is added to the entries of its directory, so the
+// directory reads by ReadDir later include it.
+func (p *MemFS) WriteFile(filename string, data string) {
+	if p.files == nil {
+		p.files = make(map[string]string)
+	}
+	if p.dirs == nil {
+		p.dirs = make(map[string][]string)
+	}
+	if _, ok := p.files[filename]; !ok {
+		dir, fname := path.Split(filename)
+		dir = path.Clean(dir)
+		items := append(p.dirs[dir], fname)
+		sort.Strings(items)
+		p.dirs[dir] = items
+	}
+	p.files[filename] = data
+}
+
+// Remove removes the file named by filename, and removes it from the entries
+// of its directory.
+func (p *MemFS) Remove(filename string) error {
+	if _, ok := p.files[filename]; !ok {
+		return syscall.ENOENT
+	}
+	delete(p.files, filename)
+	dir, fname := path.Split(filename)
+	dir = path.Clean(dir)
+	items := p.dirs[dir]
+	for i, item := range items {
+		if item == fname {
+			p.dirs[dir] = append(items[:i:i], items[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Pos returns the position of the 1-based line and column in the file named by
+// filename, which is parsed with fset. As the scanner does (see
+// token.Position), column is counted in bytes, that is, a tab is one column,
+// and a multi-byte character is as many columns as its bytes in UTF-8. If the
+// file is parsed more than once, the last one in fset is used.
+//
+// Pos returns token.NoPos if the file isn't in p or fset, or if the line or
+// column is out of the file, where the column after the last character of a
+// line (that is, the position of the line end) is still in the file.
+func (p *MemFS) Pos(fset *token.FileSet, filename string, line, column int) token.Pos {
+	src, ok := p.files[filename]
+	if !ok || line < 1 || column < 1 {
+		return token.NoPos
+	}
+	var f *token.File
+	fset.Iterate(func(file *token.File) bool {
+		if file.Name() == filename {
+			f = file
+		}
+		return true
+	})
+	if f == nil || f.Size() != len(src) || line > f.LineCount() {
+		return token.NoPos
+	}
+	start := f.Offset(f.LineStart(line))
+	n := strings.IndexByte(src[start:], '\n')
+	if n < 0 {
+		n = len(src) - start
+	}
+	if column-1 > n {
+		return token.NoPos
+	}
+	return f.Pos(start + column - 1)
+}
+
 // Join joins any number of path elements into a single path,
 // separating them with slashes. Empty elements are ignored.
 // The result is Cleaned. However, if the argument list is
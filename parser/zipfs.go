@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package parser
+
+import (
+	"archive/zip"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+
+type zipDirInfo struct {
+	name string
+}
+
+func (p *zipDirInfo) Name() string       { return p.name }
+func (p *zipDirInfo) Size() int64        { return 0 }
+func (p *zipDirInfo) Mode() os.FileMode  { return fs.ModeDir | 0555 }
+func (p *zipDirInfo) ModTime() time.Time { return time.Time{} }
+func (p *zipDirInfo) IsDir() bool        { return true }
+func (p *zipDirInfo) Sys() interface{}   { return nil }
+
+type zipFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (p *zipFileInfo) Name() string {
+	return p.name
+}
+
+type zipFS struct {
+	files map[string]*zip.File              // file path => file
+	dirs  map[string]map[string]os.FileInfo // dir path => entries
+}
+
+// FromZip adapts a zip archive to a FileSystem, so that Go+ files can be
+// parsed from the archive without extracting it, eg.
+//
+//	pkgs, err := ParseFSDir(fset, FromZip(r), "foo", nil, 0)
+//
+// Paths are slash-separated and relative to the root of the archive ("." is
+// the root). Names of the archive entries are cleaned (eg. `./foo/bar.gop`
+// and `foo\bar.gop` are both `foo/bar.gop`), entries escaping the root are
+// ignored, and directories without their own entries in the archive are still
+// listed by ReadDir.
+func FromZip(r *zip.Reader) FileSystem {
+	p := &zipFS{
+		files: make(map[string]*zip.File),
+		dirs:  map[string]map[string]os.FileInfo{".": {}},
+	}
+	for _, f := range r.File {
+		name, ok := cleanZipPath(f.Name)
+		if !ok || name == "." {
+			continue
+		}
+		if strings.HasSuffix(f.Name, "/") || f.FileInfo().IsDir() {
+			p.addDir(name)
+			continue
+		}
+		dir, fname := path.Split(name)
+		p.addDir(path.Clean(dir))[fname] = &zipFileInfo{FileInfo: f.FileInfo(), name: fname}
+		p.files[name] = f
+	}
+	return p
+}
+
+// addDir adds the directory dir and its parent directories.
+func (p *zipFS) addDir(dir string) map[string]os.FileInfo {
+	entries, ok := p.dirs[dir]
+	if !ok {
+		entries = make(map[string]os.FileInfo)
+		p.dirs[dir] = entries
+		parent, name := path.Split(dir)
+		p.addDir(path.Clean(parent))[name] = &zipDirInfo{name: name}
+	}
+	return entries
+}
+
+// cleanZipPath cleans the name of an archive entry. It returns false if the
+// name escapes the root of the archive.
+func cleanZipPath(name string) (string, bool) {
+	name = path.Clean(strings.TrimLeft(strings.ReplaceAll(name, `\`, "/"), "/"))
+	return name, name != ".." && !strings.HasPrefix(name, "../")
+}
+
+func (p *zipFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	dir, _ := cleanZipPath(dirname)
+	entries, ok := p.dirs[dir]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: dirname, Err: fs.ErrNotExist}
+	}
+	fis := make([]os.FileInfo, 0, len(entries))
+	for _, fi := range entries {
+		fis = append(fis, fi)
+	}
+	sort.Slice(fis, func(i, j int) bool {
+		return fis[i].Name() < fis[j].Name()
+	})
+	return fis, nil
+}
+
+func (p *zipFS) ReadFile(filename string) ([]byte, error) {
+	name, _ := cleanZipPath(filename)
+	f, ok := p.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: filename, Err: fs.ErrNotExist}
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, pathError("read", filename, err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, pathError("read", filename, err)
+	}
+	return b, nil
+}
+
+func (p *zipFS) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// -----------------------------------------------------------------------------
@@ -184,3 +184,58 @@ func TestFromParse(t *testing.T) {
 		return nil
 	})
 }
+
+func formatNode(t *testing.T, fset *token.FileSet, node interface{}) string {
+	var dst bytes.Buffer
+	if err := format.Node(&dst, fset, node); err != nil {
+		t.Fatal("format.Node failed:", err)
+	}
+	return dst.String()
+}
+
+func TestNodeFragments(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "foo.gop", `func f() {
+	a := [x*x for x <- [1, 3, 5], x > 1]
+	for x <- a, x > 1 {
+		println x
+	}
+}
+`, 0)
+	if err != nil {
+		t.Fatal("ParseFile failed:", err)
+	}
+	body := f.Decls[0].(*ast.FuncDecl).Body.List
+	assign := body[0].(*ast.AssignStmt)
+	if ret := formatNode(t, fset, assign.Rhs[0]); ret != "[x*x for x <- [1, 3, 5], x > 1]" {
+		t.Fatal("ComprehensionExpr:", ret)
+	}
+	fors := assign.Rhs[0].(*ast.ComprehensionExpr).Fors
+	if ret := formatNode(t, fset, fors[0]); ret != "for x <- [1, 3, 5], x > 1" {
+		t.Fatal("ForPhrase:", ret)
+	}
+	if ret := formatNode(t, fset, body[1]); ret != "for x <- a, x > 1 {\n\tprintln x\n}" {
+		t.Fatal("ForPhraseStmt:", ret)
+	}
+}
+
+func TestNodeEntrypoint(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "Kai.spx", `var (
+	n int
+)
+
+onMsg "hi", => {
+	say "hi"
+}
+`, 0)
+	if err != nil {
+		t.Fatal("ParseFile failed:", err)
+	}
+	if ret := formatNode(t, fset, f.Decls[0]); ret != "var (\n\tn int\n)" {
+		t.Fatal("class fields:", ret)
+	}
+	if ret := formatNode(t, fset, f.Decls[1]); ret != "onMsg \"hi\", => {\n\tsay \"hi\"\n}" {
+		t.Fatal("entrypoint:", ret)
+	}
+}
@@ -1080,6 +1080,9 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		p.print(token.RARROW, blank)
 		p.block(x.Body, 1)
 
+	case *ast.ForPhrase:
+		p.listForPhrase(x.For, []*ast.ForPhrase{x}, depth, x.End())
+
 	case *ast.RangeExpr:
 		if x.First != nil {
 			p.expr(x.First)
@@ -1139,6 +1139,8 @@ func (p *printer) printNode(node interface{}) error {
 
 	// format node
 	switch n := node.(type) {
+	case *ast.ForPhraseStmt: // it's also an ast.Expr, as *ast.ForPhrase is embedded
+		p.stmt(n, false)
 	case ast.Expr:
 		p.expr(n)
 	case ast.Stmt:
@@ -1149,6 +1151,9 @@ func (p *printer) printNode(node interface{}) error {
 		}
 		p.stmt(n, false)
 	case ast.Decl:
+		if fn, ok := n.(*ast.FuncDecl); ok && isEntrypoint(fn) {
+			p.unnamedFuncName = fn.Name.Name
+		}
 		p.decl(n)
 	case ast.Spec:
 		p.spec(n, 1, false)
@@ -1175,6 +1180,13 @@ unsupported:
 	return fmt.Errorf("go/printer: unsupported node type %T", node)
 }
 
+// isEntrypoint reports whether fn is the entrypoint func synthesized by the
+// parser for statements of a file without entrypoint (see ast.File.NoEntrypoint).
+func isEntrypoint(fn *ast.FuncDecl) bool {
+	return fn.Recv == nil && fn.Name.Name == "main" && fn.Type.Func == token.NoPos &&
+		fn.Body != nil && fn.Body.Lbrace == token.NoPos && len(fn.Body.List) > 0
+}
+
 // ----------------------------------------------------------------------------
 // Trimmer
 
@@ -17,8 +17,13 @@
 package scanner
 
 import (
+	"encoding/json"
+	"fmt"
 	"go/scanner"
+	"go/token"
 	"io"
+	"os"
+	"unicode/utf8"
 )
 
 // Error is an alias of go/scanner.Error
@@ -29,10 +34,116 @@ type Error = scanner.Error
 //
 type ErrorList = scanner.ErrorList
 
+// A PrintMode value is a set of flags (or 0). They control how
+// PrintErrorMode prints positions of errors.
+//
+type PrintMode uint
+
+const (
+	NoColumns PrintMode = 1 << iota // print positions as file:line, without columns
+)
+
 // PrintError is a utility function that prints a list of errors to w,
 // one error per line, if the err parameter is an ErrorList. Otherwise
 // it prints the err string.
 //
+// Positions are printed as file:line:column, like the Go toolchain does.
+// See PrintErrorMode for how columns are computed.
+//
 func PrintError(w io.Writer, err error) {
-	scanner.PrintError(w, err)
+	PrintErrorMode(w, err, 0)
+}
+
+// PrintErrorMode is like PrintError, but positions are printed according to
+// mode. Unless mode has the NoColumns flag, the column of a position is the
+// number of runes (not bytes) before it in the line plus 1, so it's the
+// same for a line containing multi-byte UTF-8 characters as seen by editors.
+// A tab counts as one column, as it does in token.Position. Columns are
+// computed from the source files read, see PrintErrorSrc.
+//
+func PrintErrorMode(w io.Writer, err error, mode PrintMode) {
+	PrintErrorSrc(w, err, mode, readSource)
+}
+
+// PrintErrorSrc is like PrintErrorMode, but the source of a file to compute
+// columns from is got by calling src with its name (eg. the source the caller
+// parsed the file from), rather than by reading the file, which may have
+// changed since it was parsed. If src returns nil for a file, the byte
+// columns of its positions are printed.
+//
+func PrintErrorSrc(w io.Writer, err error, mode PrintMode, src func(filename string) []byte) {
+	list, ok := err.(ErrorList)
+	if !ok {
+		if err != nil {
+			fmt.Fprintf(w, "%s\n", err)
+		}
+		return
+	}
+	srcs := make(map[string][]byte)
+	for _, e := range list {
+		pos := e.Pos
+		if mode&NoColumns != 0 {
+			pos.Column = 0
+		} else if pos.Filename != "" {
+			data, ok := srcs[pos.Filename]
+			if !ok {
+				data = src(pos.Filename)
+				srcs[pos.Filename] = data
+			}
+			pos.Column = runeColumn(pos, data)
+		}
+		fmt.Fprintf(w, "%s\n", &Error{Pos: pos, Msg: e.Msg})
+	}
+}
+
+func readSource(filename string) []byte {
+	data, _ := os.ReadFile(filename)
+	return data
+}
+
+// runeColumn returns the column of pos counted in runes, where src is the
+// source of the file pos is in. If pos is out of src (eg. src is nil), its
+// byte column is returned.
+//
+func runeColumn(pos token.Position, src []byte) int {
+	if pos.Column <= 1 {
+		return pos.Column
+	}
+	start := pos.Offset - (pos.Column - 1) // offset of the line start
+	if start < 0 || pos.Offset > len(src) {
+		return pos.Column
+	}
+	return utf8.RuneCount(src[start:pos.Offset]) + 1
+}
+
+// jsonError is the JSON form of an Error written by WriteErrorsJSON.
+//
+type jsonError struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// WriteErrorsJSON writes list to w as a JSON array, one object with file,
+// line, column, severity and message fields per error. Errors are sorted by
+// position (see ErrorList.Sort) without changing list, so the output is
+// stable for the same errors. The severity of all errors is "error".
+//
+func WriteErrorsJSON(w io.Writer, list ErrorList) error {
+	sorted := make(ErrorList, len(list))
+	copy(sorted, list)
+	sorted.Sort()
+	errs := make([]jsonError, len(sorted))
+	for i, e := range sorted {
+		errs[i] = jsonError{
+			File:     e.Pos.Filename,
+			Line:     e.Pos.Line,
+			Column:   e.Pos.Column,
+			Severity: "error",
+			Message:  e.Msg,
+		}
+	}
+	return json.NewEncoder(w).Encode(errs)
 }
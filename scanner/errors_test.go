@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scanner
+
+import (
+	"bytes"
+	"errors"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrintError(t *testing.T) {
+	src := []byte("x := \"世界\" + y\n\tz := 1 +\n")
+	var list ErrorList
+	list.Add(token.Position{Filename: "a.gop", Offset: 16, Line: 1, Column: 17}, "undefined: y")
+	list.Add(token.Position{Filename: "a.gop", Offset: 26, Line: 2, Column: 10}, "expected operand")
+	list.Add(token.Position{Filename: "a.gop", Offset: 0, Line: 1, Column: 1}, "x declared but not used")
+	list.Add(token.Position{Filename: "b.gop", Offset: 4, Line: 1, Column: 5}, "expected ';'")
+	sources := map[string][]byte{"a.gop": src}
+	var buf bytes.Buffer
+	PrintErrorSrc(&buf, list, 0, func(filename string) []byte {
+		return sources[filename]
+	})
+	expected := `a.gop:1:13: undefined: y
+a.gop:2:10: expected operand
+a.gop:1:1: x declared but not used
+b.gop:1:5: expected ';'
+`
+	if buf.String() != expected { // columns count runes, and fall back to bytes without source
+		t.Fatal("PrintErrorSrc:", buf.String())
+	}
+
+	buf.Reset()
+	PrintErrorMode(&buf, list[:1], NoColumns)
+	if buf.String() != "a.gop:1: undefined: y\n" {
+		t.Fatal("PrintErrorMode(NoColumns):", buf.String())
+	}
+
+	file := filepath.Join(t.TempDir(), "a.gop")
+	if err := os.WriteFile(file, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	list[0].Pos.Filename = file
+	buf.Reset()
+	PrintError(&buf, list[:1])
+	if buf.String() != file+":1:13: undefined: y\n" {
+		t.Fatal("PrintError:", buf.String())
+	}
+
+	buf.Reset()
+	PrintError(&buf, errors.New("not a list"))
+	PrintError(&buf, nil)
+	if buf.String() != "not a list\n" {
+		t.Fatal("PrintError:", buf.String())
+	}
+}
+
+func TestRuneColumn(t *testing.T) {
+	src := []byte("ab\n\t世界x")
+	cases := []struct {
+		offset, column, expected int
+	}{
+		{3, 1, 1},    // line start
+		{4, 2, 2},    // a tab counts as one column
+		{10, 8, 4},   // after 世界
+		{20, 18, 18}, // out of src
+	}
+	for _, c := range cases {
+		pos := token.Position{Filename: "a.gop", Offset: c.offset, Line: 2, Column: c.column}
+		if v := runeColumn(pos, src); v != c.expected {
+			t.Fatalf("runeColumn(%d:%d): %d", c.offset, c.column, v)
+		}
+	}
+	if v := runeColumn(token.Position{Offset: 10, Column: 8}, nil); v != 8 {
+		t.Fatal("runeColumn without source:", v)
+	}
+}
+
+func TestWriteErrorsJSON(t *testing.T) {
+	var list ErrorList
+	list.Add(token.Position{Filename: "b.gop", Offset: 3, Line: 1, Column: 4}, "expected operand")
+	list.Add(token.Position{Filename: "a.gop", Offset: 20, Line: 2, Column: 5}, "undefined: x")
+	list.Add(token.Position{Filename: "a.gop", Offset: 2, Line: 1, Column: 3}, "illegal character U+0023 '#'")
+	var buf bytes.Buffer
+	if err := WriteErrorsJSON(&buf, list); err != nil {
+		t.Fatal("WriteErrorsJSON:", err)
+	}
+	expected := `[{"file":"a.gop","line":1,"column":3,"severity":"error","message":"illegal character U+0023 '#'"},` +
+		`{"file":"a.gop","line":2,"column":5,"severity":"error","message":"undefined: x"},` +
+		`{"file":"b.gop","line":1,"column":4,"severity":"error","message":"expected operand"}]` + "\n"
+	if buf.String() != expected {
+		t.Fatal("WriteErrorsJSON:", buf.String())
+	}
+	if list[0].Pos.Filename != "b.gop" { // list isn't sorted in place
+		t.Fatal("WriteErrorsJSON changed list:", list)
+	}
+
+	buf.Reset()
+	if err := WriteErrorsJSON(&buf, nil); err != nil || buf.String() != "[]\n" {
+		t.Fatal("WriteErrorsJSON(nil):", buf.String(), err)
+	}
+}
@@ -57,6 +57,8 @@ type Scanner struct {
 	rdOffset   int  // reading offset (position after current character)
 	lineOffset int  // current line offset
 	insertSemi bool // insert a semicolon before next newline
+	errOffset  int  // offset of the last error reported, used by RecoverErrors
+	chErr      bool // an error is reported for current character ch
 
 	// public state - ok to modify
 	ErrorCount int // number of errors encountered
@@ -75,6 +77,7 @@ func (s *Scanner) next() {
 			s.file.AddLine(s.offset)
 		}
 		r, w := rune(s.src[s.rdOffset]), 1
+		errCount := s.ErrorCount
 		switch {
 		case r == 0:
 			s.error(s.offset, "illegal character NUL")
@@ -89,6 +92,7 @@ func (s *Scanner) next() {
 		}
 		s.rdOffset += w
 		s.ch = r
+		s.chErr = s.ErrorCount != errCount
 	} else {
 		s.offset = len(s.src)
 		if s.ch == '\n' {
@@ -96,6 +100,7 @@ func (s *Scanner) next() {
 			s.file.AddLine(s.offset)
 		}
 		s.ch = -1 // eof
+		s.chErr = false
 	}
 }
 
@@ -115,8 +120,12 @@ type Mode uint
 
 const (
 	// ScanComments - return comments as COMMENT tokens
-	ScanComments    Mode = 1 << iota
-	dontInsertSemis      // do not automatically insert semicolons - for testing only
+	ScanComments Mode = 1 << iota
+	// RecoverErrors - return a token having syntax errors as an ILLEGAL token,
+	// whose literal string is the source text of the token. The error handler
+	// is still called, and scanning goes on after the token.
+	RecoverErrors
+	dontInsertSemis // do not automatically insert semicolons - for testing only
 )
 
 // Init prepares the scanner s to tokenize the text src by setting the
@@ -150,6 +159,8 @@ func (s *Scanner) Init(file *token.File, src []byte, err ErrorHandler, mode Mode
 	s.rdOffset = 0
 	s.lineOffset = 0
 	s.insertSemi = false
+	s.errOffset = -1
+	s.chErr = false
 	s.ErrorCount = 0
 
 	s.next()
@@ -162,6 +173,7 @@ func (s *Scanner) error(offs int, msg string) {
 	if s.err != nil {
 		s.err(s.file.Position(s.file.Pos(offs)), msg)
 	}
+	s.errOffset = offs
 	s.ErrorCount++
 }
 
@@ -239,12 +251,12 @@ exit:
 
 	// interpret line directives
 	// (//line directives must start at the beginning of the current line)
-	if next >= 0 /* implies valid comment */ && (lit[1] == '*' || offs == s.lineOffset) && bytes.HasPrefix(lit[2:], prefix) {
+	if next >= 0 /* implies valid comment */ && len(lit) > 1 /* not an empty # comment */ && (lit[1] == '*' || offs == s.lineOffset) && bytes.HasPrefix(lit[2:], prefix) {
 		s.updateLineInfo(next, offs, lit)
 	}
 
 	if numCR > 0 {
-		lit = stripCR(lit, lit[1] == '*')
+		lit = stripCR(lit, len(lit) > 1 && lit[1] == '*')
 	}
 
 	return string(lit)
@@ -989,6 +1001,13 @@ scanAgain:
 	if s.mode&dontInsertSemis == 0 {
 		s.insertSemi = insertSemi
 	}
+	if s.mode&RecoverErrors != 0 && tok != token.EOF {
+		// an error at s.offset is for the token, unless it's for the next character
+		offs := s.file.Offset(pos)
+		if s.errOffset >= offs && (s.errOffset < s.offset || s.errOffset == s.offset && !s.chErr) {
+			tok, lit = token.ILLEGAL, string(s.src[offs:s.offset])
+		}
+	}
 
 	return
 }
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scanner
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/goplus/gop/token"
+)
+
+func scanAll(src string, mode Mode) (toks []string, errs []string) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("a.gop", -1, len(src))
+	var s Scanner
+	s.Init(file, []byte(src), func(pos token.Position, msg string) {
+		errs = append(errs, fmt.Sprintf("%v: %s", pos, msg))
+	}, mode)
+	for {
+		pos, tok, lit := s.Scan()
+		toks = append(toks, fmt.Sprintf("%v %v %q", file.Position(pos), tok, lit))
+		if tok == token.EOF {
+			return
+		}
+	}
+}
+
+func TestRecoverErrors(t *testing.T) {
+	src := "a := 0x + 1\nb := 'ab'\nc := \"x\nd := 1\ne := ⊙\n"
+	toks, errs := scanAll(src, RecoverErrors)
+	expected := `a.gop:1:1 IDENT "a"
+a.gop:1:3 := ""
+a.gop:1:6 ILLEGAL "0x"
+a.gop:1:9 + ""
+a.gop:1:11 INT "1"
+a.gop:1:12 ; "\n"
+a.gop:2:1 IDENT "b"
+a.gop:2:3 := ""
+a.gop:2:6 ILLEGAL "'ab'"
+a.gop:2:10 ; "\n"
+a.gop:3:1 IDENT "c"
+a.gop:3:3 := ""
+a.gop:3:6 ILLEGAL "\"x"
+a.gop:3:8 ; "\n"
+a.gop:4:1 IDENT "d"
+a.gop:4:3 := ""
+a.gop:4:6 INT "1"
+a.gop:4:7 ; "\n"
+a.gop:5:1 IDENT "e"
+a.gop:5:3 := ""
+a.gop:5:6 ILLEGAL "⊙"
+a.gop:5:10 EOF ""`
+	if v := strings.Join(toks, "\n"); v != expected {
+		t.Fatal("Scan with RecoverErrors:\n", v)
+	}
+	expectedErrs := `a.gop:1:8: hexadecimal literal has no digits
+a.gop:2:6: illegal rune literal
+a.gop:3:6: string literal not terminated
+a.gop:5:6: illegal character U+2299 '⊙'`
+	if v := strings.Join(errs, "\n"); v != expectedErrs {
+		t.Fatal("Scan with RecoverErrors: errors\n", v)
+	}
+
+	toks, errs = scanAll(src, 0) // tokens are returned as they are without RecoverErrors
+	if toks[2] != `a.gop:1:6 INT "0x"` || toks[8] != `a.gop:2:6 CHAR "'ab'"` || len(errs) != 4 {
+		t.Fatal("Scan without RecoverErrors:", toks, errs)
+	}
+}
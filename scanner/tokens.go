@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scanner
+
+import (
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// A TokenInfo is a token returned by Tokens.
+type TokenInfo struct {
+	Pos token.Position // position of the token, without a filename
+	Tok token.Token    // kind of the token
+	Lit string         // literal string of the token, as returned by Scanner.Scan
+}
+
+// Tokens scans all tokens of src, including comments, and returns them in
+// order, ending with the token.EOF one. Syntax errors don't stop scanning:
+// a token having syntax errors is returned as a token.ILLEGAL one (see
+// RecoverErrors), and the errors are returned sorted by positions.
+func Tokens(src []byte) (tokens []TokenInfo, errs ErrorList) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s Scanner
+	s.Init(file, src, errs.Add, ScanComments|RecoverErrors)
+	for {
+		pos, tok, lit := s.Scan()
+		tokens = append(tokens, TokenInfo{Pos: file.Position(pos), Tok: tok, Lit: lit})
+		if tok == token.EOF {
+			break
+		}
+	}
+	errs.Sort()
+	return
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scanner
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/goplus/gop/token"
+)
+
+func TestTokens(t *testing.T) {
+	src := "// hi\nx := [a*2 for a <- [1, 2]] ?: 0x\n"
+	tokens, errs := Tokens([]byte(src))
+	var buf strings.Builder
+	for _, v := range tokens {
+		fmt.Fprintf(&buf, "%v %v %q\n", v.Pos, v.Tok, v.Lit)
+	}
+	expected := `1:1 COMMENT "// hi"
+2:1 IDENT "x"
+2:3 := ""
+2:6 [ ""
+2:7 IDENT "a"
+2:8 * ""
+2:9 INT "2"
+2:11 for "for"
+2:15 IDENT "a"
+2:17 <- ""
+2:20 [ ""
+2:21 INT "1"
+2:22 , ""
+2:24 INT "2"
+2:25 ] ""
+2:26 ] ""
+2:28 ? ""
+2:29 : ""
+2:31 ILLEGAL "0x"
+2:33 ; "\n"
+2:34 EOF ""
+`
+	if buf.String() != expected {
+		t.Fatal("Tokens:\n", buf.String())
+	}
+	if len(errs) != 1 || errs[0].Error() != "2:33: hexadecimal literal has no digits" {
+		t.Fatal("Tokens: errors", errs)
+	}
+
+	tokens, errs = Tokens(nil)
+	if len(tokens) != 1 || tokens[0].Tok != token.EOF || tokens[0].Pos.Line != 1 || errs != nil {
+		t.Fatal("Tokens(nil):", tokens, errs)
+	}
+}
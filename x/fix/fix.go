@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fix implements the rules of ``gop fix'', which migrate Go+ code
+// from deprecated syntax to the current one.
+package fix
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/format"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// A Rule is a named migration of Go+ code.
+type Rule struct {
+	Name string // eg. "lambda"
+	Desc string // one-line description, shown by gop help fix
+
+	// Fix rewrites f in place, and reports whether f is changed. It should
+	// keep the comments of f (in f.Comments) where they are.
+	Fix func(f *ast.File) bool
+}
+
+var (
+	registered = map[string]*Rule{}
+)
+
+// Register registers the rule r. It panics if a rule of the same name is
+// registered already.
+func Register(r *Rule) {
+	if r.Name == "" || r.Fix == nil {
+		panic("fix.Register: invalid rule")
+	}
+	if _, ok := registered[r.Name]; ok {
+		panic("fix.Register: rule exists - " + r.Name)
+	}
+	registered[r.Name] = r
+}
+
+// Lookup returns the registered rule named name, or nil if it isn't found.
+func Lookup(name string) *Rule {
+	return registered[name]
+}
+
+// Rules returns the registered rules, sorted by names.
+func Rules() []*Rule {
+	rules := make([]*Rule, 0, len(registered))
+	for _, r := range registered {
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Name < rules[j].Name
+	})
+	return rules
+}
+
+// File applies rules (all the registered ones if rules is empty) to f in
+// order, and returns the names of the rules changing it.
+func File(f *ast.File, rules ...*Rule) (fixed []string) {
+	if len(rules) == 0 {
+		rules = Rules()
+	}
+	for _, r := range rules {
+		if r.Fix(f) {
+			fixed = append(fixed, r.Name)
+		}
+	}
+	return
+}
+
+// Source applies rules to src like File, and returns the formatted result. If
+// no rule changes src, ret is src itself, unformatted.
+func Source(src []byte, filename string, rules ...*Rule) (ret []byte, fixed []string, err error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return
+	}
+	if fixed = File(f, rules...); fixed == nil {
+		return src, nil, nil
+	}
+	var buf bytes.Buffer
+	if err = format.Node(&buf, fset, f); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), fixed, nil
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fix
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goplus/gop/ast"
+)
+
+// -----------------------------------------------------------------------------
+
+func testFix(t *testing.T, src, expected string, rules ...*Rule) {
+	t.Helper()
+	ret, fixed, err := Source([]byte(src), "foo.gop", rules...)
+	if err != nil {
+		t.Fatal("Source:", err)
+	}
+	if string(ret) != expected {
+		t.Fatalf("Source (fixed %v):\n%s\nExpected:\n%s", fixed, ret, expected)
+	}
+}
+
+func TestLambda(t *testing.T) {
+	testFix(t, `foo(() => "Hi") // say hi
+foo((x) => x * x)
+foo((x, y) => x + y)
+
+// print
+foo((x) => {
+	println(x) // x
+})
+foo(() => {
+	println("Hi")
+})
+`, `foo(=> "Hi") // say hi
+foo(x => x * x)
+foo((x, y) => x + y)
+
+// print
+foo(x => {
+	println(x) // x
+})
+foo(=> {
+	println("Hi")
+})
+`, Lookup("lambda"))
+}
+
+func TestUnchanged(t *testing.T) {
+	src := "foo(x => x * x)\nfoo((x, y) => x + y)\n"
+	ret, fixed, err := Source([]byte(src), "foo.gop")
+	if err != nil || fixed != nil || string(ret) != src {
+		t.Fatal("Source:", string(ret), fixed, err)
+	}
+	if _, _, err = Source([]byte("foo(("), "foo.gop"); err == nil {
+		t.Fatal("Source: no error?")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if r := Lookup("lambda"); r == nil || r.Desc == "" {
+		t.Fatal("Lookup lambda:", r)
+	}
+	if Lookup("unknown") != nil {
+		t.Fatal("Lookup unknown: found?")
+	}
+	var names []string
+	for _, r := range Rules() {
+		names = append(names, r.Name)
+	}
+	if !strings.Contains(strings.Join(names, ","), "lambda") {
+		t.Fatal("Rules:", names)
+	}
+	defer func() {
+		if e := recover(); e != "fix.Register: rule exists - lambda" {
+			t.Fatal("Register:", e)
+		}
+	}()
+	Register(&Rule{Name: "lambda", Fix: func(f *ast.File) bool { return false }})
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fix
+
+import (
+	"github.com/goplus/gop/ast"
+)
+
+// -----------------------------------------------------------------------------
+
+func init() {
+	Register(&Rule{
+		Name: "lambda",
+		Desc: "drop the parentheses around lambda parameters unless there are two or more: (x) => x * x to x => x * x, and () => 1 to => 1",
+		Fix:  fixLambda,
+	})
+}
+
+// fixLambda rewrites lambdas to the forms documented in ast.LambdaExpr: a
+// parameter list is parenthesized only if it has two or more parameters.
+func fixLambda(f *ast.File) (changed bool) {
+	ast.Inspect(f, func(node ast.Node) bool {
+		switch v := node.(type) {
+		case *ast.LambdaExpr:
+			if v.LhsHasParen && len(v.Lhs) < 2 {
+				v.Lhs, v.LhsHasParen = lambdaParams(v.Lhs), false
+				changed = true
+			}
+		case *ast.LambdaExpr2:
+			if v.LhsHasParen && len(v.Lhs) < 2 {
+				v.Lhs, v.LhsHasParen = lambdaParams(v.Lhs), false
+				changed = true
+			}
+		}
+		return true
+	})
+	return
+}
+
+// lambdaParams returns the parameters lhs of a lambda without parentheses,
+// which are nil if there is none, as the printer expects.
+func lambdaParams(lhs []*ast.Ident) []*ast.Ident {
+	if len(lhs) == 0 {
+		return nil
+	}
+	return lhs
+}
+
+// -----------------------------------------------------------------------------
@@ -112,6 +112,20 @@ func deleteSpec(specs []ast.Spec, v ast.Spec) []ast.Spec {
 	return specs
 }
 
+// deleteComments deletes the doc comment and the comments in [pos, end) of a
+// deleted node, or they would be printed as floating comments.
+func deleteComments(comments []*ast.CommentGroup, doc *ast.CommentGroup, pos, end token.Pos) []*ast.CommentGroup {
+	n := 0
+	for _, c := range comments {
+		if c == doc || (c.Pos() >= pos && c.End() <= end) {
+			continue
+		}
+		comments[n] = c
+		n++
+	}
+	return comments[:n]
+}
+
 func startWithLowerCase(v *ast.Ident) {
 	if c := v.Name[0]; c >= 'A' && c <= 'Z' {
 		v.Name = string(c+('a'-'A')) + v.Name[1:]
@@ -202,8 +216,13 @@ func formatFile(file *ast.File) {
 		if imp.pkgPath == "fmt" && !imp.isUsed {
 			if len(imp.decl.Specs) == 1 {
 				file.Decls = deleteDecl(file.Decls, imp.decl)
+				file.Comments = deleteComments(file.Comments, imp.decl.Doc, imp.decl.Pos(), imp.decl.End())
 			} else {
 				imp.decl.Specs = deleteSpec(imp.decl.Specs, imp.spec)
+				file.Comments = deleteComments(file.Comments, imp.spec.Doc, imp.spec.Pos(), imp.spec.End())
+			}
+			if imp.spec.Comment != nil {
+				file.Comments = deleteComments(file.Comments, imp.spec.Comment, token.NoPos, token.NoPos)
 			}
 		}
 	}
@@ -478,3 +478,72 @@ func f() {
 }
 `)
 }
+
+func testFormatTwice(t *testing.T, name string, src, expect string) {
+	t.Run(name, func(t *testing.T) {
+		result, err := GopstyleSource([]byte(src), name)
+		if err != nil {
+			t.Fatal("format.Source failed:", err)
+		}
+		if ret := string(result); ret != expect {
+			t.Fatalf("%s => Expect:\n%s\n=> Got:\n%s\n", name, expect, ret)
+		}
+		result2, err := GopstyleSource(result, name)
+		if err != nil {
+			t.Fatal("format.Source failed:", err)
+		}
+		if ret := string(result2); ret != expect {
+			t.Fatalf("%s => not idempotent:\n%s\n=> Got:\n%s\n", name, expect, ret)
+		}
+	})
+}
+
+func TestClassFileComments(t *testing.T) {
+	src := `import "fmt"
+
+// Speed is the speed.
+const Speed = 1
+
+// onMsg handles messages.
+func onMsg(msg string) {
+	// say hi
+	fmt.Println("Hi")
+}
+
+// entry
+println "hi"
+`
+	expect := `// Speed is the speed.
+const Speed = 1
+
+// onMsg handles messages.
+func onMsg(msg string) {
+	// say hi
+	println "Hi"
+}
+
+// entry
+println "hi"
+`
+	testFormatTwice(t, "Kai.spx", src, expect)
+	testFormatTwice(t, "index.gmx", src, expect)
+}
+
+func TestDeleteFmtImportComments(t *testing.T) {
+	testFormatTwice(t, "Kai.spx", `import (
+	// doc of fmt
+	"fmt" // comment of fmt
+)
+
+// doc of Foo
+const Foo = 1
+
+func main() {
+	fmt.Println(Foo)
+}
+`, `// doc of Foo
+const Foo = 1
+
+println Foo
+`)
+}
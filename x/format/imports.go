@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package format
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/format"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// ImportGrouping specifies how GroupImportsSource groups imports.
+type ImportGrouping int
+
+const (
+	// ImportsKept keeps imports as they are written.
+	ImportsKept ImportGrouping = iota
+	// ImportsSingle puts all imports in a single group, sorted by path.
+	ImportsSingle
+	// ImportsStd puts imports of the standard library, third-party ones, and
+	// local ones (see ImportOptions.LocalPrefix) in separate groups, in this
+	// order, each sorted by path, as goimports does.
+	ImportsStd
+)
+
+var importGroupings = []string{"keep", "single", "std"}
+
+func (p ImportGrouping) String() string {
+	if p >= 0 && int(p) < len(importGroupings) {
+		return importGroupings[p]
+	}
+	return "ImportGrouping(" + strconv.Itoa(int(p)) + ")"
+}
+
+// ErrInvalidImportGrouping is returned by ParseImportGrouping for an unknown
+// name.
+var ErrInvalidImportGrouping = errors.New("invalid import grouping, should be keep, single or std")
+
+// ParseImportGrouping returns the ImportGrouping named name: keep, single or
+// std (see ImportGrouping.String).
+func ParseImportGrouping(name string) (ImportGrouping, error) {
+	for i, v := range importGroupings {
+		if v == name {
+			return ImportGrouping(i), nil
+		}
+	}
+	return 0, ErrInvalidImportGrouping
+}
+
+// ImportOptions specifies how GroupImportsSource regroups imports.
+type ImportOptions struct {
+	Grouping ImportGrouping
+
+	// LocalPrefix is a comma-separated list of import path prefixes of local
+	// packages, like the -local flag of goimports. Local imports are put
+	// after third-party ones in ImportsStd grouping.
+	LocalPrefix string
+}
+
+// GroupImportsSource formats src like format.Source, after regrouping the
+// imports of each parenthesized import declaration by opts. Comments before
+// an import (up to the previous one) and on its line move with it, and the
+// ones at the end of the declaration are kept there. Groups are separated by
+// blank lines, and regrouping the result again changes nothing.
+func GroupImportsSource(src []byte, opts *ImportOptions, filename ...string) (ret []byte, err error) {
+	var fname string
+	if filename != nil {
+		fname = filename[0]
+	}
+	if opts.Grouping == ImportsKept {
+		return format.Source(src, fname)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, fname, src, parser.ParseComments|parser.ImportsOnly)
+	if err != nil {
+		return
+	}
+	var b strings.Builder
+	last := 0
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT || !d.Lparen.IsValid() || len(d.Specs) == 0 {
+			continue
+		}
+		file := fset.File(d.Pos()) // f.Pos() is invalid without a package clause
+		start, end := file.Offset(d.Lparen)+1, file.Offset(d.Rparen)
+		b.Write(src[last:start])
+		b.WriteString(opts.regroup(file, src[start:end], start, d.Specs))
+		last = end
+	}
+	b.Write(src[last:])
+	return format.Source([]byte(b.String()), fname)
+}
+
+// importChunk is the source of an import spec, with the comments before it.
+type importChunk struct {
+	path, name string
+	text       string
+}
+
+// regroup returns the source of the import specs between the parentheses of
+// an import declaration, regrouped. body is the source between them, which
+// starts at the offset base of file.
+func (p *ImportOptions) regroup(file *token.File, body []byte, base int, specs []ast.Spec) string {
+	groups := make([][]importChunk, 3) // standard library, third-party, local
+	from := 0
+	for _, spec := range specs {
+		spec := spec.(*ast.ImportSpec)
+		to := file.Offset(spec.End()) - base
+		if spec.Comment != nil {
+			to = file.Offset(spec.Comment.End()) - base
+		}
+		chunk := importChunk{text: trimChunk(body[from:to])}
+		chunk.path, _ = strconv.Unquote(spec.Path.Value)
+		if spec.Name != nil {
+			chunk.name = spec.Name.Name
+		}
+		g := p.group(chunk.path)
+		groups[g] = append(groups[g], chunk)
+		from = to
+	}
+	var b strings.Builder
+	b.WriteByte('\n')
+	for _, chunks := range groups {
+		if len(chunks) == 0 {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteByte('\n')
+		}
+		sort.SliceStable(chunks, func(i, j int) bool {
+			if chunks[i].path != chunks[j].path {
+				return chunks[i].path < chunks[j].path
+			}
+			return chunks[i].name < chunks[j].name
+		})
+		for i, chunk := range chunks {
+			if i > 0 && chunk == chunks[i-1] { // a duplicate import
+				continue
+			}
+			b.WriteString(chunk.text)
+			b.WriteByte('\n')
+		}
+	}
+	if tail := trimChunk(body[from:]); tail != "" {
+		b.WriteString(tail)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// group returns the group of an import of path: 0 for the standard library,
+// 1 for third-party, and 2 for local. All imports are in group 0 in
+// ImportsSingle grouping.
+func (p *ImportOptions) group(path string) int {
+	if p.Grouping != ImportsStd {
+		return 0
+	}
+	if p.LocalPrefix != "" {
+		for _, prefix := range strings.Split(p.LocalPrefix, ",") {
+			if prefix = strings.TrimSpace(prefix); prefix == "" {
+				continue
+			}
+			if strings.HasPrefix(path, prefix) || strings.TrimSuffix(prefix, "/") == path {
+				return 2
+			}
+		}
+	}
+	if elem := strings.SplitN(path, "/", 2)[0]; !strings.Contains(elem, ".") {
+		return 0
+	}
+	return 1
+}
+
+func trimChunk(b []byte) string {
+	return strings.Trim(string(b), " \t\r\n;")
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package format
+
+import (
+	"testing"
+
+	"github.com/goplus/gop/format"
+)
+
+func testGroupImports(t *testing.T, name string, opts *ImportOptions, src, expect string) {
+	t.Run(name, func(t *testing.T) {
+		result, err := GroupImportsSource([]byte(src), opts, name)
+		if err != nil {
+			t.Fatal("GroupImportsSource failed:", err)
+		}
+		if ret := string(result); ret != expect {
+			t.Fatalf("%s => Expect:\n%s\n=> Got:\n%s\n", name, expect, ret)
+		}
+		result, err = GroupImportsSource(result, opts, name)
+		if err != nil {
+			t.Fatal("GroupImportsSource failed:", err)
+		}
+		if ret := string(result); ret != expect {
+			t.Fatalf("%s => Not idempotent:\n%s\n", name, ret)
+		}
+	})
+}
+
+// -----------------------------------------------------------------------------
+
+const importsSrc = `import (
+	"github.com/goplus/gop/ast"
+	"strings" // for Title
+	"example.com/foo/bar"
+
+	// formatting
+	"fmt"
+	x "example.com/foo"
+	"github.com/goplus/gox"
+	"fmt"
+
+	// end of imports
+)
+
+import "os"
+
+println strings.Title(fmt.Sprint(ast.File{}, gox.Package{}, bar.X, x.Y, os.Args))
+`
+
+func TestGroupImports(t *testing.T) {
+	kept, err := format.Source([]byte(importsSrc))
+	if err != nil {
+		t.Fatal("format.Source:", err)
+	}
+	testGroupImports(t, "keep", &ImportOptions{}, importsSrc, string(kept))
+	testGroupImports(t, "single", &ImportOptions{Grouping: ImportsSingle}, importsSrc, `import (
+	x "example.com/foo"
+	"example.com/foo/bar"
+	// formatting
+	"fmt"
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gox"
+	"strings" // for Title
+	// end of imports
+)
+
+import "os"
+
+println strings.Title(fmt.Sprint(ast.File{}, gox.Package{}, bar.X, x.Y, os.Args))
+`)
+	testGroupImports(t, "std", &ImportOptions{Grouping: ImportsStd}, importsSrc, `import (
+	// formatting
+	"fmt"
+	"strings" // for Title
+
+	x "example.com/foo"
+	"example.com/foo/bar"
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gox"
+	// end of imports
+)
+
+import "os"
+
+println strings.Title(fmt.Sprint(ast.File{}, gox.Package{}, bar.X, x.Y, os.Args))
+`)
+	testGroupImports(t, "local", &ImportOptions{Grouping: ImportsStd, LocalPrefix: "github.com/goplus/, example.com/foo"}, importsSrc, `import (
+	// formatting
+	"fmt"
+	"strings" // for Title
+
+	x "example.com/foo"
+	"example.com/foo/bar"
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gox"
+	// end of imports
+)
+
+import "os"
+
+println strings.Title(fmt.Sprint(ast.File{}, gox.Package{}, bar.X, x.Y, os.Args))
+`)
+	testGroupImports(t, "local-third-party", &ImportOptions{Grouping: ImportsStd, LocalPrefix: "example.com/foo"}, `import (
+	"example.com/foo"
+	"github.com/goplus/gox"
+	"os"
+)
+`, `import (
+	"os"
+
+	"github.com/goplus/gox"
+
+	"example.com/foo"
+)
+`)
+}
+
+func TestImportGrouping(t *testing.T) {
+	for _, name := range []string{"keep", "single", "std"} {
+		if g, err := ParseImportGrouping(name); err != nil || g.String() != name {
+			t.Fatal("ParseImportGrouping:", name, g, err)
+		}
+	}
+	if _, err := ParseImportGrouping("none"); err != ErrInvalidImportGrouping {
+		t.Fatal("ParseImportGrouping:", err)
+	}
+	if s := ImportGrouping(5).String(); s != "ImportGrouping(5)" {
+		t.Fatal("ImportGrouping.String:", s)
+	}
+	if _, err := GroupImportsSource([]byte("import ("), &ImportOptions{Grouping: ImportsStd}); err == nil {
+		t.Fatal("GroupImportsSource: no error?")
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package format
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/format"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// SimplifySource formats src like format.Source, after simplifying it (see
+// Simplify).
+func SimplifySource(src []byte, filename ...string) (ret []byte, err error) {
+	var fname string
+	if filename != nil {
+		fname = filename[0]
+	}
+	fset := token.NewFileSet()
+	var f *ast.File
+	if f, err = parser.ParseFile(fset, fname, src, parser.ParseComments); err == nil {
+		Simplify(f)
+		var buf bytes.Buffer
+		if err = format.Node(&buf, fset, f); err == nil {
+			ret = buf.Bytes()
+		}
+	}
+	return
+}
+
+// Simplify simplifies the code of file f, as `gofmt -s` does. The rules are:
+//
+//   - An element type of an array, slice or map composite literal is elided:
+//     `[]T{T{}, T{}}` => `[]T{{}, {}}`, and `[]*T{&T{}}` => `[]*T{{}}`.
+//   - A slice expression `s[a:len(s)]` => `s[a:]`.
+//   - Unused variables of a range clause are removed:
+//     `for x, _ = range v` => `for x = range v` (or with :=), and
+//     `for _ = range v` => `for range v`.
+//   - The unused key of a for <- clause (in a for statement or a
+//     comprehension) is removed: `for _, v <- container` => `for v <- container`.
+//
+// All rules preserve the semantics, and applying Simplify again does nothing.
+func Simplify(f *ast.File) {
+	ast.Walk(simplifier{}, f)
+}
+
+type simplifier struct{}
+
+func (s simplifier) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.CompositeLit:
+		simplifyCompositeLit(n)
+	case *ast.SliceExpr:
+		simplifySliceExpr(n)
+	case *ast.RangeStmt:
+		simplifyRangeStmt(n)
+	case *ast.ForPhrase:
+		if n.Key != nil && n.Value != nil && n.Key.Name == "_" {
+			n.Key = nil
+		}
+	}
+	return s
+}
+
+func simplifyCompositeLit(n *ast.CompositeLit) {
+	var keyType, eltType ast.Expr
+	switch t := n.Type.(type) {
+	case *ast.ArrayType:
+		eltType = t.Elt
+	case *ast.MapType:
+		keyType, eltType = t.Key, t.Value
+	default:
+		return
+	}
+	for i, elt := range n.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			if keyType != nil {
+				kv.Key = simplifyElt(kv.Key, keyType)
+			}
+			kv.Value = simplifyElt(kv.Value, eltType)
+		} else {
+			n.Elts[i] = simplifyElt(elt, eltType)
+		}
+	}
+}
+
+// simplifyElt elides the type of the element x of a composite literal if it's
+// typ, the element type of the composite literal.
+func simplifyElt(x ast.Expr, typ ast.Expr) ast.Expr {
+	switch v := x.(type) {
+	case *ast.CompositeLit:
+		if v.Type != nil && nodeEqual(v.Type, typ) {
+			v.Type = nil
+		}
+	case *ast.UnaryExpr:
+		if ptr, ok := typ.(*ast.StarExpr); ok && v.Op == token.AND {
+			if lit, ok := v.X.(*ast.CompositeLit); ok && lit.Type != nil && nodeEqual(lit.Type, ptr.X) {
+				lit.Type = nil // &T{} => {}
+				return lit
+			}
+		}
+	}
+	return x
+}
+
+func simplifySliceExpr(n *ast.SliceExpr) {
+	if n.Slice3 || n.High == nil {
+		return
+	}
+	// s[a:len(s)] => s[a:], if s is a variable, and len is the builtin
+	s, ok := n.X.(*ast.Ident)
+	if !ok || s.Obj == nil {
+		return
+	}
+	call, ok := n.High.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 || call.Ellipsis.IsValid() {
+		return
+	}
+	if fn, ok := call.Fun.(*ast.Ident); !ok || fn.Name != "len" || fn.Obj != nil {
+		return
+	}
+	if arg, ok := call.Args[0].(*ast.Ident); ok && arg.Obj == s.Obj {
+		n.High = nil
+	}
+}
+
+func simplifyRangeStmt(n *ast.RangeStmt) {
+	if isBlank(n.Value) {
+		n.Value = nil // for x, _ = range v => for x = range v
+	}
+	if n.Value == nil && isBlank(n.Key) {
+		n.Key = nil // for _ = range v => for range v
+	}
+}
+
+func isBlank(x ast.Expr) bool {
+	ident, ok := x.(*ast.Ident)
+	return ok && ident.Name == "_"
+}
+
+var (
+	tyPos = reflect.TypeOf(token.NoPos)
+	tyObj = reflect.TypeOf((*ast.Object)(nil))
+)
+
+// nodeEqual reports whether two nodes are the same, except positions.
+func nodeEqual(x, y ast.Node) bool {
+	return valueEqual(reflect.ValueOf(x), reflect.ValueOf(y))
+}
+
+func valueEqual(x, y reflect.Value) bool {
+	if !x.IsValid() || !y.IsValid() {
+		return x.IsValid() == y.IsValid()
+	}
+	if x.Type() != y.Type() {
+		return false
+	}
+	switch x.Type() {
+	case tyPos, tyObj:
+		return true
+	}
+	switch x.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if x.IsNil() || y.IsNil() {
+			return x.IsNil() == y.IsNil()
+		}
+		return valueEqual(x.Elem(), y.Elem())
+	case reflect.Slice:
+		if x.Len() != y.Len() {
+			return false
+		}
+		for i, n := 0, x.Len(); i < n; i++ {
+			if !valueEqual(x.Index(i), y.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i, n := 0, x.NumField(); i < n; i++ {
+			if !valueEqual(x.Field(i), y.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.String:
+		return x.String() == y.String()
+	case reflect.Bool:
+		return x.Bool() == y.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return x.Int() == y.Int()
+	}
+	return x.Interface() == y.Interface()
+}
+
+// -----------------------------------------------------------------------------
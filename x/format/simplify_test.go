@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package format
+
+import (
+	"testing"
+)
+
+func testSimplify(t *testing.T, name string, src, expect string) {
+	t.Run(name, func(t *testing.T) {
+		result, err := SimplifySource([]byte(src), name)
+		if err != nil {
+			t.Fatal("SimplifySource failed:", err)
+		}
+		if ret := string(result); ret != expect {
+			t.Fatalf("%s => Expect:\n%s\n=> Got:\n%s\n", name, expect, ret)
+		}
+		result, err = SimplifySource(result, name)
+		if err != nil {
+			t.Fatal("SimplifySource failed:", err)
+		}
+		if ret := string(result); ret != expect {
+			t.Fatalf("%s => Not idempotent:\n%s\n", name, ret)
+		}
+	})
+}
+
+// -----------------------------------------------------------------------------
+
+func TestSimplifyCompositeLit(t *testing.T) {
+	testSimplify(t, "slice", `type Point struct {
+	X, Y int
+}
+
+a := []Point{Point{1, 2}, Point{X: 3}, {4, 5}}
+b := []*Point{&Point{1, 2}, nil}
+c := [...][]int{[]int{1}, []int{2, 3}}
+println a, b, c
+`, `type Point struct {
+	X, Y int
+}
+
+a := []Point{{1, 2}, {X: 3}, {4, 5}}
+b := []*Point{{1, 2}, nil}
+c := [...][]int{{1}, {2, 3}}
+println a, b, c
+`)
+	testSimplify(t, "map", `type Point struct {
+	X, Y int
+}
+
+m := map[Point]*Point{Point{1, 2}: &Point{3, 4}}
+println m
+`, `type Point struct {
+	X, Y int
+}
+
+m := map[Point]*Point{{1, 2}: {3, 4}}
+println m
+`)
+	testSimplify(t, "different types", `type Point struct {
+	X, Y int
+}
+
+type Point2 Point
+
+a := []Point{Point(Point2{1, 2})}
+b := []interface{}{Point{1, 2}, &Point{3, 4}}
+c := [{"x": Point{1, 2}}]
+println a, b, c
+`, `type Point struct {
+	X, Y int
+}
+
+type Point2 Point
+
+a := []Point{Point(Point2{1, 2})}
+b := []interface{}{Point{1, 2}, &Point{3, 4}}
+c := [{"x": Point{1, 2}}]
+println a, b, c
+`)
+}
+
+func TestSimplifySliceExpr(t *testing.T) {
+	testSimplify(t, "len", `s := "Hello"
+t := "world"
+println s[1:len(s)], s[1:len(t)], s[:len(s)]
+println s[1:len(s):len(s)]
+`, `s := "Hello"
+t := "world"
+println s[1:], s[1:len(t)], s[:]
+println s[1:len(s):len(s)]
+`)
+	testSimplify(t, "shadowed len", `func len(s string) int {
+	return 1
+}
+
+s := "Hello"
+println s[1:len(s)]
+`, `func len(s string) int {
+	return 1
+}
+
+s := "Hello"
+println s[1:len(s)]
+`)
+}
+
+func TestSimplifyRange(t *testing.T) {
+	testSimplify(t, "range stmt", `var k, v int
+
+for k, _ = range [1, 2] {
+	println k
+}
+for _ = range [1, 2] {
+}
+for _, _ = range [1, 2] {
+}
+for _, v = range [1, 2] {
+	println v
+}
+for k, _ := range [1, 2] {
+	println k
+}
+`, `var k, v int
+
+for k = range [1, 2] {
+	println k
+}
+for range [1, 2] {
+}
+for range [1, 2] {
+}
+for _, v = range [1, 2] {
+	println v
+}
+for k := range [1, 2] {
+	println k
+}
+`)
+	testSimplify(t, "for phrase", `for _, v <- [1, 2] {
+	println v
+}
+for k, _ <- [1, 2] {
+	println k
+}
+println [v for _, v <- [1, 2, 3], v > 1]
+println {v: k for k, v <- [1, 2, 3]}
+`, `for v <- [1, 2] {
+	println v
+}
+for k, _ <- [1, 2] {
+	println k
+}
+println [v for v <- [1, 2, 3], v > 1]
+println {v: k for k, v <- [1, 2, 3]}
+`)
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+
+const (
+	// DownloadAttemptsEnv is the environment variable of the max attempts to
+	// download modules, when downloading fails because of network errors. It's
+	// defaultDownloadAttempts if not set, and 1 disables retrying.
+	DownloadAttemptsEnv = "GOPDOWNLOADATTEMPTS"
+
+	defaultDownloadAttempts = 3
+	downloadDelay           = time.Second // delay before the first retry, doubled for each retry
+	maxDownloadDelay        = 30 * time.Second
+)
+
+func downloadAttempts() int {
+	if v := os.Getenv(DownloadAttemptsEnv); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			if n < 1 {
+				return 1
+			}
+			return n
+		}
+		log.Printf("invalid %s=%s, use %d\n", DownloadAttemptsEnv, v, defaultDownloadAttempts)
+	}
+	return defaultDownloadAttempts
+}
+
+// retryDownload calls download until it succeeds, or fails with an error which
+// isn't transient (see isTransient), up to downloadAttempts() times. It backs
+// off exponentially between attempts, and logs each retry so that users know
+// it isn't hung.
+func retryDownload(what string, download func() error) error {
+	attempts := downloadAttempts()
+	delay := downloadDelay
+	for i := 1; ; i++ {
+		err := download()
+		if err == nil || i >= attempts || !isTransient(err) {
+			return err
+		}
+		log.Printf("%s failed (attempt %d of %d), retry in %v: %v\n", what, i, attempts, delay, err)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxDownloadDelay {
+			delay = maxDownloadDelay
+		}
+	}
+}
+
+// transientErrors are messages of the go command when downloading modules
+// fails because of network errors, which may succeed if retried.
+var transientErrors = []string{
+	"i/o timeout",
+	"TLS handshake timeout",
+	"connection reset by peer",
+	"connection refused",
+	"broken pipe",
+	"unexpected EOF",
+	"temporary failure in name resolution",
+	"server misbehaving",
+	"Client.Timeout exceeded",
+	"429 Too Many Requests",
+	"500 Internal Server Error",
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Timeout",
+}
+
+// isTransient reports whether err is a network error which may be transient.
+// Errors like a missing module or version, or a checksum mismatch, are not.
+func isTransient(err error) bool {
+	msg := err.Error()
+	for _, s := range transientErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadDeps downloads the modules required by the go.mod in dir by
+// `go mod download`, retrying on transient errors. Other errors are ignored,
+// as the go command building in dir reports them better.
+func downloadDeps(dir string) error {
+	err := retryDownload("go mod download", func() error {
+		var stderr bytes.Buffer
+		cmd := exec.Command("go", "mod", "download")
+		cmd.Dir = dir
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return errors.New(msg)
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil && isTransient(err) {
+		return err
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
@@ -18,9 +18,12 @@ package gopmod
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/goplus/gop/env"
 )
@@ -51,7 +54,10 @@ func LoadFlags() string {
 
 type GoCmd struct {
 	*exec.Cmd
-	after func(error) error
+	before func() error // eg. download the dependencies, see downloadDeps
+	after  func(error) error
+	env    []string     // environment variables to build with, see Project.buildEnv
+	proc   *runningProc // the process being run
 }
 
 func (p GoCmd) IsValid() bool {
@@ -59,30 +65,115 @@ func (p GoCmd) IsValid() bool {
 }
 
 func (p GoCmd) Run() error {
-	err := p.Cmd.Run()
+	if p.before != nil {
+		if err := p.before(); err != nil {
+			return err
+		}
+	}
+	if p.env != nil { // set after callers setting Env
+		env := p.Cmd.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		p.Cmd.Env = append(env[:len(env):len(env)], p.env...)
+	}
+	err := p.proc.run(p.Cmd)
 	if p.after != nil {
 		return p.after(err)
 	}
 	return err
 }
 
-func goCommand(dir, op string, t *goTarget) (ret GoCmd) {
+// Signal sends sig to the process Run is waiting for: the go command, or the
+// program it built when running a Go+ project in the run cache.
+func (p GoCmd) Signal(sig os.Signal) error {
+	return p.proc.signal(sig)
+}
+
+// runningProc tracks the process being run by a GoCmd, so that it can be
+// signaled from other goroutines.
+type runningProc struct {
+	mutex sync.Mutex
+	cur   *os.Process
+}
+
+func (p *runningProc) run(cmd *exec.Cmd) error {
+	p.mutex.Lock()
+	err := cmd.Start()
+	if err == nil {
+		p.cur = cmd.Process
+	}
+	p.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	err = cmd.Wait()
+	p.mutex.Lock()
+	p.cur = nil
+	p.mutex.Unlock()
+	return err
+}
+
+func (p *runningProc) signal(sig os.Signal) error {
+	if p == nil {
+		return os.ErrProcessDone
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.cur == nil {
+		return os.ErrProcessDone
+	}
+	return p.cur.Signal(sig)
+}
+
+func goCommand(dir, op string, t *goTarget, changed bool) (ret GoCmd) {
 	proj := t.proj
-	exargs := make([]string, 1, len(proj.BuildArgs)+len(proj.ExecArgs)+6)
-	exargs[0] = op                             // 1
-	exargs = append(exargs, proj.BuildArgs...) // len(proj.BuildArgs)
-	exargs = appendLdflags(exargs, op)         // 2
-	if op == "run" && t.defctx {               // 2
-		afterDir, goFile, outFile := dir, t.goFile, t.outFile
-		dir, _ = filepath.Split(goFile)
+	ret.proc = new(runningProc)
+	printWork(t)
+	if op == "run" && t.defctx && !changed && proj.targetEnv() == nil && fileExists(t.outFile) { // run the cached executable
+		ret.Cmd = exec.Command(t.outFile, proj.ExecArgs...)
+		ret.Cmd.Dir = proj.execDir(dir)
+		return
+	}
+	ret.env = proj.buildEnv()
+	if t.defctx { // download the dependencies of the run cache, retrying on network errors
+		modDir, _ := filepath.Split(t.goFile)
+		ret.before = func() error {
+			return downloadDeps(modDir)
+		}
+	}
+	buildToRun := op == "run" && (t.defctx || proj.ExecDir != "") // build the program, and run it after
+	exargs := make([]string, 1, len(proj.BuildArgs)+len(proj.ExecArgs)+8)
+	exargs[0] = op                                   // 1
+	exargs = append(exargs, proj.BuildArgs...)       // len(proj.BuildArgs)
+	exargs = appendBuildTags(exargs, proj.BuildTags) // 2
+	exargs = appendLdflags(exargs, op)               // 2
+	exargs = appendModFlag(exargs, t)                // 1
+	exargs = appendWorkFlag(exargs, proj)            // 1
+	if buildToRun {                                  // 2
+		afterDir, goFile, outFile, tmpDir := proj.execDir(dir), t.goFile, t.outFile, ""
+		if t.defctx {
+			dir, _ = filepath.Split(goFile)
+		} else { // go run runs the program in its own directory, so build it to a temporary directory first
+			var err error
+			if tmpDir, err = os.MkdirTemp("", "goprun"); err != nil {
+				log.Panicln(err)
+			}
+			outFile = filepath.Join(tmpDir, filepath.Base(outFile))
+		}
 		exargs[0] = "build"
 		exargs = append(exargs, "-o", outFile, goFile)
 		ret.after = func(e error) error {
 			if e == nil {
-				e = runCommand(afterDir, outFile, proj.ExecArgs...)
-				os.Remove(outFile)
+				cmd := exec.Command(outFile, proj.ExecArgs...)
+				cmd.Dir = afterDir // run the program with the stdio & environment set by callers, as go run does
+				cmd.Stdin, cmd.Stdout, cmd.Stderr, cmd.Env = ret.Cmd.Stdin, ret.Cmd.Stdout, ret.Cmd.Stderr, ret.Cmd.Env
+				e = ret.proc.run(cmd)
 			}
-			if e != nil && t.proj.FlagRTOE { // remove tempfile on error
+			if tmpDir != "" {
+				os.RemoveAll(tmpDir)
+			}
+			if e != nil && t.proj.FlagRTOE && !t.proj.Work { // remove tempfile on error
 				os.Remove(goFile)
 			}
 			return e
@@ -96,9 +187,82 @@ func goCommand(dir, op string, t *goTarget) (ret GoCmd) {
 	return
 }
 
+func buildCommand(dir, outFile string, t *goTarget) *exec.Cmd {
+	proj := t.proj
+	exargs := make([]string, 1, len(proj.BuildArgs)+8)
+	exargs[0] = "build"
+	exargs = append(exargs, proj.BuildArgs...)
+	exargs = appendBuildTags(exargs, proj.BuildTags)
+	exargs = appendLdflags(exargs, "build")
+	exargs = appendModFlag(exargs, t)
+	exargs = appendWorkFlag(exargs, proj)
+	exargs = append(exargs, "-o", outFile, t.goFile)
+	printWork(t)
+	if t.defctx { // build in the run cache, using its go.mod & go.sum
+		dir, _ = filepath.Split(t.goFile)
+	}
+	cmd := exec.Command("go", exargs...)
+	cmd.Dir = dir
+	if env := proj.buildEnv(); env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
+
+func appendBuildTags(exargs []string, tags []string) []string {
+	if len(tags) > 0 {
+		return append(exargs, "-tags", strings.Join(tags, ","))
+	}
+	return exargs
+}
+
+// appendModFlag lets the go command update go.mod & go.sum if the go.mod is
+// merged with an overlay, as the dependencies it adds may be missing in them,
+// or forbids it if the go.mod is locked.
+func appendModFlag(exargs []string, t *goTarget) []string {
+	if t.modFlag != "" {
+		return append(exargs, "-mod="+t.modFlag)
+	}
+	return exargs
+}
+
+// printWork prints the directory of the generated Go file to stderr, like the
+// go command printing WORK=dir, see Project.Work.
+func printWork(t *goTarget) {
+	if t.proj.Work {
+		fmt.Fprintf(os.Stderr, "GOPWORK=%s\n", filepath.Dir(t.goFile))
+	}
+}
+
+// appendWorkFlag lets the go command print its temporary work directory and
+// keep it, see Project.Work.
+func appendWorkFlag(exargs []string, proj *Project) []string {
+	if proj.Work {
+		return append(exargs, "-work")
+	}
+	return exargs
+}
+
+// appendLdflags appends the -ldflags of Go+ (see LoadFlags) to exargs if op
+// accepts it. If exargs has -ldflags (eg. in Project.BuildArgs) already, they
+// are merged into it instead, as the go command takes the last -ldflags only.
+// The ones in exargs come last, so they win if they set the same variables.
 func appendLdflags(exargs []string, op string) []string {
 	for _, v := range opsWithLdflags {
 		if op == v {
+			for i, arg := range exargs {
+				switch {
+				case arg == "-ldflags" || arg == "--ldflags":
+					if i+1 < len(exargs) {
+						exargs[i+1] = LoadFlags() + " " + exargs[i+1]
+						return exargs
+					}
+				case strings.HasPrefix(arg, "-ldflags="), strings.HasPrefix(arg, "--ldflags="):
+					pos := strings.IndexByte(arg, '=') + 1
+					exargs[i] = arg[:pos] + LoadFlags() + " " + arg[pos:]
+					return exargs
+				}
+			}
 			return append(exargs, "-ldflags", LoadFlags())
 		}
 	}
@@ -17,6 +17,7 @@
 package gopmod
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"os"
 	"path/filepath"
@@ -34,6 +35,10 @@ func openFromGoFile(file string) (proj *Project, err error) {
 		AutoGenFile:   file,
 		FriendlyFname: filepath.Base(file),
 	}
+	proj.Kind, proj.pkgName = detectKind([]string{file})
+	proj.ModOverlay = findModOverlay([]string{file})
+	proj.srcDir = filepath.Dir(file)
+	proj.outName = baseName(file)
 	return
 }
 
@@ -46,7 +51,12 @@ func (p *goFile) Fingerp() (ret *Fingerp, err error) { // source code fingerprin
 	if err != nil {
 		return
 	}
-	hash := sha1.Sum([]byte(file))
+	var buf bytes.Buffer
+	buf.WriteString(file)
+	if err = writeContentHash(&buf, file); err != nil {
+		return
+	}
+	hash := sha1.Sum(buf.Bytes())
 	return &Fingerp{Hash: hash, ModTime: fi.ModTime()}, nil
 }
 
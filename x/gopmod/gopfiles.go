@@ -19,26 +19,43 @@ package gopmod
 import (
 	"bytes"
 	"crypto/sha1"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/goplus/gop/ast"
 	"github.com/goplus/gop/cl"
 	"github.com/goplus/gop/parser"
 	"github.com/goplus/gop/token"
-	"github.com/goplus/gox"
 )
 
 // -----------------------------------------------------------------------------
 
 type gopFiles struct {
 	files []string
+	dir   string   // the directory of files if opened by OpenDir
+	proj  *Project // the project of files, for its GoVersion and build context
 }
 
 func (p *Context) openFromGopFiles(files []string) (proj *Project, err error) {
-	proj = &Project{
-		Source: &gopFiles{files: files},
+	if p.modErr != nil {
+		return nil, p.modErr
+	}
+	src := &gopFiles{files: files}
+	proj = &Project{Source: src}
+	src.proj = proj
+	if conf := p.modConf; conf != nil {
+		proj.GoVersion = conf.GoVersion
+		proj.BuildTags = conf.BuildTags
+	}
+	proj.Kind, proj.pkgName = detectKind(files)
+	proj.ModOverlay = findModOverlay(files)
+	if len(files) > 0 {
+		proj.srcDir = filepath.Dir(files[0])
+		proj.outName = baseName(files[0])
 	}
 	if len(files) == 1 {
 		file := files[0]
@@ -55,6 +72,12 @@ func (p *Context) openFromGopFiles(files []string) (proj *Project, err error) {
 	return
 }
 
+// baseName returns the base name of file without extension.
+func baseName(file string) string {
+	fname := filepath.Base(file)
+	return strings.TrimSuffix(fname, filepath.Ext(fname))
+}
+
 func hasMultiFiles(srcDir string, ext string) bool {
 	var has bool
 	if f, err := os.Open(srcDir); err == nil {
@@ -88,42 +111,73 @@ func (p *gopFiles) Fingerp() (*Fingerp, error) { // source code fingerprint
 		if err != nil {
 			return nil, err
 		}
+		if err = writeContentHash(&buf, absfile); err != nil {
+			return nil, err
+		}
 		modTime := fi.ModTime()
 		if modTime.After(lastModTime) {
 			lastModTime = modTime
 		}
 	}
+	if ver := p.proj.GoVersion; ver != "" { // the generated code depends on it
+		buf.WriteString("\ngo ")
+		buf.WriteString(ver)
+	}
+	if p.dir != "" { // so do the files selected by the build context, see parse
+		ctxt := p.proj.buildContext()
+		fmt.Fprintf(&buf, "\n%s/%s cgo=%v tags=%q", ctxt.GOOS, ctxt.GOARCH, ctxt.CgoEnabled, ctxt.BuildTags)
+	}
 	hash := sha1.Sum(buf.Bytes())
 	return &Fingerp{Hash: hash, ModTime: lastModTime}, nil
 }
 
+// writeContentHash writes hash of the file content, so that fingerprints
+// change with the source code.
+func writeContentHash(buf *bytes.Buffer, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	hash := sha1.Sum(data)
+	buf.WriteByte(':')
+	buf.Write(hash[:])
+	return nil
+}
+
 const (
 	parserMode = parser.ParseComments
 )
 
 func (p *gopFiles) GenGo(outFile, modFile string) error {
 	fset := token.NewFileSet()
-	pkgs, err := parser.ParseFiles(fset, p.files, parserMode)
+	pkgs, err := p.parse(fset)
 	if err != nil {
 		return err
 	}
+	if len(pkgs) == 0 {
+		return fmt.Errorf("build constraints exclude all Go+ files in %s", p.dir)
+	}
 	if len(pkgs) != 1 {
 		log.Panicln("TODO: mutli packages -", len(pkgs))
 	}
-	mainPkg, ok := pkgs["main"]
-	if !ok {
-		panic("TODO: main package not found")
+	var pkg *ast.Package // main, or a library (eg. read from stdin)
+	for _, v := range pkgs {
+		pkg = v
+	}
+	if err = checkRedeclared(fset, p.files, pkg); err != nil {
+		return err
 	}
 
 	srcDir, _ := filepath.Split(outFile)
 	modDir, _ := filepath.Split(modFile)
 	conf := &cl.Config{
-		Dir: modDir, TargetDir: srcDir, Fset: fset, CacheLoadPkgs: true, PersistLoadPkgs: true}
-	out, err := cl.NewPackage("", mainPkg, conf)
+		Dir: modDir, TargetDir: srcDir, Fset: fset, GoVersion: p.proj.GoVersion,
+		CacheLoadPkgs: true, PersistLoadPkgs: true}
+	out, err := cl.NewPackage("", pkg, conf)
 	if err != nil {
 		return err
 	}
-	err = gox.WriteFile(outFile, out, false)
+	err = cl.WriteFile(outFile, out, false)
 	if err != nil {
 		return err
 	}
@@ -131,4 +185,85 @@ func (p *gopFiles) GenGo(outFile, modFile string) error {
 	return nil
 }
 
+// parse parses the files. The files of a directory are selected by their
+// build constraints (see parser.ParseFSDirEx), evaluated against the target
+// platform and build tags of the project.
+func (p *gopFiles) parse(fset *token.FileSet) (map[string]*ast.Package, error) {
+	if p.dir == "" {
+		return parser.ParseFiles(fset, p.files, parserMode)
+	}
+	files := make(map[string]bool, len(p.files))
+	for _, file := range p.files {
+		files[filepath.Base(file)] = true
+	}
+	return parser.ParseDirEx(fset, p.dir, parser.Config{
+		Filter:  func(fi os.FileInfo) bool { return files[fi.Name()] },
+		Mode:    parserMode | parser.ParseGoFiles,
+		Context: p.proj.buildContext(),
+	})
+}
+
+// checkRedeclared reports an error if a top-level name is declared both in a
+// Go file and in a Go+ file of pkg.
+func checkRedeclared(fset *token.FileSet, files []string, pkg *ast.Package) error {
+	type declInfo struct {
+		pos  token.Pos
+		isGo bool
+	}
+	decls := make(map[string]declInfo)
+	for _, file := range files {
+		f, ok := pkg.Files[file]
+		if !ok {
+			continue
+		}
+		isGo := filepath.Ext(file) == ".go"
+		check := func(name string, pos token.Pos) error {
+			if name == "_" || name == "init" {
+				return nil
+			}
+			if old, ok := decls[name]; !ok {
+				decls[name] = declInfo{pos: pos, isGo: isGo}
+			} else if old.isGo != isGo {
+				return fmt.Errorf("%v: %s redeclared in this package\n\t%v: other declaration of %s",
+					fset.Position(pos), name, fset.Position(old.pos), name)
+			}
+			return nil
+		}
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				name := d.Name.Name
+				if d.Recv != nil && len(d.Recv.List) == 1 { // method: Recv.Name
+					typ := d.Recv.List[0].Type
+					if t, ok := typ.(*ast.StarExpr); ok {
+						typ = t.X
+					}
+					if t, ok := typ.(*ast.Ident); ok {
+						name = t.Name + "." + name
+					}
+				}
+				if err := check(name, d.Name.Pos()); err != nil {
+					return err
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						if err := check(s.Name.Name, s.Name.Pos()); err != nil {
+							return err
+						}
+					case *ast.ValueSpec:
+						for _, name := range s.Names {
+							if err := check(name.Name, name.Pos()); err != nil {
+								return err
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // -----------------------------------------------------------------------------
@@ -18,14 +18,19 @@ package gopmod
 
 import (
 	"bytes"
+	"crypto/sha1"
 	"encoding/base64"
 	"fmt"
+	"go/build"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/goplus/gop/env"
@@ -48,56 +53,329 @@ type Project struct {
 	AutoGenFile   string // autogen file of output
 	FriendlyFname string // friendly fname of source
 	BuildArgs     []string
+	BuildTags     []string
 	ExecArgs      []string
+	DumpGo        io.Writer // dump the generated Go code to DumpGo if it isn't nil
+	GOOS, GOARCH  string    // target platform, the host platform if empty
 	UseDefaultCtx bool
 	ForceToGen    bool
-	FlagNRINC     bool // do not run if not changed
-	FlagRTOE      bool // remove tempfile on error
+	FlagNRINC     bool     // do not run if not changed
+	FlagRTOE      bool     // remove tempfile on error
+	Work          bool     // print the directory of the generated Go file and keep it (even if FlagRTOE), and pass -work to the go command
+	NoCgo         bool     // build with CGO_ENABLED=0, and fail if the generated Go file imports "C", see CheckNoCgo
+	Kind          ProjKind // detected from the source files when opening the project
+
+	// GoVersion is the target Go version of the generated code (eg. "go1.18"),
+	// see cl.Config.GoVersion. It's the go statement of gop.mod (if any) when
+	// opening the project. In the default context, the go.mod the project is
+	// built with has the matching go directive (see withGoVersion).
+	GoVersion string
+
+	// ExecDir is the working directory of the program run by GoCommand("run"),
+	// the directory of the context if empty. It doesn't change where the
+	// project is opened or built from.
+	ExecDir string
+
+	// ModOverlay is a go.mod file whose require, replace and exclude
+	// directives are merged into the go.mod of the default context, eg. to
+	// replace a dependency with a local fork. It's the ModOverlayFile next to
+	// the source files (if it exists) when opening the project.
+	ModOverlay string
+
+	// Locked runs the project with the versions of modules pinned in its lock
+	// files, instead of resolving them in the default context. See Context.Lock.
+	Locked bool
+
+	ctx     *Context // context to build the project in, see ctxOf
+	pkgName string   // package name of the source files, see Kind
+	outName string   // name of the executable without extension, see OutputName
+	srcDir  string   // directory of the source files, see LockFile
 }
 
 type Context struct {
-	modfile string
-	dir     string
-	defctx  bool
+	modfile  string
+	dir      string
+	runCache string // root directory of the run cache
+	defctx   bool
+	modFlag  string // -mod flag of the go command: mod (see withModOverlay), readonly (see withLock), or none
+
+	modConf *ModConfig // configuration in gop.mod, nil if there is none
+	modErr  error      // error loading modConf, returned when opening projects
+}
+
+// Config configures a Context.
+type Config struct {
+	// RunCacheDir is the root directory of the run cache, where the default
+	// context (with its go.mod & go.sum), compiled packages and module copies
+	// are. It's RunCacheDir() if empty. Use different directories to run
+	// concurrent builds in isolation.
+	RunCacheDir string
 }
 
-func New(dir string) *Context {
+// RunCacheDir returns the default root directory of the run cache: the value
+// of GOPRUNCACHE environment variable if it's set, or ~/.gop/run.
+func RunCacheDir() string {
+	if dir := os.Getenv("GOPRUNCACHE"); dir != "" {
+		return dir
+	}
+	return filepath.Join(env.HOME(), ".gop", "run")
+}
+
+func runCacheOf(conf []*Config) string {
+	if len(conf) > 0 && conf[0] != nil && conf[0].RunCacheDir != "" {
+		return conf[0].RunCacheDir
+	}
+	return RunCacheDir()
+}
+
+func New(dir string, conf ...*Config) *Context {
 	modfile, err := env.GOPMOD(dir)
 	if err != nil {
-		return NewDefault(dir)
+		return NewDefault(dir, conf...)
 	}
-	return &Context{modfile: modfile, dir: dir}
+	ctx := &Context{modfile: modfile, dir: dir, runCache: runCacheOf(conf)}
+	if ctx.modConf, ctx.modErr = LoadModConfig(modfile); ctx.modConf != nil {
+		ctx.modConf.registerClassfile()
+	}
+	return ctx
 }
 
-func NewDefault(dir string) *Context {
-	modfile := env.HOME() + "/.gop/run/go.mod"
+func NewDefault(dir string, conf ...*Config) *Context {
+	runCache := runCacheOf(conf)
+	modfile := filepath.Join(runCache, "go.mod")
 	if _, err := os.Stat(modfile); os.IsNotExist(err) {
 		genDefaultGopMod(modfile)
 	}
-	return &Context{modfile: modfile, dir: dir, defctx: true}
+	return &Context{modfile: modfile, dir: dir, runCache: runCache, defctx: true}
 }
 
-func (p *Context) GoCommand(op string, src *Project) GoCmd {
+func (p *Context) config() *Config {
+	return &Config{RunCacheDir: p.runCache}
+}
+
+// ctxOf returns the context to build the project src in. It's p, unless src
+// should be built in the default context, or in the module it comes from (see
+// OpenModule). The go.mod overlay of src applies to the default context only.
+// A locked project is always built in the default context with its lock files
+// (see withLock), which the go.mod overlay is resolved into already.
+func (p *Context) ctxOf(src *Project) *Context {
+	if src.Locked {
+		return p.withLock(src)
+	}
 	if src.UseDefaultCtx {
-		p = NewDefault(p.dir)
+		p = NewDefault(p.dir, p.config())
+	} else if src.ctx != nil {
+		return src.ctx
+	}
+	if p.defctx && src.ModOverlay != "" {
+		p = p.withModOverlay(src.ModOverlay)
+	}
+	if p.defctx && src.GoVersion != "" {
+		p = p.withGoVersion(src.GoVersion)
+	}
+	return p
+}
+
+func (p *Context) GoCommand(op string, src *Project) GoCmd {
+	p = p.ctxOf(src)
+	out, changed := p.genGo(src)
+	if src.DumpGo != nil { // even if the Go file isn't regenerated
+		if err := DumpGoFile(src.DumpGo, out.goFile, src.sourceFiles()...); err != nil {
+			log.Panicln(err)
+		}
+	}
+	if !changed && src.FlagNRINC { // do not run if not changed
+		return GoCmd{}
+	}
+	return goCommand(p.dir, op, &out, changed)
+}
+
+// sourceFiles returns names of the source files of the project, in sorted
+// order, or its FriendlyFname if the source isn't made of files.
+func (p *Project) sourceFiles() []string {
+	var files []string
+	switch src := p.Source.(type) {
+	case *gopFiles:
+		files = make([]string, len(src.files))
+		for i, file := range src.files {
+			files[i] = filepath.Base(file)
+		}
+		sort.Strings(files)
+	case *goFile:
+		files = []string{filepath.Base(src.file)}
+	default:
+		files = []string{p.FriendlyFname}
 	}
+	return files
+}
+
+// DumpGoFile writes the Go file goFile generated from Go+ source files srcs to
+// w, with a header comment naming its sources.
+func DumpGoFile(w io.Writer, goFile string, srcs ...string) (err error) {
+	b, err := os.ReadFile(goFile)
+	if err != nil {
+		return
+	}
+	header := filepath.Base(goFile)
+	if len(srcs) > 0 {
+		header += ": generated from " + strings.Join(srcs, ", ")
+	}
+	_, err = fmt.Fprintf(w, "// %s\n\n%s", header, b)
+	return
+}
+
+// BuildProject returns a `go build -o outFile` command for the project src.
+// The command isn't started, so callers can set Env, Stdout, etc. before
+// running it. If src.GOOS or src.GOARCH is set, Env is set to the current
+// environment plus them (and CGO_ENABLED=0 if src.NoCgo), so append to Env
+// rather than replace it.
+func (p *Context) BuildProject(outFile string, src *Project) *exec.Cmd {
+	p = p.ctxOf(src)
+	absOutFile, err := filepath.Abs(outFile)
+	if err != nil {
+		log.Panicln(err)
+	}
+	out, _ := p.genGo(src)
+	return buildCommand(p.dir, absOutFile, &out)
+}
+
+// GoFile returns the Go file generated from the project src by GoCommand and
+// BuildProject, and whether it's in the run cache. A Go file not in the run
+// cache is next to the source files (see Project.AutoGenFile).
+func (p *Context) GoFile(src *Project) (goFile string, inRunCache bool, err error) {
+	p = p.ctxOf(src)
+	fp, err := src.Fingerp()
+	if err != nil {
+		return
+	}
+	out := p.target(src, fp)
+	return out.goFile, out.defctx, nil
+}
+
+func (p *Context) target(src *Project, fp *Fingerp) goTarget {
+	if p.defctx {
+		return p.out(src, cacheKey(src, fp))
+	}
+	return p.out(src, fp.Hash[:])
+}
+
+func (p *Context) genGo(src *Project) (out goTarget, changed bool) {
 	fp, err := src.Fingerp()
 	if err != nil {
 		log.Panicln(err)
 	}
-	out := p.out(src, fp.Hash[:])
-	if src.ForceToGen || fileIsDirty(fp.ModTime, out.goFile) {
+	out = p.target(src, fp)
+	if src.ForceToGen || p.isDirty(fp, out.goFile) {
+		dir, _ := filepath.Split(out.goFile)
+		os.MkdirAll(dir, 0755)
+		if err := src.GenGo(out.goFile, p.modfile); err != nil {
+			log.Panicln(err)
+		}
 		if p.defctx {
-			dir, _ := filepath.Split(out.goFile)
-			os.Mkdir(dir, 0755)
+			p.evictStale(&out)
+		} else {
+			p.writeGenStamp(out.goFile, fp)
 		}
-		if err := src.GenGo(out.goFile, p.modfile); err != nil {
+		changed = true
+	}
+	if src.NoCgo {
+		if err := CheckNoCgo(out.goFile); err != nil {
 			log.Panicln(err)
 		}
-	} else if src.FlagNRINC { // do not run if not changed
-		return GoCmd{}
 	}
-	return goCommand(p.dir, op, &out)
+	return
+}
+
+// isDirty reports whether destFile needs to be regenerated. Files in the run
+// cache are content addressed, so they are valid as long as they exist. Other
+// files are regenerated if they are older than the source, or were generated
+// from another fingerprint, eg. for another target platform (see genStamp).
+func (p *Context) isDirty(fp *Fingerp, destFile string) bool {
+	if p.defctx {
+		return !fileExists(destFile)
+	}
+	return fileIsDirty(fp.ModTime, destFile) || p.genStamp(destFile) != fp.Hash
+}
+
+const (
+	genStampDir = "gen"
+)
+
+// genStampFile returns the file recording the fingerprint of the source that
+// goFile, a Go file not in the run cache, is generated from.
+func (p *Context) genStampFile(goFile string) string {
+	if abs, err := filepath.Abs(goFile); err == nil {
+		goFile = abs
+	}
+	id := sha1.Sum([]byte(goFile))
+	return filepath.Join(p.runCache, genStampDir, base64.RawURLEncoding.EncodeToString(id[:]))
+}
+
+// genStamp returns the fingerprint hash recorded by writeGenStamp for goFile,
+// or a zero hash if there is none.
+func (p *Context) genStamp(goFile string) (hash [20]byte) {
+	if b, err := os.ReadFile(p.genStampFile(goFile)); err == nil && len(b) == len(hash) {
+		copy(hash[:], b)
+	}
+	return
+}
+
+func (p *Context) writeGenStamp(goFile string, fp *Fingerp) {
+	stampFile := p.genStampFile(goFile)
+	os.MkdirAll(filepath.Dir(stampFile), 0755)
+	os.WriteFile(stampFile, fp.Hash[:], 0644)
+}
+
+func fileExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// target returns the target platform of the project.
+func (p *Project) target() (goos, goarch string) {
+	goos, goarch = p.GOOS, p.GOARCH
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	if goarch == "" {
+		goarch = runtime.GOARCH
+	}
+	return
+}
+
+// buildContext returns the build context to select the source files of the
+// project by their build constraints: its target platform and build tags.
+func (p *Project) buildContext() *build.Context {
+	ctxt := build.Default
+	ctxt.GOOS, ctxt.GOARCH = p.target()
+	ctxt.BuildTags = p.BuildTags
+	if p.NoCgo || ctxt.GOOS != runtime.GOOS || ctxt.GOARCH != runtime.GOARCH { // cgo is off by default when cross compiling
+		ctxt.CgoEnabled = false
+	}
+	return &ctxt
+}
+
+// targetEnv returns the environment variables to set the target platform of
+// the project, or nil if it's the host platform.
+func (p *Project) targetEnv() []string {
+	var env []string
+	if p.GOOS != "" {
+		env = append(env, "GOOS="+p.GOOS)
+	}
+	if p.GOARCH != "" {
+		env = append(env, "GOARCH="+p.GOARCH)
+	}
+	return env
+}
+
+// buildEnv returns the environment variables to build the project with: the
+// ones of its target platform (see targetEnv), and CGO_ENABLED=0 if NoCgo.
+func (p *Project) buildEnv() []string {
+	env := p.targetEnv()
+	if p.NoCgo {
+		env = append(env, "CGO_ENABLED=0")
+	}
+	return env
 }
 
 func fileIsDirty(srcMod time.Time, destFile string) bool {
@@ -108,11 +386,37 @@ func fileIsDirty(srcMod time.Time, destFile string) bool {
 	return srcMod.After(fiDest.ModTime())
 }
 
+// execDir returns the working directory of the program run for the project,
+// which is dir if ExecDir is empty.
+func (p *Project) execDir(dir string) string {
+	if p.ExecDir != "" {
+		return p.ExecDir
+	}
+	return dir
+}
+
 type goTarget struct {
 	goFile  string
 	outFile string
 	proj    *Project
 	defctx  bool
+	modFlag string
+}
+
+// OutputName returns the file name of the executable that building proj
+// produces by default, like go build names it: the base name of the directory
+// of a directory project, or of the first file of a files project (without
+// extension), with .exe added if the target platform is windows. It doesn't
+// build anything.
+func (p *Context) OutputName(proj *Project) string {
+	name := proj.outName
+	if name == "" { // not opened by a Context
+		name = strings.TrimSuffix(proj.FriendlyFname, filepath.Ext(proj.FriendlyFname))
+	}
+	if goos, _ := proj.target(); goos == "windows" {
+		name += ".exe"
+	}
+	return name
 }
 
 func (p *Context) out(src *Project, hash []byte) (ret goTarget) {
@@ -121,15 +425,26 @@ func (p *Context) out(src *Project, hash []byte) (ret goTarget) {
 		fname += ".go"
 	}
 	dir, _ := filepath.Split(p.modfile)
+	if p.defctx {
+		dir = filepath.Join(dir, runCacheDir) + "/"
+	}
 	ret.outFile = dir + "g" + base64.RawURLEncoding.EncodeToString(hash)
+	goos, goarch := src.target()
+	if goos != runtime.GOOS || goarch != runtime.GOARCH { // don't mix up files of different platforms
+		ret.outFile += "_" + goos + "_" + goarch
+	}
+	if src.NoCgo { // nor files built with and without cgo
+		ret.outFile += "_nocgo"
+	}
 	ret.proj = src
 	ret.defctx = p.defctx
+	ret.modFlag = p.modFlag
 	if ret.defctx || src.AutoGenFile == "" {
 		ret.goFile = ret.outFile + fname
 	} else {
 		ret.goFile = src.AutoGenFile
 	}
-	if inWindows {
+	if goos == "windows" {
 		ret.outFile += ".exe"
 	}
 	return
@@ -141,6 +456,99 @@ const (
 
 // -----------------------------------------------------------------------------
 
+const (
+	runCacheDir = "cache"
+)
+
+// cacheKey returns the key of src in the run cache. Besides the source code,
+// it depends on versions of the Go+ and Go toolchains, the target platform and
+// the build options, so that a new Go+ build doesn't serve stale artifacts. The Go version is the
+// one of the go command building the cached executables (see goVersion), not
+// the one gop is built with.
+func cacheKey(src *Project, fp *Fingerp) []byte {
+	var buf bytes.Buffer
+	buf.Write(fp.Hash[:])
+	fmt.Fprintf(&buf, "\n%s\n%s\n%s\n", GOPVERSION, GOPBUILDDATE, goVersion())
+	goos, goarch := src.target()
+	fmt.Fprintf(&buf, "%s/%s\n%v\n", goos, goarch, src.NoCgo)
+	fmt.Fprintf(&buf, "%q\n%q\n", src.BuildArgs, src.BuildTags)
+	hash := sha1.Sum(buf.Bytes())
+	return hash[:]
+}
+
+var (
+	goVerOnce sync.Once
+	goVer     string
+)
+
+// goVersion returns the version of the go command (`go env GOVERSION`), or ""
+// if it's unknown.
+func goVersion() string {
+	goVerOnce.Do(func() {
+		if b, err := exec.Command("go", "env", "GOVERSION").Output(); err == nil {
+			goVer = strings.TrimSpace(string(b))
+		}
+	})
+	return goVer
+}
+
+// evictStale removes the files in the run cache generated from the previous
+// version of the source of out, ie. its Go file and executable, when out is
+// generated from a new version. So the run cache keeps one entry per project
+// and target platform, rather than one per edit. The entry of a project is
+// recorded in a file named after its source and target platform.
+func (p *Context) evictStale(out *goTarget) {
+	src := out.proj
+	goos, goarch := src.target()
+	id := sha1.Sum([]byte(fmt.Sprintf("%s\n%s\n%s/%s\n%v", src.srcDir, src.FriendlyFname, goos, goarch, src.NoCgo)))
+	dir, _ := filepath.Split(out.goFile)
+	entryFile := filepath.Join(dir, "p"+base64.RawURLEncoding.EncodeToString(id[:]))
+	if b, err := os.ReadFile(entryFile); err == nil {
+		if old := strings.SplitN(string(b), "\n", 2); len(old) == 2 && old[1] != out.goFile {
+			os.Remove(old[0])
+			os.Remove(old[1])
+		}
+	}
+	os.WriteFile(entryFile, []byte(out.outFile+"\n"+out.goFile), 0644)
+}
+
+// CleanCache removes all compiled packages in the run cache (see RunCacheDir),
+// including the ones built with go.mod overlays.
+func CleanCache() error {
+	_, err := CleanRunCache(false)
+	return err
+}
+
+// CleanRunCache removes the compiled packages in the run cache like
+// CleanCache, and returns the paths removed. If all is true, it also removes
+// the go.mod & go.sum of the default context, the module copies, the
+// fingerprints of generated Go files (see genStamp) and the contexts of lock
+// files (see withLock), which are recreated when needed, eg. to recover from a
+// corrupted run cache.
+//
+// The list is mirrored by cleanGopRunCache of cmd/make.go, which can't import
+// this package, so keep them in sync.
+func CleanRunCache(all bool) (removed []string, err error) {
+	root := RunCacheDir()
+	names := []string{overlayCacheDir, runCacheDir}
+	if all {
+		names = append(names, modCacheDir, genStampDir, lockCacheDir, "dummy", "go.mod", "go.sum")
+	}
+	for _, name := range names {
+		path := filepath.Join(root, name)
+		if _, e := os.Lstat(path); e != nil {
+			continue
+		}
+		if err = os.RemoveAll(path); err != nil {
+			return
+		}
+		removed = append(removed, path)
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
+
 const (
 	dummyGoFile = `package dummy
 
@@ -148,9 +556,13 @@ import (
 	_ "github.com/goplus/gop"
 )
 `
+	// defaultGoVersion is the go directive of the go.mod of the default
+	// context, see Project.GoVersion.
+	defaultGoVersion = "1.16"
+
 	gomodFormat = `module goplus.org/userapp
 
-go 1.16
+go %s
 
 require (
 	github.com/goplus/gop %s
@@ -172,7 +584,7 @@ func genGomodFile(modfile string) {
 		}
 		gopRoot = filepath.ToSlash(gopRoot)
 	}
-	fmt.Fprintf(&buf, gomodFormat, GOPVERSION, gopRoot)
+	fmt.Fprintf(&buf, gomodFormat, defaultGoVersion, GOPVERSION, gopRoot)
 	err = os.WriteFile(modfile, buf.Bytes(), 0644)
 	if err != nil {
 		log.Panicln(err)
@@ -199,13 +611,17 @@ func execCommand(dir, command string, args ...string) {
 }
 
 func runCommand(dir, command string, args ...string) error {
+	return newCommand(dir, command, args...).Run()
+}
+
+func newCommand(dir, command string, args ...string) *exec.Cmd {
 	cmd := exec.Command(command, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Env = os.Environ()
 	cmd.Dir = dir
-	return cmd.Run()
+	return cmd
 }
 
 func genDefaultGopMod(modfile string) {
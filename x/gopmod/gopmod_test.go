@@ -0,0 +1,1274 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/goplus/gop/cl"
+	"github.com/goplus/gop/x/gopmod"
+	"github.com/goplus/gop/x/gopproj"
+)
+
+// goSource is a Source generating a trivial Go program.
+type goSource struct {
+	file string
+}
+
+func (p *goSource) Fingerp() (*gopmod.Fingerp, error) {
+	fi, err := os.Stat(p.file)
+	if err != nil {
+		return nil, err
+	}
+	return &gopmod.Fingerp{ModTime: fi.ModTime()}, nil
+}
+
+func (p *goSource) GenGo(outFile, modFile string) error {
+	return os.WriteFile(outFile, []byte("package main\n\nfunc main() {\n\tprintln(\"Hi\")\n}\n"), 0644)
+}
+
+// goMod returns the go.mod of module modPath. If requireGop, the module
+// requires Go+ (replaced by GOPROOT), as the Go code generated from Go+
+// files does.
+func goMod(modPath, goVer string, requireGop bool) string {
+	mod := "module " + modPath + "\n\ngo " + goVer + "\n"
+	if requireGop {
+		mod += "\nrequire github.com/goplus/gop v1.0.0" +
+			"\n\nreplace github.com/goplus/gop => " + filepath.ToSlash(gopmod.GOPROOT) + "\n"
+	}
+	return mod
+}
+
+// goSum returns the go.sum of GOPROOT, for the modules Go+ requires.
+func goSum() string {
+	b, _ := os.ReadFile(filepath.Join(gopmod.GOPROOT, "go.sum"))
+	return string(b)
+}
+
+// writeGoMod writes the go.mod (and go.sum if requireGop) of module
+// example.com/foo to dir.
+func writeGoMod(t *testing.T, dir string, requireGop bool) {
+	files := map[string]string{"go.mod": goMod("example.com/foo", "1.16", requireGop)}
+	if requireGop {
+		files["go.sum"] = goSum()
+	}
+	writeFiles(t, dir, files)
+}
+
+// writeFiles writes files to dir. A name ending with "/" makes an empty
+// directory.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		file := filepath.Join(dir, name)
+		if strings.HasSuffix(name, "/") {
+			os.MkdirAll(file, 0755)
+			continue
+		}
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCrossBuild(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	goarch := "arm64"
+	if runtime.GOARCH == goarch {
+		goarch = "amd64"
+	}
+	dir := t.TempDir()
+	writeGoMod(t, dir, false)
+	src := filepath.Join(dir, "foo.gop")
+	if err := os.WriteFile(src, []byte(`println "Hi"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := gopmod.New(dir)
+	proj := &gopmod.Project{
+		Source:        &goSource{file: src},
+		FriendlyFname: "foo.gop",
+		AutoGenFile:   filepath.Join(dir, "gop_autogen.go"),
+		GOOS:          "linux",
+		GOARCH:        goarch,
+	}
+	out := filepath.Join(dir, "foo")
+	cmd := ctx.BuildProject(out, proj)
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("BuildProject failed: %v\n%s", err, b)
+	}
+	f, err := elf.Open(out)
+	if err != nil {
+		t.Fatal("elf.Open:", err)
+	}
+	defer f.Close()
+	machine := elf.EM_AARCH64
+	if goarch == "amd64" {
+		machine = elf.EM_X86_64
+	}
+	if f.Machine != machine {
+		t.Fatal("machine of the executable:", f.Machine)
+	}
+}
+
+func TestWork(t *testing.T) {
+	dir := t.TempDir()
+	writeGoMod(t, dir, false)
+	src := filepath.Join(dir, "foo.gop")
+	if err := os.WriteFile(src, []byte(`println "Hi"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := gopmod.New(dir)
+	proj := &gopmod.Project{
+		Source:        &goSource{file: src},
+		FriendlyFname: "foo.gop",
+		AutoGenFile:   filepath.Join(dir, "gop_autogen.go"),
+		Work:          true,
+	}
+	cmd := ctx.GoCommand("run", proj)
+	if args := strings.Join(cmd.Args, " "); !strings.Contains(args, " -work ") {
+		t.Fatal("GoCommand:", args)
+	}
+	proj.Work = false
+	cmd = ctx.GoCommand("run", proj)
+	if args := strings.Join(cmd.Args, " "); strings.Contains(args, " -work ") {
+		t.Fatal("GoCommand:", args)
+	}
+}
+
+func TestBuildLdflags(t *testing.T) {
+	dir := t.TempDir()
+	writeGoMod(t, dir, false)
+	src := filepath.Join(dir, "foo.gop")
+	if err := os.WriteFile(src, []byte(`println "Hi"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := gopmod.New(dir)
+	proj := &gopmod.Project{
+		Source:        &goSource{file: src},
+		FriendlyFname: "foo.gop",
+		AutoGenFile:   filepath.Join(dir, "gop_autogen.go"),
+	}
+	if goFile, inRunCache, err := ctx.GoFile(proj); err != nil || goFile != proj.AutoGenFile || inRunCache {
+		t.Fatal("GoFile:", goFile, inRunCache, err)
+	}
+	for _, args := range [][]string{{"-ldflags", "-s -w"}, {"-ldflags=-s -w"}, {"--ldflags=-s -w"}} {
+		proj.BuildArgs = args
+		cmd := ctx.BuildProject(filepath.Join(dir, "foo"), proj)
+		n := 0
+		for i, arg := range cmd.Args {
+			if strings.Contains(arg, "ldflags") {
+				n++
+				if !strings.Contains(arg, "-s -w") {
+					arg = cmd.Args[i+1]
+				}
+				if !strings.HasSuffix(arg, gopmod.LoadFlags()+" -s -w") {
+					t.Fatal("BuildProject: ldflags not merged -", arg)
+				}
+			}
+		}
+		if n != 1 {
+			t.Fatal("BuildProject:", cmd.Args)
+		}
+	}
+}
+
+// codeSource is a Source generating the Go file code.
+type codeSource struct {
+	goSource
+	code string
+}
+
+func (p *codeSource) GenGo(outFile, modFile string) error {
+	return os.WriteFile(outFile, []byte(p.code), 0644)
+}
+
+func TestNoCgo(t *testing.T) {
+	dir := t.TempDir()
+	writeGoMod(t, dir, false)
+	src := filepath.Join(dir, "foo.gop")
+	if err := os.WriteFile(src, []byte(`println "Hi"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := gopmod.New(dir)
+	source := &codeSource{
+		goSource: goSource{file: src},
+		code:     "package main\n\nimport \"os\"\n\nfunc main() {\n\tprint(os.Getenv(\"CGO_ENABLED\"))\n}\n",
+	}
+	proj := &gopmod.Project{
+		Source:        source,
+		FriendlyFname: "foo.gop",
+		AutoGenFile:   filepath.Join(dir, "gop_autogen.go"),
+		ForceToGen:    true,
+		NoCgo:         true,
+	}
+	cmd := ctx.BuildProject(filepath.Join(dir, "foo"), proj)
+	if !hasEnv(cmd.Env, "CGO_ENABLED=0") {
+		t.Fatal("BuildProject: no CGO_ENABLED=0 -", cmd.Env)
+	}
+	gocmd := ctx.GoCommand("run", proj)
+	var stderr bytes.Buffer
+	gocmd.Stderr = &stderr
+	if err := gocmd.Run(); err != nil || !hasEnv(gocmd.Env, "CGO_ENABLED=0") {
+		t.Fatalf("GoCommand: %v %v\n%s", err, gocmd.Env, stderr.String())
+	}
+	if stderr.String() != "0" { // the go command runs the program with its environment
+		t.Fatalf("GoCommand: CGO_ENABLED=%q", stderr.String())
+	}
+	proj.NoCgo = false
+	if cmd = ctx.BuildProject(filepath.Join(dir, "foo"), proj); hasEnv(cmd.Env, "CGO_ENABLED=0") {
+		t.Fatal("BuildProject: CGO_ENABLED=0 without NoCgo")
+	}
+
+	source.code = "package main\n\nimport \"C\"\n\nfunc main() {\n}\n"
+	if err := gopmod.CheckNoCgo(proj.AutoGenFile); err != nil {
+		t.Fatal("CheckNoCgo:", err)
+	}
+	ctx.BuildProject(filepath.Join(dir, "foo"), proj) // without NoCgo, it's the go command to check
+	err := gopmod.CheckNoCgo(proj.AutoGenFile)
+	if !errors.Is(err, gopmod.ErrCgoImported) {
+		t.Fatal("CheckNoCgo:", err)
+	}
+	proj.NoCgo = true
+	defer func() {
+		if e := recover(); e == nil || !strings.Contains(e.(string), gopmod.ErrCgoImported.Error()) {
+			t.Fatal("BuildProject importing C:", e)
+		}
+	}()
+	ctx.BuildProject(filepath.Join(dir, "foo"), proj)
+}
+
+func TestExecDir(t *testing.T) {
+	dir := t.TempDir()
+	writeGoMod(t, dir, false)
+	src := filepath.Join(dir, "foo.gop")
+	if err := os.WriteFile(src, []byte(`println "Hi"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	execDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proj := &gopmod.Project{
+		Source: &codeSource{
+			goSource: goSource{file: src},
+			code:     "package main\n\nimport \"os\"\n\nfunc main() {\n\twd, _ := os.Getwd()\n\tprint(wd)\n}\n",
+		},
+		FriendlyFname: "foo.gop",
+		AutoGenFile:   filepath.Join(dir, "gop_autogen.go"),
+		ForceToGen:    true,
+		ExecDir:       execDir,
+	}
+	cmd := gopmod.New(dir).GoCommand("run", proj) // go run can't run the program in ExecDir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("GoCommand: %v\n%s", err, stderr.String())
+	}
+	if wd := stderr.String(); wd != execDir {
+		t.Fatalf("GoCommand: working directory %q, expected %q", wd, execDir)
+	}
+	if cmd.Args[1] != "build" {
+		t.Fatal("GoCommand:", cmd.Args)
+	}
+}
+
+func hasEnv(env []string, kv string) bool {
+	for _, v := range env {
+		if v == kv {
+			return true
+		}
+	}
+	return false
+}
+
+func TestImports(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":     goMod("example.com/foo", "1.16", true),
+		"go.sum":     goSum(),
+		"bar/bar.go": "package bar\n\nconst Name = \"bar\"\n",
+		"main.gop":   "import (\n\t\"unicode/utf8\"\n\n\t\"example.com/foo/bar\"\n)\n\nprintln utf8.RuneCountInString(bar.Name)\n",
+	}
+	writeFiles(t, dir, files)
+	ctx := gopmod.New(dir)
+	proj, err := ctx.OpenProject(0, &gopproj.DirProj{Dir: dir})
+	if err != nil {
+		t.Fatal("OpenProject:", err)
+	}
+	imports, err := ctx.Imports(proj)
+	if err != nil {
+		t.Fatal("Imports:", err)
+	}
+	has := make(map[string]bool)
+	for _, pkgPath := range imports {
+		has[pkgPath] = true
+	}
+	for _, pkgPath := range []string{"example.com/foo/bar", "fmt", "unicode/utf8", "io", "errors"} { // io, errors: imported by fmt
+		if !has[pkgPath] {
+			t.Fatal("Imports: no", pkgPath, "-", imports)
+		}
+	}
+	if has["example.com/foo"] || !sort.StringsAreSorted(imports) {
+		t.Fatal("Imports:", imports)
+	}
+	injected, err := ctx.InjectedImports(proj)
+	if err != nil {
+		t.Fatal("InjectedImports:", err)
+	}
+	if v := strings.Join(injected, " "); v != "fmt" {
+		t.Fatal("InjectedImports:", v)
+	}
+}
+
+func TestList(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":      goMod("example.com/foo", "1.16", false),
+		"bar/bar.go":  "package bar\n\nimport \"unicode/utf8\"\n\nvar Len = utf8.RuneCountInString\n",
+		"main.gop":    "import \"example.com/foo/bar\"\n\nprintln bar.Len(name)\n",
+		"util.go":     "package main\n\nconst name = \"Hi\"\n",
+		"lib/lib.gop": "package lib\n\nimport \"../bar\"\n\nfunc Len(s string) int {\n\treturn bar.Len(s)\n}\n",
+	}
+	writeFiles(t, dir, files)
+	ctx := gopmod.New(dir)
+	proj, err := ctx.OpenProject(0, &gopproj.DirProj{Dir: dir})
+	if err != nil {
+		t.Fatal("OpenProject:", err)
+	}
+	pkg, err := ctx.List(proj, true)
+	if err != nil {
+		t.Fatal("List:", err)
+	}
+	if pkg.Dir != dir || pkg.Name != "main" || !pkg.Main ||
+		strings.Join(pkg.GopFiles, " ") != "main.gop" || strings.Join(pkg.GoFiles, " ") != "util.go" ||
+		strings.Join(pkg.Imports, " ") != "example.com/foo/bar" ||
+		strings.Join(pkg.Deps, " ") != "example.com/foo/bar unicode/utf8" {
+		t.Fatal("List:", pkg)
+	}
+
+	proj, err = ctx.OpenProject(0, &gopproj.FilesProj{Files: []string{filepath.Join(dir, "lib", "lib.gop")}})
+	if err != nil {
+		t.Fatal("OpenProject:", err)
+	}
+	pkg, err = ctx.List(proj, false)
+	if err != nil {
+		t.Fatal("List:", err)
+	}
+	if pkg.Name != "lib" || pkg.Main || strings.Join(pkg.GopFiles, " ") != "lib.gop" ||
+		strings.Join(pkg.Imports, " ") != "example.com/foo/bar" || pkg.Deps != nil {
+		t.Fatal("List:", pkg)
+	}
+}
+
+func setenv(t *testing.T, key, val string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, val)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestOpenModule(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	dir := t.TempDir()
+	writeGoMod(t, dir, false)
+	setenv(t, "GOPROXY", "file://"+filepath.ToSlash(newModProxy(t, dir)))
+	setenv(t, "GOSUMDB", "off")
+	setenv(t, "GOFLAGS", "-modcacherw")
+	setenv(t, "GOMODCACHE", filepath.Join(dir, "modcache"))
+	setenv(t, "HOME", filepath.Join(dir, "home"))
+
+	ctx := gopmod.New(dir)
+	proj, err := ctx.OpenProject(0, &gopproj.PkgPathProj{Path: "example.com/hello/cmd/hi", Version: "latest"})
+	if err != nil {
+		t.Fatal("OpenProject:", err)
+	}
+	autogen := filepath.Join(dir, "home", ".gop", "run", "mod", "example.com", "hello@v1.0.0", "cmd", "hi", "gop_autogen.go")
+	if proj.FriendlyFname != "hi" || proj.AutoGenFile != autogen {
+		t.Fatal("OpenProject:", proj.FriendlyFname, proj.AutoGenFile)
+	}
+	if _, err = ctx.OpenProject(0, &gopproj.PkgPathProj{Path: "example.com/hello/cmd/hi", Version: "v1.2.0"}); err == nil {
+		t.Fatal("OpenProject: no error?")
+	}
+}
+
+// newModProxy creates a module proxy in dir/proxy serving module
+// example.com/hello v1.0.0, and returns its directory.
+func newModProxy(t *testing.T, dir string) string {
+	proxy := filepath.Join(dir, "proxy", "example.com", "hello", "@v")
+	os.MkdirAll(proxy, 0755)
+	helloMod := goMod("example.com/hello", "1.16", false)
+	var zipData bytes.Buffer
+	zw := zip.NewWriter(&zipData)
+	for name, data := range map[string]string{"go.mod": helloMod, "cmd/hi/hi.gop": `println "Hi"`} {
+		w, _ := zw.Create("example.com/hello@v1.0.0/" + name)
+		w.Write([]byte(data))
+	}
+	zw.Close()
+	for name, data := range map[string]string{
+		"list":        "v1.0.0\n",
+		"v1.0.0.info": `{"Version":"v1.0.0"}`,
+		"v1.0.0.mod":  helloMod,
+		"v1.0.0.zip":  zipData.String(),
+	} {
+		if err := os.WriteFile(filepath.Join(proxy, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "proxy")
+}
+
+func TestDownloadRetry(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	dir := t.TempDir()
+	writeGoMod(t, dir, false)
+	var failures int32 // number of requests to fail with 503
+	files := http.FileServer(http.Dir(newModProxy(t, dir)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/example.com/hello/@v/") && atomic.AddInt32(&failures, -1) >= 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	setenv(t, "GOPROXY", server.URL)
+	setenv(t, "GOSUMDB", "off")
+	setenv(t, "GOFLAGS", "-modcacherw")
+	setenv(t, "GOMODCACHE", filepath.Join(dir, "modcache"))
+	setenv(t, "HOME", filepath.Join(dir, "home"))
+
+	ctx := gopmod.New(dir)
+	src := &gopproj.PkgPathProj{Path: "example.com/hello/cmd/hi", Version: "v1.0.0"}
+	setenv(t, gopmod.DownloadAttemptsEnv, "1")
+	atomic.StoreInt32(&failures, 1)
+	if _, err := ctx.OpenProject(0, src); err == nil {
+		t.Fatal("OpenProject: no error?")
+	}
+	setenv(t, gopmod.DownloadAttemptsEnv, "2")
+	atomic.StoreInt32(&failures, 1)
+	if _, err := ctx.OpenProject(0, src); err != nil {
+		t.Fatal("OpenProject:", err)
+	}
+}
+
+func TestProjKind(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		file, src string
+		kind      gopmod.ProjKind
+		errMsg    string
+	}{
+		{"script.gop", `println "Hi"`, gopmod.KindCmd, ""},
+		{"main.gop", "package main\n\nfunc main() {\n}\n", gopmod.KindCmd, ""},
+		{"main.go", "package main\n\nfunc main() {\n}\n", gopmod.KindCmd, ""},
+		{"nomain.gop", "package main\n\nfunc foo() {\n}\n", gopmod.KindLib,
+			"cannot run nomain.gop: function main is undeclared in the main package"},
+		{"lib.gop", "package foo\n\nfunc Foo() {\n}\n", gopmod.KindLib,
+			"cannot run lib.gop: package foo is a library, not a main package"},
+		{"bad.gop", "package foo\n\nfunc Foo( {\n", gopmod.KindUnknown, ""},
+	}
+	writeGoMod(t, dir, false)
+	ctx := gopmod.New(dir)
+	for _, c := range cases {
+		file := filepath.Join(dir, c.file)
+		if err := os.WriteFile(file, []byte(c.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		proj, err := ctx.OpenProject(0, &gopproj.FilesProj{Files: []string{file}})
+		if err != nil {
+			t.Fatal("OpenProject:", err)
+		}
+		if proj.Kind != c.kind {
+			t.Fatal(c.file, "- Kind:", proj.Kind)
+		}
+		err = proj.CheckRunnable()
+		if c.errMsg == "" && err != nil || c.errMsg != "" && (err == nil || err.Error() != c.errMsg) {
+			t.Fatal(c.file, "- CheckRunnable:", err)
+		}
+	}
+}
+
+func TestOutputName(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hello.v2")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod("example.com/hello", "1.16", false)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, fname := range []string{"foo.gop", "bar.gop"} {
+		if err := os.WriteFile(filepath.Join(dir, fname), []byte(`println "Hi"`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	ctx := gopmod.New(dir)
+	cases := []struct {
+		proj gopproj.Proj
+		goos string
+		name string
+	}{
+		{&gopproj.DirProj{Dir: dir}, "", "hello.v2" + exe},
+		{&gopproj.FilesProj{Files: []string{filepath.Join(dir, "foo.gop")}}, "", "foo" + exe},
+		{&gopproj.FilesProj{Files: []string{filepath.Join(dir, "bar.gop"), filepath.Join(dir, "foo.gop")}}, "", "bar" + exe},
+		{&gopproj.DirProj{Dir: dir}, "windows", "hello.v2.exe"},
+		{&gopproj.FilesProj{Files: []string{filepath.Join(dir, "foo.gop")}}, "linux", "foo"},
+	}
+	for _, c := range cases {
+		proj, err := ctx.OpenProject(0, c.proj)
+		if err != nil {
+			t.Fatal("OpenProject:", err)
+		}
+		proj.GOOS = c.goos
+		if name := ctx.OutputName(proj); name != c.name {
+			t.Fatal("OutputName:", name, "expected:", c.name)
+		}
+	}
+}
+
+func TestBuildLib(t *testing.T) {
+	dir := t.TempDir()
+	writeGoMod(t, dir, true)
+	src := filepath.Join(dir, "foo.gop")
+	if err := os.WriteFile(src, []byte("package foo; func Add(a, b int) int { return a + b }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := gopmod.New(dir)
+	proj, err := ctx.OpenFiles(0, src)
+	if err != nil || proj.Kind != gopmod.KindLib {
+		t.Fatal("OpenFiles:", proj, err)
+	}
+	cmd := ctx.BuildProject(os.DevNull, proj)
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("BuildProject failed: %v\n%s", err, b)
+	}
+	goFile, _, err := ctx.GoFile(proj)
+	if err != nil {
+		t.Fatal("GoFile:", err)
+	}
+	if b, err := os.ReadFile(goFile); err != nil || !strings.HasPrefix(string(b), "package foo\n") {
+		t.Fatalf("GoFile: %v\n%s", err, b)
+	}
+}
+
+func TestRunCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	old, ok := os.LookupEnv("GOPRUNCACHE")
+	os.Setenv("GOPRUNCACHE", dir)
+	defer func() {
+		if ok {
+			os.Setenv("GOPRUNCACHE", old)
+		} else {
+			os.Unsetenv("GOPRUNCACHE")
+		}
+	}()
+	if ret := gopmod.RunCacheDir(); ret != dir {
+		t.Fatal("RunCacheDir:", ret)
+	}
+	cache := filepath.Join(dir, "cache")
+	os.MkdirAll(cache, 0755)
+	if err := gopmod.CleanCache(); err != nil {
+		t.Fatal("CleanCache:", err)
+	}
+	if _, err := os.Stat(cache); !os.IsNotExist(err) {
+		t.Fatal("CleanCache: cache not removed -", err)
+	}
+	for _, name := range []string{"cache", "ovl", "mod", "lock", "go.mod"} {
+		os.MkdirAll(filepath.Join(dir, name), 0755)
+	}
+	removed, err := gopmod.CleanRunCache(false)
+	if err != nil || len(removed) != 2 || removed[0] != filepath.Join(dir, "ovl") || removed[1] != cache {
+		t.Fatal("CleanRunCache:", removed, err)
+	}
+	removed, err = gopmod.CleanRunCache(true)
+	if err != nil || strings.Join(removed, " ") != filepath.Join(dir, "mod")+" "+filepath.Join(dir, "lock")+" "+filepath.Join(dir, "go.mod") {
+		t.Fatal("CleanRunCache:", removed, err)
+	}
+	os.Unsetenv("GOPRUNCACHE")
+	if ret := gopmod.RunCacheDir(); ret == dir || filepath.Base(ret) != "run" {
+		t.Fatal("RunCacheDir:", ret)
+	}
+}
+
+// hashSource is a Source generating the Go file code, whose fingerprint is
+// the hash of code.
+type hashSource struct {
+	codeSource
+}
+
+func (p *hashSource) Fingerp() (*gopmod.Fingerp, error) {
+	return &gopmod.Fingerp{Hash: sha1.Sum([]byte(p.code))}, nil
+}
+
+func TestRunCacheEvict(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	runCache := t.TempDir()
+	if err := os.WriteFile(filepath.Join(runCache, "go.mod"), []byte(goMod("goplus.org/userapp", "1.16", false)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := gopmod.NewDefault(t.TempDir(), &gopmod.Config{RunCacheDir: runCache})
+	source := new(hashSource)
+	proj := &gopmod.Project{Source: source, FriendlyFname: "hi.gop"}
+	run := func(msg string) {
+		source.code = "package main\n\nfunc main() {\n\tprint(\"" + msg + "\")\n}\n"
+		cmd := ctx.GoCommand("run", proj)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("GoCommand: %v\n%s", err, stderr.String())
+		}
+		if stdout.String()+stderr.String() != msg {
+			t.Fatal("GoCommand:", stdout.String(), stderr.String())
+		}
+	}
+	entries := func() []string {
+		fis, err := os.ReadDir(filepath.Join(runCache, "cache"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, fi := range fis {
+			if name := fi.Name(); strings.HasPrefix(name, "g") {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	run("Hi")
+	first := entries()
+	if len(first) != 2 { // the Go file and the executable
+		t.Fatal("run cache:", first)
+	}
+	run("Hi")
+	if v := entries(); strings.Join(v, " ") != strings.Join(first, " ") {
+		t.Fatal("run cache of an unchanged project:", v)
+	}
+	run("Hello")
+	second := entries()
+	if len(second) != 2 || second[0] == first[0] || second[0] == first[1] {
+		t.Fatal("run cache after an edit:", first, second)
+	}
+
+	other := &gopmod.Project{Source: &hashSource{codeSource{code: "package main\n\nfunc main() {\n}\n"}}, FriendlyFname: "other.gop"}
+	if err := ctx.GoCommand("run", other).Run(); err != nil {
+		t.Fatal("GoCommand:", err)
+	}
+	if v := entries(); len(v) != 4 { // other projects are kept
+		t.Fatal("run cache of two projects:", v)
+	}
+}
+
+func TestModOverlay(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	dir := t.TempDir()
+	runCache := filepath.Join(dir, "run")
+	baseMod := goMod("goplus.org/userapp", "1.16", true)
+	files := map[string]string{
+		"run/go.mod":         baseMod,
+		"run/go.sum":         goSum(),
+		"fork/go.mod":        goMod("example.com/fork", "1.16", false),
+		"fork/fork.go":       "package fork\n\nfunc Name() string {\n\treturn \"local fork\"\n}\n",
+		"proj/main.gop":      "import \"example.com/fork\"\n\nprintln fork.Name()\n",
+		"proj/gop.run.mod":   "require example.com/fork v1.0.0\n\nreplace example.com/fork => ../fork\n\nexclude example.com/fork v0.9.0\n",
+		"noovl/main.gop":     "println \"Hi\"\n",
+		"noovl/gop.run.mod/": "",
+	}
+	writeFiles(t, dir, files)
+	projDir := filepath.Join(dir, "proj")
+	ctx := gopmod.NewDefault(projDir, &gopmod.Config{RunCacheDir: runCache})
+	proj, err := ctx.OpenProject(0, &gopproj.DirProj{Dir: projDir})
+	if err != nil {
+		t.Fatal("OpenProject:", err)
+	}
+	if proj.ModOverlay != filepath.Join(projDir, gopmod.ModOverlayFile) {
+		t.Fatal("ModOverlay:", proj.ModOverlay)
+	}
+	proj.UseDefaultCtx = true
+	out := filepath.Join(dir, "main")
+	cmd := ctx.BuildProject(out, proj)
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("BuildProject failed: %v\n%s", err, b)
+	}
+	if b, err := exec.Command(out).Output(); err != nil || string(b) != "local fork\n" {
+		t.Fatal("run:", string(b), err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(runCache, "go.mod")); string(b) != baseMod {
+		t.Fatal("go.mod of the default context changed:\n", string(b))
+	}
+	mods, _ := filepath.Glob(filepath.Join(runCache, "ovl", "*", "go.mod"))
+	if len(mods) != 1 {
+		t.Fatal("merged go.mod:", mods)
+	}
+	b, err := os.ReadFile(mods[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, directive := range []string{
+		"github.com/goplus/gop v1.0.0",
+		"example.com/fork v1.0.0",
+		"example.com/fork => " + filepath.ToSlash(filepath.Join(dir, "fork")),
+		"exclude example.com/fork v0.9.0",
+	} {
+		if !strings.Contains(string(b), directive) {
+			t.Fatalf("merged go.mod: %q not found\n%s", directive, b)
+		}
+	}
+
+	noovl := filepath.Join(dir, "noovl")
+	if proj, err = ctx.OpenProject(0, &gopproj.DirProj{Dir: noovl}); err != nil || proj.ModOverlay != "" {
+		t.Fatal("OpenProject:", proj, err)
+	}
+}
+
+func TestGoVersion(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	dir := t.TempDir()
+	runCache := filepath.Join(dir, "run")
+	baseMod := goMod("goplus.org/userapp", "1.16", true)
+	files := map[string]string{
+		"run/go.mod":    baseMod,
+		"run/go.sum":    goSum(),
+		"proj/main.gop": "println 0b101\n",
+	}
+	writeFiles(t, dir, files)
+	projDir := filepath.Join(dir, "proj")
+	ctx := gopmod.NewDefault(projDir, &gopmod.Config{RunCacheDir: runCache})
+	proj, err := ctx.OpenProject(0, &gopproj.DirProj{Dir: projDir})
+	if err != nil {
+		t.Fatal("OpenProject:", err)
+	}
+	proj.UseDefaultCtx = true
+	proj.GoVersion = "go1.13"
+	out := filepath.Join(dir, "main")
+	cmd := ctx.BuildProject(out, proj)
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("BuildProject failed: %v\n%s", err, b)
+	}
+	if b, err := exec.Command(out).Output(); err != nil || string(b) != "5\n" {
+		t.Fatal("run:", string(b), err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(runCache, "go.mod")); string(b) != baseMod {
+		t.Fatal("go.mod of the default context changed:\n", string(b))
+	}
+	mods, _ := filepath.Glob(filepath.Join(runCache, "ovl", "*", "go.mod"))
+	if len(mods) != 1 {
+		t.Fatal("go.mod of go1.13:", mods)
+	}
+	if b, _ := os.ReadFile(mods[0]); !strings.Contains(string(b), "\ngo 1.13\n") {
+		t.Fatal("go.mod of go1.13:\n", string(b))
+	}
+
+	proj.GoVersion = "go1.12"
+	err = proj.GenGo(filepath.Join(dir, "gop_autogen.go"), filepath.Join(runCache, "go.mod"))
+	if err == nil || !strings.Contains(err.Error(), "requires go1.13 or later (target Go version is go1.12)") {
+		t.Fatal("GenGo:", err)
+	}
+}
+
+func TestBuildConstraints(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":      goMod("example.com/foo", "1.16", true),
+		"go.sum":      goSum(),
+		"main.gop":    "println hello\n",
+		"plan9.gop":   "//gop:build plan9\n\nvar hello = \"plan9\"\n",
+		"other.gop":   "//gop:build !plan9 && !foo\n\nvar hello = \"other\"\n",
+		"foo.gop":     "//gop:build !plan9 && foo\n\nvar hello = \"foo\"\n",
+		"excluded.go": "//go:build ignore\n\npackage main\n\nfunc hello() {}\n",
+	}
+	writeFiles(t, dir, files)
+	ctx := gopmod.New(dir)
+	genGo := func(proj *gopmod.Project) string {
+		goFile := filepath.Join(dir, "gop_autogen.go")
+		if err := proj.GenGo(goFile, filepath.Join(dir, "go.mod")); err != nil {
+			t.Fatal("GenGo:", err)
+		}
+		b, _ := os.ReadFile(goFile)
+		return string(b)
+	}
+
+	proj, err := ctx.OpenProject(0, &gopproj.DirProj{Dir: dir})
+	if err != nil {
+		t.Fatal("OpenProject:", err)
+	}
+	proj.GOOS = "linux"
+	if v := genGo(proj); !strings.Contains(v, `"other"`) || strings.Contains(v, `"foo"`) || strings.Contains(v, `"plan9"`) {
+		t.Fatal("linux:\n", v)
+	}
+	proj.GOOS = "plan9"
+	if v := genGo(proj); !strings.Contains(v, `"plan9"`) || strings.Contains(v, `"other"`) {
+		t.Fatal("plan9:\n", v)
+	}
+
+	proj, err = ctx.OpenProject(0, &gopproj.DirProj{Dir: dir, BuildTags: []string{"foo"}})
+	if err != nil {
+		t.Fatal("OpenProject:", err)
+	}
+	proj.GOOS = "linux"
+	if v := genGo(proj); !strings.Contains(v, `"foo"`) || strings.Contains(v, `"other"`) {
+		t.Fatal("linux, -tags foo:\n", v)
+	}
+}
+
+func TestBuildTargetRegen(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	dir := t.TempDir()
+	runCache := filepath.Join(dir, "run")
+	writeFiles(t, dir, map[string]string{
+		"proj/go.mod":    goMod("example.com/foo", "1.16", true),
+		"proj/go.sum":    goSum(),
+		"proj/main.gop":  "println hello\n",
+		"proj/plan9.gop": "//gop:build plan9\n\nvar hello = \"plan9\"\n",
+		"proj/other.gop": "//gop:build !plan9 && !foo\n\nvar hello = \"other\"\n",
+		"proj/foo.gop":   "//gop:build !plan9 && foo\n\nvar hello = \"foo\"\n",
+		"run/go.mod":     goMod("goplus.org/userapp", "1.16", true),
+		"run/go.sum":     goSum(),
+	})
+	projDir := filepath.Join(dir, "proj")
+	conf := &gopmod.Config{RunCacheDir: runCache}
+	for _, ctx := range []*gopmod.Context{gopmod.New(projDir, conf), gopmod.NewDefault(projDir, conf)} {
+		genGo := func(goos string, tags ...string) string {
+			proj, err := ctx.OpenProject(0, &gopproj.DirProj{Dir: projDir, BuildTags: tags})
+			if err != nil {
+				t.Fatal("OpenProject:", err)
+			}
+			proj.GOOS = goos
+			ctx.BuildProject(filepath.Join(dir, "out"), proj) // generates the Go file, without building it
+			goFile, _, err := ctx.GoFile(proj)
+			if err != nil {
+				t.Fatal("GoFile:", err)
+			}
+			b, _ := os.ReadFile(goFile)
+			return string(b)
+		}
+		if v := genGo("linux"); !strings.Contains(v, `"other"`) {
+			t.Fatal("linux:\n", v)
+		}
+		if v := genGo("plan9"); !strings.Contains(v, `"plan9"`) {
+			t.Fatal("plan9:\n", v)
+		}
+		if v := genGo("linux", "foo"); !strings.Contains(v, `"foo"`) {
+			t.Fatal("linux, -tags foo:\n", v)
+		}
+		if v := genGo("linux"); !strings.Contains(v, `"other"`) { // not the newer Go file generated for -tags foo
+			t.Fatal("linux again:\n", v)
+		}
+	}
+}
+
+func TestModConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"gop.mod":  "module example.com/foo\n\ngo 1.12\n\ntags purego,netgo\n\nclassfile .gmxconf .spxconf example.com/foo/game\nthis self\n",
+		"go.mod":   goMod("example.com/foo", "1.12", true),
+		"go.sum":   goSum(),
+		"main.gop": "println 0b101\n",
+	}
+	writeFiles(t, dir, files)
+	ctx := gopmod.New(dir)
+	proj, err := ctx.OpenProject(0, &gopproj.DirProj{Dir: dir})
+	if err != nil {
+		t.Fatal("OpenProject:", err)
+	}
+	if strings.Join(proj.BuildTags, ",") != "purego,netgo" {
+		t.Fatal("OpenProject: default build tags", proj.BuildTags)
+	}
+	err = proj.GenGo(filepath.Join(dir, "gop_autogen.go"), filepath.Join(dir, "gop.mod"))
+	if err == nil || !strings.Contains(err.Error(), "requires go1.13 or later (target Go version is go1.12)") {
+		t.Fatal("GenGo:", err)
+	}
+	if _, _, _, this, ok := cl.ClassFileInfo("Hero.spxconf"); !ok || this != "self" {
+		t.Fatal("classfile not registered:", this)
+	}
+	gopmod.New(dir) // register the classfile only once
+
+	proj, err = ctx.OpenProject(0, &gopproj.DirProj{Dir: dir, BuildTags: []string{"foo"}})
+	if err != nil || strings.Join(proj.BuildTags, ",") != "foo" {
+		t.Fatal("OpenProject: build tags", proj.BuildTags, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "gop.mod"), []byte("module example.com/foo\n\ntags a-b\n"), 0644)
+	if _, err = gopmod.New(dir).OpenProject(0, &gopproj.DirProj{Dir: dir}); err == nil {
+		t.Fatal("OpenProject: no error?")
+	}
+}
+
+func TestLock(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	dir := t.TempDir()
+	runCache := filepath.Join(dir, "run")
+	baseMod := goMod("goplus.org/userapp", "1.16", true)
+	files := map[string]string{
+		"run/go.mod":       baseMod,
+		"run/go.sum":       goSum(),
+		"fork/go.mod":      goMod("example.com/fork", "1.16", false),
+		"fork/fork.go":     "package fork\n\nfunc Name() string {\n\treturn \"local fork\"\n}\n",
+		"proj/main.gop":    "import \"example.com/fork\"\n\nprintln fork.Name()\n",
+		"proj/gop.run.mod": "require example.com/fork v1.0.0\n\nreplace example.com/fork => ../fork\n",
+	}
+	writeFiles(t, dir, files)
+	projDir := filepath.Join(dir, "proj")
+	ctx := gopmod.NewDefault(projDir, &gopmod.Config{RunCacheDir: runCache})
+	proj, err := ctx.OpenProject(0, &gopproj.DirProj{Dir: projDir})
+	if err != nil {
+		t.Fatal("OpenProject:", err)
+	}
+	if err = ctx.Lock(proj); err != nil {
+		t.Fatal("Lock:", err)
+	}
+	if proj.LockFile() != filepath.Join(projDir, "proj.gop.lock") {
+		t.Fatal("LockFile:", proj.LockFile())
+	}
+	lock, err := os.ReadFile(proj.LockFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(lock), "example.com/fork => ../fork") ||
+		!strings.Contains(string(lock), "github.com/goplus/gop v1.0.0") ||
+		strings.Contains(string(lock), filepath.ToSlash(gopmod.GOPROOT)) {
+		t.Fatal("lock file:\n", string(lock))
+	}
+	sumFile := filepath.Join(projDir, "proj.gop.sum")
+	if sum, err := os.ReadFile(sumFile); err != nil || !strings.Contains(string(sum), "github.com/goplus/gox") {
+		t.Fatal("lock sum file:", string(sum), err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(runCache, "go.mod")); string(b) != baseMod {
+		t.Fatal("go.mod of the default context changed:\n", string(b))
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(runCache, "lock", "tmp*")); len(tmps) != 0 {
+		t.Fatal("temporary module not removed:", tmps)
+	}
+
+	setenv(t, "GOFLAGS", "") // don't let -mod=mod update the locked go.mod when compiling
+	proj.Locked = true
+	out := filepath.Join(dir, "main")
+	if b, err := ctx.BuildProject(out, proj).CombinedOutput(); err != nil {
+		t.Fatalf("BuildProject failed: %v\n%s", err, b)
+	}
+	if b, err := exec.Command(out).Output(); err != nil || string(b) != "local fork\n" {
+		t.Fatal("run:", string(b), err)
+	}
+
+	// The fork isn't required: the lock is stale, and it isn't updated.
+	stale := strings.Replace(string(lock), "example.com/fork v1.0.0", "", 1)
+	os.WriteFile(proj.LockFile(), []byte(stale), 0644)
+	err = func() (err error) {
+		defer func() {
+			if e := recover(); e != nil { // failed to compile
+				err = fmt.Errorf("%v", e)
+			}
+		}()
+		_, err = ctx.BuildProject(out, proj).CombinedOutput()
+		return
+	}()
+	if err == nil {
+		t.Fatal("BuildProject: no error?")
+	}
+}
+
+func TestDumpGo(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":   goMod("example.com/foo", "1.16", true),
+		"go.sum":   goSum(),
+		"main.gop": "println hello()\n",
+		"b.gop":    "func hello() string {\n\treturn world\n}\n",
+		"a.go":     "package main\n\nvar world = \"Hi\"\n",
+	}
+	writeFiles(t, dir, files)
+	ctx := gopmod.New(dir)
+	proj, err := ctx.OpenProject(0, &gopproj.DirProj{Dir: dir})
+	if err != nil {
+		t.Fatal("OpenProject:", err)
+	}
+	goFile, _, err := ctx.GoFile(proj)
+	if err != nil {
+		t.Fatal("GoFile:", err)
+	}
+	header := "// " + filepath.Base(goFile) + ": generated from a.go, b.gop, main.gop\n\n"
+	for _, changed := range []bool{true, false} {
+		var buf bytes.Buffer
+		proj.DumpGo = &buf
+		proj.FlagNRINC = true
+		if cmd := ctx.GoCommand("run", proj); cmd.IsValid() != changed {
+			t.Fatal("GoCommand: changed -", cmd.IsValid())
+		}
+		b, err := os.ReadFile(goFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dump := buf.String(); dump != header+string(b) {
+			t.Fatalf("DumpGo (changed: %v):\n%s", changed, dump)
+		}
+		if !strings.Contains(string(b), "func hello() string") {
+			t.Fatal("generated Go code:\n", string(b))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = gopmod.DumpGoFile(&buf, filepath.Join(dir, "a.go")); err != nil || buf.String() != "// a.go\n\n"+files["a.go"] {
+		t.Fatalf("DumpGoFile without sources: %v\n%s", err, buf.String())
+	}
+	if err = gopmod.DumpGoFile(&buf, filepath.Join(dir, "unknown.go"), "unknown.gop"); !os.IsNotExist(err) {
+		t.Fatal("DumpGoFile of a file not found:", err)
+	}
+}
+
+func TestOpenDirMixed(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	dir := t.TempDir()
+	writeGoMod(t, dir, true)
+	writeFiles(t, dir, map[string]string{
+		"main.gop":         "println hello()\n",
+		"hello.go":         "package main\n\nfunc hello() string {\n\treturn \"Hi\"\n}\n",
+		"hello_test.go":    "package main\n",
+		"hello_test.gop":   "package main_test\n\nimport \"testing\"\n\nfunc TestHello(t *testing.T) {\n}\n",
+		"gop_autogen.go":   "package main\n",
+		"_ignored.gop":     "println 1\n",
+		".hidden.gop":      "println 2\n",
+		"sub/ignored.gop":  "println 3\n",
+		"README.md":        "# foo\n",
+		"onlygo/foo.go":    "package main\n",
+		"onlygop/main.gop": "println \"Hi\"\n",
+	})
+	ctx := gopmod.New(dir)
+	proj, err := ctx.OpenDir(0, dir)
+	if err != nil {
+		t.Fatal("OpenDir:", err)
+	}
+	if proj.FriendlyFname != filepath.Base(dir) || proj.AutoGenFile != filepath.Join(dir, ".gop", "gop_autogen.gop.go") {
+		t.Fatal("OpenDir:", proj.FriendlyFname, proj.AutoGenFile)
+	}
+	var buf bytes.Buffer
+	goFile := filepath.Join(t.TempDir(), "gop_autogen.go")
+	if err = proj.GenGo(goFile, filepath.Join(dir, "go.mod")); err != nil {
+		t.Fatal("GenGo:", err)
+	}
+	if err = gopmod.DumpGoFile(&buf, goFile); err != nil {
+		t.Fatal("DumpGoFile:", err)
+	}
+	if code := buf.String(); !strings.Contains(code, "func hello() string") || strings.Contains(code, "println") ||
+		strings.Count(code, "fmt.Println(") != 1 {
+		t.Fatal("GenGo:\n", code)
+	}
+
+	if proj, err = ctx.OpenDir(0, filepath.Join(dir, "onlygop")); err != nil {
+		t.Fatal("OpenDir:", err)
+	}
+	if proj.AutoGenFile != filepath.Join(dir, "onlygop", "gop_autogen.go") {
+		t.Fatal("OpenDir without Go files:", proj.AutoGenFile)
+	}
+	if _, err = ctx.OpenDir(0, filepath.Join(dir, "onlygo")); err != syscall.ENOENT {
+		t.Fatal("OpenDir without Go+ files:", err)
+	}
+}
+
+func TestRedeclared(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	dir := t.TempDir()
+	writeGoMod(t, dir, true)
+	ctx := gopmod.New(dir)
+	for _, c := range []struct {
+		gop, gocode, err string
+	}{
+		{"func hello() {}\n", "func hello() {}\n", "hello redeclared in this package"},
+		{"var hello = 1\n", "type hello int\n", "hello redeclared in this package"},
+		{"func (T) Hello() {}\n", "type T int\n\nfunc (T) Hello() {}\n", "T.Hello redeclared in this package"},
+		{"func (*T) Hello() {}\n", "type T int\n\nfunc (T) Hi() {}\n", ""},
+		{"func init() {}\n\nvar _ = 1\n", "func init() {}\n\nvar _ = 2\n", ""},
+	} {
+		gopFile, goFile := filepath.Join(dir, "a.gop"), filepath.Join(dir, "b.go")
+		os.WriteFile(gopFile, []byte(c.gop), 0644)
+		os.WriteFile(goFile, []byte("package main\n\n"+c.gocode), 0644)
+		proj, err := ctx.OpenDir(0, dir)
+		if err != nil {
+			t.Fatal("OpenDir:", err)
+		}
+		err = proj.GenGo(filepath.Join(dir, ".gop", "gop_autogen.gop.go"), filepath.Join(dir, "go.mod"))
+		if c.err == "" {
+			if err != nil {
+				t.Fatalf("GenGo of %q and %q: %v", c.gop, c.gocode, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) ||
+			!strings.Contains(err.Error(), goFile) || !strings.Contains(err.Error(), gopFile) {
+			t.Fatalf("GenGo of %q and %q: %v", c.gop, c.gocode, err)
+		}
+	}
+}
+
+func TestOpenDirClassFiles(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found:", err)
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"gop.mod": "module example.com/foo\n\nclassfile .tgame .tsprite example.com/foo/game\n",
+		"go.mod":  goMod("example.com/foo", "1.16", true),
+		"go.sum":  goSum(),
+		"game/game.go": `package game
+
+import "fmt"
+
+const (
+	GopPackage = true
+	Gop_game   = "*MyGame"
+	Gop_sched  = "Sched,SchedNow"
+)
+
+type MyGame struct {
+}
+
+func Gopt_MyGame_Main(game interface{}) {
+	game.(interface{ MainEntry() }).MainEntry()
+}
+
+func Sched() {
+}
+
+func SchedNow() {
+}
+
+type Sprite struct {
+}
+
+func (p *Sprite) Say(msg string) {
+	fmt.Println(msg)
+}
+`,
+		"index.tgame":      "var (\n\tKai Kai\n)\n\nKai.greet\n",
+		"Kai.tsprite":      "func greet() {\n\tsay \"Hi\"\n}\n",
+		"Kai_test.tsprite": "func testGreet() {\n\tundefined\n}\n",
+	}
+	writeFiles(t, dir, files)
+	ctx := gopmod.New(dir)
+	proj, err := ctx.OpenDir(0, dir)
+	if err != nil {
+		t.Fatal("OpenDir:", err)
+	}
+	if proj.Kind != gopmod.KindCmd || proj.CheckRunnable() != nil {
+		t.Fatal("OpenDir: kind of the project -", proj.Kind)
+	}
+	exe := filepath.Join(t.TempDir(), "foo")
+	if b, err := ctx.BuildProject(exe, proj).CombinedOutput(); err != nil {
+		t.Fatalf("BuildProject: %v\n%s", err, b)
+	}
+	if b, err := exec.Command(exe).Output(); err != nil || string(b) != "Hi\n" {
+		t.Fatalf("run the executable built: %v\n%s", err, b)
+	}
+
+	os.MkdirAll(filepath.Join(dir, "spx"), 0755) // default classfile project type
+	os.WriteFile(filepath.Join(dir, "spx", "index.gmx"), nil, 0644)
+	if proj, err = ctx.OpenDir(0, filepath.Join(dir, "spx")); err != nil || proj.Kind != gopmod.KindCmd {
+		t.Fatal("OpenDir of a spx project:", err)
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.gop", "b.gop", "c.go"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("println \"Hi\"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runCache := filepath.Join(dir, "run")
+	os.MkdirAll(runCache, 0755)
+	os.WriteFile(filepath.Join(runCache, "go.mod"), []byte("module goplus.org/userapp\n"), 0644)
+	ctx := gopmod.NewDefault(dir, &gopmod.Config{RunCacheDir: runCache})
+	cases := []struct {
+		proj gopproj.Proj
+		lock string
+	}{
+		{&gopproj.FilesProj{Files: []string{filepath.Join(dir, "a.gop")}}, "a.gop"},
+		{&gopproj.FilesProj{Files: []string{filepath.Join(dir, "b.gop")}}, "b.gop"},
+		{&gopproj.FilesProj{Files: []string{filepath.Join(dir, "c.go")}}, "c.gop"},
+		{&gopproj.FilesProj{Files: []string{filepath.Join(dir, "b.gop"), filepath.Join(dir, "a.gop")}}, "b.gop"},
+		{&gopproj.DirProj{Dir: dir}, filepath.Base(dir) + ".gop"},
+	}
+	for _, c := range cases {
+		proj, err := ctx.OpenProject(0, c.proj)
+		if err != nil {
+			t.Fatal("OpenProject:", err)
+		}
+		if v := proj.LockFile(); v != filepath.Join(dir, c.lock+".lock") {
+			t.Fatal("LockFile:", v)
+		}
+		if v := proj.LockSumFile(); v != filepath.Join(dir, c.lock+".sum") {
+			t.Fatal("LockSumFile:", v)
+		}
+	}
+	if proj := (&gopmod.Project{}); proj.LockFile() != "" || proj.LockSumFile() != "" {
+		t.Fatal("lock files of a project without source files:", proj.LockFile(), proj.LockSumFile())
+	}
+}
@@ -17,8 +17,12 @@
 package gopmod
 
 import (
+	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 
+	"github.com/goplus/gop/cl"
 	"github.com/goplus/gop/x/gopproj"
 )
 
@@ -28,16 +32,32 @@ const (
 	FlagGoAsGoPlus = 1 << iota
 )
 
+// OpenProject opens the Go+ project src. flags is a combination of the Flag*
+// constants, or 0. Whether the project is a command or a library is detected
+// from its source files, see Project.Kind.
 func (p *Context) OpenProject(flags int, src gopproj.Proj) (proj *Project, err error) {
+	var tags []string
 	switch v := src.(type) {
 	case *gopproj.FilesProj:
-		return p.OpenFiles(flags, v.Files...)
+		proj, err = p.OpenFiles(flags, v.Files...)
+		tags = v.BuildTags
 	case *gopproj.DirProj:
-		return p.OpenDir(flags, v.Dir)
+		proj, err = p.OpenDir(flags, v.Dir)
+		tags = v.BuildTags
 	case *gopproj.PkgPathProj:
-		return p.OpenPkgPath(flags, v.Path)
+		if v.Version != "" {
+			proj, err = p.OpenModule(flags, v.Path, v.Version)
+		} else {
+			proj, err = p.OpenPkgPath(flags, v.Path)
+		}
+		tags = v.BuildTags
+	default:
+		panic("OpenProject: unexpected source")
 	}
-	panic("OpenProject: unexpected source")
+	if err == nil && tags != nil { // or the default ones in gop.mod
+		proj.BuildTags = tags
+	}
+	return
 }
 
 func (p *Context) OpenFiles(flags int, args ...string) (proj *Project, err error) {
@@ -51,8 +71,70 @@ func (p *Context) OpenFiles(flags int, args ...string) (proj *Project, err error
 	return p.openFromGopFiles(args)
 }
 
+// OpenDir opens the Go+ package in directory dir. Go files in dir are
+// compiled together with the Go+ files as a single package, so they can refer
+// to each other. Go+ files include class files (eg. .gmx and .spx files, and
+// those of the classfile project type in gop.mod). Test files, named like
+// *_test.go, *_test.gop or *_test.spx, aren't part of the package.
 func (p *Context) OpenDir(flags int, dir string) (proj *Project, err error) {
-	panic("todo")
+	f, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fis, err := f.ReadDir(-1)
+	if err != nil {
+		return
+	}
+	var files []string
+	var hasGop, hasGo bool
+	for _, fi := range fis {
+		fname := fi.Name()
+		if fi.IsDir() || strings.HasPrefix(fname, "_") || strings.HasPrefix(fname, ".") || isTestFile(fname) {
+			continue
+		}
+		switch filepath.Ext(fname) {
+		case ".gop":
+			hasGop = true
+		case ".go":
+			if strings.HasPrefix(fname, "gop_autogen") {
+				continue
+			}
+			hasGo = true
+		default:
+			if isClass, _, _, _, _ := cl.ClassFileInfo(fname); !isClass {
+				continue
+			}
+			hasGop = true
+		}
+		files = append(files, filepath.Join(dir, fname))
+	}
+	if !hasGop {
+		return nil, syscall.ENOENT
+	}
+	proj, err = p.openFromGopFiles(files)
+	if err != nil {
+		return
+	}
+	proj.Source.(*gopFiles).dir = dir
+	absdir, err := filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	proj.FriendlyFname = filepath.Base(absdir)
+	proj.outName = proj.FriendlyFname
+	if hasGo { // the Go files are compiled into autogen file, so they can't be in the same directory
+		proj.AutoGenFile = filepath.Join(dir, ".gop", "gop_autogen.gop.go")
+	} else {
+		proj.AutoGenFile = filepath.Join(dir, "gop_autogen.go")
+	}
+	return
+}
+
+// isTestFile reports whether fname is a test file, whose name without
+// extension ends with _test.
+func isTestFile(fname string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(fname, filepath.Ext(fname)), "_test")
 }
 
 func (p *Context) OpenPkgPath(flags int, pkgPath string) (proj *Project, err error) {
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+var (
+	ErrImportsNotSupported = errors.New("can't list imports of this kind of project")
+)
+
+// Imports returns import paths of all packages the project src depends on,
+// sorted and deduplicated: the packages imported by the source code, the ones
+// imported automatically by the Go+ compiler (see InjectedImports), and their
+// transitive dependencies, listed by the go command in the context src is
+// built in (see List). Relative import paths (eg. "./foo") are resolved to
+// paths in the module.
+func (p *Context) Imports(src *Project) ([]string, error) {
+	ctx, explicit, generated, err := p.imports(src)
+	if err != nil {
+		return nil, err
+	}
+	for pkgPath := range explicit {
+		generated[pkgPath] = true
+	}
+	if len(generated) == 0 {
+		return []string{}, nil
+	}
+	return ctx.deps(src, sortedPaths(generated))
+}
+
+// InjectedImports returns import paths of the packages imported automatically
+// by the Go+ compiler for the project src (eg. fmt for println, and the Go+
+// builtin packages), which aren't imported by the source code. Unlike Imports,
+// their dependencies aren't included.
+func (p *Context) InjectedImports(src *Project) ([]string, error) {
+	_, explicit, generated, err := p.imports(src)
+	if err != nil {
+		return nil, err
+	}
+	for pkgPath := range explicit {
+		delete(generated, pkgPath)
+	}
+	return sortedPaths(generated), nil
+}
+
+// imports returns the packages imported by the source files of src, and the
+// ones imported by the Go code generated from them, in the context ctx src is
+// built in.
+func (p *Context) imports(src *Project) (ctx *Context, explicit, generated map[string]bool, err error) {
+	var files []string
+	switch s := src.Source.(type) {
+	case *gopFiles:
+		files = s.files
+	case *goFile:
+		files = []string{s.file}
+	default:
+		return nil, nil, nil, ErrImportsNotSupported
+	}
+	ctx = p.ctxOf(src)
+	defer func() {
+		if e := recover(); e != nil { // genGo panics on errors
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	out, _ := ctx.genGo(src)
+
+	resolve := ctx.relImportResolver()
+	explicit = make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if err = importsOf(fset, file, explicit, resolve); err != nil {
+			return
+		}
+	}
+	generated = make(map[string]bool)
+	err = importsOf(fset, out.goFile, generated, resolve)
+	return
+}
+
+func importsOf(fset *token.FileSet, file string, imports map[string]bool, resolve func(dir, pkgPath string) string) error {
+	f, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(file)
+	for _, imp := range f.Imports {
+		pkgPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(pkgPath, "gop/") { // see cl.simplifyGopPackage
+			pkgPath = "github.com/goplus/" + pkgPath
+		}
+		imports[resolve(dir, pkgPath)] = true
+	}
+	return nil
+}
+
+// relImportResolver returns a function to resolve a relative import path
+// in directory dir to the path in the module. Paths which can't be resolved
+// are returned as they are.
+func (p *Context) relImportResolver() func(dir, pkgPath string) string {
+	var modPath, modRoot string
+	if !p.defctx {
+		if data, err := os.ReadFile(p.modfile); err == nil {
+			modPath = modfile.ModulePath(data)
+			modRoot = filepath.Dir(p.modfile)
+		}
+	}
+	return func(dir, pkgPath string) string {
+		if modPath == "" || !(strings.HasPrefix(pkgPath, "./") || strings.HasPrefix(pkgPath, "../")) {
+			return pkgPath
+		}
+		absdir, err := filepath.Abs(dir)
+		if err != nil {
+			return pkgPath
+		}
+		rel, err := filepath.Rel(modRoot, filepath.Join(absdir, pkgPath))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return pkgPath
+		}
+		return path.Join(modPath, filepath.ToSlash(rel))
+	}
+}
+
+func sortedPaths(m map[string]bool) []string {
+	ret := make([]string, 0, len(m))
+	for pkgPath := range m {
+		ret = append(ret, pkgPath)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// Package is the metadata of a Go+ project, like the output of `go list -json`.
+// Its fields are in a stable order, so it can be encoded in JSON for tools
+// (eg. editors) to consume.
+type Package struct {
+	Dir      string   // absolute directory of the source files
+	Name     string   // package name
+	Main     bool     // whether it's a main package with a main function, see KindCmd
+	GopFiles []string `json:",omitempty"` // .gop source files, relative to Dir
+	GoFiles  []string `json:",omitempty"` // .go source files compiled with them, relative to Dir
+	Imports  []string `json:",omitempty"` // import paths of the source files, sorted
+	Deps     []string `json:",omitempty"` // all transitive dependencies, sorted, if listed with deps
+}
+
+// List returns the metadata of the project src. Relative import paths are
+// resolved to paths in the module, as Imports does. If deps is true, it lists
+// the transitive dependencies of the imports too, by the go command in the
+// context src is built in.
+func (p *Context) List(src *Project, deps bool) (pkg *Package, err error) {
+	var files []string
+	switch s := src.Source.(type) {
+	case *gopFiles:
+		files = s.files
+	case *goFile:
+		files = []string{s.file}
+	default:
+		return nil, ErrImportsNotSupported
+	}
+	if src.Kind == KindUnknown {
+		return nil, fmt.Errorf("can't detect the package of %s", strings.Join(files, " "))
+	}
+	dir, err := filepath.Abs(filepath.Dir(files[0]))
+	if err != nil {
+		return
+	}
+	pkg = &Package{Dir: dir, Name: src.pkgName, Main: src.Kind == KindCmd}
+	for _, file := range files {
+		fname := filepath.Base(file)
+		if filepath.Ext(fname) == ".gop" {
+			pkg.GopFiles = append(pkg.GopFiles, fname)
+		} else {
+			pkg.GoFiles = append(pkg.GoFiles, fname)
+		}
+	}
+	sort.Strings(pkg.GopFiles)
+	sort.Strings(pkg.GoFiles)
+
+	ctx := p.ctxOf(src)
+	resolve := ctx.relImportResolver()
+	imports := make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if err = importsOf(fset, file, imports, resolve); err != nil {
+			return nil, err
+		}
+	}
+	pkg.Imports = sortedPaths(imports)
+	if deps && len(pkg.Imports) > 0 {
+		if pkg.Deps, err = ctx.deps(src, pkg.Imports); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// deps returns the packages imports and their transitive dependencies, listed
+// by `go list -deps` in the module of the context.
+func (p *Context) deps(src *Project, imports []string) ([]string, error) {
+	exargs := []string{"list", "-deps", "-f", "{{.ImportPath}}"}
+	exargs = appendBuildTags(exargs, src.BuildTags)
+	if p.modFlag != "" {
+		exargs = append(exargs, "-mod="+p.modFlag)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", append(exargs, imports...)...)
+	cmd.Dir = filepath.Dir(p.modfile)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if env := src.buildEnv(); env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go list failed: %v\n%s", err, stderr.String())
+	}
+	ret := strings.Fields(stdout.String())
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// -----------------------------------------------------------------------------
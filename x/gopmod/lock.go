@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// -----------------------------------------------------------------------------
+
+const (
+	// LockModExt is the extension of the lock file of a project, which is the
+	// go.mod resolved for it by Context.Lock. The lock file is next to the
+	// source files, and named after the project (see Context.OutputName), eg.
+	// hello.gop.lock for hello.gop, so that programs in the same directory
+	// don't share it.
+	LockModExt = ".gop.lock"
+
+	// LockSumExt is the extension of the go.sum of the lock file, next to it.
+	LockSumExt = ".gop.sum"
+
+	lockCacheDir = "lock"
+	gopModPath   = "github.com/goplus/gop"
+)
+
+var (
+	ErrNoSourceDir = errors.New("project without a source directory can't be locked")
+)
+
+// LockFile returns the lock file of the project (see LockModExt), which is
+// next to its source files, or "" if it has no source files (eg. a project of
+// a module).
+func (p *Project) LockFile() string {
+	return p.lockFile(LockModExt)
+}
+
+// LockSumFile returns the go.sum of the lock file of the project (see
+// LockSumExt), or "" if it has no source files.
+func (p *Project) LockSumFile() string {
+	return p.lockFile(LockSumExt)
+}
+
+func (p *Project) lockFile(ext string) string {
+	if p.srcDir == "" {
+		return ""
+	}
+	return filepath.Join(p.srcDir, p.outName+ext)
+}
+
+// Lock resolves the modules required by the project src in the default
+// context (with its go.mod overlay merged, if any) by `go mod tidy`, and
+// writes the resulting go.mod and go.sum to its lock files (see LockFile).
+// They are meant to be committed, so that running src with Project.Locked
+// uses the same versions of all modules, including the transitive ones, with
+// their hashes verified, on any machine.
+//
+// The replacement of the Go+ module by the local GOPROOT isn't locked, as it
+// differs between machines. It's added back when src is run.
+func (p *Context) Lock(src *Project) (err error) {
+	lockFile := src.LockFile()
+	if lockFile == "" {
+		return ErrNoSourceDir
+	}
+	ctx := NewDefault(p.dir, p.config())
+	if src.ModOverlay != "" {
+		ctx = ctx.withModOverlay(src.ModOverlay)
+	}
+	out, _ := ctx.genGo(src)
+
+	base, err := os.ReadFile(ctx.modfile)
+	if err != nil {
+		return
+	}
+	mod, err := mergeModFile(ctx.modfile, base, "", nil) // make local paths absolute
+	if err != nil {
+		return
+	}
+	tmpdir := filepath.Join(p.runCache, lockCacheDir)
+	if err = os.MkdirAll(tmpdir, 0755); err != nil {
+		return
+	}
+	dir, err := os.MkdirTemp(tmpdir, "tmp")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	if err = os.WriteFile(filepath.Join(dir, "go.mod"), mod, 0644); err != nil {
+		return
+	}
+	if gosum := filepath.Join(filepath.Dir(ctx.modfile), "go.sum"); fileExists(gosum) {
+		if err = copyFile(filepath.Join(dir, "go.sum"), gosum); err != nil {
+			return
+		}
+	}
+	if err = copyFile(filepath.Join(dir, "main.go"), out.goFile); err != nil {
+		return
+	}
+	dummy := filepath.Join(dir, "dummy")
+	os.MkdirAll(dummy, 0755)
+	genDummyProject(dummy) // keep the Go+ module required, as the compiler needs it
+	if err = retryDownload("go mod tidy", func() error { return goModTidy(dir) }); err != nil {
+		return
+	}
+
+	if mod, err = lockedModFile(filepath.Join(dir, "go.mod"), src.srcDir); err != nil {
+		return
+	}
+	sum, err := os.ReadFile(filepath.Join(dir, "go.sum"))
+	if err != nil {
+		return
+	}
+	if err = writeFileAtomic(lockFile, mod); err != nil {
+		return
+	}
+	return writeFileAtomic(src.LockSumFile(), sum)
+}
+
+// goModTidy runs `go mod tidy` in dir, and returns an error with the messages
+// of the go command if it fails.
+func goModTidy(dir string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// lockedModFile returns the content of the go.mod file resolved by Lock, to be
+// written to the lock file in srcDir: the replacement of the Go+ module is
+// dropped, and absolute local paths replacing modules are made relative to
+// srcDir.
+func lockedModFile(file, srcDir string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	f, err := modfile.Parse(file, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	absDir, err := filepath.Abs(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range f.Replace {
+		if r.Old.Path == gopModPath {
+			if err = f.DropReplace(r.Old.Path, r.Old.Version); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if r.New.Version != "" || !filepath.IsAbs(filepath.FromSlash(r.New.Path)) {
+			continue
+		}
+		rel, err := filepath.Rel(absDir, filepath.FromSlash(r.New.Path))
+		if err != nil {
+			return nil, err
+		}
+		if rel = filepath.ToSlash(rel); !strings.HasPrefix(rel, "../") {
+			rel = "./" + rel
+		}
+		if err = f.AddReplace(r.Old.Path, r.Old.Version, rel, ""); err != nil {
+			return nil, err
+		}
+	}
+	f.Cleanup()
+	return f.Format()
+}
+
+// withLock returns the default context with the lock files of the project src
+// (see Lock). Its go.mod is the lock file with local paths replacing modules
+// made absolute, and the Go+ module replaced by GOPROOT. It's in the run cache
+// (eg. ~/.gop/run/lock/<hash>/go.mod) with the go.sum of the lock file, and the
+// go command never updates it (even if GOFLAGS=-mod=mod), so building fails if
+// the lock files are stale.
+func (p *Context) withLock(src *Project) *Context {
+	lockFile := src.LockFile()
+	if lockFile == "" {
+		log.Panicln(ErrNoSourceDir)
+	}
+	data, err := os.ReadFile(lockFile)
+	if err != nil {
+		log.Panicln(err)
+	}
+	sum, err := os.ReadFile(src.LockSumFile())
+	if err != nil {
+		log.Panicln(err)
+	}
+	f, err := modfile.Parse(lockFile, data, nil)
+	if err != nil {
+		log.Panicln(err)
+	}
+	for _, r := range f.Replace {
+		if path, ok := absLocalPath(r.New, lockFile); ok {
+			if err = f.AddReplace(r.Old.Path, r.Old.Version, path, ""); err != nil {
+				log.Panicln(err)
+			}
+		}
+	}
+	if err = f.AddReplace(gopModPath, "", filepath.ToSlash(GOPROOT), ""); err != nil {
+		log.Panicln(err)
+	}
+	f.Cleanup()
+	mod, err := f.Format()
+	if err != nil {
+		log.Panicln(err)
+	}
+	hash := sha1.Sum(append(append(mod, 0), sum...))
+	dir := filepath.Join(p.runCache, lockCacheDir, base64.RawURLEncoding.EncodeToString(hash[:]))
+	modfile := filepath.Join(dir, "go.mod")
+	if !fileExists(modfile) {
+		os.MkdirAll(dir, 0755)
+		if err = writeFileAtomic(filepath.Join(dir, "go.sum"), sum); err != nil {
+			log.Panicln(err)
+		}
+		if err = writeFileAtomic(modfile, mod); err != nil {
+			log.Panicln(err)
+		}
+	}
+	return &Context{modfile: modfile, dir: p.dir, runCache: p.runCache, defctx: true, modFlag: "readonly"}
+}
+
+// writeFileAtomic writes data to a temporary file in the directory of file
+// first, and then renames it to file, so that a concurrent reader never sees
+// file partially written, and concurrent writers don't clobber each other.
+func writeFileAtomic(file string, data []byte) (err error) {
+	dir, fname := filepath.Split(file)
+	f, err := os.CreateTemp(dir, fname+".tmp")
+	if err != nil {
+		return
+	}
+	tmpfile := f.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(tmpfile)
+		}
+	}()
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return
+	}
+	if err = os.Chmod(tmpfile, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmpfile, file)
+}
+
+// -----------------------------------------------------------------------------
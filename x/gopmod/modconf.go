@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/goplus/gop/cl"
+	"github.com/goplus/gop/x/mod/modfile"
+)
+
+// -----------------------------------------------------------------------------
+
+// ModConfig is the project-level configuration of Go+ in the gop.mod file at
+// the root of a module.
+type ModConfig struct {
+	GoVersion string             // target Go version of the generated code (eg. "go1.16"), from the go statement
+	BuildTags []string           // build tags used if a project has none, from the tags statement
+	Classfile *modfile.Classfile // classfile project type of the module, from the classfile statement
+	This      string             // receiver name of the class files of Classfile, from the this statement
+	Class     []*modfile.Class   // more work classes of Classfile, from the class statements
+}
+
+// LoadModConfig reads the configuration in the gop.mod file modFile. It
+// returns nil (and no error) if modFile isn't a gop.mod file (eg. a go.mod
+// file), so that the defaults apply.
+func LoadModConfig(modFile string) (*ModConfig, error) {
+	if filepath.Base(modFile) != "gop.mod" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(modFile)
+	if err != nil {
+		return nil, err
+	}
+	f, err := modfile.ParseLax(modFile, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	conf := &ModConfig{Classfile: f.Classfile, Class: f.Class}
+	if f.This != nil {
+		conf.This = f.This.Name
+	}
+	if f.Go != nil {
+		conf.GoVersion = "go" + f.Go.Version
+	}
+	if f.Tags != nil {
+		conf.BuildTags = f.Tags.List
+	}
+	return conf, nil
+}
+
+// registerClassfile registers the classfile project type of the module to cl,
+// unless it's registered already (eg. by another Context of the module).
+func (p *ModConfig) registerClassfile() {
+	c := p.Classfile
+	if c == nil {
+		return
+	}
+	if _, _, _, _, ok := cl.ClassFileInfo("main" + c.ProjExt); ok {
+		return
+	}
+	cl.RegisterClassFileType(c.ProjExt, c.WorkExt, c.PkgPaths...)
+	if p.This != "" {
+		cl.RegisterClassThis(c.ProjExt, p.This)
+	}
+	if p.Class != nil {
+		works := make([]cl.WorkClass, len(p.Class))
+		for i, v := range p.Class {
+			works[i] = cl.WorkClass{Ext: v.Ext, Base: v.Base, This: v.This}
+		}
+		cl.RegisterWorkClasses(c.ProjExt, works...)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// -----------------------------------------------------------------------------
+
+const (
+	modCacheDir = "mod"
+)
+
+// moduleInfo is the output of `go mod download -json`.
+type moduleInfo struct {
+	Path    string
+	Version string
+	Error   string
+	Dir     string
+	GoMod   string
+}
+
+// OpenModule opens the Go+ package pkgPath in the module of version (eg.
+// v1.2.0, or latest), like `go run pkgPath@version` does. The module is
+// downloaded into the module cache by the go command, so GOPROXY, GOPRIVATE,
+// GONOSUMDB, GOSUMDB, etc. are respected, and the checksum database is
+// checked unless disabled by them.
+//
+// As files in the module cache are read only, the module is copied into
+// the run cache (eg. ~/.gop/run/mod) to generate Go files in it. The project is built in the
+// context of the module, with the dependencies it requires.
+func (p *Context) OpenModule(flags int, pkgPath, version string) (proj *Project, err error) {
+	mod, err := downloadModule(pkgPath, version)
+	if err != nil {
+		return
+	}
+	modDir, err := copyModule(p.runCache, mod)
+	if err != nil {
+		return
+	}
+	dir := filepath.Join(modDir, filepath.FromSlash(strings.TrimPrefix(pkgPath, mod.Path)))
+	ctx := New(dir, p.config())
+	proj, err = ctx.OpenDir(flags, dir)
+	if err != nil {
+		return
+	}
+	proj.FriendlyFname = path.Base(pkgPath)
+	proj.ctx = ctx
+	return
+}
+
+// downloadModule downloads the module providing package pkgPath. As the go
+// command does, the longest module path that is a prefix of pkgPath wins.
+// Downloading is retried on network errors, see retryDownload.
+func downloadModule(pkgPath, version string) (mod *moduleInfo, err error) {
+	err = errors.New("no module provides package " + pkgPath + "@" + version)
+	for modPath := pkgPath; modPath != "." && modPath != "/"; modPath = path.Dir(modPath) {
+		mod := modPath + "@" + version
+		var info *moduleInfo
+		retryDownload("go mod download "+mod, func() error {
+			if info = goModDownload(mod); info != nil && info.Error != "" {
+				return errors.New(info.Error)
+			}
+			return nil
+		})
+		if info == nil {
+			continue
+		}
+		if info.Error == "" && info.Dir != "" {
+			return info, nil
+		}
+		if modPath == pkgPath {
+			err = errors.New(info.Error)
+		}
+	}
+	return nil, err
+}
+
+// goModDownload runs `go mod download -json mod`, and returns its output, or
+// nil if the output isn't valid.
+func goModDownload(mod string) *moduleInfo {
+	var stdout bytes.Buffer
+	cmd := exec.Command("go", "mod", "download", "-json", mod)
+	cmd.Dir = os.TempDir() // not in any module, so no go.mod is changed
+	cmd.Stdout = &stdout
+	cmd.Run() // error is reported by the Error field
+	var info moduleInfo
+	if err := json.Unmarshal(stdout.Bytes(), &info); err != nil {
+		return nil
+	}
+	return &info
+}
+
+// copyModule copies the downloaded module mod into the module copies of the
+// run cache runCache, and returns the directory of the copy. A version of a module
+// never changes, so an existing copy is reused.
+func copyModule(runCache string, mod *moduleInfo) (dir string, err error) {
+	escPath, err := module.EscapePath(mod.Path)
+	if err != nil {
+		return
+	}
+	escVer, err := module.EscapeVersion(mod.Version)
+	if err != nil {
+		return
+	}
+	dir = filepath.Join(runCache, modCacheDir, filepath.FromSlash(escPath)+"@"+escVer)
+	if fileExists(dir) {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".tmp")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+	if err = copyDir(tmpDir, mod.Dir); err != nil {
+		return
+	}
+	if goMod := filepath.Join(tmpDir, "go.mod"); !fileExists(goMod) && mod.GoMod != "" {
+		// go.mod synthesized by the go command for a module without it
+		if err = copyFile(goMod, mod.GoMod); err != nil {
+			return
+		}
+	}
+	if err = os.Rename(tmpDir, dir); err != nil && fileExists(dir) { // copied by someone else
+		err = nil
+	}
+	return
+}
+
+func copyDir(dst, src string) error {
+	return filepath.Walk(src, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if fi.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFile(target, file)
+	})
+}
+
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"strconv"
+)
+
+// -----------------------------------------------------------------------------
+
+// ErrCgoImported is the error of a Go file importing "C" when building with
+// CGO_ENABLED=0, see Project.NoCgo.
+var ErrCgoImported = errors.New(`import "C" requires cgo, which is disabled (CGO_ENABLED=0)`)
+
+// CheckNoCgo returns an error wrapping ErrCgoImported if goFile imports "C",
+// so that a build without cgo fails with a clear message, rather than the go
+// command excluding the file silently.
+func CheckNoCgo(goFile string) error {
+	f, err := parser.ParseFile(token.NewFileSet(), goFile, nil, parser.ImportsOnly)
+	if err != nil {
+		return err
+	}
+	for _, spec := range f.Imports {
+		if path, _ := strconv.Unquote(spec.Path.Value); path == "C" {
+			return fmt.Errorf("%s: %w", goFile, ErrCgoImported)
+		}
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
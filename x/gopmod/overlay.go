@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// -----------------------------------------------------------------------------
+
+const (
+	// ModOverlayFile is the name of the file next to the source files of a
+	// project, whose require, replace and exclude directives are merged into
+	// the go.mod of the default context. See Project.ModOverlay.
+	ModOverlayFile = "gop.run.mod"
+
+	overlayCacheDir = "ovl"
+)
+
+// findModOverlay returns the ModOverlayFile in the directory of files if it
+// exists, or "" if not.
+func findModOverlay(files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+	file := filepath.Join(filepath.Dir(files[0]), ModOverlayFile)
+	if fi, err := os.Stat(file); err != nil || fi.IsDir() {
+		return ""
+	}
+	return file
+}
+
+// withModOverlay returns the context of the default context p with the
+// directives of the go.mod overlay file ovl merged into its go.mod. The merged
+// go.mod is in the run cache (eg. ~/.gop/run/ovl/<hash>/go.mod), so that the
+// default go.mod shared by all projects isn't changed.
+func (p *Context) withModOverlay(ovl string) *Context {
+	ovl, err := filepath.Abs(ovl)
+	if err != nil {
+		log.Panicln(err)
+	}
+	base, err := os.ReadFile(p.modfile)
+	if err != nil {
+		log.Panicln(err)
+	}
+	data, err := os.ReadFile(ovl)
+	if err != nil {
+		log.Panicln(err)
+	}
+	merged, err := mergeModFile(p.modfile, base, ovl, data)
+	if err != nil {
+		log.Panicln(err)
+	}
+	return p.withModFile(merged)
+}
+
+// withGoVersion returns the context of the default context p with the go
+// directive of its go.mod set to the Go version ver (eg. go1.18), in the run
+// cache as withModOverlay does. It's p if ver is invalid, which cl reports
+// when generating the Go code.
+func (p *Context) withGoVersion(ver string) *Context {
+	base, err := os.ReadFile(p.modfile)
+	if err != nil {
+		log.Panicln(err)
+	}
+	f, err := modfile.Parse(p.modfile, base, nil)
+	if err != nil {
+		log.Panicln(err)
+	}
+	if f.AddGoStmt(strings.TrimPrefix(ver, "go")) != nil {
+		return p
+	}
+	data, err := f.Format()
+	if err != nil {
+		log.Panicln(err)
+	}
+	return p.withModFile(data)
+}
+
+// withModFile returns the context of the default context p with its go.mod
+// replaced by data, which is in the run cache under a directory named by
+// the hash of data, with go.sum of p copied.
+func (p *Context) withModFile(data []byte) *Context {
+	hash := sha1.Sum(data)
+	dir := filepath.Join(p.runCache, overlayCacheDir, base64.RawURLEncoding.EncodeToString(hash[:]))
+	modfile := filepath.Join(dir, "go.mod")
+	if !fileExists(modfile) {
+		os.MkdirAll(dir, 0755)
+		if gosum := filepath.Join(filepath.Dir(p.modfile), "go.sum"); fileExists(gosum) {
+			if err := copyFile(filepath.Join(dir, "go.sum"), gosum); err != nil {
+				log.Panicln(err)
+			}
+		}
+		if err := writeFileAtomic(modfile, data); err != nil {
+			log.Panicln(err)
+		}
+	}
+	return &Context{modfile: modfile, dir: p.dir, runCache: p.runCache, defctx: true, modFlag: "mod"}
+}
+
+// mergeModFile merges the require, replace and exclude directives of the
+// go.mod overlay file ovl into the go.mod file base. A module required by both
+// is required at the higher version, as the go command selects. Local paths
+// replacing modules are made absolute, as the merged go.mod is in another
+// directory.
+func mergeModFile(baseFile string, base []byte, ovlFile string, ovl []byte) ([]byte, error) {
+	f, err := modfile.Parse(baseFile, base, nil)
+	if err != nil {
+		return nil, err
+	}
+	o, err := modfile.Parse(ovlFile, ovl, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range f.Replace {
+		if path, ok := absLocalPath(r.New, baseFile); ok {
+			if err = f.AddReplace(r.Old.Path, r.Old.Version, path, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	vers := make(map[string]string, len(f.Require))
+	for _, r := range f.Require {
+		vers[r.Mod.Path] = r.Mod.Version
+	}
+	for _, r := range o.Require {
+		if v, ok := vers[r.Mod.Path]; ok && semver.Compare(v, r.Mod.Version) >= 0 {
+			continue
+		}
+		if err = f.AddRequire(r.Mod.Path, r.Mod.Version); err != nil {
+			return nil, err
+		}
+		vers[r.Mod.Path] = r.Mod.Version
+	}
+	for _, r := range o.Replace {
+		newPath := r.New.Path
+		if path, ok := absLocalPath(r.New, ovlFile); ok {
+			newPath = path
+		}
+		if err = f.AddReplace(r.Old.Path, r.Old.Version, newPath, r.New.Version); err != nil {
+			return nil, err
+		}
+	}
+	for _, x := range o.Exclude {
+		if err = f.AddExclude(x.Mod.Path, x.Mod.Version); err != nil {
+			return nil, err
+		}
+	}
+	f.Cleanup()
+	return f.Format()
+}
+
+// absLocalPath returns the absolute path of the local path replacing a module
+// (relative to the directory of file), or false if mod isn't a relative local
+// path.
+func absLocalPath(mod module.Version, file string) (string, bool) {
+	if mod.Version != "" || !modfile.IsDirectoryPath(mod.Path) || filepath.IsAbs(mod.Path) {
+		return "", false
+	}
+	path := filepath.Join(filepath.Dir(file), filepath.FromSlash(mod.Path))
+	return filepath.ToSlash(path), true
+}
+
+// -----------------------------------------------------------------------------
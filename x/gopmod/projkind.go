@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopmod
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// ProjKind tells whether a project is a command or a library.
+type ProjKind int
+
+const (
+	KindUnknown ProjKind = iota // not detected, eg. the source files can't be parsed
+	KindCmd                     // a command: package main with a main function
+	KindLib                     // a library, which can't be run
+)
+
+func (p ProjKind) String() string {
+	switch p {
+	case KindCmd:
+		return "command"
+	case KindLib:
+		return "library"
+	}
+	return "unknown"
+}
+
+// detectKind parses files to detect the kind of the project, and the name of
+// its package. Go+ files without a package clause are in package main, and
+// their global statements are the main function. A main package with a
+// project class file (eg. main.gmx) is a command too, as the main function is
+// generated for it.
+func detectKind(files []string) (kind ProjKind, pkgName string) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseFiles(fset, files, 0)
+	if err != nil || len(pkgs) != 1 {
+		return KindUnknown, ""
+	}
+	for name, pkg := range pkgs {
+		if name == "main" && (hasMainFunc(pkg) || hasProjClassFile(pkg)) {
+			return KindCmd, name
+		}
+		return KindLib, name
+	}
+	return
+}
+
+func hasMainFunc(pkg *ast.Package) bool {
+	for _, f := range pkg.Files {
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "main" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasProjClassFile(pkg *ast.Package) bool {
+	for _, f := range pkg.Files {
+		if f.FileType == ast.FileTypeGmx {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRunnable returns an error if the project is detected to be a library,
+// as running it can only fail.
+func (p *Project) CheckRunnable() error {
+	if p.Kind != KindLib {
+		return nil
+	}
+	msg := "function main is undeclared in the main package"
+	if p.pkgName != "main" {
+		msg = fmt.Sprintf("package %s is a library, not a main package", p.pkgName)
+	}
+	if p.FriendlyFname != "" {
+		msg = p.FriendlyFname + ": " + msg
+	}
+	return errors.New("cannot run " + msg)
+}
+
+// -----------------------------------------------------------------------------
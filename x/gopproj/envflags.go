@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopproj
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+
+// FlagsEnv is the environment variable of the default flags of Go+ commands,
+// like GOFLAGS of the go command, eg. GOPFLAGS='-v -tags=foo,bar'.
+//
+// The flags are put before the flags on the command line, so the latter win
+// if they conflict. A flag with a value should be in the form -flag=value.
+// Flags that a command doesn't know are ignored by it.
+const FlagsEnv = "GOPFLAGS"
+
+// EnvFlags returns the flags in FlagsEnv, split by SplitFlags.
+func EnvFlags() ([]string, error) {
+	flags, err := SplitFlags(os.Getenv(FlagsEnv))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", FlagsEnv, err)
+	}
+	for _, flag := range flags {
+		if !strings.HasPrefix(flag, "-") {
+			return nil, fmt.Errorf("invalid %s: %s isn't a flag", FlagsEnv, flag)
+		}
+	}
+	return flags, nil
+}
+
+// FlagName returns the name of flag arg (eg. tags of -tags=foo, or --tags),
+// or "" if arg isn't a flag.
+func FlagName(arg string) string {
+	if !strings.HasPrefix(arg, "-") {
+		return ""
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+	if pos := strings.IndexByte(name, '='); pos >= 0 {
+		name = name[:pos]
+	}
+	return name
+}
+
+var errUnterminatedQuote = errors.New("unterminated quoted string")
+
+// SplitFlags splits s into words separated by whitespace, with shell-like
+// quoting: a word can be quoted by single quotes (no escapes inside) or
+// double quotes (\" and \\ are escaped inside), and a backslash escapes the
+// next character outside quotes. Eg. `-a -b="x y" 'z\'` is split into -a,
+// -b=x y, and z\.
+func SplitFlags(s string) (words []string, err error) {
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errUnterminatedQuote
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, errUnterminatedQuote
+			}
+		case c == '\\' && i+1 < len(s):
+			i++
+			word.WriteByte(s[i])
+		default:
+			word.WriteByte(c)
+		}
+		inWord = true
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return
+}
+
+// -----------------------------------------------------------------------------
@@ -13,16 +13,23 @@ type Proj = interface {
 	projObj()
 }
 
+// Stdin is the file name of a FilesProj whose source is read from stdin.
+const Stdin = "-"
+
 type FilesProj struct {
-	Files []string
+	Files     []string // or []string{Stdin} if the source is read from stdin
+	BuildTags []string
 }
 
 type PkgPathProj struct {
-	Path string
+	Path      string
+	Version   string // module version of a `path@version` argument, eg. latest
+	BuildTags []string
 }
 
 type DirProj struct {
-	Dir string
+	Dir       string
+	BuildTags []string
 }
 
 func (p *FilesProj) projObj()   {}
@@ -32,21 +39,66 @@ func (p *DirProj) projObj()     {}
 // -----------------------------------------------------------------------------
 
 func ParseOne(args ...string) (proj Proj, next []string, err error) {
+	tags, args, err := parseBuildTags(args)
+	if err != nil {
+		return
+	}
 	if len(args) == 0 {
 		return nil, nil, syscall.ENOENT
 	}
 	arg := args[0]
+	if arg == Stdin {
+		return &FilesProj{Files: args[:1], BuildTags: tags}, args[1:], nil
+	}
 	if isFile(arg) {
 		n := 1
 		for n < len(args) && isFile(args[n]) {
 			n++
 		}
-		return &FilesProj{Files: args[:n]}, args[n:], nil
+		return &FilesProj{Files: args[:n], BuildTags: tags}, args[n:], nil
 	}
 	if strings.HasPrefix(arg, ".") || strings.HasPrefix(arg, "/") {
-		return &DirProj{Dir: arg}, args[1:], nil
+		return &DirProj{Dir: arg, BuildTags: tags}, args[1:], nil
+	}
+	proj = &PkgPathProj{Path: arg, BuildTags: tags}
+	if pos := strings.Index(arg, "@"); pos >= 0 {
+		if pos == 0 || pos == len(arg)-1 {
+			return nil, nil, ErrInvalidPkgPath
+		}
+		proj = &PkgPathProj{Path: arg[:pos], Version: arg[pos+1:], BuildTags: tags}
+	}
+	return proj, args[1:], nil
+}
+
+// parseBuildTags extracts a leading `-tags foo,bar` (or `-tags=foo,bar`)
+// option from args.
+func parseBuildTags(args []string) (tags []string, next []string, err error) {
+	if len(args) == 0 {
+		return nil, args, nil
+	}
+	var val string
+	switch arg := args[0]; {
+	case arg == "-tags" || arg == "--tags":
+		if len(args) < 2 {
+			return nil, nil, ErrEmptyBuildTags
+		}
+		val, next = args[1], args[2:]
+	case strings.HasPrefix(arg, "-tags="):
+		val, next = arg[6:], args[1:]
+	case strings.HasPrefix(arg, "--tags="):
+		val, next = arg[7:], args[1:]
+	default:
+		return nil, args, nil
+	}
+	for _, tag := range strings.Split(val, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return nil, nil, ErrEmptyBuildTags
 	}
-	return &PkgPathProj{Path: arg}, args[1:], nil
+	return
 }
 
 func isFile(fname string) bool {
@@ -59,15 +111,24 @@ func isFile(fname string) bool {
 
 // -----------------------------------------------------------------------------
 
-func ParseAll(args ...string) (projs []Proj, err error) {
+// ParseAll parses args into projects as ParseOne does, until the end of args,
+// a `--` argument, or a flag other than -tags. The arguments left (without the
+// `--`) are returned as next, eg. arguments of the program to run. Files
+// projects can't be mixed with others, as it's ambiguous whether an argument
+// after files is a project or an argument of the program, which should be
+// separated by `--` then.
+func ParseAll(args ...string) (projs []Proj, next []string, err error) {
 	var hasFiles, hasNotFiles bool
-	for {
-		proj, next, e := ParseOne(args...)
+	for len(args) > 0 {
+		if arg := args[0]; arg == "--" {
+			args = args[1:]
+			break
+		} else if arg != Stdin && FlagName(arg) != "" && FlagName(arg) != "tags" {
+			break
+		}
+		proj, rest, e := ParseOne(args...)
 		if e != nil {
-			if hasFiles && hasNotFiles {
-				return nil, ErrMixedFilesProj
-			}
-			return
+			return nil, nil, e
 		}
 		if _, ok := proj.(*FilesProj); ok {
 			hasFiles = true
@@ -75,12 +136,18 @@ func ParseAll(args ...string) (projs []Proj, err error) {
 			hasNotFiles = true
 		}
 		projs = append(projs, proj)
-		args = next
+		args = rest
+	}
+	if hasFiles && hasNotFiles {
+		return nil, nil, ErrMixedFilesProj
 	}
+	return projs, args, nil
 }
 
 var (
 	ErrMixedFilesProj = errors.New("mixed files project")
+	ErrEmptyBuildTags = errors.New("empty value for flag -tags")
+	ErrInvalidPkgPath = errors.New("invalid package path, should be path@version")
 )
 
 // -----------------------------------------------------------------------------
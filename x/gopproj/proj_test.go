@@ -1,6 +1,12 @@
 package gopproj
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
 
 // -----------------------------------------------------------------------------
 
@@ -11,8 +17,58 @@ func TestParseOne(t *testing.T) {
 	}
 }
 
+func TestParseOne_stdin(t *testing.T) {
+	proj, next, err := ParseOne("-tags", "foo", "-", "a.gop", "-x")
+	if err != nil || len(next) != 2 || next[0] != "a.gop" || next[1] != "-x" {
+		t.Fatal("ParseOne failed:", proj, next, err)
+	}
+	if v, ok := proj.(*FilesProj); !ok || len(v.Files) != 1 || v.Files[0] != Stdin || len(v.BuildTags) != 1 {
+		t.Fatal("ParseOne failed:", proj)
+	}
+}
+
+func TestParseOne_tags(t *testing.T) {
+	proj, next, err := ParseOne("-tags", "foo,bar", "a.gop", "abc")
+	if err != nil || len(next) != 1 || next[0] != "abc" {
+		t.Fatal("ParseOne failed:", proj, next, err)
+	}
+	if v, ok := proj.(*FilesProj); !ok || len(v.BuildTags) != 2 || v.BuildTags[1] != "bar" {
+		t.Fatal("ParseOne failed:", proj)
+	}
+	proj, _, err = ParseOne("-tags=foo", "./a")
+	if v, ok := proj.(*DirProj); err != nil || !ok || len(v.BuildTags) != 1 || v.BuildTags[0] != "foo" {
+		t.Fatal("ParseOne failed:", proj, err)
+	}
+}
+
+func TestParseOne_emptyTags(t *testing.T) {
+	for _, args := range [][]string{{"-tags=", "a.gop"}, {"-tags", ",", "a.gop"}, {"-tags"}} {
+		if _, _, err := ParseOne(args...); err != ErrEmptyBuildTags {
+			t.Fatal("ParseOne:", args, err)
+		}
+	}
+	if _, _, err := ParseAll("-tags", "", "a.gop"); err != ErrEmptyBuildTags {
+		t.Fatal("ParseAll:", err)
+	}
+}
+
+func TestParseOne_version(t *testing.T) {
+	proj, next, err := ParseOne("github.com/user/pkg@latest", "abc")
+	if err != nil || len(next) != 1 || next[0] != "abc" {
+		t.Fatal("ParseOne failed:", proj, next, err)
+	}
+	if v, ok := proj.(*PkgPathProj); !ok || v.Path != "github.com/user/pkg" || v.Version != "latest" {
+		t.Fatal("ParseOne failed:", proj)
+	}
+	for _, arg := range []string{"github.com/user/pkg@", "@v1.0.0"} {
+		if _, _, err := ParseOne(arg); err != ErrInvalidPkgPath {
+			t.Fatal("ParseOne:", arg, err)
+		}
+	}
+}
+
 func TestParseAll_wildcard1(t *testing.T) {
-	projs, err := ParseAll("*.go")
+	projs, _, err := ParseAll("*.go")
 	if err != nil || len(projs) != 1 {
 		t.Fatal("ParseAll failed:", projs, err)
 	}
@@ -22,7 +78,7 @@ func TestParseAll_wildcard1(t *testing.T) {
 }
 
 func TestParseAll_wildcard2(t *testing.T) {
-	projs, err := ParseAll("t/*.go")
+	projs, _, err := ParseAll("t/*.go")
 	if err != nil || len(projs) != 1 {
 		t.Fatal("ParseAll failed:", projs, err)
 	}
@@ -32,7 +88,7 @@ func TestParseAll_wildcard2(t *testing.T) {
 }
 
 func TestParseAll_multiFiles(t *testing.T) {
-	projs, err := ParseAll("a.gop", "b.go")
+	projs, _, err := ParseAll("a.gop", "b.go")
 	if err != nil || len(projs) != 1 {
 		t.Fatal("ParseAll failed:", projs, err)
 	}
@@ -43,7 +99,7 @@ func TestParseAll_multiFiles(t *testing.T) {
 }
 
 func TestParseAll_multiProjs(t *testing.T) {
-	projs, err := ParseAll("a/...", "./a/...", "/a")
+	projs, _, err := ParseAll("a/...", "./a/...", "/a")
 	if err != nil || len(projs) != 3 {
 		t.Fatal("ParseAll failed:", projs, err)
 	}
@@ -62,10 +118,114 @@ func TestParseAll_multiProjs(t *testing.T) {
 }
 
 func TestParseAllErr(t *testing.T) {
-	_, err := ParseAll("a/...", "./a/...", "/a", "*.go")
+	_, _, err := ParseAll("a/...", "./a/...", "/a", "*.go")
 	if err != ErrMixedFilesProj {
 		t.Fatal("ParseAll:", err)
 	}
+	if _, _, err = ParseAll("a.gop", "abc"); err != ErrMixedFilesProj {
+		t.Fatal("ParseAll:", err)
+	}
+	if _, _, err = ParseAll("./a", "-tags", "foo"); err != syscall.ENOENT {
+		t.Fatal("ParseAll:", err)
+	}
+}
+
+func TestParseAll_next(t *testing.T) {
+	projs, next, err := ParseAll("a.gop", "b.gop", "--", "abc", "-x")
+	if err != nil || len(projs) != 1 || len(next) != 2 || next[0] != "abc" || next[1] != "-x" {
+		t.Fatal("ParseAll failed:", projs, next, err)
+	}
+	projs, next, err = ParseAll("./a", "-tags=foo", "b", "-x", "abc")
+	if err != nil || len(projs) != 2 || len(next) != 2 || next[0] != "-x" {
+		t.Fatal("ParseAll failed:", projs, next, err)
+	}
+	if proj, ok := projs[1].(*PkgPathProj); !ok || proj.Path != "b" || len(proj.BuildTags) != 1 {
+		t.Fatal("ParseAll failed:", projs[1])
+	}
+	projs, next, err = ParseAll("-", "--")
+	if err != nil || len(projs) != 1 || len(next) != 0 {
+		t.Fatal("ParseAll failed:", projs, next, err)
+	}
+}
+
+func TestSplitFlags(t *testing.T) {
+	cases := []struct {
+		s, words string // words are joined by |
+	}{
+		{"", ""},
+		{"  -v\t-x \n", "-v|-x"},
+		{`-a -b="x y" 'z\'`, `-a|-b=x y|z\`},
+		{`-tags=foo,bar -ldflags="-X \"main.v=1\""`, `-tags=foo,bar|-ldflags=-X "main.v=1"`},
+		{`a\ b c''d ""`, `a b|cd|`},
+	}
+	for _, c := range cases {
+		words, err := SplitFlags(c.s)
+		if err != nil || strings.Join(words, "|") != c.words {
+			t.Fatalf("SplitFlags(%q): %q %v", c.s, words, err)
+		}
+	}
+	for _, s := range []string{`-a="x`, `'x`} {
+		if _, err := SplitFlags(s); err != errUnterminatedQuote {
+			t.Fatalf("SplitFlags(%q): %v", s, err)
+		}
+	}
+}
+
+func TestEnvFlags(t *testing.T) {
+	old, ok := os.LookupEnv(FlagsEnv)
+	defer func() {
+		if ok {
+			os.Setenv(FlagsEnv, old)
+		} else {
+			os.Unsetenv(FlagsEnv)
+		}
+	}()
+	os.Setenv(FlagsEnv, "-v --tags='foo bar'")
+	flags, err := EnvFlags()
+	if err != nil || len(flags) != 2 || FlagName(flags[0]) != "v" || FlagName(flags[1]) != "tags" {
+		t.Fatal("EnvFlags:", flags, err)
+	}
+	os.Setenv(FlagsEnv, "-v foo")
+	if _, err = EnvFlags(); err == nil || err.Error() != "invalid GOPFLAGS: foo isn't a flag" {
+		t.Fatal("EnvFlags:", err)
+	}
+	if name := FlagName("foo"); name != "" {
+		t.Fatal("FlagName:", name)
+	}
+}
+
+func TestReadStdin(t *testing.T) {
+	cases := []struct {
+		pkgName, src, file, expected string
+	}{
+		{"", `println "Hi"`, "main.gop", `println "Hi"`},
+		{"main", "func main() {}", "main.gop", "func main() {}"},
+		{"foo", "func F() {}", "foo.gop", "package foo; func F() {}"},
+		{"foo", "// bar\npackage bar\n", "foo.gop", "// bar\npackage bar\n"},
+	}
+	for _, c := range cases {
+		proj := &FilesProj{Files: []string{Stdin}}
+		if !proj.IsStdin() {
+			t.Fatal("IsStdin: false")
+		}
+		cleanup, err := ReadStdin(proj, strings.NewReader(c.src), c.pkgName)
+		if err != nil {
+			t.Fatal("ReadStdin:", err)
+		}
+		b, err := os.ReadFile(proj.Files[0])
+		cleanup()
+		if err != nil || filepath.Base(proj.Files[0]) != c.file || string(b) != c.expected {
+			t.Fatalf("ReadStdin(%q): %s %q %v", c.pkgName, proj.Files[0], b, err)
+		}
+		if _, err = os.Stat(proj.Files[0]); !os.IsNotExist(err) {
+			t.Fatal("cleanup:", err)
+		}
+	}
+	for _, name := range []string{"1x", "_", "a-b"} {
+		if _, err := ReadStdin(&FilesProj{Files: []string{Stdin}}, strings.NewReader(""), name); err != ErrInvalidPkgName {
+			t.Fatalf("ReadStdin(%q): %v", name, err)
+		}
+	}
 }
 
 // -----------------------------------------------------------------------------
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gopproj
+
+import (
+	"errors"
+	gotoken "go/token"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/goplus/gop/scanner"
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+var (
+	ErrInvalidPkgName = errors.New("invalid package name")
+)
+
+// IsStdin reports whether the source of p is read from stdin.
+func (p *FilesProj) IsStdin() bool {
+	return len(p.Files) == 1 && p.Files[0] == Stdin
+}
+
+// ReadStdin reads the Go+ source of proj (see IsStdin) from stdin into a file
+// of a temporary directory, and makes proj a single-file project of it. The
+// returned cleanup function removes the temporary directory.
+//
+// The source is in package pkgName (main if empty) unless it has a package
+// clause. For a package other than main, `package pkgName;` is added in front
+// of its first line, which keeps the line numbers of the source. The file is
+// named pkgName.gop.
+func ReadStdin(proj *FilesProj, stdin io.Reader, pkgName string) (cleanup func(), err error) {
+	if pkgName == "" {
+		pkgName = "main"
+	} else if !gotoken.IsIdentifier(pkgName) || pkgName == "_" {
+		return nil, ErrInvalidPkgName
+	}
+	src, err := io.ReadAll(stdin)
+	if err != nil {
+		return
+	}
+	if pkgName != "main" && !hasPackageClause(src) { // a main package may be a script without it
+		src = append([]byte("package "+pkgName+"; "), src...)
+	}
+	dir, err := os.MkdirTemp("", "gopstdin")
+	if err != nil {
+		return
+	}
+	file := filepath.Join(dir, pkgName+".gop")
+	if err = os.WriteFile(file, src, 0644); err != nil {
+		os.RemoveAll(dir)
+		return
+	}
+	proj.Files = []string{file}
+	return func() { os.RemoveAll(dir) }, nil
+}
+
+// hasPackageClause reports whether the first token of src (after comments) is
+// the package keyword.
+func hasPackageClause(src []byte) bool {
+	var s scanner.Scanner
+	s.Init(token.NewFileSet().AddFile("", -1, len(src)), src, nil, 0)
+	_, tok, _ := s.Scan()
+	return tok == token.PACKAGE
+}
+
+// -----------------------------------------------------------------------------
@@ -107,6 +107,10 @@ func TidyArgs(dir string, args ...string) {
 	runCmd(dir, "go", append([]string{"mod", "tidy"}, args...)...)
 }
 
+func GetArgs(dir string, args ...string) {
+	runCmd(dir, "go", append([]string{"get"}, args...)...)
+}
+
 func InitArgs(dir string, args ...string) {
 	runCmd(dir, "go", append([]string{"mod", "init"}, args...)...)
 }
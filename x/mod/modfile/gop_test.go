@@ -121,6 +121,55 @@ func TestParse2(t *testing.T) {
 	}
 }
 
+const gopmodClass = `
+module spx
+
+classfile .gmx .spx github.com/goplus/spx math
+this me
+
+class .worker Worker
+class (
+	.rpc RPCHandler self
+)
+`
+
+func TestParseClass(t *testing.T) {
+	f, err := Parse("github.com/goplus/gop/gop.mod", []byte(gopmodClass), nil)
+	if err != nil || len(f.Class) != 2 {
+		t.Fatal("Parse:", f, err)
+	}
+	if f.This == nil || f.This.Name != "me" {
+		t.Fatal("Parse => This:", f.This)
+	}
+	if c := f.Class[0]; c.Ext != ".worker" || c.Base != "Worker" || c.This != "" {
+		t.Fatal("Parse => Class:", c)
+	}
+	if c := f.Class[1]; c.Ext != ".rpc" || c.Base != "RPCHandler" || c.This != "self" {
+		t.Fatal("Parse => Class:", c)
+	}
+}
+
+const gopmodTags = `
+module spx
+
+go 1.16
+
+tags purego netgo,osusergo
+`
+
+func TestParseTags(t *testing.T) {
+	f, err := Parse("github.com/goplus/gop/gop.mod", []byte(gopmodTags), nil)
+	if err != nil || f.Tags == nil {
+		t.Fatal("Parse:", f, err)
+	}
+	if tags := f.Tags.List; len(tags) != 3 || tags[0] != "purego" || tags[1] != "netgo" || tags[2] != "osusergo" {
+		t.Fatal("Parse => Tags:", tags)
+	}
+	if f.Go.Version != "1.16" {
+		t.Fatal("Parse => Go:", f.Go.Version)
+	}
+}
+
 func TestParseErr(t *testing.T) {
 	doTestParseErr(t, `gop.mod:3: repeated go statement`, `
 gop 1.1
@@ -156,6 +205,41 @@ classfile "\?" .spx math
 `)
 	doTestParseErr(t, `gop.mod:2: invalid quoted string: invalid syntax`, `
 classfile .123 .spx "\?"
+`)
+	doTestParseErr(t, `gop.mod:2: usage: class workExt baseType [thisName]`, `
+class .worker
+`)
+	doTestParseErr(t, `gop.mod:2: ext worker invalid: invalid ext format`, `
+class worker Worker
+`)
+	doTestParseErr(t, `gop.mod:2: invalid identifier: 1this`, `
+class .worker Worker 1this
+`)
+	doTestParseErr(t, `gop.mod:2: invalid identifier: _`, `
+class .worker Worker _
+`)
+	doTestParseErr(t, `gop.mod:3: repeated this statement`, `
+this self
+this me
+`)
+	doTestParseErr(t, `gop.mod:2: usage: this thisName`, `
+this
+`)
+	doTestParseErr(t, `gop.mod:2: invalid identifier: 1this`, `
+this 1this
+`)
+	doTestParseErr(t, `gop.mod:3: repeated tags statement`, `
+tags purego
+tags netgo
+`)
+	doTestParseErr(t, `gop.mod:2: usage: tags tag[,tag ...] ...`, `
+tags
+`)
+	doTestParseErr(t, `gop.mod:2: usage: tags tag[,tag ...] ...`, `
+tags ,
+`)
+	doTestParseErr(t, `gop.mod:2: invalid build tag: "a-b"`, `
+tags a-b
 `)
 	doTestParseErr(t, `gop.mod:2: unknown directive: unknown`, `
 unknown .spx
@@ -19,8 +19,10 @@ package modfile
 import (
 	"errors"
 	"fmt"
+	"go/token"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"golang.org/x/mod/modfile"
 	"golang.org/x/mod/module"
@@ -31,7 +33,10 @@ type File struct {
 	modfile.File
 	Gop       *Gop
 	Classfile *Classfile
+	This      *This
+	Class     []*Class
 	Register  []*Register
+	Tags      *Tags
 }
 
 // A Module is the module statement.
@@ -63,12 +68,35 @@ type Classfile struct {
 	Syntax   *Line
 }
 
+// A This is the this statement. It sets the receiver name of the project and
+// work class files declared by the classfile statement, "this" if absent.
+type This struct {
+	Name   string // eg. "self"
+	Syntax *Line
+}
+
+// A Class is the class statement. It declares a kind of work class files
+// (besides the one declared by the classfile statement) of a classfile project.
+type Class struct {
+	Ext    string // ".worker"
+	Base   string // base type of the work class, eg. "Worker"
+	This   string // receiver name of the work class, "this" if empty
+	Syntax *Line
+}
+
 // A Register is the register statement.
 type Register struct {
 	ClassfileMod string // module path of classfile
 	Syntax       *Line
 }
 
+// A Tags is the tags statement. It lists the default build tags of projects
+// in the module, which are used if no build tags are specified.
+type Tags struct {
+	List   []string // eg. ["purego", "netgo"]
+	Syntax *Line
+}
+
 // A VersionInterval represents a range of versions with upper and lower bounds.
 // Intervals are closed: both bounds are included. When Low is equal to High,
 // the interval may refer to a single version ('v1.2.3') or an interval
@@ -200,6 +228,80 @@ func (f *File) parseVerb(errs *ErrorList, verb string, line *Line, args []string
 		f.Classfile = &Classfile{
 			ProjExt: projExt, WorkExt: workExt, PkgPaths: pkgPaths, Syntax: line,
 		}
+	case "this":
+		if f.This != nil {
+			errorf("repeated this statement")
+			return
+		}
+		if len(args) != 1 {
+			errorf("usage: this thisName")
+			return
+		}
+		name, err := parseString(&args[0])
+		if err != nil {
+			errorf("invalid quoted string: %v", err)
+			return
+		}
+		if !token.IsIdentifier(name) || name == "_" {
+			errorf("invalid identifier: %s", name)
+			return
+		}
+		f.This = &This{Name: name, Syntax: line}
+	case "class":
+		if len(args) < 2 || len(args) > 3 {
+			errorf("usage: class workExt baseType [thisName]")
+			return
+		}
+		ext, err := parseExt(&args[0])
+		if err != nil {
+			wrapError(err)
+			return
+		}
+		names, err := parseStrings(args[1:])
+		if err != nil {
+			errorf("invalid quoted string: %v", err)
+			return
+		}
+		for _, name := range names {
+			if !token.IsIdentifier(name) {
+				errorf("invalid identifier: %s", name)
+				return
+			}
+		}
+		class := &Class{Ext: ext, Base: names[0], Syntax: line}
+		if len(names) > 1 {
+			if names[1] == "_" {
+				errorf("invalid identifier: %s", names[1])
+				return
+			}
+			class.This = names[1]
+		}
+		f.Class = append(f.Class, class)
+	case "tags":
+		if f.Tags != nil {
+			errorf("repeated tags statement")
+			return
+		}
+		if len(args) == 0 {
+			errorf("usage: tags tag[,tag ...] ...")
+			return
+		}
+		var list []string
+		for _, tag := range args {
+			if tag == "," { // commas are separate tokens
+				continue
+			}
+			if !isBuildTag(tag) {
+				errorf("invalid build tag: %q", tag)
+				return
+			}
+			list = append(list, tag)
+		}
+		if list == nil {
+			errorf("usage: tags tag[,tag ...] ...")
+			return
+		}
+		f.Tags = &Tags{List: list, Syntax: line}
 	default:
 		if strict {
 			errorf("unknown directive: %s", verb)
@@ -269,6 +371,20 @@ failed:
 	}
 }
 
+// isBuildTag reports whether tag is a valid build tag: a non-empty sequence of
+// letters, digits, underscores and dots, as the go command accepts.
+func isBuildTag(tag string) bool {
+	if tag == "" {
+		return false
+	}
+	for _, c := range tag {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
 type InvalidExtError struct {
 	Ext string
 	Err error
@@ -291,11 +407,14 @@ const (
 	directiveGo
 	directiveGop
 	directiveClassfile
+	directiveThis
+	directiveTags
 )
 
 const (
 	directiveLineBlock = 0x80 + iota
 	directiveRegister
+	directiveClass
 	directiveRequire
 	directiveExclude
 	directiveReplace
@@ -307,7 +426,10 @@ var directiveWeights = map[string]int{
 	"go":        directiveGo,
 	"gop":       directiveGop,
 	"classfile": directiveClassfile,
+	"this":      directiveThis,
+	"tags":      directiveTags,
 	"register":  directiveRegister,
+	"class":     directiveClass,
 	"require":   directiveRequire,
 	"exclude":   directiveExclude,
 	"replace":   directiveReplace,
@@ -0,0 +1,310 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package refactor implements refactorings of Go+ code, based on the type
+// information of the cl package.
+package refactor
+
+import (
+	"fmt"
+	"go/types"
+	"sort"
+
+	"github.com/goplus/gop/ast"
+	"github.com/goplus/gop/cl"
+	"github.com/goplus/gop/token"
+)
+
+// -----------------------------------------------------------------------------
+
+// Edit replaces the text in [Pos, End) with NewText.
+type Edit struct {
+	Pos, End token.Pos
+	NewText  string
+}
+
+// Rename renames the symbol denoted by the identifier at pos in files (of a
+// package) to newName, and returns the edits to apply, sorted by positions.
+// The package is compiled by cl.NewPackage with conf (Fset and Info of conf
+// are ignored) to find the references of the symbol.
+//
+// Rename refuses a rename that may change the meaning of the code, eg. if
+// newName is declared in the same scope (or as a field or method of the same
+// type), or if an identifier newName appears where the symbol is visible, as
+// one of them may shadow the other. It's conservative: some valid renames are
+// refused too. Symbols not declared in files (eg. imported ones, and the
+// receiver and the class of a class file) can't be renamed.
+func Rename(fset *token.FileSet, files map[string]*ast.File, pos token.Pos, newName string, conf *cl.Config) ([]Edit, error) {
+	if !token.IsIdentifier(newName) || newName == "_" {
+		return nil, fmt.Errorf("invalid identifier: %q", newName)
+	}
+	id, file := identAt(fset, files, pos)
+	if id == nil {
+		return nil, fmt.Errorf("no identifier at %v", fset.Position(pos))
+	}
+	if isClass, _, _, this, _ := cl.ClassFileInfo(fset.Position(pos).Filename); isClass && id.Name == this {
+		return nil, fmt.Errorf("cannot rename the receiver %s of a class file", this)
+	}
+	pkg, info, err := compile(fset, files, file, conf)
+	if err != nil {
+		return nil, err
+	}
+	obj := info.ObjectOf(id)
+	if obj == nil {
+		return nil, fmt.Errorf("cannot rename %s: no symbol found", id.Name)
+	}
+	if obj.Name() == newName {
+		return nil, nil
+	}
+	r := &renamer{fset: fset, files: files, pkg: pkg, info: info, obj: obj, newName: newName}
+	if err = r.check(); err != nil {
+		return nil, err
+	}
+	return r.edits(), nil
+}
+
+// identAt returns the identifier at pos in files (keyed by file names), and
+// the file it's in.
+func identAt(fset *token.FileSet, files map[string]*ast.File, pos token.Pos) (ret *ast.Ident, file *ast.File) {
+	tf := fset.File(pos)
+	if tf == nil {
+		return
+	}
+	file = files[tf.Name()]
+	if file == nil {
+		return
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if ret != nil || n == nil || pos < n.Pos() || pos > n.End() {
+			return false
+		}
+		if id, ok := n.(*ast.Ident); ok && pos < id.End() {
+			ret = id
+		}
+		return true
+	})
+	return
+}
+
+func compile(fset *token.FileSet, files map[string]*ast.File, file *ast.File, conf *cl.Config) (*types.Package, *cl.Info, error) {
+	info := &cl.Info{
+		Defs: make(map[*ast.Ident]types.Object),
+		Uses: make(map[*ast.Ident]types.Object),
+	}
+	var c cl.Config
+	if conf != nil {
+		c = *conf
+	}
+	c.Fset, c.Info = fset, info
+	pkg := &ast.Package{Name: file.Name.Name, Files: files}
+	out, err := cl.NewPackage("", pkg, &c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out.Types, info, nil
+}
+
+type renamer struct {
+	fset    *token.FileSet
+	files   map[string]*ast.File
+	pkg     *types.Package
+	info    *cl.Info
+	obj     types.Object
+	newName string
+}
+
+func (p *renamer) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("cannot rename %s to %s: "+format, append([]interface{}{p.obj.Name(), p.newName}, args...)...)
+}
+
+// check reports an error if obj can't be renamed to newName safely.
+func (p *renamer) check() error {
+	obj, newName := p.obj, p.newName
+	if obj.Pkg() != p.pkg {
+		return p.errorf("%s isn't declared in the package", obj.Name())
+	}
+	if _, ok := obj.(*types.PkgName); ok {
+		return p.errorf("renaming an imported package isn't supported")
+	}
+	if !p.declared() {
+		return p.errorf("%s isn't declared in the source files", obj.Name())
+	}
+	if obj.Parent() == p.pkg.Scope() {
+		if name := obj.Name(); name == "main" || name == "init" {
+			if _, ok := obj.(*types.Func); ok {
+				return p.errorf("func %s is special", name)
+			}
+		}
+	}
+	if scope := obj.Parent(); scope != nil && scope.Lookup(newName) != nil {
+		return p.errorf("%s is already declared in the same scope", newName)
+	}
+	if err := p.checkMember(); err != nil {
+		return err
+	}
+	if tn, ok := obj.(*types.TypeName); ok {
+		for id, def := range p.info.Defs {
+			if v, ok := def.(*types.Var); ok && v.Embedded() && id.Name == tn.Name() {
+				return p.errorf("%s is embedded in a struct", tn.Name())
+			}
+		}
+	}
+	// An identifier newName where obj is visible may be shadowed by obj, or
+	// shadow obj after the rename.
+	for _, id := range p.region() {
+		if id.Name == newName {
+			return p.errorf("%s is used at %v", newName, p.fset.Position(id.Pos()))
+		}
+	}
+	return nil
+}
+
+// checkMember checks if obj, a field or a method, conflicts with the fields
+// and methods of its type.
+func (p *renamer) checkMember() error {
+	var recv types.Type
+	switch o := p.obj.(type) {
+	case *types.Var:
+		if !o.IsField() {
+			return nil
+		}
+		recv = p.structOf(o)
+	case *types.Func:
+		if sig, ok := o.Type().(*types.Signature); ok && sig.Recv() != nil {
+			recv = sig.Recv().Type()
+		}
+	}
+	if recv == nil {
+		return nil
+	}
+	if obj, _, _ := types.LookupFieldOrMethod(recv, true, p.pkg, p.newName); obj != nil {
+		return p.errorf("%s is a field or method of %v already", p.newName, recv)
+	}
+	return nil
+}
+
+// structOf returns the pointer to the named type whose struct has the field
+// fld, or nil if not found.
+func (p *renamer) structOf(fld *types.Var) types.Type {
+	scope := p.pkg.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		if t, ok := tn.Type().Underlying().(*types.Struct); ok {
+			for i, n := 0, t.NumFields(); i < n; i++ {
+				if t.Field(i) == fld {
+					return types.NewPointer(tn.Type())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// declared reports whether obj is declared by an identifier in the files.
+func (p *renamer) declared() bool {
+	for _, def := range p.info.Defs {
+		if def == p.obj {
+			return true
+		}
+	}
+	return false
+}
+
+// region returns the identifiers in the region where obj is visible: the
+// function declaring obj if it's local, or all the files of the package.
+func (p *renamer) region() (idents []*ast.Ident) {
+	var nodes []ast.Node
+	if fn := p.enclosingFunc(); fn != nil {
+		nodes = append(nodes, fn)
+	} else {
+		for _, f := range p.files {
+			nodes = append(nodes, f)
+		}
+	}
+	for _, node := range nodes {
+		ast.Inspect(node, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				idents = append(idents, id)
+			}
+			return true
+		})
+	}
+	return
+}
+
+// enclosingFunc returns the outermost function declaring obj if it's a local
+// object, or nil.
+func (p *renamer) enclosingFunc() ast.Node {
+	switch o := p.obj.(type) {
+	case *types.Var:
+		if o.IsField() {
+			return nil
+		}
+	case *types.Func:
+		return nil
+	}
+	parent := p.obj.Parent()
+	if parent == nil || parent == p.pkg.Scope() || parent == types.Universe {
+		return nil
+	}
+	pos := p.defPos()
+	for _, f := range p.files {
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Pos() <= pos && pos < fn.End() {
+				return fn
+			}
+		}
+	}
+	return nil
+}
+
+func (p *renamer) defPos() token.Pos {
+	for id, def := range p.info.Defs {
+		if def == p.obj {
+			return id.Pos()
+		}
+	}
+	return token.NoPos
+}
+
+// edits returns edits renaming all identifiers denoting obj.
+func (p *renamer) edits() []Edit {
+	var edits []Edit
+	add := func(m map[*ast.Ident]types.Object) {
+		for id, o := range m {
+			if o == p.obj {
+				edits = append(edits, Edit{Pos: id.Pos(), End: id.End(), NewText: p.newName})
+			}
+		}
+	}
+	add(p.info.Defs)
+	add(p.info.Uses)
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].Pos < edits[j].Pos
+	})
+	ret := edits[:0]
+	for i, e := range edits {
+		if i == 0 || e.Pos != edits[i-1].Pos {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,225 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package refactor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goplus/gop/cl"
+	"github.com/goplus/gop/parser"
+	"github.com/goplus/gop/parser/parsertest"
+	"github.com/goplus/gop/token"
+)
+
+var baseConf = (&cl.Config{ModRootDir: "../..", CacheLoadPkgs: true, NoFileLine: true}).Ensure()
+
+func init() {
+	cl.RegisterClassFile(".trect", "github.com/goplus/gop/cl/internal/spx", "Worker", "")
+}
+
+// testRename renames the symbol at the position marked by `@` in src to
+// newName, and checks the result is expected, or the error contains errMsg.
+func testRename(t *testing.T, name, src, newName, expected, errMsg string) {
+	t.Run(name, func(t *testing.T) {
+		fname := "bar.gop"
+		if strings.HasPrefix(src, "// class\n") {
+			fname = "Rect.trect"
+		}
+		offset := strings.Index(src, "@")
+		src = src[:offset] + src[offset+1:]
+		fset := token.NewFileSet()
+		fs := parsertest.NewSingleFileFS("/foo", fname, src)
+		pkgs, err := parser.ParseFSDir(fset, fs, "/foo", nil, 0)
+		if err != nil {
+			t.Fatal("ParseFSDir:", err)
+		}
+		pkg := pkgs["main"]
+		var pos token.Pos
+		fset.Iterate(func(f *token.File) bool {
+			pos = f.Pos(offset)
+			return false
+		})
+		edits, err := Rename(fset, pkg.Files, pos, newName, baseConf)
+		if errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), errMsg) {
+				t.Fatal("Rename: expected error", errMsg, "- got", err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal("Rename:", err)
+		}
+		var b strings.Builder
+		last := 0
+		for _, e := range edits {
+			start, end := fset.Position(e.Pos).Offset, fset.Position(e.End).Offset
+			b.WriteString(src[last:start])
+			b.WriteString(e.NewText)
+			last = end
+		}
+		b.WriteString(src[last:])
+		if ret := b.String(); ret != expected {
+			t.Fatalf("Rename:\n%s\nExpected:\n%s", ret, expected)
+		}
+	})
+}
+
+func TestRename(t *testing.T) {
+	testRename(t, "func", `func @add(a, b int) int {
+	return a + b
+}
+
+println add(1, 2), add(3, 4)
+`, "sum", `func sum(a, b int) int {
+	return a + b
+}
+
+println sum(1, 2), sum(3, 4)
+`, "")
+	testRename(t, "local", `func foo(n int) int {
+	x := n * 2
+	return x + @x
+}
+`, "y", `func foo(n int) int {
+	y := n * 2
+	return y + y
+}
+`, "")
+	testRename(t, "field", `type Point struct {
+	X, Y int
+}
+
+func (p *Point) Move(dx int) {
+	p.@X += dx
+}
+
+p := &Point{X: 1, Y: 2}
+p.Move(1)
+println p.X
+`, "Left", `type Point struct {
+	Left, Y int
+}
+
+func (p *Point) Move(dx int) {
+	p.Left += dx
+}
+
+p := &Point{Left: 1, Y: 2}
+p.Move(1)
+println p.Left
+`, "")
+	testRename(t, "class field", `// class
+var (
+	Width, Height int
+)
+
+func @Area() int {
+	return Width * Height
+}
+
+func Scale(n int) {
+	this.Width *= n
+	Height *= n
+	println Area(), this.Area()
+}
+`, "Size", `// class
+var (
+	Width, Height int
+)
+
+func Size() int {
+	return Width * Height
+}
+
+func Scale(n int) {
+	this.Width *= n
+	Height *= n
+	println Size(), this.Size()
+}
+`, "")
+	testRename(t, "class method", `// class
+var (
+	@Width, Height int
+)
+
+func Scale(n int) {
+	this.Width *= n
+	Width += 1
+}
+`, "W", `// class
+var (
+	W, Height int
+)
+
+func Scale(n int) {
+	this.W *= n
+	W += 1
+}
+`, "")
+}
+
+func TestRenameRefused(t *testing.T) {
+	testRename(t, "invalid", `x := 1
+println @x
+`, "func", "", "invalid identifier")
+	testRename(t, "same scope", `func @foo() {}
+func bar() {}
+`, "bar", "", "bar is already declared in the same scope")
+	testRename(t, "shadowed", `func foo(n int) int {
+	@x := n * 2
+	for i := 0; i < n; i++ {
+		y := i
+		x += y
+	}
+	return x
+}
+`, "y", "", "y is used at")
+	testRename(t, "shadowing", `var count = 1
+
+func foo() int {
+	@n := 2
+	return n + count
+}
+`, "count", "", "count is used at")
+	testRename(t, "member", `type Point struct {
+	@X, Y int
+}
+`, "Y", "", "Y is a field or method of *Point already")
+	testRename(t, "import", `import "strings"
+
+func @upper(s string) string {
+	return strings.ToUpper(s)
+}
+`, "strings", "", "strings is used at /foo/bar.gop:4:9")
+	testRename(t, "builtin", `println @len("Hi")
+`, "size", "", "isn't declared in the package")
+	testRename(t, "main", `func @main() {}
+`, "run", "", "func main is special")
+	testRename(t, "this", `// class
+var (
+	Width int
+)
+
+func Scale(n int) {
+	@this.Width *= n
+}
+`, "self", "", "cannot rename the receiver this")
+	testRename(t, "no ident", `x := 1
+println x @+ 1
+`, "y", "", "no identifier at")
+}